@@ -0,0 +1,126 @@
+// Package auth authenticates the users of the todo API by their API tokens.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrInvalidUser  = errors.New("invalid user")
+)
+
+// User is an account of the todo API. Its Id is the owner of the user's todos
+// in the store, ids start at 1 as 0 is the anonymous owner used without
+// authentication.
+type User struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	// TokenHash is the hex encoded SHA-256 hash of the user's API token, the
+	// token itself is never stored.
+	TokenHash string `json:"token_sha256"`
+}
+
+// Users authenticates a fixed set of users.
+type Users struct {
+	byHash map[string]User
+}
+
+// NewUsers checks that every user has a positive id and a well formed token
+// hash, and that neither is shared with another user.
+func NewUsers(users []User) (*Users, error) {
+	ids := make(map[int]bool, len(users))
+	byHash := make(map[string]User, len(users))
+
+	for _, user := range users {
+		if user.Id <= 0 {
+			return nil, fmt.Errorf("%w: id of '%s' must be positive", ErrInvalidUser, user.Name)
+		}
+
+		if ids[user.Id] {
+			return nil, fmt.Errorf("%w: duplicate id %d", ErrInvalidUser, user.Id)
+		}
+		ids[user.Id] = true
+
+		hash, err := hex.DecodeString(user.TokenHash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%w: token hash of user %d is not a hex encoded SHA-256 hash", ErrInvalidUser, user.Id)
+		}
+
+		if _, ok := byHash[string(hash)]; ok {
+			return nil, fmt.Errorf("%w: token of user %d is shared with another user", ErrInvalidUser, user.Id)
+		}
+		byHash[string(hash)] = user
+	}
+
+	return &Users{byHash: byHash}, nil
+}
+
+// LoadUsers reads the users from a JSON file holding a list of User.
+func LoadUsers(path string) (*Users, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read users: %w", err)
+	}
+
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("decode users: %w", err)
+	}
+
+	return NewUsers(users)
+}
+
+// Authenticate returns the user owning token. Only the hash of the token is
+// looked up, so the lookup does not leak how much of a token matched.
+func (u *Users) Authenticate(token string) (User, error) {
+	if token == "" {
+		return User{}, ErrInvalidToken
+	}
+
+	sum := sha256.Sum256([]byte(token))
+
+	user, ok := u.byHash[string(sum[:])]
+	if !ok {
+		return User{}, ErrInvalidToken
+	}
+
+	return user, nil
+}
+
+// Ids returns the ids of the users in ascending order.
+func (u *Users) Ids() []int {
+	ids := make([]int, 0, len(u.byHash))
+	for _, user := range u.byHash {
+		ids = append(ids, user.Id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+// HashToken returns the value to put into User.TokenHash for token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateToken returns a new random API token.
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
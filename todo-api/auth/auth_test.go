@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsers_Authenticate(t *testing.T) {
+	users, err := NewUsers([]User{
+		{Id: 1, Name: "alice", TokenHash: HashToken("alice-token")},
+		{Id: 2, Name: "bob", TokenHash: HashToken("bob-token")},
+	})
+	if err != nil {
+		t.Fatalf("NewUsers() failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantUser int
+		wantErr  error
+	}{
+		{name: "first user", token: "alice-token", wantUser: 1},
+		{name: "second user", token: "bob-token", wantUser: 2},
+		{name: "unknown token", token: "mallory-token", wantErr: ErrInvalidToken},
+		{name: "empty token", token: "", wantErr: ErrInvalidToken},
+		{name: "hash instead of token", token: HashToken("alice-token"), wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := users.Authenticate(tt.token)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantUser, user.Id)
+		})
+	}
+}
+
+func TestUsers_Ids(t *testing.T) {
+	users, err := NewUsers([]User{
+		{Id: 7, Name: "carol", TokenHash: HashToken("carol-token")},
+		{Id: 2, Name: "bob", TokenHash: HashToken("bob-token")},
+	})
+	if err != nil {
+		t.Fatalf("NewUsers() failed: %v", err)
+	}
+
+	assert.Equal(t, []int{2, 7}, users.Ids())
+}
+
+func TestNewUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		users   []User
+		wantErr bool
+	}{
+		{
+			name:  "no users",
+			users: nil,
+		},
+		{
+			name:    "anonymous id",
+			users:   []User{{Id: 0, Name: "alice", TokenHash: HashToken("a")}},
+			wantErr: true,
+		},
+		{
+			name: "duplicate id",
+			users: []User{
+				{Id: 1, Name: "alice", TokenHash: HashToken("a")},
+				{Id: 1, Name: "bob", TokenHash: HashToken("b")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "shared token",
+			users: []User{
+				{Id: 1, Name: "alice", TokenHash: HashToken("a")},
+				{Id: 2, Name: "bob", TokenHash: HashToken("a")},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "plain token instead of hash",
+			users:   []User{{Id: 1, Name: "alice", TokenHash: "alice-token"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewUsers(tt.users)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrInvalidUser), "got error %v, want %v", err, ErrInvalidUser)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestLoadUsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	data := `[{"id":1,"name":"alice","token_sha256":"` + HashToken("alice-token") + `"}]`
+
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("writing users failed: %v", err)
+	}
+
+	users, err := LoadUsers(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	user, err := users.Authenticate("alice-token")
+	assert.NoError(t, err)
+	assert.Equal(t, User{Id: 1, Name: "alice", TokenHash: HashToken("alice-token")}, user)
+}
+
+func TestGenerateToken(t *testing.T) {
+	first, err := GenerateToken()
+	assert.NoError(t, err)
+
+	second, err := GenerateToken()
+	assert.NoError(t, err)
+
+	assert.Len(t, first, 43)
+	assert.NotEqual(t, first, second)
+}
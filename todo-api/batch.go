@@ -0,0 +1,94 @@
+package todoapp
+
+import (
+	"context"
+	"todoapp/model"
+)
+
+// BatchTodos applies ops as one atomic write, see store.Store.Batch, and
+// returns the todo written by each of them. Completing todos follows the
+// rules of UpdateTodo, blockers completed by earlier operations of the batch
+// count as completed.
+func (t *TodoApp) BatchTodos(ctx context.Context, owner int, ops []model.Operation) ([]*model.Todo, error) {
+	if err := model.CheckBatch(ops); err != nil {
+		return nil, err
+	}
+
+	// The todos of ops are not changed, they belong to the caller.
+	ops = append([]model.Operation(nil), ops...)
+
+	prevs := make([]*model.Todo, len(ops))
+	nexts := make([]*model.Todo, len(ops))
+	completing := make([]bool, len(ops))
+	done := make(map[int]bool)
+
+	for idx, op := range ops {
+		if op.Op != model.OpCreate {
+			current, err := t.backend.GetById(ctx, owner, op.Id)
+			if err != nil {
+				return nil, &model.OperationError{Index: idx, Err: backendError("get todo", err)}
+			}
+
+			prevs[idx] = current
+		}
+
+		if op.Op == model.OpDelete {
+			continue
+		}
+
+		completing[idx] = op.Todo.Completed && (prevs[idx] == nil || !prevs[idx].Completed)
+		if completing[idx] {
+			if err := t.checkPendingBlockers(ctx, owner, op.Todo, done); err != nil {
+				return nil, &model.OperationError{Index: idx, Err: err}
+			}
+
+			if op.Op == model.OpUpdate {
+				done[op.Id] = true
+				ops[idx].Todo, nexts[idx] = takeRecurrence(op.Todo)
+			}
+		}
+	}
+
+	results, err := t.backend.Batch(ctx, owner, ops)
+	if err != nil {
+		return nil, backendError("apply batch", err)
+	}
+
+	for idx, op := range ops {
+		switch op.Op {
+		case model.OpCreate:
+			t.record(ctx, owner, &model.Revision{Action: model.ActionCreated}, nil, results[idx])
+		case model.OpUpdate:
+			t.record(ctx, owner, &model.Revision{Action: model.ActionUpdated}, prevs[idx], results[idx])
+		case model.OpDelete:
+			t.record(ctx, owner, &model.Revision{Action: model.ActionDeleted}, prevs[idx], nil)
+		}
+	}
+
+	for idx, result := range results {
+		if !completing[idx] {
+			continue
+		}
+
+		if ops[idx].Op == model.OpUpdate {
+			t.scheduleNext(ctx, owner, result.Id, nexts[idx])
+		}
+		t.completeParents(ctx, owner, result)
+	}
+
+	return results, nil
+}
+
+// checkPendingBlockers is checkBlockers leaving out the blockers in done.
+func (t *TodoApp) checkPendingBlockers(ctx context.Context, owner int, todo *model.Todo, done map[int]bool) error {
+	pending := *todo
+	pending.BlockedBy = nil
+
+	for _, blockerId := range todo.BlockedBy {
+		if !done[blockerId] {
+			pending.BlockedBy = append(pending.BlockedBy, blockerId)
+		}
+	}
+
+	return t.checkBlockers(ctx, owner, &pending)
+}
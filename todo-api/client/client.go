@@ -0,0 +1,251 @@
+// Package client talks to the /v0 API of a todoapp server. A Client
+// implements todoapp.TodoService, so code written against the service works
+// the same with a remote server:
+//
+//	c := client.New("http://localhost:8000", client.WithToken(token))
+//	todos, err := c.GetTodos(ctx, store.Anonymous)
+//
+// The server decides whose todos a request reads from the token it is sent,
+// the owner passed to every method only selects that token, see
+// WithTokenSource. Errors of the server are returned as *Error, which matches
+// the sentinels of the service with errors.Is, e.g. store.ErrTodoNotFound.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	applicationJSON = "application/json"
+	mergePatchJSON  = "application/merge-patch+json"
+	jsonPatchJSON   = "application/json-patch+json"
+
+	defaultTimeout = 30 * time.Second
+	// defaultRetries and defaultBackoff retry an idempotent request twice,
+	// after waiting 100ms and 200ms.
+	defaultRetries = 2
+	defaultBackoff = 100 * time.Millisecond
+)
+
+// Client sends the calls of todoapp.TodoService to a server. It is safe for
+// concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	token   func(owner int) string
+
+	retries int
+	backoff time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with hc instead of a client with a 30
+// second timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithToken sends token as bearer token with every request, whatever the
+// owner.
+func WithToken(token string) Option {
+	return WithTokenSource(func(int) string { return token })
+}
+
+// WithTokenSource sends the token returned for the owner of a call, e.g. to
+// act for several users of a server. No token is sent for the empty string.
+func WithTokenSource(token func(owner int) string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries retries an idempotent request up to max times when the server
+// cannot be reached or answers 502, 503 or 504. The first retry waits
+// backoff, every further one twice as long as the one before, unless the
+// server asks for a different delay with Retry-After. Zero max disables
+// retries.
+func WithRetries(max int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = max
+		c.backoff = backoff
+	}
+}
+
+// New returns a Client for the server at baseURL, e.g.
+// "http://localhost:8000".
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    &http.Client{Timeout: defaultTimeout},
+		token:   func(int) string { return "" },
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// request describes a call of the API. Body is sent as JSON of contentType,
+// or as is if it is an io.Reader, which is never retried.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	header      http.Header
+	contentType string
+	body        interface{}
+}
+
+// do sends req for owner and returns the response to a successful request,
+// the caller closes its body. An error status is returned as *Error.
+func (c *Client) do(ctx context.Context, owner int, req request) (*http.Response, error) {
+	target := c.baseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	stream, streaming := req.body.(io.Reader)
+
+	var data []byte
+	if req.body != nil && !streaming {
+		var err error
+		if data, err = json.Marshal(req.body); err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+	}
+
+	retries := c.retries
+	if streaming || !idempotent(req.method) {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		switch {
+		case streaming:
+			body = stream
+		case data != nil:
+			body = bytes.NewReader(data)
+		}
+
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, target, body)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+
+		for key, values := range req.header {
+			httpReq.Header[key] = values
+		}
+		httpReq.Header.Set("Accept", applicationJSON)
+		if body != nil {
+			httpReq.Header.Set("Content-Type", req.contentType)
+		}
+		if token := c.token(owner); token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := c.http.Do(httpReq)
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			return resp, nil
+		}
+
+		if attempt >= retries || !retryable(resp, err) || ctx.Err() != nil {
+			if err != nil {
+				return nil, err
+			}
+
+			defer resp.Body.Close()
+			return nil, decodeError(resp)
+		}
+
+		delay := c.backoff << attempt
+		if resp != nil {
+			if after, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && after >= 0 {
+				delay = time.Duration(after) * time.Second
+			}
+
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := c.wait(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// call sends req for owner and decodes the response into out unless it is
+// nil. It returns the headers of the response.
+func (c *Client) call(ctx context.Context, owner int, req request, out interface{}) (http.Header, error) {
+	resp, err := c.do(ctx, owner, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+	}
+
+	return resp.Header, nil
+}
+
+// wait sleeps for delay unless ctx ends first.
+func (c *Client) wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// idempotent reports whether sending a request with method twice has the same
+// effect as sending it once. POST and PATCH are never retried.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryable reports whether a failed request may succeed when sent again:
+// the server could not be reached or a proxy or the server itself is
+// temporarily unavailable.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,461 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"todoapp"
+	"todoapp/client"
+	"todoapp/cmd/server"
+	"todoapp/model"
+	"todoapp/store"
+	"todoapp/transfer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T) *client.Client {
+	ts := httptest.NewServer(server.New(todoapp.New(store.NewInMemoryStore())))
+	t.Cleanup(ts.Close)
+
+	return client.New(ts.URL)
+}
+
+// titles returns the titles of todos for comparing them without timestamps.
+func titles(todos []*model.Todo) []string {
+	result := make([]string, len(todos))
+	for idx, todo := range todos {
+		result[idx] = todo.Title
+	}
+
+	return result
+}
+
+func assertIs(t *testing.T, err, want error) {
+	t.Helper()
+	assert.True(t, errors.Is(err, want), "got error %v, want %v", err, want)
+}
+
+func TestClient_Todos(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t)
+	owner := store.Anonymous
+
+	for _, title := range []string{"Water plants", "Buy milk", "Call mum"} {
+		if err := c.SaveTodo(ctx, owner, &model.Todo{Title: title}); err != nil {
+			t.Fatalf("SaveTodo() failed: %v", err)
+		}
+	}
+
+	todo, err := c.GetTodo(ctx, owner, 2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Buy milk", todo.Title)
+		assert.Equal(t, 1, todo.Version)
+	}
+
+	_, err = c.GetTodo(ctx, owner, 9)
+	assertIs(t, err, store.ErrTodoNotFound)
+
+	todos, total, err := c.QueryTodos(ctx, owner, model.Query{Sort: []model.SortKey{{Field: model.SortFieldTitle}}, Limit: 2})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"Buy milk", "Call mum"}, titles(todos))
+		assert.Equal(t, 3, total)
+	}
+
+	_, err = c.UpdateTodo(ctx, owner, 2, &model.Todo{Title: ""})
+	assertIs(t, err, model.ErrInvalidTodo)
+
+	var apiErr *client.Error
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+		assert.Equal(t, []model.FieldError{{Field: "title", Rule: model.RuleRequired, Reason: "must not be empty"}}, apiErr.InvalidParams)
+	}
+
+	todo, err = c.UpdateTodo(ctx, owner, 2, &model.Todo{Title: "Buy oat milk", Version: 1})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, todo.Version)
+	}
+
+	_, err = c.UpdateTodo(ctx, owner, 2, &model.Todo{Title: "Buy soy milk", Version: 1})
+	assertIs(t, err, store.ErrVersionConflict)
+
+	todo, err = c.PatchTodo(ctx, owner, 2, 2, model.MergePatch(`{"priority":1}`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, todo.Priority)
+	}
+
+	_, err = c.PatchTodo(ctx, owner, 2, 2, model.MergePatch(`{"priority":2}`))
+	assertIs(t, err, store.ErrVersionConflict)
+
+	todo, err = c.PatchTodo(ctx, owner, 3, 0, model.JSONPatch(`[{"op":"add","path":"/parent_id","value":2}]`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, todo.ParentId)
+	}
+
+	_, err = c.PatchTodo(ctx, owner, 3, 0, model.JSONPatch(`[{"op":"test","path":"/title","value":"Call dad"}]`))
+	assertIs(t, err, model.ErrPatchTestFailed)
+
+	tree, err := c.GetTodoTree(ctx, owner, 2)
+	if assert.NoError(t, err) && assert.Len(t, tree.Children, 1) {
+		assert.Equal(t, "Call mum", tree.Children[0].Title)
+	}
+
+	assertIs(t, c.DeleteTodo(ctx, owner, 2), store.ErrTodoReferenced)
+	assert.NoError(t, c.DeleteTodo(ctx, owner, 1))
+
+	trash, err := c.GetTrash(ctx, owner)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"Water plants"}, titles(trash))
+	}
+
+	todo, err = c.RestoreTodo(ctx, owner, 1)
+	if assert.NoError(t, err) {
+		assert.Nil(t, todo.DeletedAt)
+	}
+
+	history, err := c.GetHistory(ctx, owner, 2)
+	if assert.NoError(t, err) && assert.Len(t, history, 3) {
+		assert.Equal(t, model.ActionCreated, history[0].Action)
+	}
+
+	todo, err = c.RevertTodo(ctx, owner, 2, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Buy milk", todo.Title)
+		assert.Equal(t, 0, todo.Priority)
+	}
+
+	_, err = c.RevertTodo(ctx, owner, 2, 9)
+	assertIs(t, err, store.ErrRevisionNotFound)
+}
+
+func TestClient_Blockers(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t)
+	owner := store.Anonymous
+
+	blocker := &model.Todo{Title: "Buy paint"}
+	if err := c.SaveTodo(ctx, owner, blocker); err != nil {
+		t.Fatalf("SaveTodo() failed: %v", err)
+	}
+
+	blocked := &model.Todo{Title: "Paint fence", BlockedBy: []int{blocker.Id}}
+	if err := c.SaveTodo(ctx, owner, blocked); err != nil {
+		t.Fatalf("SaveTodo() failed: %v", err)
+	}
+
+	blockers, err := c.GetBlockers(ctx, owner, blocked.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"Buy paint"}, titles(blockers))
+	}
+
+	_, err = c.PatchTodo(ctx, owner, blocked.Id, 0, model.MergePatch(`{"completed":true}`))
+	assertIs(t, err, todoapp.ErrBlocked)
+}
+
+func TestClient_Batch(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t)
+	owner := store.Anonymous
+
+	todos, err := c.BatchTodos(ctx, owner, []model.Operation{
+		{Op: model.OpCreate, Todo: &model.Todo{Title: "Plant tulips"}},
+		{Op: model.OpCreate, Todo: &model.Todo{Title: "Mow lawn"}},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"Plant tulips", "Mow lawn"}, titles(todos))
+	}
+
+	todos, err = c.BatchTodos(ctx, owner, []model.Operation{
+		{Op: model.OpUpdate, Id: 1, Todo: &model.Todo{Title: "Plant roses"}},
+		{Op: model.OpDelete, Id: 2},
+	})
+	if assert.NoError(t, err) && assert.Len(t, todos, 2) {
+		assert.Equal(t, "Plant roses", todos[0].Title)
+		assert.Equal(t, &model.Todo{Id: 2}, todos[1])
+	}
+
+	tests := []struct {
+		name      string
+		ops       []model.Operation
+		wantIndex int
+		wantErr   error
+	}{
+		{
+			name:      "Missing todo",
+			ops:       []model.Operation{{Op: model.OpUpdate, Id: 1, Todo: &model.Todo{Title: "Plant lilies"}}, {Op: model.OpDelete, Id: 7}},
+			wantIndex: 1,
+			wantErr:   store.ErrTodoNotFound,
+		},
+		{
+			name:      "Invalid todo",
+			ops:       []model.Operation{{Op: model.OpDelete, Id: 1}, {Op: model.OpDelete, Id: 1}, {Op: model.OpCreate, Todo: &model.Todo{}}},
+			wantIndex: 2,
+			wantErr:   model.ErrInvalidTodo,
+		},
+		{
+			name:      "Unknown op",
+			ops:       []model.Operation{{Op: "upsert", Id: 1}},
+			wantIndex: 0,
+			wantErr:   model.ErrInvalidBatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.BatchTodos(ctx, owner, tt.ops)
+
+			var operr *model.OperationError
+			if assert.True(t, errors.As(err, &operr), "got error %v, want *model.OperationError", err) {
+				assert.Equal(t, tt.wantIndex, operr.Index)
+			}
+			assertIs(t, err, tt.wantErr)
+		})
+	}
+
+	// Nothing of the failed batches has been applied.
+	todo, err := c.GetTodo(ctx, owner, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Plant roses", todo.Title)
+	}
+}
+
+func TestClient_Lists(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t)
+	owner := store.Anonymous
+
+	list := &model.List{Name: "Garden"}
+	if err := c.SaveList(ctx, owner, list); err != nil {
+		t.Fatalf("SaveList() failed: %v", err)
+	}
+	assert.Equal(t, 1, list.Id)
+
+	assertIs(t, c.SaveList(ctx, owner, &model.List{}), model.ErrInvalidList)
+
+	updated, err := c.UpdateList(ctx, owner, list.Id, &model.List{Name: "Backyard"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Backyard", updated.Name)
+	}
+
+	got, err := c.GetList(ctx, owner, list.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Backyard", got.Name)
+	}
+
+	lists, err := c.GetLists(ctx, owner)
+	if assert.NoError(t, err) {
+		assert.Len(t, lists, 1)
+	}
+
+	if err := c.SaveTodo(ctx, owner, &model.Todo{Title: "Mow lawn", ListId: list.Id}); err != nil {
+		t.Fatalf("SaveTodo() failed: %v", err)
+	}
+
+	assertIs(t, c.DeleteList(ctx, owner, list.Id, ""), store.ErrListNotEmpty)
+	assertIs(t, c.DeleteList(ctx, owner, list.Id, "everything"), model.ErrInvalidCascade)
+	assert.NoError(t, c.DeleteList(ctx, owner, list.Id, model.CascadeDetach))
+
+	_, err = c.GetList(ctx, owner, list.Id)
+	assertIs(t, err, store.ErrListNotFound)
+
+	todo, err := c.GetTodo(ctx, owner, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, todo.ListId)
+	}
+}
+
+// itemWriter collects the items written to it.
+type itemWriter struct {
+	items  []*transfer.Item
+	closed bool
+}
+
+func (iw *itemWriter) Write(item *transfer.Item) error {
+	iw.items = append(iw.items, item)
+	return nil
+}
+
+func (iw *itemWriter) Close() error {
+	iw.closed = true
+	return nil
+}
+
+func TestClient_ImportExport(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t)
+	owner := store.Anonymous
+
+	file := "id,title,priority,list\n" +
+		"1,Buy milk,,Groceries\n" +
+		"2,Broken,twelve,\n" +
+		"3,,,\n" +
+		"4,Call mum,1,\n"
+
+	newReader := func() transfer.Reader {
+		r, err := transfer.NewReader(transfer.FormatCSV, strings.NewReader(file))
+		if err != nil {
+			t.Fatalf("NewReader() failed: %v", err)
+		}
+		return r
+	}
+
+	report, err := c.ImportTodos(ctx, owner, newReader(), true)
+	if assert.NoError(t, err) {
+		assert.True(t, report.DryRun)
+		assert.Equal(t, 2, report.Imported)
+	}
+
+	todos, err := c.GetTodos(ctx, owner)
+	if assert.NoError(t, err) {
+		assert.Empty(t, todos)
+	}
+
+	report, err = c.ImportTodos(ctx, owner, newReader(), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, []string{"Groceries"}, report.Lists)
+
+	rows := make([]int, len(report.Errors))
+	for idx, rowErr := range report.Errors {
+		rows[idx] = rowErr.Row
+	}
+	assert.Equal(t, []int{3, 4}, rows)
+
+	out := &itemWriter{}
+	if assert.NoError(t, c.ExportTodos(ctx, owner, out)) {
+		assert.True(t, out.closed)
+		if assert.Len(t, out.items, 2) {
+			assert.Equal(t, "Buy milk", out.items[0].Title)
+			assert.Equal(t, "Groceries", out.items[0].List)
+			assert.Equal(t, 1, out.items[1].Priority)
+		}
+	}
+}
+
+func TestClient_Token(t *testing.T) {
+	ctx := context.Background()
+
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	tokens := map[int]string{1: "alice-token"}
+	c := client.New(ts.URL, client.WithTokenSource(func(owner int) string { return tokens[owner] }))
+
+	for _, owner := range []int{1, 2} {
+		_, err := c.GetTodos(ctx, owner)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"Bearer alice-token", ""}, got)
+}
+
+func TestClient_Retries(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		call         func(c *client.Client) error
+		wantErr      error
+		wantRequests int32
+	}{
+		{
+			name:         "Recovers",
+			failures:     2,
+			status:       http.StatusServiceUnavailable,
+			call:         func(c *client.Client) error { _, err := c.GetTodos(ctx, store.Anonymous); return err },
+			wantRequests: 3,
+		},
+		{
+			name:         "GivesUp",
+			failures:     5,
+			status:       http.StatusServiceUnavailable,
+			call:         func(c *client.Client) error { _, err := c.GetTodos(ctx, store.Anonymous); return err },
+			wantErr:      store.ErrUnavailable,
+			wantRequests: 3,
+		},
+		{
+			name:         "NotOnClientErrors",
+			failures:     5,
+			status:       http.StatusNotFound,
+			call:         func(c *client.Client) error { return c.DeleteTodo(ctx, store.Anonymous, 1) },
+			wantErr:      store.ErrTodoNotFound,
+			wantRequests: 1,
+		},
+		{
+			name:         "NotOnPost",
+			failures:     5,
+			status:       http.StatusServiceUnavailable,
+			call:         func(c *client.Client) error { return c.SaveTodo(ctx, store.Anonymous, &model.Todo{Title: "Mow lawn"}) },
+			wantErr:      store.ErrUnavailable,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tt.failures {
+					msg := store.ErrUnavailable.Error()
+					if tt.status == http.StatusNotFound {
+						msg = store.ErrTodoNotFound.Error()
+					}
+
+					w.WriteHeader(tt.status)
+					w.Write([]byte(`{"error":"failed: ` + msg + `"}`))
+					return
+				}
+
+				w.Write([]byte("[]"))
+			}))
+			defer ts.Close()
+
+			c := client.New(ts.URL, client.WithRetries(2, time.Millisecond))
+
+			err := tt.call(c)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assertIs(t, err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantRequests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestClient_Context(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	c := client.New(ts.URL, client.WithRetries(10, time.Hour))
+
+	start := time.Now()
+	_, err := c.GetTodos(ctx, store.Anonymous)
+	assertIs(t, err, context.DeadlineExceeded)
+	assert.True(t, time.Since(start) < time.Second, "retries outlived the context")
+}
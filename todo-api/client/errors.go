@@ -0,0 +1,135 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"todoapp"
+	"todoapp/cmd/server"
+	"todoapp/model"
+	"todoapp/store"
+	"todoapp/transfer"
+)
+
+// Error is a request the server answered with an error status. Message is
+// the error it sent, InvalidParams the fields that failed validation.
+type Error struct {
+	StatusCode    int
+	Message       string
+	InvalidParams []model.FieldError
+
+	// sentinels are the errors of the service the server reported.
+	sentinels []error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the sentinel errors the server reported, so that errors.Is
+// tells the errors of a remote service apart like those of a local one.
+func (e *Error) Unwrap() []error {
+	return e.sentinels
+}
+
+// sentinels are the errors the server reports with each status. The server
+// only sends their messages, so an error matches the sentinels of its status
+// whose message it contains.
+var sentinels = map[int][]error{
+	http.StatusNotFound: {
+		store.ErrTodoNotFound,
+		store.ErrListNotFound,
+		store.ErrRevisionNotFound,
+	},
+	http.StatusConflict: {
+		store.ErrVersionConflict,
+		store.ErrListNotEmpty,
+		store.ErrTodoReferenced,
+		todoapp.ErrBlocked,
+		model.ErrPatchTestFailed,
+	},
+	// A conflict is a failed precondition when the request sent If-Match.
+	http.StatusPreconditionFailed: {
+		store.ErrVersionConflict,
+	},
+	http.StatusUnprocessableEntity: {
+		model.ErrInvalidTodo,
+		model.ErrInvalidList,
+		model.ErrNilTodo,
+		model.ErrNilList,
+	},
+	http.StatusBadRequest: {
+		model.ErrInvalidPatch,
+		model.ErrInvalidBatch,
+		model.ErrInvalidSort,
+		model.ErrInvalidCascade,
+		transfer.ErrMalformed,
+	},
+	http.StatusServiceUnavailable: {
+		store.ErrUnavailable,
+	},
+}
+
+// operationPattern finds the index of the failed operation of a batch in the
+// name of an invalid field, "operations[2].todo.title", or else in the
+// message, "failed applying batch: operation 2: todo not found".
+var operationPattern = regexp.MustCompile(`^operations\[(\d+)\]\.|: operation (\d+): `)
+
+// decodeError turns an error response into an *Error, understanding both the
+// {"error": ...} bodies and the problem details of validation errors.
+func decodeError(resp *http.Response) *Error {
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+
+	data, err := io.ReadAll(resp.Body)
+	if err == nil && len(data) > 0 {
+		var (
+			problem server.ProblemResponse
+			fail    server.FailResponse
+		)
+
+		switch {
+		case json.Unmarshal(data, &problem) == nil && problem.Detail != "":
+			apiErr.Message = problem.Detail
+			apiErr.InvalidParams = problem.InvalidParams
+		case json.Unmarshal(data, &fail) == nil && fail.Error != "":
+			apiErr.Message = fail.Error
+		default:
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+	}
+
+	for _, sentinel := range sentinels[apiErr.StatusCode] {
+		if strings.Contains(apiErr.Message, sentinel.Error()) {
+			apiErr.sentinels = append(apiErr.sentinels, sentinel)
+		}
+	}
+
+	return apiErr
+}
+
+// operationError wraps the error of a failed batch into the
+// *model.OperationError the service returns, if the server named the failed
+// operation.
+func operationError(err error) error {
+	apiErr, ok := err.(*Error)
+	if !ok {
+		return err
+	}
+
+	text := apiErr.Message
+	if len(apiErr.InvalidParams) > 0 {
+		text = apiErr.InvalidParams[0].Field
+	}
+
+	match := operationPattern.FindStringSubmatch(text)
+	if match == nil {
+		return err
+	}
+
+	index, _ := strconv.Atoi(match[1] + match[2])
+
+	return &model.OperationError{Index: index, Err: apiErr}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"todoapp/model"
+)
+
+func listPath(id int) string {
+	return "/v0/lists/" + strconv.Itoa(id)
+}
+
+func (c *Client) GetList(ctx context.Context, owner int, id int) (*model.List, error) {
+	var list model.List
+	if _, err := c.call(ctx, owner, request{method: http.MethodGet, path: listPath(id)}, &list); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+func (c *Client) GetLists(ctx context.Context, owner int) ([]*model.List, error) {
+	var lists []*model.List
+	if _, err := c.call(ctx, owner, request{method: http.MethodGet, path: "/v0/lists"}, &lists); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// SaveList adds list and updates it with the id and timestamps the server
+// assigned.
+func (c *Client) SaveList(ctx context.Context, owner int, list *model.List) error {
+	if list == nil {
+		return model.ErrNilList
+	}
+
+	_, err := c.call(ctx, owner, request{method: http.MethodPost, path: "/v0/lists", contentType: applicationJSON, body: list}, list)
+
+	return err
+}
+
+func (c *Client) UpdateList(ctx context.Context, owner int, id int, list *model.List) (*model.List, error) {
+	if list == nil {
+		return nil, model.ErrNilList
+	}
+
+	var updated model.List
+	if _, err := c.call(ctx, owner, request{method: http.MethodPut, path: listPath(id), contentType: applicationJSON, body: list}, &updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// DeleteList deletes the list with the given id, cascade decides what
+// happens to its todos.
+func (c *Client) DeleteList(ctx context.Context, owner int, id int, cascade model.Cascade) error {
+	req := request{method: http.MethodDelete, path: listPath(id)}
+	if cascade != "" {
+		req.query = url.Values{"cascade": {string(cascade)}}
+	}
+
+	_, err := c.call(ctx, owner, req, nil)
+
+	return err
+}
@@ -0,0 +1,363 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"todoapp"
+	"todoapp/cmd/server"
+	"todoapp/model"
+	"todoapp/transfer"
+)
+
+var _ todoapp.TodoService = (*Client)(nil)
+
+func todoPath(id int) string {
+	return "/v0/todos/" + strconv.Itoa(id)
+}
+
+func (c *Client) GetTodo(ctx context.Context, owner int, id int) (*model.Todo, error) {
+	var todo model.Todo
+	if _, err := c.call(ctx, owner, request{method: http.MethodGet, path: todoPath(id)}, &todo); err != nil {
+		return nil, err
+	}
+
+	return &todo, nil
+}
+
+func (c *Client) GetTodos(ctx context.Context, owner int) ([]*model.Todo, error) {
+	var todos []*model.Todo
+	if _, err := c.call(ctx, owner, request{method: http.MethodGet, path: "/v0/todos"}, &todos); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// QueryTodos returns the page of todos selected by q along with the total
+// number of todos matching its filters.
+func (c *Client) QueryTodos(ctx context.Context, owner int, q model.Query) ([]*model.Todo, int, error) {
+	var todos []*model.Todo
+	header, err := c.call(ctx, owner, request{method: http.MethodGet, path: "/v0/todos", query: queryValues(q)}, &todos)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := strconv.Atoi(header.Get("X-Total-Count"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("decode total count: %w", err)
+	}
+
+	return todos, total, nil
+}
+
+// queryValues encodes q as the query string parsed by the server.
+func queryValues(q model.Query) url.Values {
+	values := url.Values{}
+
+	if q.Completed != nil {
+		values.Set("completed", strconv.FormatBool(*q.Completed))
+	}
+	if q.ListId != nil {
+		values.Set("list_id", strconv.Itoa(*q.ListId))
+	}
+	if q.ParentId != nil {
+		values.Set("parent_id", strconv.Itoa(*q.ParentId))
+	}
+	if q.Search != "" {
+		values.Set("q", q.Search)
+	}
+	if len(q.Sort) > 0 {
+		keys := make([]string, len(q.Sort))
+		for idx, key := range q.Sort {
+			keys[idx] = key.String()
+		}
+		values.Set("sort", strings.Join(keys, ","))
+	}
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		values.Set("offset", strconv.Itoa(q.Offset))
+	}
+
+	return values
+}
+
+// SaveTodo adds todo and updates it with the id, version and timestamps the
+// server assigned.
+func (c *Client) SaveTodo(ctx context.Context, owner int, todo *model.Todo) error {
+	if todo == nil {
+		return model.ErrNilTodo
+	}
+
+	_, err := c.call(ctx, owner, request{method: http.MethodPost, path: "/v0/todos", contentType: applicationJSON, body: todo}, todo)
+
+	return err
+}
+
+// UpdateTodo replaces the todo with the given id, a non-zero version of todo
+// makes the update fail with store.ErrVersionConflict if the todo changed
+// meanwhile.
+func (c *Client) UpdateTodo(ctx context.Context, owner int, id int, todo *model.Todo) (*model.Todo, error) {
+	if todo == nil {
+		return nil, model.ErrNilTodo
+	}
+
+	var updated model.Todo
+	if _, err := c.call(ctx, owner, request{method: http.MethodPut, path: todoPath(id), contentType: applicationJSON, body: todo}, &updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// PatchTodo applies a model.MergePatch or model.JSONPatch to the todo with
+// the given id, a non-zero version is sent as If-Match.
+func (c *Client) PatchTodo(ctx context.Context, owner int, id int, version int, patch model.Patch) (*model.Todo, error) {
+	req := request{method: http.MethodPatch, path: todoPath(id), header: http.Header{}}
+
+	switch patch := patch.(type) {
+	case model.MergePatch:
+		req.contentType, req.body = mergePatchJSON, strings.NewReader(string(patch))
+	case model.JSONPatch:
+		req.contentType, req.body = jsonPatchJSON, strings.NewReader(string(patch))
+	default:
+		return nil, fmt.Errorf("%w: %T cannot be sent to the server", model.ErrInvalidPatch, patch)
+	}
+
+	if version != 0 {
+		req.header.Set("If-Match", fmt.Sprintf("\"%d\"", version))
+	}
+
+	var todo model.Todo
+	if _, err := c.call(ctx, owner, req, &todo); err != nil {
+		return nil, err
+	}
+
+	return &todo, nil
+}
+
+// DeleteTodo moves the todo with the given id to the trash.
+func (c *Client) DeleteTodo(ctx context.Context, owner int, id int) error {
+	_, err := c.call(ctx, owner, request{method: http.MethodDelete, path: todoPath(id)}, nil)
+
+	return err
+}
+
+func (c *Client) GetTodoTree(ctx context.Context, owner int, id int) (*model.Tree, error) {
+	var tree model.Tree
+	if _, err := c.call(ctx, owner, request{method: http.MethodGet, path: todoPath(id) + "/tree"}, &tree); err != nil {
+		return nil, err
+	}
+
+	return &tree, nil
+}
+
+func (c *Client) GetBlockers(ctx context.Context, owner int, id int) ([]*model.Todo, error) {
+	var todos []*model.Todo
+	if _, err := c.call(ctx, owner, request{method: http.MethodGet, path: todoPath(id) + "/blockers"}, &todos); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+func (c *Client) GetTrash(ctx context.Context, owner int) ([]*model.Todo, error) {
+	var todos []*model.Todo
+	if _, err := c.call(ctx, owner, request{method: http.MethodGet, path: "/v0/trash"}, &todos); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+func (c *Client) RestoreTodo(ctx context.Context, owner int, id int) (*model.Todo, error) {
+	var todo model.Todo
+	if _, err := c.call(ctx, owner, request{method: http.MethodPost, path: todoPath(id) + "/restore"}, &todo); err != nil {
+		return nil, err
+	}
+
+	return &todo, nil
+}
+
+func (c *Client) GetHistory(ctx context.Context, owner int, id int) ([]*model.Revision, error) {
+	var revisions []*model.Revision
+	if _, err := c.call(ctx, owner, request{method: http.MethodGet, path: todoPath(id) + "/history"}, &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (c *Client) RevertTodo(ctx context.Context, owner int, id int, number int) (*model.Todo, error) {
+	var todo model.Todo
+	path := fmt.Sprintf("%s/history/%d/revert", todoPath(id), number)
+	if _, err := c.call(ctx, owner, request{method: http.MethodPost, path: path}, &todo); err != nil {
+		return nil, err
+	}
+
+	return &todo, nil
+}
+
+// BatchTodos applies ops all together or not at all. The todo returned for a
+// delete only carries its id. A failed operation is reported as
+// *model.OperationError wrapping the *Error of the server.
+func (c *Client) BatchTodos(ctx context.Context, owner int, ops []model.Operation) ([]*model.Todo, error) {
+	var resp server.BatchResponse
+	req := request{method: http.MethodPost, path: "/v0/todos:batch", contentType: applicationJSON, body: server.BatchRequest{Operations: ops}}
+	if _, err := c.call(ctx, owner, req, &resp); err != nil {
+		return nil, operationError(err)
+	}
+
+	todos := make([]*model.Todo, len(resp.Results))
+	for idx, result := range resp.Results {
+		todos[idx] = result.Todo
+		if todos[idx] == nil {
+			todos[idx] = &model.Todo{Id: result.Id}
+		}
+	}
+
+	return todos, nil
+}
+
+// ExportTodos writes all todos of owner to w and closes it.
+func (c *Client) ExportTodos(ctx context.Context, owner int, w transfer.Writer) error {
+	resp, err := c.do(ctx, owner, request{method: http.MethodGet, path: "/v0/export", query: url.Values{"format": {string(transfer.FormatJSON)}}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	in, err := transfer.NewReader(transfer.FormatJSON, resp.Body)
+	if err != nil {
+		return err
+	}
+
+	for {
+		item, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read export: %w", err)
+		}
+
+		if err := w.Write(item); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// ImportTodos streams the items of r to the server. Items r cannot read are
+// reported along with the items the server rejected, by their row in r.
+func (c *Client) ImportTodos(ctx context.Context, owner int, r transfer.Reader, dryRun bool) (*transfer.Report, error) {
+	body, out := io.Pipe()
+
+	// rows maps the items sent onto their rows in r, the server numbers
+	// them from one in the order they are sent.
+	var (
+		rows    []int
+		skipped []*transfer.RowError
+		done    = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+		out.CloseWithError(c.sendItems(r, out, &rows, &skipped))
+	}()
+
+	var report importReport
+	req := request{
+		method:      http.MethodPost,
+		path:        "/v0/import",
+		query:       url.Values{"format": {string(transfer.FormatJSON)}, "dry_run": {strconv.FormatBool(dryRun)}},
+		contentType: transfer.FormatJSON.ContentType(),
+		body:        body,
+	}
+	_, err := c.call(ctx, owner, req, &report)
+
+	// Stop the items being sent if the server did not read them all.
+	body.Close()
+	<-done
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &transfer.Report{
+		DryRun:   report.DryRun,
+		Imported: report.Imported,
+		Failed:   report.Failed + len(skipped),
+		Lists:    report.Lists,
+		Errors:   skipped,
+	}
+
+	for _, rowErr := range report.Errors {
+		row := rowErr.Row
+		if row >= 1 && row <= len(rows) {
+			row = rows[row-1]
+		}
+
+		result.Errors = append(result.Errors, &transfer.RowError{Row: row, Err: errors.New(rowErr.Error)})
+	}
+
+	sort.SliceStable(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Row < result.Errors[j].Row
+	})
+
+	return result, nil
+}
+
+// sendItems writes the items of r to w as JSON, recording the row of every
+// item sent and the items r cannot read.
+func (c *Client) sendItems(r transfer.Reader, w io.Writer, rows *[]int, skipped *[]*transfer.RowError) error {
+	out, err := transfer.NewWriter(transfer.FormatJSON, w)
+	if err != nil {
+		return err
+	}
+
+	for {
+		item, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		var rowErr *transfer.RowError
+		if errors.As(err, &rowErr) {
+			*skipped = append(*skipped, rowErr)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := out.Write(item); err != nil {
+			return err
+		}
+		*rows = append(*rows, item.Row)
+	}
+
+	return out.Close()
+}
+
+// importReport is a transfer.Report as sent by the server, with the errors
+// of the rows as text.
+type importReport struct {
+	DryRun   bool     `json:"dry_run"`
+	Imported int      `json:"imported"`
+	Failed   int      `json:"failed"`
+	Lists    []string `json:"created_lists"`
+	Errors   []struct {
+		Row   int    `json:"row"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
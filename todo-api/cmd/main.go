@@ -1,30 +1,158 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"time"
 	"todoapp"
+	"todoapp/auth"
 	"todoapp/cmd/server"
+	"todoapp/events"
+	"todoapp/search"
 	"todoapp/store"
+	"todoapp/webhook"
 
 	"github.com/gorilla/handlers"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
-	service := todoapp.New(store.NewInMemoryStore())
+	backendKind := flag.String("store", envOr("TODOAPP_STORE", "memory"), "storage backend: memory, file or sqlite (env TODOAPP_STORE)")
+	dataDir := flag.String("data", envOr("TODOAPP_DATA", "data"), "directory used by the file backend (env TODOAPP_DATA)")
+	dsn := flag.String("dsn", envOr("TODOAPP_DSN", "todoapp.db"), "data source name used by the sqlite backend (env TODOAPP_DSN)")
+	usersFile := flag.String("users", envOr("TODOAPP_USERS", ""), "JSON file listing the users and their token hashes, authentication is disabled if empty (env TODOAPP_USERS)")
+	webhooksFile := flag.String("webhooks", envOr("TODOAPP_WEBHOOKS", ""), "file keeping the webhooks and their delivery queue, kept in memory if empty (env TODOAPP_WEBHOOKS)")
+	webhooksPrivate := flag.Bool("webhooks-allow-private", envOr("TODOAPP_WEBHOOKS_ALLOW_PRIVATE", "") == "true", "let webhooks reach loopback, private and link-local addresses, only for trusted users (env TODOAPP_WEBHOOKS_ALLOW_PRIVATE)")
+	retention := flag.Duration("trash-retention", 30*24*time.Hour, "how long deleted todos are kept in the trash before they are purged, zero keeps them forever")
+	replaySize := flag.Int("event-replay", 1000, "number of recent events kept for clients resuming the event stream")
+	newToken := flag.Bool("new-token", false, "print a new API token and its hash for the users file, then exit")
+	flag.Parse()
 
-	headers := handlers.AllowedHeaders([]string{"X-Requested-With"})
+	if *newToken {
+		token, err := auth.GenerateToken()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("token:        %s\ntoken_sha256: %s\n", token, auth.HashToken(token))
+		return
+	}
+
+	var options []server.Option
+	owners := []int{store.Anonymous}
+	if *usersFile != "" {
+		users, err := auth.LoadUsers(*usersFile)
+		if err != nil {
+			log.Fatalf("loading users: %v", err)
+		}
+
+		options = append(options, server.WithAuthenticator(users))
+		owners = users.Ids()
+	} else {
+		log.Printf("no users configured, authentication is disabled and all requests share one todo list")
+	}
+
+	backend, err := openStore(*backendKind, *dataDir, *dsn)
+	if err != nil {
+		log.Fatalf("opening %s store: %v", *backendKind, err)
+	}
+
+	if *retention > 0 {
+		go store.RunPurger(context.Background(), backend, *retention, purgeInterval(*retention))
+	}
+
+	broker := events.NewBroker(*replaySize)
+	options = append(options, server.WithEvents(broker))
+
+	hooks, err := openWebhooks(*webhooksFile)
+	if err != nil {
+		log.Fatalf("opening webhooks: %v", err)
+	}
+
+	var dispatcherOptions []webhook.Option
+	if *webhooksPrivate {
+		dispatcherOptions = append(dispatcherOptions, webhook.WithPrivateAddresses())
+	}
+
+	dispatcher := webhook.NewDispatcher(hooks, dispatcherOptions...)
+	options = append(options, server.WithWebhooks(dispatcher))
+	go dispatcher.Run(context.Background())
+
+	index := search.NewIndex(backend.GetAll)
+	for _, owner := range owners {
+		if err := index.Rebuild(context.Background(), owner); err != nil {
+			log.Printf("indexing todos of owner %d: %v", owner, err)
+		}
+	}
+	options = append(options, server.WithSearch(index))
+
+	service := todoapp.New(store.WithChangeHook(backend, func(change store.Change) {
+		broker.Publish(change)
+		dispatcher.Publish(change)
+		index.Apply(change)
+	}))
+
+	headers := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "If-Match", "If-None-Match", "Last-Event-ID"})
 	origins := handlers.AllowedOrigins([]string{"*"})
-	methods := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS"})
+	exposed := handlers.ExposedHeaders([]string{"ETag", "Link", "X-Total-Count"})
+	methods := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
 
 	srv := &http.Server{
-		Handler:      handlers.CORS(headers, origins, methods)(server.New(service)),
+		Handler:      handlers.CORS(headers, origins, methods, exposed)(server.New(service, options...)),
 		Addr:         ":8000",
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
 	}
 
-	log.Printf("starting to listen on %v", srv.Addr)
+	log.Printf("starting to listen on %v with %s store", srv.Addr, *backendKind)
 	log.Fatal(srv.ListenAndServe())
 }
+
+func openStore(kind, dataDir, dsn string) (store.Store, error) {
+	switch kind {
+	case "memory":
+		return store.NewInMemoryStore(), nil
+	case "file":
+		return store.NewFileStore(dataDir)
+	case "sqlite":
+		db, err := sql.Open("sqlite", store.SQLiteDSN(dsn))
+		if err != nil {
+			return nil, err
+		}
+
+		return store.NewSQLStore(db)
+	default:
+		return nil, fmt.Errorf("unknown backend %q", kind)
+	}
+}
+
+// purgeInterval checks the trash hourly, or more often for short retentions.
+func purgeInterval(retention time.Duration) time.Duration {
+	if retention < time.Hour {
+		return retention
+	}
+
+	return time.Hour
+}
+
+func openWebhooks(path string) (webhook.Store, error) {
+	if path == "" {
+		log.Printf("no webhooks file configured, pending deliveries are lost on restart")
+		return webhook.NewMemoryStore(), nil
+	}
+
+	return webhook.NewFileStore(path)
+}
+
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+
+	return fallback
+}
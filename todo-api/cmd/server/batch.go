@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"todoapp/model"
+)
+
+const (
+	ErrBatchFailed = "failed applying batch"
+)
+
+// batchTodos applies the operations of a BatchRequest all together or not at
+// all. An invalid todo is reported with its fields addressed through the
+// operation, e.g. "operations[2].todo.title".
+func (s *Server) batchTodos() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var batch BatchRequest
+
+		err := json.NewDecoder(r.Body).Decode(&batch)
+		if err != nil {
+			s.sendFailure(w, ErrJSONDecodeFailed, err, http.StatusBadRequest)
+			return
+		}
+
+		todos, err := s.service.BatchTodos(r.Context(), owner(r), batch.Operations)
+		if err != nil {
+			var (
+				operr *model.OperationError
+				verr  *model.ValidationError
+			)
+			if errors.As(err, &operr) && errors.As(operr.Err, &verr) {
+				s.sendValidationFailure(w, verr.WithPrefix(fmt.Sprintf("operations[%d].todo.", operr.Index)))
+				return
+			}
+
+			s.sendError(w, ErrBatchFailed, err)
+			return
+		}
+
+		resp := BatchResponse{Results: make([]BatchResult, len(todos))}
+		for idx, todo := range todos {
+			result := BatchResult{Op: batch.Operations[idx].Op, Id: todo.Id}
+			if result.Op != model.OpDelete {
+				result.Todo = todo
+			}
+
+			resp.Results[idx] = result
+		}
+
+		s.sendSuccess(w, resp)
+	}
+}
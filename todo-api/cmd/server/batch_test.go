@@ -0,0 +1,112 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todoapp"
+	"todoapp/cmd/server"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_Batch(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Create todo",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Water plants\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Water plants\",\"completed\":false,\"version\":1}",
+		},
+		{
+			name:   "Apply batch",
+			method: http.MethodPost,
+			path:   "/v0/todos:batch",
+			body: "{\"operations\":[" +
+				"{\"op\":\"create\",\"todo\":{\"title\":\"Plant tulips\"}}," +
+				"{\"op\":\"update\",\"id\":1,\"todo\":{\"title\":\"Water plants\",\"completed\":true}}," +
+				"{\"op\":\"create\",\"todo\":{\"title\":\"Mow lawn\"}}]}",
+			wantStatus: http.StatusOK,
+			wantBody: "{\"results\":[" +
+				"{\"op\":\"create\",\"id\":2,\"todo\":{\"id\":2,\"title\":\"Plant tulips\",\"completed\":false,\"version\":1}}," +
+				"{\"op\":\"update\",\"id\":1,\"todo\":{\"id\":1,\"title\":\"Water plants\",\"completed\":true,\"version\":2}}," +
+				"{\"op\":\"create\",\"id\":3,\"todo\":{\"id\":3,\"title\":\"Mow lawn\",\"completed\":false,\"version\":1}}]}",
+		},
+		{
+			name:   "Batch with missing todo",
+			method: http.MethodPost,
+			path:   "/v0/todos:batch",
+			body: "{\"operations\":[" +
+				"{\"op\":\"delete\",\"id\":3}," +
+				"{\"op\":\"delete\",\"id\":7}]}",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"failed applying batch: operation 1: todo not found\"}",
+		},
+		{
+			name:   "Batch with invalid todo",
+			method: http.MethodPost,
+			path:   "/v0/todos:batch",
+			body: "{\"operations\":[" +
+				"{\"op\":\"delete\",\"id\":3}," +
+				"{\"op\":\"update\",\"id\":2,\"todo\":{\"title\":\"\"}}]}",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody: "{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422," +
+				"\"detail\":\"invalid todo: title must not be empty\"," +
+				"\"invalid-params\":[{\"name\":\"operations[1].todo.title\",\"rule\":\"required\",\"reason\":\"must not be empty\"}]}",
+		},
+		{
+			name:       "Batch with unknown op",
+			method:     http.MethodPost,
+			path:       "/v0/todos:batch",
+			body:       "{\"operations\":[{\"op\":\"upsert\",\"id\":3}]}",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"failed applying batch: operation 0: invalid batch: op must be one of create, update or delete, not 'upsert'\"}",
+		},
+		{
+			name:       "Empty batch",
+			method:     http.MethodPost,
+			path:       "/v0/todos:batch",
+			body:       "{\"operations\":[]}",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"failed applying batch: invalid batch: a batch must contain at least one operation\"}",
+		},
+		{
+			name:       "Failed batches changed nothing",
+			method:     http.MethodGet,
+			path:       "/v0/todos/3",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":3,\"title\":\"Mow lawn\",\"completed\":false,\"version\":1}",
+		},
+		{
+			name:       "Delete in batch",
+			method:     http.MethodPost,
+			path:       "/v0/todos:batch",
+			body:       "{\"operations\":[{\"op\":\"delete\",\"id\":3}]}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"results\":[{\"op\":\"delete\",\"id\":3}]}",
+		},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequest(step.method, step.path, bytes.NewBuffer([]byte(step.body)))
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		assert.Equal(t, step.wantStatus, w.Code, step.name)
+		assert.Equal(t, step.wantBody, withoutTimestamps(w.Body.String()), step.name)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"todoapp/ical"
+	"todoapp/transfer"
+)
+
+const (
+	ErrCalendarFailed = "failed serving calendar"
+	ErrSyncFailed     = "failed syncing calendar"
+
+	actionCreated = "created"
+	actionUpdated = "updated"
+)
+
+// getCalendar streams all todos as the VTODO components of an iCalendar
+// feed, calendar apps can subscribe to it.
+func (s *Server) getCalendar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		headers := map[string]string{contentTypeKey: ical.ContentType}
+
+		s.streamTodos(w, r, ErrCalendarFailed, headers, func(out io.Writer) (transfer.Writer, error) {
+			return ical.NewWriter(out), nil
+		})
+	}
+}
+
+// syncCalendar applies the VTODO components of an uploaded calendar. A
+// component with the UID of one of the todos of the feed updates that todo,
+// the fields it carries replace those of the todo. Any other component adds
+// a new todo. The results carry the UIDs of the todos in the feed, which a
+// client has to use from then on. Components that fail are reported and
+// skipped, only a failing store ends the upload, keeping the changes made so
+// far.
+func (s *Server) syncCalendar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := ical.Parse(r.Body)
+		if err != nil {
+			s.sendError(w, ErrSyncFailed, err)
+			return
+		}
+
+		response := CalendarResponse{Results: make([]CalendarResult, 0, len(entries))}
+		for _, entry := range entries {
+			if entry.Err != nil {
+				response.Results = append(response.Results, CalendarResult{UID: entry.UID, Error: entry.Err.Error()})
+				continue
+			}
+
+			var result CalendarResult
+			if id, ok := ical.ParseUID(entry.UID); ok {
+				_, err = s.service.PatchTodo(r.Context(), owner(r), id, 0, ical.Patch(entry.Todo))
+				result = CalendarResult{UID: entry.UID, Id: id, Action: actionUpdated}
+			} else {
+				err = s.service.SaveTodo(r.Context(), owner(r), entry.Todo)
+				result = CalendarResult{UID: ical.UID(entry.Todo.Id), Id: entry.Todo.Id, Action: actionCreated}
+			}
+
+			if err != nil {
+				if errorStatus(err) >= http.StatusInternalServerError {
+					s.sendError(w, ErrSyncFailed, err)
+					return
+				}
+
+				result = CalendarResult{UID: entry.UID, Error: err.Error()}
+			}
+
+			response.Results = append(response.Results, result)
+		}
+
+		s.sendSuccess(w, response)
+	}
+}
@@ -0,0 +1,111 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"todoapp"
+	"todoapp/cmd/server"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// icalTimestampPattern matches the UTC times of iCalendar feeds.
+var icalTimestampPattern = regexp.MustCompile(`\d{8}T\d{6}Z`)
+
+func vcalendar(lines ...string) string {
+	return strings.Join(append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//todoapp//todoapp//EN"}, lines...), "END:VCALENDAR"), "\r\n") + "\r\n"
+}
+
+func TestHandler_Calendar(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	steps := []struct {
+		name            string
+		method          string
+		path            string
+		body            string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "Empty feed",
+			method:          http.MethodGet,
+			path:            "/v0/calendar.ics",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/calendar; charset=utf-8",
+			wantBody:        vcalendar(),
+		},
+		{
+			name:   "Upload new todos",
+			method: http.MethodPost,
+			path:   "/v0/calendar.ics",
+			body: vcalendar(
+				"BEGIN:VEVENT", "UID:party@example.com", "SUMMARY:Party", "END:VEVENT",
+				"BEGIN:VTODO", "UID:plants@example.com", "SUMMARY:Water plants", "DUE;VALUE=DATE:20261019", "PRIORITY:1", "CATEGORIES:garden", "END:VTODO",
+				"BEGIN:VTODO", "UID:blank@example.com", "DESCRIPTION:No title", "END:VTODO",
+				"BEGIN:VTODO", "SUMMARY:Buy seeds", "RELATED-TO:todo-1@todoapp", "END:VTODO",
+			),
+			wantStatus: http.StatusOK,
+			wantBody: "{\"results\":[{\"uid\":\"todo-1@todoapp\",\"id\":1,\"action\":\"created\"}," +
+				"{\"uid\":\"blank@example.com\",\"error\":\"invalid todo: title must not be empty\"}," +
+				"{\"uid\":\"todo-2@todoapp\",\"id\":2,\"action\":\"created\"}]}",
+		},
+		{
+			name:   "Upload changes",
+			method: http.MethodPost,
+			path:   "/v0/calendar.ics",
+			body: vcalendar(
+				"BEGIN:VTODO", "UID:todo-2@todoapp", "SUMMARY:Buy seeds", "STATUS:COMPLETED", "END:VTODO",
+				"BEGIN:VTODO", "UID:todo-9@todoapp", "SUMMARY:Gone", "END:VTODO",
+				"BEGIN:VTODO", "UID:todo-1@todoapp", "SUMMARY:Water plants", "DUE;VALUE=DATE:20261019", "PRIORITY:soon", "END:VTODO",
+			),
+			wantStatus: http.StatusOK,
+			wantBody: "{\"results\":[{\"uid\":\"todo-2@todoapp\",\"id\":2,\"action\":\"updated\"}," +
+				"{\"uid\":\"todo-9@todoapp\",\"error\":\"todo not found\"}," +
+				"{\"uid\":\"todo-1@todoapp\",\"error\":\"PRIORITY 'soon' is not an integer\"}]}",
+		},
+		{
+			name:            "Feed",
+			method:          http.MethodGet,
+			path:            "/v0/calendar.ics",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/calendar; charset=utf-8",
+			wantBody: vcalendar(
+				"BEGIN:VTODO", "UID:todo-1@todoapp", "DTSTAMP:<time>", "CREATED:<time>", "LAST-MODIFIED:<time>",
+				"SUMMARY:Water plants", "STATUS:NEEDS-ACTION", "DUE:<time>", "PRIORITY:1", "CATEGORIES:garden", "SEQUENCE:0", "END:VTODO",
+				"BEGIN:VTODO", "UID:todo-2@todoapp", "DTSTAMP:<time>", "CREATED:<time>", "LAST-MODIFIED:<time>",
+				"SUMMARY:Buy seeds", "STATUS:COMPLETED", "COMPLETED:<time>", "SEQUENCE:1", "END:VTODO",
+			),
+		},
+		{
+			name:       "Upload without calendar",
+			method:     http.MethodPost,
+			path:       "/v0/calendar.ics",
+			body:       "BEGIN:VTODO\r\nSUMMARY:x\r\nEND:VTODO\r\n",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"failed syncing calendar: malformed calendar: line 1: calendar must start with BEGIN:VCALENDAR\"}",
+		},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequest(step.method, step.path, bytes.NewBuffer([]byte(step.body)))
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", "text/calendar")
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		assert.Equal(t, step.wantStatus, w.Code, step.name)
+		assert.Equal(t, step.wantBody, icalTimestampPattern.ReplaceAllString(w.Body.String(), "<time>"), step.name)
+
+		if step.wantContentType != "" {
+			assert.Equal(t, step.wantContentType, w.Header().Get("Content-Type"), step.name)
+		}
+	}
+}
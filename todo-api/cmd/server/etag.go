@@ -0,0 +1,116 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"todoapp/model"
+	"todoapp/store"
+)
+
+const (
+	etagKey        = "ETag"
+	ifMatchKey     = "If-Match"
+	ifNoneMatchKey = "If-None-Match"
+)
+
+var (
+	errUnsupportedETag = errors.New("If-Match must be '*' or a list of strong entity tags")
+)
+
+// etag derives the entity tag of a todo from its version.
+func etag(todo *model.Todo) string {
+	return fmt.Sprintf("\"%d\"", todo.Version)
+}
+
+// ifMatchVersions returns the versions listed by the If-Match header of r.
+// None means the request is unconditional or, for "*", only requires the
+// todo to exist.
+func ifMatchVersions(r *http.Request) ([]int, error) {
+	header := strings.TrimSpace(r.Header.Get(ifMatchKey))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		// If-Match uses the strong comparison, weak tags never match.
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			return nil, errUnsupportedETag
+		}
+
+		version, err := strconv.Atoi(tag[1 : len(tag)-1])
+		if err != nil || version < 1 {
+			return nil, errUnsupportedETag
+		}
+
+		versions = append(versions, version)
+	}
+
+	if len(versions) == 0 {
+		return nil, errUnsupportedETag
+	}
+
+	return versions, nil
+}
+
+// ifMatchVersion returns the version the todo with the given id must have
+// for the If-Match header of r, zero if any will do. Of several listed tags
+// the one of the current version is required, so that the store still
+// refuses the write if another one slips in, and store.ErrVersionConflict is
+// returned if none is current.
+func (s *Server) ifMatchVersion(r *http.Request, id int) (int, error) {
+	versions, err := ifMatchVersions(r)
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+
+	if len(versions) == 1 {
+		return versions[0], nil
+	}
+
+	current, err := s.service.GetTodo(r.Context(), owner(r), id)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, version := range versions {
+		if version == current.Version {
+			return version, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: version %d is not listed", store.ErrVersionConflict, current.Version)
+}
+
+// preconditionFailed reports whether err of a request with If-Match means
+// that its condition does not hold.
+func preconditionFailed(err error) bool {
+	return errors.Is(err, errUnsupportedETag) || errors.Is(err, store.ErrVersionConflict)
+}
+
+// noneMatch reports whether the If-None-Match header of r matches tag, using
+// the weak comparison as required for GET requests.
+func noneMatch(r *http.Request, tag string) bool {
+	header := r.Header.Get(ifNoneMatchKey)
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
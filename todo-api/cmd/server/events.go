@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"todoapp/events"
+)
+
+const (
+	lastEventIdKey = "Last-Event-ID"
+	cacheControl   = "Cache-Control"
+	eventStream    = "text/event-stream"
+
+	// defaultHeartbeat is how often an idle event stream sends a comment so
+	// that proxies do not close it.
+	defaultHeartbeat = 15 * time.Second
+
+	ErrStreamingUnsupported = "streaming unsupported"
+)
+
+// WithEvents serves the events published to b as a Server-Sent Events stream
+// at /v0/events and to WebSocket clients at /v0/ws, see getEvents and
+// serveSocket.
+func WithEvents(b *events.Broker) Option {
+	return func(s *Server) {
+		s.events = b
+	}
+}
+
+// getEvents streams the changes to the todos of the user as Server-Sent
+// Events named created, updated or deleted, carrying the todo as data. A
+// client reconnecting with Last-Event-ID first receives the events it missed.
+// If some of them are no longer buffered a reset event is sent first, the
+// client should then fetch its todos again.
+func (s *Server) getEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var lastId uint64
+
+		if v := r.Header.Get(lastEventIdKey); v != "" {
+			parsed, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("%s must be an event id, got '%s'", lastEventIdKey, v), http.StatusBadRequest)
+				return
+			}
+
+			lastId = parsed
+		}
+
+		rc := http.NewResponseController(w)
+
+		// The stream outlives the write timeout of the server.
+		rc.SetWriteDeadline(time.Time{})
+
+		sub, replay, complete := s.events.Subscribe(owner(r), lastId)
+		defer sub.Cancel()
+
+		w.Header().Set(contentTypeKey, eventStream)
+		w.Header().Set(cacheControl, "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		if !complete {
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		}
+
+		for _, event := range replay {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			s.sendFailure(w, ErrStreamingUnsupported, err, http.StatusInternalServerError)
+			return
+		}
+
+		heartbeat := time.NewTicker(s.heartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event.Todo)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+
+	return err
+}
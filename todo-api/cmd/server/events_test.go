@@ -0,0 +1,130 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"todoapp"
+	"todoapp/cmd/server"
+	"todoapp/events"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readEvent reads the lines of the next event from an event stream.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event failed: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return withoutTimestamps(strings.Join(lines, "\n"))
+		}
+
+		lines = append(lines, line)
+	}
+}
+
+func openEvents(t *testing.T, ctx context.Context, url string, lastId string) *bufio.Reader {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/v0/events", nil)
+	if err != nil {
+		t.Fatalf("creating request failed: %v", err)
+	}
+
+	if lastId != "" {
+		req.Header.Set("Last-Event-ID", lastId)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("opening event stream failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	return bufio.NewReader(resp.Body)
+}
+
+func send(t *testing.T, url, method, path, body string) {
+	req, err := http.NewRequest(method, url+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("creating request failed: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	resp.Body.Close()
+}
+
+func TestHandler_Events(t *testing.T) {
+	broker := events.NewBroker(10)
+	service := todoapp.New(store.WithChangeHook(store.NewInMemoryStore(), broker.Publish))
+
+	ts := httptest.NewServer(server.New(service, server.WithEvents(broker)))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := openEvents(t, ctx, ts.URL, "")
+
+	send(t, ts.URL, http.MethodPost, "/v0/todos", "{\"title\":\"Say hello\"}")
+	assert.Equal(t, "id: 1\nevent: created\ndata: {\"id\":1,\"title\":\"Say hello\",\"completed\":false,\"version\":1}",
+		readEvent(t, stream))
+
+	send(t, ts.URL, http.MethodPut, "/v0/todos/1", "{\"title\":\"Say goodbye\"}")
+	assert.Equal(t, "id: 2\nevent: updated\ndata: {\"id\":1,\"title\":\"Say goodbye\",\"completed\":false,\"version\":2}",
+		readEvent(t, stream))
+
+	send(t, ts.URL, http.MethodDelete, "/v0/todos/1", "")
+	assert.Equal(t, "id: 3\nevent: deleted\ndata: {\"id\":1,\"title\":\"Say goodbye\",\"completed\":false,\"version\":2}",
+		readEvent(t, stream))
+
+	resumed := openEvents(t, ctx, ts.URL, "1")
+	assert.Equal(t, "id: 2\nevent: updated\ndata: {\"id\":1,\"title\":\"Say goodbye\",\"completed\":false,\"version\":2}",
+		readEvent(t, resumed))
+	assert.Equal(t, "id: 3\nevent: deleted\ndata: {\"id\":1,\"title\":\"Say goodbye\",\"completed\":false,\"version\":2}",
+		readEvent(t, resumed))
+
+	restarted := openEvents(t, ctx, ts.URL, "42")
+	assert.Equal(t, "event: reset\ndata: {}", readEvent(t, restarted))
+}
+
+func TestHandler_EventsInvalidLastEventId(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()), server.WithEvents(events.NewBroker(10)))
+
+	req, err := http.NewRequest(http.MethodGet, "/v0/events", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "yesterday")
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "{\"error\":\"invalid parameter: Last-Event-ID must be an event id, got 'yesterday'\"}", w.Body.String())
+}
+
+func TestHandler_EventsDisabled(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	req, err := http.NewRequest(http.MethodGet, "/v0/events", nil)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
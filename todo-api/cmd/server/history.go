@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// getHistory lists the revisions of a todo, oldest first.
+func (s *Server) getHistory() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["id"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		revisions, err := s.service.GetHistory(r.Context(), owner(r), id)
+		if err != nil {
+			s.sendError(w, "fetch history with id "+idString, err)
+			return
+		}
+
+		s.sendSuccess(w, revisions)
+	}
+}
+
+// revertTodo sets a todo back to the state of one of its revisions and sends
+// it as reverted.
+func (s *Server) revertTodo() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		idString, numberString := vars["id"], vars["revision"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		number, err := strconv.Atoi(numberString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", numberString), http.StatusBadRequest)
+			return
+		}
+
+		todo, err := s.service.RevertTodo(r.Context(), owner(r), id, number)
+		if err != nil {
+			s.sendError(w, "revert with id "+idString, err)
+			return
+		}
+
+		w.Header().Set(etagKey, etag(todo))
+		s.sendSuccess(w, todo)
+	}
+}
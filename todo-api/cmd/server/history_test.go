@@ -0,0 +1,124 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todoapp"
+	"todoapp/cmd/server"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_History(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Create todo",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Plant tulips\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Plant tulips\",\"completed\":false,\"version\":1}",
+		},
+		{
+			name:       "Rename todo",
+			method:     http.MethodPut,
+			path:       "/v0/todos/1",
+			body:       "{\"title\":\"Plant daffodils\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Plant daffodils\",\"completed\":false,\"version\":2}",
+		},
+		{
+			name:       "Get history",
+			method:     http.MethodGet,
+			path:       "/v0/todos/1/history",
+			wantStatus: http.StatusOK,
+			wantBody: "[{\"todo_id\":1,\"number\":1,\"action\":\"created\",\"actor\":0," +
+				"\"changes\":[{\"field\":\"title\",\"after\":\"Plant tulips\"}]," +
+				"\"todo\":{\"id\":1,\"title\":\"Plant tulips\",\"completed\":false,\"version\":1}}," +
+				"{\"todo_id\":1,\"number\":2,\"action\":\"updated\",\"actor\":0," +
+				"\"changes\":[{\"field\":\"title\",\"before\":\"Plant tulips\",\"after\":\"Plant daffodils\"}]," +
+				"\"todo\":{\"id\":1,\"title\":\"Plant daffodils\",\"completed\":false,\"version\":2}}]",
+		},
+		{
+			name:       "Revert to first revision",
+			method:     http.MethodPost,
+			path:       "/v0/todos/1/history/1/revert",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Plant tulips\",\"completed\":false,\"version\":3}",
+		},
+		{
+			name:       "Revert to unknown revision",
+			method:     http.MethodPost,
+			path:       "/v0/todos/1/history/7/revert",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"revert with id 1: revision not found\"}",
+		},
+		{
+			name:       "Revert with invalid revision",
+			method:     http.MethodPost,
+			path:       "/v0/todos/1/history/first/revert",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: 'first' cannot be converted to int\"}",
+		},
+		{
+			name:       "Get history of unknown todo",
+			method:     http.MethodGet,
+			path:       "/v0/todos/2/history",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"fetch history with id 2: todo not found\"}",
+		},
+		{
+			name:       "Delete todo",
+			method:     http.MethodDelete,
+			path:       "/v0/todos/1",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Get history of deleted todo",
+			method:     http.MethodGet,
+			path:       "/v0/todos/1/history",
+			wantStatus: http.StatusOK,
+			wantBody: "[{\"todo_id\":1,\"number\":1,\"action\":\"created\",\"actor\":0," +
+				"\"changes\":[{\"field\":\"title\",\"after\":\"Plant tulips\"}]," +
+				"\"todo\":{\"id\":1,\"title\":\"Plant tulips\",\"completed\":false,\"version\":1}}," +
+				"{\"todo_id\":1,\"number\":2,\"action\":\"updated\",\"actor\":0," +
+				"\"changes\":[{\"field\":\"title\",\"before\":\"Plant tulips\",\"after\":\"Plant daffodils\"}]," +
+				"\"todo\":{\"id\":1,\"title\":\"Plant daffodils\",\"completed\":false,\"version\":2}}," +
+				"{\"todo_id\":1,\"number\":3,\"action\":\"reverted\",\"actor\":0,\"reverts\":1," +
+				"\"changes\":[{\"field\":\"title\",\"before\":\"Plant daffodils\",\"after\":\"Plant tulips\"}]," +
+				"\"todo\":{\"id\":1,\"title\":\"Plant tulips\",\"completed\":false,\"version\":3}}," +
+				"{\"todo_id\":1,\"number\":4,\"action\":\"deleted\",\"actor\":0," +
+				"\"changes\":[{\"field\":\"title\",\"before\":\"Plant tulips\"}]," +
+				"\"todo\":{\"id\":1,\"title\":\"Plant tulips\",\"completed\":false,\"version\":3}}]",
+		},
+		{
+			name:       "Revert deleted todo",
+			method:     http.MethodPost,
+			path:       "/v0/todos/1/history/2/revert",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"revert with id 1: todo not found\"}",
+		},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequest(step.method, step.path, bytes.NewBuffer([]byte(step.body)))
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		assert.Equal(t, step.wantStatus, w.Code, step.name)
+		assert.Equal(t, step.wantBody, withoutTimestamps(w.Body.String()), step.name)
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"todoapp/model"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) getLists() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lists, err := s.service.GetLists(r.Context(), owner(r))
+		if err != nil {
+			s.sendError(w, ErrFetchListFailed, err)
+			return
+		}
+
+		s.sendSuccess(w, lists)
+	}
+}
+
+func (s *Server) addList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var list model.List
+
+		err := json.NewDecoder(r.Body).Decode(&list)
+		if err != nil {
+			s.sendFailure(w, ErrJSONDecodeFailed, err, http.StatusBadRequest)
+			return
+		}
+
+		err = s.service.SaveList(r.Context(), owner(r), &list)
+		if err != nil {
+			s.sendError(w, ErrSaveListFailed, err)
+			return
+		}
+
+		s.sendSuccess(w, list)
+	}
+}
+
+func (s *Server) getListById() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["listId"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		list, err := s.service.GetList(r.Context(), owner(r), id)
+		if err != nil {
+			s.sendError(w, "fetch list with id "+idString, err)
+			return
+		}
+
+		s.sendSuccess(w, list)
+	}
+}
+
+func (s *Server) updateList() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["listId"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		var list model.List
+		err = json.NewDecoder(r.Body).Decode(&list)
+		if err != nil {
+			s.sendFailure(w, ErrJSONDecodeFailed, err, http.StatusBadRequest)
+			return
+		}
+
+		updatedList, err := s.service.UpdateList(r.Context(), owner(r), id, &list)
+		if err != nil {
+			s.sendError(w, "update list with id "+idString, err)
+			return
+		}
+
+		s.sendSuccess(w, updatedList)
+	}
+}
+
+// deleteList deletes a list, the cascade parameter decides what happens to
+// the todos on it: restrict (the default) refuses to delete a list that still
+// has todos, delete removes them unless todos elsewhere refer to them and
+// detach keeps them without a list.
+func (s *Server) deleteList() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["listId"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		cascade, err := model.ParseCascade(r.URL.Query().Get("cascade"))
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, err, http.StatusBadRequest)
+			return
+		}
+
+		err = s.service.DeleteList(r.Context(), owner(r), id, cascade)
+		if err != nil {
+			s.sendError(w, "delete list with id "+idString, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// getListTodos lists the todos on a list, it takes the same parameters as
+// listing all todos.
+func (s *Server) getListTodos() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["listId"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		query, err := parseQuery(r.URL.Query())
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, err, http.StatusBadRequest)
+			return
+		}
+
+		// An unknown list is reported as such rather than as an empty one.
+		if _, err := s.service.GetList(r.Context(), owner(r), id); err != nil {
+			s.sendError(w, "fetch list with id "+idString, err)
+			return
+		}
+
+		query.ListId = &id
+		s.sendTodoPage(w, r, query)
+	}
+}
+
+// addListTodo creates a todo on a list, a list_id in the body is ignored.
+func (s *Server) addListTodo() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["listId"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		var todo model.Todo
+		err = json.NewDecoder(r.Body).Decode(&todo)
+		if err != nil {
+			s.sendFailure(w, ErrJSONDecodeFailed, err, http.StatusBadRequest)
+			return
+		}
+
+		todo.ListId = id
+
+		err = s.service.SaveTodo(r.Context(), owner(r), &todo)
+		if err != nil {
+			s.sendError(w, "add to list with id "+idString, err)
+			return
+		}
+
+		w.Header().Set(etagKey, etag(&todo))
+		s.sendSuccess(w, todo)
+	}
+}
@@ -1,15 +1,32 @@
 package server
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"strings"
 	"time"
+	"todoapp/auth"
+	"todoapp/store"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	authorizationKey   = "Authorization"
+	wwwAuthenticateKey = "WWW-Authenticate"
+	bearerPrefix       = "Bearer "
+	accessTokenParam   = "access_token"
 )
 
+type contextKey int
+
+const userKey contextKey = iota
+
 func (s *Server) mwLogger(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Println(r.RemoteAddr, r.Method, r.RequestURI)
+		log.Println(r.RemoteAddr, r.Method, loggedURI(r))
 
 		next.ServeHTTP(w, r)
 	})
@@ -25,3 +42,76 @@ func (s *Server) mwTimer(next http.Handler) http.Handler {
 		log.Println(time.Since(start))
 	})
 }
+
+// loggedURI returns the request URI of r with the value of an access_token
+// parameter left out, so that tokens do not end up in the logs.
+func loggedURI(r *http.Request) string {
+	query := r.URL.Query()
+	if !query.Has(accessTokenParam) {
+		return r.RequestURI
+	}
+
+	query.Set(accessTokenParam, "redacted")
+
+	u := *r.URL
+	u.RawQuery = query.Encode()
+
+	return u.RequestURI()
+}
+
+// mwAuth authenticates the bearer token of every request and stores the user
+// in the request context. Without an Authenticator requests pass unchanged.
+func (s *Server) mwAuth(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := s.bearerToken(r)
+		if !ok {
+			w.Header().Set(wwwAuthenticateKey, "Bearer")
+			s.sendFailure(w, ErrUnauthorized, auth.ErrInvalidToken, http.StatusUnauthorized)
+			return
+		}
+
+		user, err := s.auth.Authenticate(token)
+		if err != nil {
+			w.Header().Set(wwwAuthenticateKey, `Bearer error="invalid_token"`)
+			s.sendFailure(w, ErrUnauthorized, err, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+	})
+}
+
+// bearerToken returns the token of the Authorization header of r. Requests
+// without the header may send the token as access_token parameter to the
+// routes accepting it, since browsers cannot set headers on an EventSource or
+// WebSocket.
+func (s *Server) bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get(authorizationKey)
+	if header == "" && s.tokenRoutes[mux.CurrentRoute(r)] {
+		token := r.URL.Query().Get(accessTokenParam)
+		return token, token != ""
+	}
+
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(header[len(bearerPrefix):]), true
+}
+
+// owner returns the id of the authenticated user of r, or store.Anonymous if
+// the server runs without authentication.
+func owner(r *http.Request) int {
+	user, ok := r.Context().Value(userKey).(auth.User)
+	if !ok {
+		return store.Anonymous
+	}
+
+	return user.Id
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"todoapp/model"
+)
+
+const (
+	totalCountKey = "X-Total-Count"
+	linkKey       = "Link"
+
+	maxPageLimit = 1000
+)
+
+// parseQuery builds a model.Query from the query string of a list request:
+// completed=true|false, list_id=id (0 for todos on no list), parent_id=id (0
+// for top level todos), q=substring, sort=field[,-field...], limit and offset.
+func parseQuery(values url.Values) (model.Query, error) {
+	var q model.Query
+
+	if v := values.Get("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, fmt.Errorf("'%s' is not a valid value for completed", v)
+		}
+
+		q.Completed = &completed
+	}
+
+	if v := values.Get("list_id"); v != "" {
+		listId, err := strconv.Atoi(v)
+		if err != nil || listId < 0 {
+			return q, fmt.Errorf("list_id must be a non-negative integer, got '%s'", v)
+		}
+
+		q.ListId = &listId
+	}
+
+	if v := values.Get("parent_id"); v != "" {
+		parentId, err := strconv.Atoi(v)
+		if err != nil || parentId < 0 {
+			return q, fmt.Errorf("parent_id must be a non-negative integer, got '%s'", v)
+		}
+
+		q.ParentId = &parentId
+	}
+
+	q.Search = values.Get("q")
+
+	sortKeys, err := model.ParseSort(values.Get("sort"))
+	if err != nil {
+		return q, err
+	}
+	q.Sort = sortKeys
+
+	if v := values.Get("limit"); v != "" {
+		q.Limit, err = strconv.Atoi(v)
+		if err != nil || q.Limit < 1 || q.Limit > maxPageLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d, got '%s'", maxPageLimit, v)
+		}
+	}
+
+	if v := values.Get("offset"); v != "" {
+		q.Offset, err = strconv.Atoi(v)
+		if err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("offset must be a non-negative integer, got '%s'", v)
+		}
+	}
+
+	return q, nil
+}
+
+// pageLinks renders an RFC 8288 Link header pointing at the first, previous,
+// next and last pages relative to the requested one. Unpaged queries have no
+// links.
+func pageLinks(u *url.URL, q model.Query, total int) string {
+	if q.Limit == 0 {
+		return ""
+	}
+
+	link := func(offset int, rel string) string {
+		values := u.Query()
+		values.Set("limit", strconv.Itoa(q.Limit))
+		values.Set("offset", strconv.Itoa(offset))
+
+		return fmt.Sprintf("<%s?%s>; rel=\"%s\"", u.Path, values.Encode(), rel)
+	}
+
+	last := 0
+	if total > 0 {
+		last = (total - 1) / q.Limit * q.Limit
+	}
+
+	links := []string{link(0, "first")}
+
+	if q.Offset > 0 {
+		prev := q.Offset - q.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link(prev, "prev"))
+	}
+
+	if q.Offset+q.Limit < total {
+		links = append(links, link(q.Offset+q.Limit, "next"))
+	}
+
+	links = append(links, link(last, "last"))
+
+	return strings.Join(links, ", ")
+}
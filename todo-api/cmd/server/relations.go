@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) getTodoTree() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["id"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		tree, err := s.service.GetTodoTree(r.Context(), owner(r), id)
+		if err != nil {
+			s.sendError(w, "fetch tree of id "+idString, err)
+			return
+		}
+
+		s.sendSuccess(w, tree)
+	}
+}
+
+func (s *Server) getBlockers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["id"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		blockers, err := s.service.GetBlockers(r.Context(), owner(r), id)
+		if err != nil {
+			s.sendError(w, "fetch blockers of id "+idString, err)
+			return
+		}
+
+		s.sendSuccess(w, blockers)
+	}
+}
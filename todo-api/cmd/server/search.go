@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"todoapp/model"
+	"todoapp/search"
+)
+
+const (
+	ErrSearchFailed = "failed searching todos"
+
+	// defaultSearchLimit is the size of a page of search results unless the
+	// request asks for another.
+	defaultSearchLimit = 20
+)
+
+// Searcher finds the todos of an owner matching the words of q.Search, the
+// best matches first.
+type Searcher interface {
+	Search(ctx context.Context, owner int, q model.Query) ([]*search.Result, int, error)
+}
+
+// WithSearch serves the full-text search of searcher under /v0/search.
+func WithSearch(searcher Searcher) Option {
+	return func(s *Server) {
+		s.search = searcher
+	}
+}
+
+// searchTodos sends a page of the todos matching the words of the q
+// parameter, ordered by relevance. The filters, limit and offset are those of
+// /v0/todos, sort is not supported.
+func (s *Server) searchTodos() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseQuery(r.URL.Query())
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, err, http.StatusBadRequest)
+			return
+		}
+
+		if query.Search == "" {
+			s.sendFailure(w, ErrInvalidParameter, errors.New("q must not be empty"), http.StatusBadRequest)
+			return
+		}
+
+		if len(query.Sort) > 0 {
+			s.sendFailure(w, ErrInvalidParameter, errors.New("search results are ordered by relevance and cannot be sorted"), http.StatusBadRequest)
+			return
+		}
+
+		if query.Limit == 0 {
+			query.Limit = defaultSearchLimit
+		}
+
+		results, total, err := s.search.Search(r.Context(), owner(r), query)
+		if err != nil {
+			s.sendError(w, ErrSearchFailed, err)
+			return
+		}
+
+		w.Header().Set(totalCountKey, strconv.Itoa(total))
+		w.Header().Set(linkKey, pageLinks(r.URL, query, total))
+
+		s.sendSuccess(w, results)
+	}
+}
@@ -0,0 +1,132 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"todoapp"
+	"todoapp/cmd/server"
+	"todoapp/search"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scorePattern matches the relevance of search results, which depends on
+// every indexed todo.
+var scorePattern = regexp.MustCompile(`"score":[0-9.]+`)
+
+func TestHandler_Search(t *testing.T) {
+	backend := store.NewInMemoryStore()
+	index := search.NewIndex(backend.GetAll)
+	srv := server.New(todoapp.New(store.WithChangeHook(backend, index.Apply)), server.WithSearch(index))
+
+	steps := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		wantStatus     int
+		wantTotalCount string
+		wantBody       string
+	}{
+		{
+			name:       "Add todo",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Buy groceries\",\"description\":\"Milk and bread\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Buy groceries\",\"completed\":false,\"description\":\"Milk and bread\",\"version\":1}",
+		},
+		{
+			name:       "Add another todo",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Bake bread\",\"tags\":[\"baking\"]}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":2,\"title\":\"Bake bread\",\"completed\":false,\"tags\":[\"baking\"],\"version\":1}",
+		},
+		{
+			name:           "Search",
+			method:         http.MethodGet,
+			path:           "/v0/search?q=bread",
+			wantStatus:     http.StatusOK,
+			wantTotalCount: "2",
+			wantBody: "[{\"todo\":{\"id\":2,\"title\":\"Bake bread\",\"completed\":false,\"tags\":[\"baking\"],\"version\":1},<score>," +
+				"\"highlights\":{\"title\":\"Bake \\u003cmark\\u003ebread\\u003c/mark\\u003e\"}}," +
+				"{\"todo\":{\"id\":1,\"title\":\"Buy groceries\",\"completed\":false,\"description\":\"Milk and bread\",\"version\":1},<score>," +
+				"\"highlights\":{\"description\":\"Milk and \\u003cmark\\u003ebread\\u003c/mark\\u003e\",\"title\":\"Buy groceries\"}}]",
+		},
+		{
+			name:           "Search by prefix and stem",
+			method:         http.MethodGet,
+			path:           "/v0/search?q=grocery+mil",
+			wantStatus:     http.StatusOK,
+			wantTotalCount: "1",
+			wantBody: "[{\"todo\":{\"id\":1,\"title\":\"Buy groceries\",\"completed\":false,\"description\":\"Milk and bread\",\"version\":1},<score>," +
+				"\"highlights\":{\"description\":\"\\u003cmark\\u003eMilk\\u003c/mark\\u003e and bread\",\"title\":\"Buy \\u003cmark\\u003egroceries\\u003c/mark\\u003e\"}}]",
+		},
+		{
+			name:       "Update todo",
+			method:     http.MethodPatch,
+			path:       "/v0/todos/2",
+			body:       "{\"title\":\"Bake a cake\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":2,\"title\":\"Bake a cake\",\"completed\":false,\"tags\":[\"baking\"],\"version\":2}",
+		},
+		{
+			name:       "Delete todo",
+			method:     http.MethodDelete,
+			path:       "/v0/todos/1",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Search after changes",
+			method:         http.MethodGet,
+			path:           "/v0/search?q=bread",
+			wantStatus:     http.StatusOK,
+			wantTotalCount: "0",
+			wantBody:       "[]",
+		},
+		{
+			name:           "Search with filter",
+			method:         http.MethodGet,
+			path:           "/v0/search?q=cake&completed=true",
+			wantStatus:     http.StatusOK,
+			wantTotalCount: "0",
+			wantBody:       "[]",
+		},
+		{
+			name:       "Search without words",
+			method:     http.MethodGet,
+			path:       "/v0/search",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: q must not be empty\"}",
+		},
+		{
+			name:       "Search sorted",
+			method:     http.MethodGet,
+			path:       "/v0/search?q=cake&sort=title",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: search results are ordered by relevance and cannot be sorted\"}",
+		},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequest(step.method, step.path, bytes.NewBuffer([]byte(step.body)))
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		assert.Equal(t, step.wantStatus, w.Code, step.name)
+		assert.Equal(t, step.wantBody, scorePattern.ReplaceAllString(withoutTimestamps(w.Body.String()), "<score>"), step.name)
+
+		if step.wantTotalCount != "" {
+			assert.Equal(t, step.wantTotalCount, w.Header().Get("X-Total-Count"), step.name)
+		}
+	}
+}
@@ -1,44 +1,100 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"time"
 	"todoapp"
+	"todoapp/auth"
+	"todoapp/events"
+	"todoapp/ical"
 	"todoapp/model"
 	"todoapp/store"
+	"todoapp/transfer"
+	"todoapp/webhook"
 
 	"github.com/gorilla/mux"
 )
 
 const (
 	contentTypeKey  = "Content-Type"
+	acceptPatchKey  = "Accept-Patch"
 	applicationJSON = "application/json"
+	problemJSON     = "application/problem+json"
+	mergePatchJSON  = "application/merge-patch+json"
+	jsonPatchJSON   = "application/json-patch+json"
 
 	ErrJSONDecodeFailed    = "failed decoding request body"
 	ErrJSONEncodeFailed    = "failed encoding response body"
 	ErrSaveFailed          = "failed saving todo"
+	ErrDeleteFailed        = "failed deleting todo"
 	ErrResponseWriteFailed = "failed writing response"
 	ErrFetchTodoFailed     = "failed fetching todos"
+	ErrFetchListFailed     = "failed fetching lists"
+	ErrSaveListFailed      = "failed saving list"
 	ErrInvalidParameter    = "invalid parameter"
+	ErrReadBodyFailed      = "failed reading request body"
+	ErrUnsupportedPatch    = "unsupported patch format"
+	ErrPatchFailed         = "failed patching todo"
+	ErrPreconditionFailed  = "precondition failed"
+	ErrUnauthorized        = "unauthorized"
 	ErrUnknownError        = "something went wrong"
 )
 
 type Server struct {
-	service todoapp.TodoService
-	router  *mux.Router
+	service   todoapp.TodoService
+	auth      Authenticator
+	events    *events.Broker
+	webhooks  Webhooks
+	search    Searcher
+	heartbeat time.Duration
+	router    *mux.Router
+
+	// tokenRoutes are the routes taking the bearer token from the
+	// access_token parameter as well, see mwAuth.
+	tokenRoutes map[*mux.Route]bool
+}
+
+// Authenticator resolves the API token of a request to the user sending it.
+type Authenticator interface {
+	Authenticate(token string) (auth.User, error)
+}
+
+// Option configures optional behaviour of a Server.
+type Option func(*Server)
+
+// WithAuthenticator requires every request to carry a bearer token accepted by
+// a, and scopes the todos it sees to the authenticated user. Without it all
+// requests share the todos of store.Anonymous. Browsers connect to /v0/events
+// and /v0/ws with the token as access_token parameter instead.
+func WithAuthenticator(a Authenticator) Option {
+	return func(s *Server) {
+		s.auth = a
+	}
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
 
-func New(service todoapp.TodoService) *Server {
+func New(service todoapp.TodoService, options ...Option) *Server {
 	s := &Server{
-		service: service,
-		router:  mux.NewRouter(),
+		service:     service,
+		heartbeat:   defaultHeartbeat,
+		router:      mux.NewRouter(),
+		tokenRoutes: make(map[*mux.Route]bool),
 	}
+
+	for _, option := range options {
+		option(s)
+	}
+
 	s.routes()
 	s.middlewares()
 
@@ -46,11 +102,16 @@ func New(service todoapp.TodoService) *Server {
 }
 
 func (s *Server) routes() {
-	routes := []struct {
+	type route struct {
 		path    string
 		handler http.HandlerFunc
 		methods []string
-	}{
+		// tokenParam accepts the bearer token as access_token parameter, for
+		// the streams browsers cannot send an Authorization header with.
+		tokenParam bool
+	}
+
+	routes := []route{
 		{
 			path:    "/v0/todos",
 			handler: s.getTodos(),
@@ -61,22 +122,176 @@ func (s *Server) routes() {
 			handler: s.addTodo(),
 			methods: []string{http.MethodPost},
 		},
+		{
+			path:    "/v0/todos:batch",
+			handler: s.batchTodos(),
+			methods: []string{http.MethodPost},
+		},
 		{
 			path:    "/v0/todos/{id}",
 			handler: s.updateTodo(),
 			methods: []string{http.MethodPut},
 		},
+		{
+			path:    "/v0/todos/{id}",
+			handler: s.patchTodo(),
+			methods: []string{http.MethodPatch},
+		},
 		{
 			path:    "/v0/todos/{id}",
 			handler: s.getTodoById(),
 			methods: []string{http.MethodGet},
 		},
+		{
+			path:    "/v0/todos/{id}",
+			handler: s.deleteTodo(),
+			methods: []string{http.MethodDelete},
+		},
+		{
+			path:    "/v0/todos/{id}/tree",
+			handler: s.getTodoTree(),
+			methods: []string{http.MethodGet},
+		},
+		{
+			path:    "/v0/todos/{id}/blockers",
+			handler: s.getBlockers(),
+			methods: []string{http.MethodGet},
+		},
+		{
+			path:    "/v0/todos/{id}/restore",
+			handler: s.restoreTodo(),
+			methods: []string{http.MethodPost},
+		},
+		{
+			path:    "/v0/todos/{id}/history",
+			handler: s.getHistory(),
+			methods: []string{http.MethodGet},
+		},
+		{
+			path:    "/v0/todos/{id}/history/{revision}/revert",
+			handler: s.revertTodo(),
+			methods: []string{http.MethodPost},
+		},
+		{
+			path:    "/v0/trash",
+			handler: s.getTrash(),
+			methods: []string{http.MethodGet},
+		},
+		{
+			path:    "/v0/export",
+			handler: s.exportTodos(),
+			methods: []string{http.MethodGet},
+		},
+		{
+			path:    "/v0/import",
+			handler: s.importTodos(),
+			methods: []string{http.MethodPost},
+		},
+		{
+			path:    "/v0/calendar.ics",
+			handler: s.getCalendar(),
+			methods: []string{http.MethodGet},
+		},
+		{
+			path:    "/v0/calendar.ics",
+			handler: s.syncCalendar(),
+			methods: []string{http.MethodPost},
+		},
+		{
+			path:    "/v0/lists",
+			handler: s.getLists(),
+			methods: []string{http.MethodGet},
+		},
+		{
+			path:    "/v0/lists",
+			handler: s.addList(),
+			methods: []string{http.MethodPost},
+		},
+		{
+			path:    "/v0/lists/{listId}",
+			handler: s.getListById(),
+			methods: []string{http.MethodGet},
+		},
+		{
+			path:    "/v0/lists/{listId}",
+			handler: s.updateList(),
+			methods: []string{http.MethodPut},
+		},
+		{
+			path:    "/v0/lists/{listId}",
+			handler: s.deleteList(),
+			methods: []string{http.MethodDelete},
+		},
+		{
+			path:    "/v0/lists/{listId}/todos",
+			handler: s.getListTodos(),
+			methods: []string{http.MethodGet},
+		},
+		{
+			path:    "/v0/lists/{listId}/todos",
+			handler: s.addListTodo(),
+			methods: []string{http.MethodPost},
+		},
+	}
+
+	if s.events != nil {
+		routes = append(routes, route{
+			path:       "/v0/events",
+			handler:    s.getEvents(),
+			methods:    []string{http.MethodGet},
+			tokenParam: true,
+		}, route{
+			path:       "/v0/ws",
+			handler:    s.serveSocket(),
+			methods:    []string{http.MethodGet},
+			tokenParam: true,
+		})
+	}
+
+	if s.search != nil {
+		routes = append(routes, route{
+			path:    "/v0/search",
+			handler: s.searchTodos(),
+			methods: []string{http.MethodGet},
+		})
+	}
+
+	if s.webhooks != nil {
+		routes = append(routes, route{
+			path:    "/v0/webhooks",
+			handler: s.getWebhooks(),
+			methods: []string{http.MethodGet},
+		}, route{
+			path:    "/v0/webhooks",
+			handler: s.addWebhook(),
+			methods: []string{http.MethodPost},
+		}, route{
+			path:    "/v0/webhooks/{hookId}",
+			handler: s.getWebhookById(),
+			methods: []string{http.MethodGet},
+		}, route{
+			path:    "/v0/webhooks/{hookId}",
+			handler: s.updateWebhook(),
+			methods: []string{http.MethodPut},
+		}, route{
+			path:    "/v0/webhooks/{hookId}",
+			handler: s.deleteWebhook(),
+			methods: []string{http.MethodDelete},
+		}, route{
+			path:    "/v0/webhooks/{hookId}/deliveries",
+			handler: s.getDeliveries(),
+			methods: []string{http.MethodGet},
+		})
 	}
 
 	for _, route := range routes {
-		s.router.
+		r := s.router.
 			HandleFunc(route.path, route.handler).
 			Methods(route.methods...)
+
+		if route.tokenParam {
+			s.tokenRoutes[r] = true
+		}
 	}
 }
 
@@ -84,6 +299,7 @@ func (s *Server) middlewares() {
 	mws := []mux.MiddlewareFunc{
 		s.mwLogger,
 		s.mwTimer,
+		s.mwAuth,
 	}
 
 	for _, mw := range mws {
@@ -93,14 +309,31 @@ func (s *Server) middlewares() {
 
 func (s *Server) getTodos() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		todos, err := s.service.GetTodos()
+		query, err := parseQuery(r.URL.Query())
 		if err != nil {
-			s.sendFailure(w, ErrFetchTodoFailed, err, http.StatusInternalServerError)
+			s.sendFailure(w, ErrInvalidParameter, err, http.StatusBadRequest)
 			return
 		}
 
-		s.sendSuccess(w, todos)
+		s.sendTodoPage(w, r, query)
+	}
+}
+
+// sendTodoPage runs query and sends the resulting page of todos along with
+// the total count and the links to the other pages.
+func (s *Server) sendTodoPage(w http.ResponseWriter, r *http.Request, query model.Query) {
+	todos, total, err := s.service.QueryTodos(r.Context(), owner(r), query)
+	if err != nil {
+		s.sendError(w, ErrFetchTodoFailed, err)
+		return
+	}
+
+	w.Header().Set(totalCountKey, strconv.Itoa(total))
+	if links := pageLinks(r.URL, query, total); links != "" {
+		w.Header().Set(linkKey, links)
 	}
+
+	s.sendSuccess(w, todos)
 }
 
 func (s *Server) addTodo() http.HandlerFunc {
@@ -113,12 +346,13 @@ func (s *Server) addTodo() http.HandlerFunc {
 			return
 		}
 
-		err = s.service.SaveTodo(&todo)
+		err = s.service.SaveTodo(r.Context(), owner(r), &todo)
 		if err != nil {
-			s.sendFailure(w, ErrSaveFailed, err, http.StatusInternalServerError)
+			s.sendError(w, ErrSaveFailed, err)
 			return
 		}
 
+		w.Header().Set(etagKey, etag(&todo))
 		s.sendSuccess(w, todo)
 	}
 }
@@ -134,20 +368,24 @@ func (s *Server) getTodoById() http.HandlerFunc {
 			return
 		}
 
-		todo, err := s.service.GetTodo(id)
+		todo, err := s.service.GetTodo(r.Context(), owner(r), id)
 		if err != nil {
-			if err == store.ErrTodoNotFound {
-				s.sendFailure(w, "fetch with id "+idString, err, http.StatusNotFound)
-				return
-			}
+			s.sendError(w, "fetch with id "+idString, err)
+			return
+		}
+
+		tag := etag(todo)
+		w.Header().Set(etagKey, tag)
 
-			s.sendFailure(w, ErrUnknownError, err, http.StatusInternalServerError)
+		if noneMatch(r, tag) {
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
 
 		s.sendSuccess(w, todo)
 	}
 }
+
 func (s *Server) updateTodo() http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -159,6 +397,17 @@ func (s *Server) updateTodo() http.HandlerFunc {
 			return
 		}
 
+		version, err := s.ifMatchVersion(r, id)
+		if err != nil {
+			if preconditionFailed(err) {
+				s.sendFailure(w, ErrPreconditionFailed, err, http.StatusPreconditionFailed)
+				return
+			}
+
+			s.sendError(w, "update with id "+idString, err)
+			return
+		}
+
 		var todo model.Todo
 		err = json.NewDecoder(r.Body).Decode(&todo)
 		if err != nil {
@@ -166,16 +415,107 @@ func (s *Server) updateTodo() http.HandlerFunc {
 			return
 		}
 
-		updatedTodo, err := s.service.UpdateTodo(id, &todo)
+		// If-Match takes precedence over a version sent in the body.
+		conditional := r.Header.Get(ifMatchKey) != ""
+		if conditional {
+			todo.Version = version
+		}
+
+		updatedTodo, err := s.service.UpdateTodo(r.Context(), owner(r), id, &todo)
 		if err != nil {
-			s.sendFailure(w, ErrSaveFailed, err, http.StatusInternalServerError)
+			if conditional && errors.Is(err, store.ErrVersionConflict) {
+				s.sendFailure(w, ErrPreconditionFailed, err, http.StatusPreconditionFailed)
+				return
+			}
+
+			s.sendError(w, "update with id "+idString, err)
 			return
 		}
 
+		w.Header().Set(etagKey, etag(updatedTodo))
 		s.sendSuccess(w, updatedTodo)
 	}
 }
 
+func (s *Server) patchTodo() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["id"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		version, err := s.ifMatchVersion(r, id)
+		if err != nil {
+			if preconditionFailed(err) {
+				s.sendFailure(w, ErrPreconditionFailed, err, http.StatusPreconditionFailed)
+				return
+			}
+
+			s.sendError(w, "patch with id "+idString, err)
+			return
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get(contentTypeKey))
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.sendFailure(w, ErrReadBodyFailed, err, http.StatusBadRequest)
+			return
+		}
+
+		var patch model.Patch
+		switch mediaType {
+		case mergePatchJSON:
+			patch = model.MergePatch(body)
+		case jsonPatchJSON:
+			patch = model.JSONPatch(body)
+		default:
+			w.Header().Set(acceptPatchKey, mergePatchJSON+", "+jsonPatchJSON)
+			s.sendFailure(w, ErrUnsupportedPatch, fmt.Errorf("'%s' is not supported", mediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		patchedTodo, err := s.service.PatchTodo(r.Context(), owner(r), id, version, patch)
+		if err != nil {
+			if version != 0 && errors.Is(err, store.ErrVersionConflict) {
+				s.sendFailure(w, ErrPreconditionFailed, err, http.StatusPreconditionFailed)
+				return
+			}
+
+			s.sendError(w, "patch with id "+idString, err)
+			return
+		}
+
+		w.Header().Set(etagKey, etag(patchedTodo))
+		s.sendSuccess(w, patchedTodo)
+	}
+}
+
+func (s *Server) deleteTodo() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["id"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		err = s.service.DeleteTodo(r.Context(), owner(r), id)
+		if err != nil {
+			s.sendError(w, "delete with id "+idString, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
 func (s *Server) sendSuccess(w http.ResponseWriter, payload interface{}) {
 	resp, err := json.Marshal(payload)
 	if err != nil {
@@ -193,6 +533,77 @@ func (s *Server) sendSuccess(w http.ResponseWriter, payload interface{}) {
 	}
 }
 
+// errorStatus maps an error of the service onto the HTTP status reporting it.
+// It is the single place deciding this, handlers only take care of the cases
+// depending on the request, like a conflict the client asked for with
+// If-Match being a failed precondition rather than a conflict.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrTodoNotFound),
+		errors.Is(err, store.ErrListNotFound),
+		errors.Is(err, store.ErrRevisionNotFound),
+		errors.Is(err, webhook.ErrWebhookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrVersionConflict),
+		errors.Is(err, store.ErrListNotEmpty),
+		errors.Is(err, store.ErrTodoReferenced),
+		errors.Is(err, todoapp.ErrBlocked),
+		errors.Is(err, model.ErrPatchTestFailed):
+		return http.StatusConflict
+	case errors.Is(err, model.ErrInvalidTodo),
+		errors.Is(err, model.ErrNilTodo),
+		errors.Is(err, model.ErrInvalidList),
+		errors.Is(err, model.ErrNilList),
+		errors.Is(err, model.ErrInvalidWebhook),
+		errors.Is(err, model.ErrNilWebhook):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, model.ErrInvalidPatch),
+		errors.Is(err, model.ErrInvalidBatch),
+		errors.Is(err, transfer.ErrMalformed),
+		errors.Is(err, ical.ErrMalformed),
+		errors.Is(err, model.ErrInvalidSort),
+		errors.Is(err, model.ErrInvalidCascade):
+		return http.StatusBadRequest
+	case errors.Is(err, store.ErrUnavailable),
+		errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// sendError reports an error of the service with the status chosen by
+// errorStatus, validation errors are sent as problem details.
+func (s *Server) sendError(w http.ResponseWriter, errMsg string, err error) {
+	var verr *model.ValidationError
+	if errors.As(err, &verr) {
+		s.sendValidationFailure(w, verr)
+		return
+	}
+
+	s.sendFailure(w, errMsg, err, errorStatus(err))
+}
+
+// sendValidationFailure reports an invalid todo as 422 problem details, listing
+// every failed field so clients can attach the reasons to their inputs.
+func (s *Server) sendValidationFailure(w http.ResponseWriter, verr *model.ValidationError) {
+	pr := ProblemResponse{
+		Type:          "about:blank",
+		Title:         http.StatusText(http.StatusUnprocessableEntity),
+		Status:        http.StatusUnprocessableEntity,
+		Detail:        verr.Error(),
+		InvalidParams: verr.Fields,
+	}
+
+	w.Header().Set(contentTypeKey, problemJSON)
+	w.WriteHeader(pr.Status)
+
+	err := pr.SendJSON(w)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed sending error: %v", err), http.StatusInternalServerError)
+	}
+}
+
 func (s *Server) sendFailure(w http.ResponseWriter, errMsg string, err error, status int) {
 	fr := FailResponse{
 		Error: fmt.Sprintf("%v: %v", errMsg, err),
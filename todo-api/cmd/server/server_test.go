@@ -2,19 +2,42 @@ package server_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
+	"time"
 	"todoapp"
+	"todoapp/auth"
 	"todoapp/cmd/server"
 	"todoapp/model"
 	"todoapp/store"
+	"todoapp/transfer"
 
 	"github.com/stretchr/testify/assert"
 )
 
+var timestampPattern = regexp.MustCompile(`,"(created_at|updated_at|completed_at|deleted_at|occurred_at|at)":"[^"]*"`)
+
+// withoutTimestamps strips the store managed timestamps from a response body
+// so it can be compared verbatim.
+func withoutTimestamps(body string) string {
+	return timestampPattern.ReplaceAllString(body, "")
+}
+
+func clearTimestamps(todos []*model.Todo) {
+	for _, todo := range todos {
+		todo.CreatedAt = time.Time{}
+		todo.UpdatedAt = time.Time{}
+		todo.CompletedAt = nil
+	}
+}
+
 func TestHandle_GetTodos(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name       string
 		todos      []*model.Todo
@@ -32,7 +55,7 @@ func TestHandle_GetTodos(t *testing.T) {
 			todos: []*model.Todo{
 				{Title: "Hey"},
 			},
-			wantBody:   "[{\"id\":1,\"title\":\"Hey\",\"completed\":false}]",
+			wantBody:   "[{\"id\":1,\"title\":\"Hey\",\"completed\":false,\"version\":1}]",
 			wantStatus: http.StatusOK,
 		},
 		{
@@ -40,7 +63,7 @@ func TestHandle_GetTodos(t *testing.T) {
 			todos: []*model.Todo{
 				{Id: 1, Title: "Hey", Completed: true},
 			},
-			wantBody:   "[{\"id\":1,\"title\":\"Hey\",\"completed\":true}]",
+			wantBody:   "[{\"id\":1,\"title\":\"Hey\",\"completed\":true,\"version\":1}]",
 			wantStatus: http.StatusOK,
 		},
 		{
@@ -48,7 +71,7 @@ func TestHandle_GetTodos(t *testing.T) {
 			todos: []*model.Todo{
 				{Id: 10, Title: "Hey", Completed: true},
 			},
-			wantBody:   "[{\"id\":1,\"title\":\"Hey\",\"completed\":true}]",
+			wantBody:   "[{\"id\":1,\"title\":\"Hey\",\"completed\":true,\"version\":1}]",
 			wantStatus: http.StatusOK,
 		},
 		{
@@ -57,7 +80,7 @@ func TestHandle_GetTodos(t *testing.T) {
 				{Id: 1, Title: "Hey", Completed: true},
 				{Id: 2, Title: "Hello", Completed: false},
 			},
-			wantBody:   "[{\"id\":1,\"title\":\"Hey\",\"completed\":true},{\"id\":2,\"title\":\"Hello\",\"completed\":false}]",
+			wantBody:   "[{\"id\":1,\"title\":\"Hey\",\"completed\":true,\"version\":1},{\"id\":2,\"title\":\"Hello\",\"completed\":false,\"version\":1}]",
 			wantStatus: http.StatusOK,
 		},
 	}
@@ -66,7 +89,7 @@ func TestHandle_GetTodos(t *testing.T) {
 			mockStore := store.NewInMemoryStore()
 
 			for _, todo := range tt.todos {
-				err := mockStore.Add(todo)
+				err := mockStore.Add(ctx, store.Anonymous, todo)
 				assert.NoError(t, err)
 			}
 
@@ -82,7 +105,7 @@ func TestHandle_GetTodos(t *testing.T) {
 			srv.ServeHTTP(w, req)
 
 			assert.Equal(t, tt.wantStatus, w.Code)
-			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantBody, withoutTimestamps(w.Body.String()))
 		})
 	}
 }
@@ -104,19 +127,19 @@ func TestHandler_AddTodo(t *testing.T) {
 			name:       "Add one",
 			addTodos:   []string{"{\"id\":1,\"title\":\"Hey\",\"completed\":false}"},
 			wantStatus: http.StatusOK,
-			wantBodies: []string{"{\"id\":1,\"title\":\"Hey\",\"completed\":false}"},
+			wantBodies: []string{"{\"id\":1,\"title\":\"Hey\",\"completed\":false,\"version\":1}"},
 		},
 		{
 			name:       "Add one with no ID",
 			addTodos:   []string{"{\"title\":\"Hey\",\"completed\":false}"},
 			wantStatus: http.StatusOK,
-			wantBodies: []string{"{\"id\":1,\"title\":\"Hey\",\"completed\":false}"},
+			wantBodies: []string{"{\"id\":1,\"title\":\"Hey\",\"completed\":false,\"version\":1}"},
 		},
 		{
 			name:       "Add one with no id and completed true",
 			addTodos:   []string{"{\"title\":\"Hey\",\"completed\":true}"},
 			wantStatus: http.StatusOK,
-			wantBodies: []string{"{\"id\":1,\"title\":\"Hey\",\"completed\":true}"},
+			wantBodies: []string{"{\"id\":1,\"title\":\"Hey\",\"completed\":true,\"version\":1}"},
 		},
 		{
 			name: "Add two",
@@ -126,8 +149,8 @@ func TestHandler_AddTodo(t *testing.T) {
 			},
 			wantStatus: http.StatusOK,
 			wantBodies: []string{
-				"{\"id\":1,\"title\":\"Hey\",\"completed\":true}",
-				"{\"id\":2,\"title\":\"Hey Again\",\"completed\":false}",
+				"{\"id\":1,\"title\":\"Hey\",\"completed\":true,\"version\":1}",
+				"{\"id\":2,\"title\":\"Hey Again\",\"completed\":false,\"version\":1}",
 			},
 		},
 	}
@@ -145,13 +168,15 @@ func TestHandler_AddTodo(t *testing.T) {
 				srv.ServeHTTP(w, req)
 
 				assert.Equal(t, tt.wantStatus, w.Code)
-				assert.Equal(t, tt.wantBodies[idx], w.Body.String())
+				assert.Equal(t, tt.wantBodies[idx], withoutTimestamps(w.Body.String()))
 			}
 		})
 	}
 }
 
 func TestHandler_GetTodoById(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name       string
 		todos      []*model.Todo
@@ -184,7 +209,7 @@ func TestHandler_GetTodoById(t *testing.T) {
 			},
 			fetchId:    "1",
 			wantStatus: http.StatusOK,
-			wantBody:   "{\"id\":1,\"title\":\"Hey\",\"completed\":false}",
+			wantBody:   "{\"id\":1,\"title\":\"Hey\",\"completed\":false,\"version\":1}",
 		},
 		{
 			name: "Fetch first of three",
@@ -195,7 +220,7 @@ func TestHandler_GetTodoById(t *testing.T) {
 			},
 			fetchId:    "1",
 			wantStatus: http.StatusOK,
-			wantBody:   "{\"id\":1,\"title\":\"Hey\",\"completed\":true}",
+			wantBody:   "{\"id\":1,\"title\":\"Hey\",\"completed\":true,\"version\":1}",
 		},
 		{
 			name: "Fetch second of three",
@@ -206,7 +231,7 @@ func TestHandler_GetTodoById(t *testing.T) {
 			},
 			fetchId:    "2",
 			wantStatus: http.StatusOK,
-			wantBody:   "{\"id\":2,\"title\":\"Hey Again\",\"completed\":false}",
+			wantBody:   "{\"id\":2,\"title\":\"Hey Again\",\"completed\":false,\"version\":1}",
 		},
 		{
 			name: "Fetch third of three",
@@ -217,7 +242,7 @@ func TestHandler_GetTodoById(t *testing.T) {
 			},
 			fetchId:    "3",
 			wantStatus: http.StatusOK,
-			wantBody:   "{\"id\":3,\"title\":\"Good Bye\",\"completed\":false}",
+			wantBody:   "{\"id\":3,\"title\":\"Good Bye\",\"completed\":false,\"version\":1}",
 		},
 	}
 	for _, tt := range tests {
@@ -225,7 +250,7 @@ func TestHandler_GetTodoById(t *testing.T) {
 			mockStore := store.NewInMemoryStore()
 
 			for _, todo := range tt.todos {
-				err := mockStore.Add(todo)
+				err := mockStore.Add(ctx, store.Anonymous, todo)
 				assert.NoError(t, err)
 			}
 
@@ -242,12 +267,14 @@ func TestHandler_GetTodoById(t *testing.T) {
 			srv.ServeHTTP(w, req)
 
 			assert.Equal(t, tt.wantStatus, w.Code)
-			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantBody, withoutTimestamps(w.Body.String()))
 		})
 	}
 }
 
 func TestHandle_UpdateTodo(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name       string
 		todos      []*model.Todo
@@ -274,9 +301,9 @@ func TestHandle_UpdateTodo(t *testing.T) {
 			updateTodo: "{\"id\":1,\"title\":\"Updated\",\"completed\":false}",
 			updateId:   "1",
 			wantStatus: http.StatusOK,
-			wantBody:   "{\"id\":1,\"title\":\"Updated\",\"completed\":false}",
+			wantBody:   "{\"id\":1,\"title\":\"Updated\",\"completed\":false,\"version\":2}",
 			wantTodos: []*model.Todo{
-				{Id: 1, Title: "Updated", Completed: false},
+				{Id: 1, Title: "Updated", Completed: false, Version: 2},
 			},
 		},
 		{
@@ -289,11 +316,11 @@ func TestHandle_UpdateTodo(t *testing.T) {
 			updateTodo: "{\"id\":1,\"title\":\"Updated\",\"completed\":true}",
 			updateId:   "1",
 			wantStatus: http.StatusOK,
-			wantBody:   "{\"id\":1,\"title\":\"Updated\",\"completed\":true}",
+			wantBody:   "{\"id\":1,\"title\":\"Updated\",\"completed\":true,\"version\":2}",
 			wantTodos: []*model.Todo{
-				{Id: 1, Title: "Updated", Completed: true},
-				{Id: 2, Title: "Second", Completed: false},
-				{Id: 3, Title: "Third", Completed: false},
+				{Id: 1, Title: "Updated", Completed: true, Version: 2},
+				{Id: 2, Title: "Second", Completed: false, Version: 1},
+				{Id: 3, Title: "Third", Completed: false, Version: 1},
 			},
 		},
 		{
@@ -306,11 +333,11 @@ func TestHandle_UpdateTodo(t *testing.T) {
 			updateTodo: "{\"id\":2,\"title\":\"Updated\",\"completed\":true}",
 			updateId:   "2",
 			wantStatus: http.StatusOK,
-			wantBody:   "{\"id\":2,\"title\":\"Updated\",\"completed\":true}",
+			wantBody:   "{\"id\":2,\"title\":\"Updated\",\"completed\":true,\"version\":2}",
 			wantTodos: []*model.Todo{
-				{Id: 1, Title: "First", Completed: false},
-				{Id: 2, Title: "Updated", Completed: true},
-				{Id: 3, Title: "Third", Completed: false},
+				{Id: 1, Title: "First", Completed: false, Version: 1},
+				{Id: 2, Title: "Updated", Completed: true, Version: 2},
+				{Id: 3, Title: "Third", Completed: false, Version: 1},
 			},
 		},
 		{
@@ -323,11 +350,11 @@ func TestHandle_UpdateTodo(t *testing.T) {
 			updateTodo: "{\"id\":3,\"title\":\"Updated\",\"completed\":true}",
 			updateId:   "3",
 			wantStatus: http.StatusOK,
-			wantBody:   "{\"id\":3,\"title\":\"Updated\",\"completed\":true}",
+			wantBody:   "{\"id\":3,\"title\":\"Updated\",\"completed\":true,\"version\":2}",
 			wantTodos: []*model.Todo{
-				{Id: 1, Title: "First", Completed: false},
-				{Id: 2, Title: "Second", Completed: false},
-				{Id: 3, Title: "Updated", Completed: true},
+				{Id: 1, Title: "First", Completed: false, Version: 1},
+				{Id: 2, Title: "Second", Completed: false, Version: 1},
+				{Id: 3, Title: "Updated", Completed: true, Version: 2},
 			},
 		},
 		{
@@ -340,11 +367,11 @@ func TestHandle_UpdateTodo(t *testing.T) {
 			updateTodo: "{\"id\":1,\"title\":\"Updated\",\"completed\":true}",
 			updateId:   "3",
 			wantStatus: http.StatusOK,
-			wantBody:   "{\"id\":3,\"title\":\"Updated\",\"completed\":true}",
+			wantBody:   "{\"id\":3,\"title\":\"Updated\",\"completed\":true,\"version\":2}",
 			wantTodos: []*model.Todo{
-				{Id: 1, Title: "First", Completed: false},
-				{Id: 2, Title: "Second", Completed: false},
-				{Id: 3, Title: "Updated", Completed: true},
+				{Id: 1, Title: "First", Completed: false, Version: 1},
+				{Id: 2, Title: "Second", Completed: false, Version: 1},
+				{Id: 3, Title: "Updated", Completed: true, Version: 2},
 			},
 		},
 	}
@@ -353,7 +380,7 @@ func TestHandle_UpdateTodo(t *testing.T) {
 			mockStore := store.NewInMemoryStore()
 
 			for _, todo := range tt.todos {
-				err := mockStore.Add(todo)
+				err := mockStore.Add(ctx, store.Anonymous, todo)
 				assert.NoError(t, err)
 			}
 
@@ -366,10 +393,11 @@ func TestHandle_UpdateTodo(t *testing.T) {
 			srv.ServeHTTP(w, req)
 
 			assert.Equal(t, tt.wantStatus, w.Code)
-			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantBody, withoutTimestamps(w.Body.String()))
 
-			todos, _ := mockStore.GetAll()
+			todos, _ := mockStore.GetAll(ctx, store.Anonymous)
 
+			clearTimestamps(todos)
 			model.SortById(todos)
 			model.SortById(tt.wantTodos)
 
@@ -379,3 +407,1153 @@ func TestHandle_UpdateTodo(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_DeleteTodo(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		todos      []*model.Todo
+		deleteId   string
+		wantStatus int
+		wantBody   string
+		wantTodos  []*model.Todo
+	}{
+		{
+			name: "Delete non-existent",
+			todos: []*model.Todo{
+				{Title: "Hey"},
+			},
+			deleteId:   "99",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"delete with id 99: todo not found\"}",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "Hey", Completed: false, Version: 1},
+			},
+		},
+		{
+			name: "Delete non-int",
+			todos: []*model.Todo{
+				{Title: "Hey"},
+			},
+			deleteId:   "asd",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: 'asd' cannot be converted to int\"}",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "Hey", Completed: false, Version: 1},
+			},
+		},
+		{
+			name: "Delete one",
+			todos: []*model.Todo{
+				{Title: "Hey"},
+			},
+			deleteId:   "1",
+			wantStatus: http.StatusNoContent,
+			wantBody:   "",
+			wantTodos:  []*model.Todo{},
+		},
+		{
+			name: "Delete second of three",
+			todos: []*model.Todo{
+				{Title: "First"},
+				{Title: "Second"},
+				{Title: "Third"},
+			},
+			deleteId:   "2",
+			wantStatus: http.StatusNoContent,
+			wantBody:   "",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Completed: false, Version: 1},
+				{Id: 3, Title: "Third", Completed: false, Version: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := store.NewInMemoryStore()
+
+			for _, todo := range tt.todos {
+				err := mockStore.Add(ctx, store.Anonymous, todo)
+				assert.NoError(t, err)
+			}
+
+			srv := server.New(todoapp.New(mockStore))
+			url := fmt.Sprintf("/v0/todos/%s", tt.deleteId)
+			req, err := http.NewRequest(http.MethodDelete, url, nil)
+			assert.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, withoutTimestamps(w.Body.String()))
+
+			todos, _ := mockStore.GetAll(ctx, store.Anonymous)
+
+			clearTimestamps(todos)
+			model.SortById(todos)
+
+			if assert.Equal(t, len(tt.wantTodos), len(todos)) {
+				for idx, todo := range todos {
+					assert.Equal(t, tt.wantTodos[idx], todo)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_PatchTodo(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		todos       []*model.Todo
+		patchId     string
+		contentType string
+		ifMatch     string
+		patch       string
+		wantStatus  int
+		wantBody    string
+		wantTodos   []*model.Todo
+	}{
+		{
+			name: "Merge patch",
+			todos: []*model.Todo{
+				{Title: "First"},
+				{Title: "Second"},
+			},
+			patchId:     "2",
+			contentType: "application/merge-patch+json",
+			patch:       "{\"completed\":true}",
+			wantStatus:  http.StatusOK,
+			wantBody:    "{\"id\":2,\"title\":\"Second\",\"completed\":true,\"version\":2}",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Completed: false, Version: 1},
+				{Id: 2, Title: "Second", Completed: true, Version: 2},
+			},
+		},
+		{
+			name: "JSON patch",
+			todos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId:     "1",
+			contentType: "application/json-patch+json; charset=utf-8",
+			patch:       "[{\"op\":\"replace\",\"path\":\"/title\",\"value\":\"Renamed\"}]",
+			wantStatus:  http.StatusOK,
+			wantBody:    "{\"id\":1,\"title\":\"Renamed\",\"completed\":false,\"version\":2}",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "Renamed", Completed: false, Version: 2},
+			},
+		},
+		{
+			name: "Unsupported content type",
+			todos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId:     "1",
+			contentType: "application/json",
+			patch:       "{\"completed\":true}",
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantBody:    "{\"error\":\"unsupported patch format: 'application/json' is not supported\"}",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Completed: false, Version: 1},
+			},
+		},
+		{
+			name: "Patch non-existent",
+			todos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId:     "99",
+			contentType: "application/merge-patch+json",
+			patch:       "{\"completed\":true}",
+			wantStatus:  http.StatusNotFound,
+			wantBody:    "{\"error\":\"patch with id 99: todo not found\"}",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Completed: false, Version: 1},
+			},
+		},
+		{
+			name: "Malformed patch",
+			todos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId:     "1",
+			contentType: "application/json-patch+json",
+			patch:       "[{\"op\":\"remove\",\"path\":\"/missing\"}]",
+			wantStatus:  http.StatusBadRequest,
+			wantBody:    "{\"error\":\"patch with id 1: operation 0 (remove): invalid patch: \\\"missing\\\" does not exist\"}",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Completed: false, Version: 1},
+			},
+		},
+		{
+			name: "Failed test operation",
+			todos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId:     "1",
+			contentType: "application/json-patch+json",
+			patch:       "[{\"op\":\"test\",\"path\":\"/title\",\"value\":\"Other\"},{\"op\":\"replace\",\"path\":\"/completed\",\"value\":true}]",
+			wantStatus:  http.StatusConflict,
+			wantBody:    "{\"error\":\"patch with id 1: operation 0 (test): patch test failed: value at \\\"/title\\\" differs\"}",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Completed: false, Version: 1},
+			},
+		},
+		{
+			name: "Merge patch with current If-Match",
+			todos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId:     "1",
+			contentType: "application/merge-patch+json",
+			ifMatch:     "\"1\"",
+			patch:       "{\"completed\":true}",
+			wantStatus:  http.StatusOK,
+			wantBody:    "{\"id\":1,\"title\":\"First\",\"completed\":true,\"version\":2}",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Completed: true, Version: 2},
+			},
+		},
+		{
+			name: "JSON patch with stale If-Match",
+			todos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId:     "1",
+			contentType: "application/json-patch+json",
+			ifMatch:     "\"3\"",
+			patch:       "[{\"op\":\"replace\",\"path\":\"/title\",\"value\":\"Renamed\"}]",
+			wantStatus:  http.StatusPreconditionFailed,
+			wantBody:    "{\"error\":\"precondition failed: todo version conflict\"}",
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Completed: false, Version: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := store.NewInMemoryStore()
+
+			for _, todo := range tt.todos {
+				err := mockStore.Add(ctx, store.Anonymous, todo)
+				assert.NoError(t, err)
+			}
+
+			srv := server.New(todoapp.New(mockStore))
+			url := fmt.Sprintf("/v0/todos/%s", tt.patchId)
+			req, err := http.NewRequest(http.MethodPatch, url, bytes.NewBuffer([]byte(tt.patch)))
+			assert.NoError(t, err)
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, withoutTimestamps(w.Body.String()))
+
+			todos, _ := mockStore.GetAll(ctx, store.Anonymous)
+
+			clearTimestamps(todos)
+			model.SortById(todos)
+
+			if assert.Equal(t, len(tt.wantTodos), len(todos)) {
+				for idx, todo := range todos {
+					assert.Equal(t, tt.wantTodos[idx], todo)
+				}
+			}
+		})
+	}
+}
+
+func TestHandle_QueryTodos(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBody   string
+		wantTotal  string
+		wantLink   string
+	}{
+		{
+			name:       "no parameters",
+			query:      "",
+			wantStatus: http.StatusOK,
+			wantBody:   "[{\"id\":1,\"title\":\"Buy milk\",\"completed\":false,\"version\":1},{\"id\":2,\"title\":\"Call mum\",\"completed\":true,\"version\":1},{\"id\":3,\"title\":\"Buy bread\",\"completed\":false,\"version\":1}]",
+			wantTotal:  "3",
+		},
+		{
+			name:       "filter completed",
+			query:      "?completed=true",
+			wantStatus: http.StatusOK,
+			wantBody:   "[{\"id\":2,\"title\":\"Call mum\",\"completed\":true,\"version\":1}]",
+			wantTotal:  "1",
+		},
+		{
+			name:       "search sorted by title",
+			query:      "?q=buy&sort=title",
+			wantStatus: http.StatusOK,
+			wantBody:   "[{\"id\":3,\"title\":\"Buy bread\",\"completed\":false,\"version\":1},{\"id\":1,\"title\":\"Buy milk\",\"completed\":false,\"version\":1}]",
+			wantTotal:  "2",
+		},
+		{
+			name:       "first page",
+			query:      "?sort=-id&limit=1",
+			wantStatus: http.StatusOK,
+			wantBody:   "[{\"id\":3,\"title\":\"Buy bread\",\"completed\":false,\"version\":1}]",
+			wantTotal:  "3",
+			wantLink: "</v0/todos?limit=1&offset=0&sort=-id>; rel=\"first\", " +
+				"</v0/todos?limit=1&offset=1&sort=-id>; rel=\"next\", " +
+				"</v0/todos?limit=1&offset=2&sort=-id>; rel=\"last\"",
+		},
+		{
+			name:       "middle page",
+			query:      "?limit=1&offset=1",
+			wantStatus: http.StatusOK,
+			wantBody:   "[{\"id\":2,\"title\":\"Call mum\",\"completed\":true,\"version\":1}]",
+			wantTotal:  "3",
+			wantLink: "</v0/todos?limit=1&offset=0>; rel=\"first\", " +
+				"</v0/todos?limit=1&offset=0>; rel=\"prev\", " +
+				"</v0/todos?limit=1&offset=2>; rel=\"next\", " +
+				"</v0/todos?limit=1&offset=2>; rel=\"last\"",
+		},
+		{
+			name:       "invalid completed",
+			query:      "?completed=maybe",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: 'maybe' is not a valid value for completed\"}",
+		},
+		{
+			name:       "invalid sort",
+			query:      "?sort=colour",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: invalid sort: unknown field 'colour'\"}",
+		},
+		{
+			name:       "invalid limit",
+			query:      "?limit=0",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: limit must be between 1 and 1000, got '0'\"}",
+		},
+		{
+			name:       "invalid offset",
+			query:      "?offset=-1",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: offset must be a non-negative integer, got '-1'\"}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := store.NewInMemoryStore()
+
+			for _, todo := range []*model.Todo{
+				{Title: "Buy milk"},
+				{Title: "Call mum", Completed: true},
+				{Title: "Buy bread"},
+			} {
+				err := mockStore.Add(ctx, store.Anonymous, todo)
+				assert.NoError(t, err)
+			}
+
+			srv := server.New(todoapp.New(mockStore))
+
+			req, err := http.NewRequest(http.MethodGet, "/v0/todos"+tt.query, nil)
+			if err != nil {
+				t.Errorf("failed constructing get request: %v", err)
+				return
+			}
+
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, withoutTimestamps(w.Body.String()))
+			assert.Equal(t, tt.wantTotal, w.Header().Get("X-Total-Count"))
+			assert.Equal(t, tt.wantLink, w.Header().Get("Link"))
+		})
+	}
+}
+
+func TestHandler_ETag(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		method      string
+		headers     map[string]string
+		body        string
+		wantStatus  int
+		wantETag    string
+		wantBody    string
+		wantVersion int
+	}{
+		{
+			name:        "Get sets ETag",
+			method:      http.MethodGet,
+			wantStatus:  http.StatusOK,
+			wantETag:    "\"1\"",
+			wantBody:    "{\"id\":1,\"title\":\"First\",\"completed\":false,\"version\":1}",
+			wantVersion: 1,
+		},
+		{
+			name:        "Get not modified",
+			method:      http.MethodGet,
+			headers:     map[string]string{"If-None-Match": "\"7\", W/\"1\""},
+			wantStatus:  http.StatusNotModified,
+			wantETag:    "\"1\"",
+			wantBody:    "",
+			wantVersion: 1,
+		},
+		{
+			name:        "Get modified",
+			method:      http.MethodGet,
+			headers:     map[string]string{"If-None-Match": "\"7\""},
+			wantStatus:  http.StatusOK,
+			wantETag:    "\"1\"",
+			wantBody:    "{\"id\":1,\"title\":\"First\",\"completed\":false,\"version\":1}",
+			wantVersion: 1,
+		},
+		{
+			name:        "Put with current If-Match",
+			method:      http.MethodPut,
+			headers:     map[string]string{"If-Match": "\"1\""},
+			body:        "{\"title\":\"Updated\",\"completed\":true,\"version\":9}",
+			wantStatus:  http.StatusOK,
+			wantETag:    "\"2\"",
+			wantBody:    "{\"id\":1,\"title\":\"Updated\",\"completed\":true,\"version\":2}",
+			wantVersion: 2,
+		},
+		{
+			name:        "Put with any If-Match",
+			method:      http.MethodPut,
+			headers:     map[string]string{"If-Match": "*"},
+			body:        "{\"title\":\"Updated\",\"completed\":true}",
+			wantStatus:  http.StatusOK,
+			wantETag:    "\"2\"",
+			wantBody:    "{\"id\":1,\"title\":\"Updated\",\"completed\":true,\"version\":2}",
+			wantVersion: 2,
+		},
+		{
+			name:        "Put with stale If-Match",
+			method:      http.MethodPut,
+			headers:     map[string]string{"If-Match": "\"5\""},
+			body:        "{\"title\":\"Updated\",\"completed\":true}",
+			wantStatus:  http.StatusPreconditionFailed,
+			wantBody:    "{\"error\":\"precondition failed: todo version conflict\"}",
+			wantVersion: 1,
+		},
+		{
+			name:        "Put with weak If-Match",
+			method:      http.MethodPut,
+			headers:     map[string]string{"If-Match": "W/\"1\""},
+			body:        "{\"title\":\"Updated\",\"completed\":true}",
+			wantStatus:  http.StatusPreconditionFailed,
+			wantBody:    "{\"error\":\"precondition failed: If-Match must be '*' or a list of strong entity tags\"}",
+			wantVersion: 1,
+		},
+		{
+			name:        "Put with stale version in body",
+			method:      http.MethodPut,
+			body:        "{\"title\":\"Updated\",\"completed\":true,\"version\":5}",
+			wantStatus:  http.StatusConflict,
+			wantBody:    "{\"error\":\"update with id 1: todo version conflict\"}",
+			wantVersion: 1,
+		},
+		{
+			name:        "Put with listed If-Match",
+			method:      http.MethodPut,
+			headers:     map[string]string{"If-Match": "\"7\", W/\"8\", \"1\""},
+			body:        "{\"title\":\"Updated\"}",
+			wantStatus:  http.StatusOK,
+			wantETag:    "\"2\"",
+			wantBody:    "{\"id\":1,\"title\":\"Updated\",\"completed\":false,\"version\":2}",
+			wantVersion: 2,
+		},
+		{
+			name:        "Put with unlisted If-Match",
+			method:      http.MethodPut,
+			headers:     map[string]string{"If-Match": "\"7\", \"8\""},
+			body:        "{\"title\":\"Updated\"}",
+			wantStatus:  http.StatusPreconditionFailed,
+			wantBody:    "{\"error\":\"precondition failed: todo version conflict: version 1 is not listed\"}",
+			wantVersion: 1,
+		},
+		{
+			name:        "Patch with current If-Match",
+			method:      http.MethodPatch,
+			headers:     map[string]string{"If-Match": "\"1\"", "Content-Type": "application/merge-patch+json"},
+			body:        "{\"completed\":true}",
+			wantStatus:  http.StatusOK,
+			wantETag:    "\"2\"",
+			wantBody:    "{\"id\":1,\"title\":\"First\",\"completed\":true,\"version\":2}",
+			wantVersion: 2,
+		},
+		{
+			name:        "Patch with stale If-Match",
+			method:      http.MethodPatch,
+			headers:     map[string]string{"If-Match": "\"2\"", "Content-Type": "application/merge-patch+json"},
+			body:        "{\"completed\":true}",
+			wantStatus:  http.StatusPreconditionFailed,
+			wantBody:    "{\"error\":\"precondition failed: todo version conflict\"}",
+			wantVersion: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := store.NewInMemoryStore()
+
+			err := mockStore.Add(ctx, store.Anonymous, &model.Todo{Title: "First"})
+			assert.NoError(t, err)
+
+			srv := server.New(todoapp.New(mockStore))
+			req, err := http.NewRequest(tt.method, "/v0/todos/1", bytes.NewBuffer([]byte(tt.body)))
+			assert.NoError(t, err)
+
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantETag, w.Header().Get("ETag"))
+			assert.Equal(t, tt.wantBody, withoutTimestamps(w.Body.String()))
+
+			stored, err := mockStore.GetById(ctx, store.Anonymous, 1)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantVersion, stored.Version)
+			}
+		})
+	}
+}
+
+func TestHandler_TodoDetails(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	body := "{\"title\":\"Plan trip\",\"description\":\"Book trains\",\"due\":\"2019-05-03T09:30:00+02:00\"," +
+		"\"priority\":2,\"tags\":[\"travel\"],\"created_at\":\"1999-01-01T00:00:00Z\"}"
+
+	req, err := http.NewRequest(http.MethodPost, "/v0/todos", bytes.NewBuffer([]byte(body)))
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "{\"id\":1,\"title\":\"Plan trip\",\"completed\":false,\"description\":\"Book trains\","+
+		"\"due\":\"2019-05-03T07:30:00Z\",\"priority\":2,\"tags\":[\"travel\"],\"version\":1}", withoutTimestamps(w.Body.String()))
+	assert.NotContains(t, w.Body.String(), "1999")
+	assert.Contains(t, w.Body.String(), "\"created_at\":\"")
+
+	req, err = http.NewRequest(http.MethodPut, "/v0/todos/1", bytes.NewBuffer([]byte("{\"title\":\"Plan trip\",\"completed\":true}")))
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "{\"id\":1,\"title\":\"Plan trip\",\"completed\":true,\"version\":2}", withoutTimestamps(w.Body.String()))
+	assert.Contains(t, w.Body.String(), "\"completed_at\":\"")
+}
+
+func TestHandler_ValidationErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{
+			name:   "Add without title",
+			method: http.MethodPost,
+			path:   "/v0/todos",
+			body:   "{\"title\":\"\",\"priority\":12}",
+			want: "{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422," +
+				"\"detail\":\"invalid todo: title must not be empty; priority must be between 0 and 9\"," +
+				"\"invalid-params\":[{\"name\":\"title\",\"rule\":\"required\",\"reason\":\"must not be empty\"}," +
+				"{\"name\":\"priority\",\"rule\":\"range\",\"reason\":\"must be between 0 and 9\"}]}",
+		},
+		{
+			name:   "Update with duplicate tag",
+			method: http.MethodPut,
+			path:   "/v0/todos/1",
+			body:   "{\"title\":\"Say hello\",\"tags\":[\"a\",\"a\"]}",
+			want: "{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422," +
+				"\"detail\":\"invalid todo: tags must be unique\"," +
+				"\"invalid-params\":[{\"name\":\"tags[1]\",\"rule\":\"unique\",\"reason\":\"must not repeat an earlier tag\"}]}",
+		},
+		{
+			name:        "Patch clearing the title",
+			method:      http.MethodPatch,
+			path:        "/v0/todos/1",
+			contentType: "application/merge-patch+json",
+			body:        "{\"title\":\"\"}",
+			want: "{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422," +
+				"\"detail\":\"invalid todo: title must not be empty\"," +
+				"\"invalid-params\":[{\"name\":\"title\",\"rule\":\"required\",\"reason\":\"must not be empty\"}]}",
+		},
+		{
+			name:   "Add with unsupported recurrence",
+			method: http.MethodPost,
+			path:   "/v0/todos",
+			body:   "{\"title\":\"Say hello\",\"recurrence\":\"FREQ=HOURLY\"}",
+			want: "{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422," +
+				"\"detail\":\"invalid todo: recurrence must be a supported RRULE; due must be set for recurring todos\"," +
+				"\"invalid-params\":[{\"name\":\"recurrence\",\"rule\":\"format\"," +
+				"\"reason\":\"FREQ 'HOURLY' is not one of DAILY, WEEKLY or MONTHLY\"}," +
+				"{\"name\":\"due\",\"rule\":\"required\",\"reason\":\"must be set for recurring todos\"}]}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := todoapp.New(store.NewInMemoryStore())
+			assert.NoError(t, service.SaveTodo(ctx, store.Anonymous, &model.Todo{Title: "Say hello"}))
+
+			srv := server.New(service)
+
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBuffer([]byte(tt.body)))
+			assert.NoError(t, err)
+
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+// failingService fails every call with err.
+type failingService struct {
+	err error
+}
+
+func (fs failingService) GetTodo(context.Context, int, int) (*model.Todo, error) { return nil, fs.err }
+func (fs failingService) GetTodos(context.Context, int) ([]*model.Todo, error)   { return nil, fs.err }
+func (fs failingService) SaveTodo(context.Context, int, *model.Todo) error       { return fs.err }
+func (fs failingService) DeleteTodo(context.Context, int, int) error             { return fs.err }
+func (fs failingService) UpdateTodo(context.Context, int, int, *model.Todo) (*model.Todo, error) {
+	return nil, fs.err
+}
+func (fs failingService) PatchTodo(context.Context, int, int, int, model.Patch) (*model.Todo, error) {
+	return nil, fs.err
+}
+func (fs failingService) QueryTodos(context.Context, int, model.Query) ([]*model.Todo, int, error) {
+	return nil, 0, fs.err
+}
+func (fs failingService) GetTodoTree(context.Context, int, int) (*model.Tree, error) {
+	return nil, fs.err
+}
+func (fs failingService) GetBlockers(context.Context, int, int) ([]*model.Todo, error) {
+	return nil, fs.err
+}
+func (fs failingService) GetTrash(context.Context, int) ([]*model.Todo, error) { return nil, fs.err }
+func (fs failingService) RestoreTodo(context.Context, int, int) (*model.Todo, error) {
+	return nil, fs.err
+}
+func (fs failingService) GetHistory(context.Context, int, int) ([]*model.Revision, error) {
+	return nil, fs.err
+}
+func (fs failingService) RevertTodo(context.Context, int, int, int) (*model.Todo, error) {
+	return nil, fs.err
+}
+func (fs failingService) BatchTodos(context.Context, int, []model.Operation) ([]*model.Todo, error) {
+	return nil, fs.err
+}
+func (fs failingService) ExportTodos(context.Context, int, transfer.Writer) error { return fs.err }
+func (fs failingService) ImportTodos(context.Context, int, transfer.Reader, bool) (*transfer.Report, error) {
+	return nil, fs.err
+}
+func (fs failingService) GetList(context.Context, int, int) (*model.List, error)    { return nil, fs.err }
+func (fs failingService) GetLists(context.Context, int) ([]*model.List, error)      { return nil, fs.err }
+func (fs failingService) SaveList(context.Context, int, *model.List) error          { return fs.err }
+func (fs failingService) DeleteList(context.Context, int, int, model.Cascade) error { return fs.err }
+func (fs failingService) UpdateList(context.Context, int, int, *model.List) (*model.List, error) {
+	return nil, fs.err
+}
+
+func TestHandler_ErrorStatus(t *testing.T) {
+	requests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/v0/todos", ""},
+		{http.MethodPost, "/v0/todos", "{\"title\":\"Say hello\"}"},
+		{http.MethodGet, "/v0/todos/1", ""},
+		{http.MethodPut, "/v0/todos/1", "{\"title\":\"Say hello\"}"},
+		{http.MethodPatch, "/v0/todos/1", "{\"completed\":true}"},
+		{http.MethodDelete, "/v0/todos/1", ""},
+		{http.MethodGet, "/v0/todos/1/tree", ""},
+		{http.MethodGet, "/v0/todos/1/blockers", ""},
+		{http.MethodPost, "/v0/todos/1/restore", ""},
+		{http.MethodGet, "/v0/todos/1/history", ""},
+		{http.MethodPost, "/v0/todos:batch", "{\"operations\":[{\"op\":\"delete\",\"id\":1}]}"},
+		{http.MethodPost, "/v0/todos/1/history/1/revert", ""},
+		{http.MethodGet, "/v0/trash", ""},
+		{http.MethodGet, "/v0/export", ""},
+		{http.MethodPost, "/v0/import", "[]"},
+		{http.MethodGet, "/v0/calendar.ics", ""},
+		{http.MethodGet, "/v0/lists", ""},
+		{http.MethodPost, "/v0/lists", "{\"name\":\"Groceries\"}"},
+		{http.MethodGet, "/v0/lists/1", ""},
+		{http.MethodPut, "/v0/lists/1", "{\"name\":\"Groceries\"}"},
+		{http.MethodDelete, "/v0/lists/1", ""},
+		{http.MethodGet, "/v0/lists/1/todos", ""},
+		{http.MethodPost, "/v0/lists/1/todos", "{\"title\":\"Say hello\"}"},
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"Not found", store.ErrTodoNotFound, http.StatusNotFound},
+		{"Revision not found", store.ErrRevisionNotFound, http.StatusNotFound},
+		{"Wrapped not found", fmt.Errorf("get todo: %w", store.ErrTodoNotFound), http.StatusNotFound},
+		{"Version conflict", store.ErrVersionConflict, http.StatusConflict},
+		{"Still referenced", store.ErrTodoReferenced, http.StatusConflict},
+		{"Blocked", todoapp.ErrBlocked, http.StatusConflict},
+		{"Invalid todo", model.ErrEmptyTitle, http.StatusUnprocessableEntity},
+		{"Invalid sort", fmt.Errorf("%w: unknown field 'colour'", model.ErrInvalidSort), http.StatusBadRequest},
+		{"Store unavailable", fmt.Errorf("select todo: %w: database is locked", store.ErrUnavailable), http.StatusServiceUnavailable},
+		{"Deadline exceeded", fmt.Errorf("select todo: %w", context.DeadlineExceeded), http.StatusServiceUnavailable},
+		{"Unknown error", fmt.Errorf("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		srv := server.New(failingService{err: tt.err})
+
+		for _, r := range requests {
+			t.Run(tt.name+" "+r.method+" "+r.path, func(t *testing.T) {
+				req, err := http.NewRequest(r.method, r.path, bytes.NewBuffer([]byte(r.body)))
+				assert.NoError(t, err)
+
+				req.Header.Set("Content-Type", "application/merge-patch+json")
+
+				w := httptest.NewRecorder()
+				srv.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.wantStatus, w.Code)
+			})
+		}
+	}
+}
+
+func TestHandler_UpdateMissingTodo(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	req, err := http.NewRequest(http.MethodPut, "/v0/todos/99", bytes.NewBuffer([]byte("{\"title\":\"Say hello\"}")))
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "{\"error\":\"update with id 99: todo not found\"}", w.Body.String())
+}
+
+func TestHandler_Auth(t *testing.T) {
+	users, err := auth.NewUsers([]auth.User{
+		{Id: 1, Name: "alice", TokenHash: auth.HashToken("alice-token")},
+		{Id: 2, Name: "bob", TokenHash: auth.HashToken("bob-token")},
+	})
+	if err != nil {
+		t.Fatalf("NewUsers() failed: %v", err)
+	}
+
+	srv := server.New(todoapp.New(store.NewInMemoryStore()), server.WithAuthenticator(users))
+
+	send := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, bytes.NewBuffer([]byte(body)))
+		assert.NoError(t, err)
+
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := send(http.MethodPost, "/v0/todos", "Bearer alice-token", "{\"title\":\"Alice's todo\"}")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		wantStatus    int
+		wantBody      string
+	}{
+		{
+			name:       "Missing token",
+			method:     http.MethodGet,
+			path:       "/v0/todos",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "{\"error\":\"unauthorized: invalid token\"}",
+		},
+		{
+			name:          "Other scheme",
+			method:        http.MethodGet,
+			path:          "/v0/todos",
+			authorization: "Basic YWxpY2U6c2VjcmV0",
+			wantStatus:    http.StatusUnauthorized,
+			wantBody:      "{\"error\":\"unauthorized: invalid token\"}",
+		},
+		{
+			name:          "Unknown token",
+			method:        http.MethodGet,
+			path:          "/v0/todos",
+			authorization: "Bearer mallory-token",
+			wantStatus:    http.StatusUnauthorized,
+			wantBody:      "{\"error\":\"unauthorized: invalid token\"}",
+		},
+		{
+			name:       "Token parameter outside of streams",
+			method:     http.MethodGet,
+			path:       "/v0/todos?access_token=alice-token",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "{\"error\":\"unauthorized: invalid token\"}",
+		},
+		{
+			name:          "Owner lists own todos",
+			method:        http.MethodGet,
+			path:          "/v0/todos",
+			authorization: "Bearer alice-token",
+			wantStatus:    http.StatusOK,
+			wantBody:      "[{\"id\":1,\"title\":\"Alice's todo\",\"completed\":false,\"version\":1}]",
+		},
+		{
+			name:          "Other user lists nothing",
+			method:        http.MethodGet,
+			path:          "/v0/todos",
+			authorization: "bearer bob-token",
+			wantStatus:    http.StatusOK,
+			wantBody:      "[]",
+		},
+		{
+			name:          "Other user cannot fetch",
+			method:        http.MethodGet,
+			path:          "/v0/todos/1",
+			authorization: "Bearer bob-token",
+			wantStatus:    http.StatusNotFound,
+			wantBody:      "{\"error\":\"fetch with id 1: todo not found\"}",
+		},
+		{
+			name:          "Other user cannot delete",
+			method:        http.MethodDelete,
+			path:          "/v0/todos/1",
+			authorization: "Bearer bob-token",
+			wantStatus:    http.StatusNotFound,
+			wantBody:      "{\"error\":\"delete with id 1: todo not found\"}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.method, tt.path, tt.authorization, "")
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, withoutTimestamps(w.Body.String()))
+
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
+
+func TestHandler_Lists(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	steps := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			name:       "Create list",
+			method:     http.MethodPost,
+			path:       "/v0/lists",
+			body:       "{\"name\":\"Groceries\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"name\":\"Groceries\"}",
+		},
+		{
+			name:       "Create list without name",
+			method:     http.MethodPost,
+			path:       "/v0/lists",
+			body:       "{\"name\":\"\"}",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody: "{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422," +
+				"\"detail\":\"invalid list: name must not be empty\"," +
+				"\"invalid-params\":[{\"name\":\"name\",\"rule\":\"required\",\"reason\":\"must not be empty\"}]}",
+		},
+		{
+			name:       "Rename list",
+			method:     http.MethodPut,
+			path:       "/v0/lists/1",
+			body:       "{\"name\":\"Food\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"name\":\"Food\"}",
+		},
+		{
+			name:       "Add todo to list",
+			method:     http.MethodPost,
+			path:       "/v0/lists/1/todos",
+			body:       "{\"title\":\"Buy milk\",\"list_id\":5}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Buy milk\",\"completed\":false,\"list_id\":1,\"version\":1}",
+		},
+		{
+			name:       "Add todo to missing list",
+			method:     http.MethodPost,
+			path:       "/v0/lists/9/todos",
+			body:       "{\"title\":\"Buy milk\"}",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"add to list with id 9: list not found\"}",
+		},
+		{
+			name:       "Add unlisted todo",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Call mum\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":2,\"title\":\"Call mum\",\"completed\":false,\"version\":1}",
+		},
+		{
+			name:       "List todos on list",
+			method:     http.MethodGet,
+			path:       "/v0/lists/1/todos",
+			wantStatus: http.StatusOK,
+			wantBody:   "[{\"id\":1,\"title\":\"Buy milk\",\"completed\":false,\"list_id\":1,\"version\":1}]",
+		},
+		{
+			name:       "List todos on missing list",
+			method:     http.MethodGet,
+			path:       "/v0/lists/9/todos",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"fetch list with id 9: list not found\"}",
+		},
+		{
+			name:        "Move todo onto list",
+			method:      http.MethodPatch,
+			path:        "/v0/todos/2",
+			contentType: "application/merge-patch+json",
+			body:        "{\"list_id\":1}",
+			wantStatus:  http.StatusOK,
+			wantBody:    "{\"id\":2,\"title\":\"Call mum\",\"completed\":false,\"list_id\":1,\"version\":2}",
+		},
+		{
+			name:       "Delete non-empty list",
+			method:     http.MethodDelete,
+			path:       "/v0/lists/1",
+			wantStatus: http.StatusConflict,
+			wantBody:   "{\"error\":\"delete list with id 1: list is not empty: 2 todos left\"}",
+		},
+		{
+			name:       "Delete with unknown cascade",
+			method:     http.MethodDelete,
+			path:       "/v0/lists/1?cascade=nuke",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: invalid cascade: 'nuke' is not one of restrict, delete or detach\"}",
+		},
+		{
+			name:       "Delete list keeping its todos",
+			method:     http.MethodDelete,
+			path:       "/v0/lists/1?cascade=detach",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Todos are kept without list",
+			method:     http.MethodGet,
+			path:       "/v0/todos?list_id=0",
+			wantStatus: http.StatusOK,
+			wantBody: "[{\"id\":1,\"title\":\"Buy milk\",\"completed\":false,\"version\":2}," +
+				"{\"id\":2,\"title\":\"Call mum\",\"completed\":false,\"version\":3}]",
+		},
+		{
+			name:       "Deleted list is gone",
+			method:     http.MethodGet,
+			path:       "/v0/lists",
+			wantStatus: http.StatusOK,
+			wantBody:   "[]",
+		},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequest(step.method, step.path, bytes.NewBuffer([]byte(step.body)))
+		assert.NoError(t, err)
+
+		if step.contentType != "" {
+			req.Header.Set("Content-Type", step.contentType)
+		}
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		assert.Equal(t, step.wantStatus, w.Code, step.name)
+		assert.Equal(t, step.wantBody, withoutTimestamps(w.Body.String()), step.name)
+	}
+}
+
+func TestHandler_Relations(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Create parent",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Move house\",\"auto_complete\":true}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Move house\",\"completed\":false,\"auto_complete\":true,\"version\":1}",
+		},
+		{
+			name:       "Create subtask",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Pack boxes\",\"parent_id\":1}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":2,\"title\":\"Pack boxes\",\"completed\":false,\"parent_id\":1,\"version\":1}",
+		},
+		{
+			name:       "Create blocked subtask",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Load van\",\"parent_id\":1,\"blocked_by\":[2]}",
+			wantStatus: http.StatusOK,
+			wantBody: "{\"id\":3,\"title\":\"Load van\",\"completed\":false,\"parent_id\":1," +
+				"\"blocked_by\":[2],\"version\":1}",
+		},
+		{
+			name:       "Create subtask of missing todo",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Orphan\",\"parent_id\":9}",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody: "{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422," +
+				"\"detail\":\"invalid todo: parent_id must refer to an existing todo\"," +
+				"\"invalid-params\":[{\"name\":\"parent_id\",\"rule\":\"exists\",\"reason\":\"must refer to an existing todo\"}]}",
+		},
+		{
+			name:       "Make parent its own grandchild",
+			method:     http.MethodPut,
+			path:       "/v0/todos/1",
+			body:       "{\"title\":\"Move house\",\"parent_id\":3}",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody: "{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422," +
+				"\"detail\":\"invalid todo: parent_id must not make a todo its own ancestor\"," +
+				"\"invalid-params\":[{\"name\":\"parent_id\",\"rule\":\"acyclic\",\"reason\":\"must not make the todo its own ancestor\"}]}",
+		},
+		{
+			name:       "List blockers",
+			method:     http.MethodGet,
+			path:       "/v0/todos/3/blockers",
+			wantStatus: http.StatusOK,
+			wantBody:   "[{\"id\":2,\"title\":\"Pack boxes\",\"completed\":false,\"parent_id\":1,\"version\":1}]",
+		},
+		{
+			name:       "Complete blocked todo",
+			method:     http.MethodPut,
+			path:       "/v0/todos/3",
+			body:       "{\"title\":\"Load van\",\"completed\":true,\"parent_id\":1,\"blocked_by\":[2]}",
+			wantStatus: http.StatusConflict,
+			wantBody:   "{\"error\":\"update with id 3: todo is blocked by open todos: todo 2 is still open\"}",
+		},
+		{
+			name:       "Delete todo with subtasks",
+			method:     http.MethodDelete,
+			path:       "/v0/todos/1",
+			wantStatus: http.StatusConflict,
+			wantBody:   "{\"error\":\"delete with id 1: todo has subtasks or blocks other todos: todo 2 refers to it\"}",
+		},
+		{
+			name:       "Fetch tree",
+			method:     http.MethodGet,
+			path:       "/v0/todos/1/tree",
+			wantStatus: http.StatusOK,
+			wantBody: "{\"id\":1,\"title\":\"Move house\",\"completed\":false,\"auto_complete\":true,\"version\":1,\"children\":[" +
+				"{\"id\":2,\"title\":\"Pack boxes\",\"completed\":false,\"parent_id\":1,\"version\":1,\"children\":[]}," +
+				"{\"id\":3,\"title\":\"Load van\",\"completed\":false,\"parent_id\":1,\"blocked_by\":[2],\"version\":1,\"children\":[]}]}",
+		},
+		{
+			name:       "Complete first subtask",
+			method:     http.MethodPut,
+			path:       "/v0/todos/2",
+			body:       "{\"title\":\"Pack boxes\",\"completed\":true,\"parent_id\":1}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":2,\"title\":\"Pack boxes\",\"completed\":true,\"parent_id\":1,\"version\":2}",
+		},
+		{
+			name:       "Parent stays open while a subtask is open",
+			method:     http.MethodGet,
+			path:       "/v0/todos/1",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Move house\",\"completed\":false,\"auto_complete\":true,\"version\":1}",
+		},
+		{
+			name:       "Complete last subtask",
+			method:     http.MethodPut,
+			path:       "/v0/todos/3",
+			body:       "{\"title\":\"Load van\",\"completed\":true,\"parent_id\":1,\"blocked_by\":[2]}",
+			wantStatus: http.StatusOK,
+			wantBody: "{\"id\":3,\"title\":\"Load van\",\"completed\":true,\"parent_id\":1," +
+				"\"blocked_by\":[2],\"version\":2}",
+		},
+		{
+			name:       "Parent is completed with its subtasks",
+			method:     http.MethodGet,
+			path:       "/v0/todos/1",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Move house\",\"completed\":true,\"auto_complete\":true,\"version\":2}",
+		},
+		{
+			name:       "Tree of missing todo",
+			method:     http.MethodGet,
+			path:       "/v0/todos/9/tree",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"fetch tree of id 9: todo not found\"}",
+		},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequest(step.method, step.path, bytes.NewBuffer([]byte(step.body)))
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		assert.Equal(t, step.wantStatus, w.Code, step.name)
+		assert.Equal(t, step.wantBody, withoutTimestamps(w.Body.String()), step.name)
+	}
+}
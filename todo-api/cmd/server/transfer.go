@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"todoapp/transfer"
+)
+
+const (
+	ErrExportFailed = "failed exporting todos"
+	ErrImportFailed = "failed importing todos"
+
+	contentDispositionKey = "Content-Disposition"
+)
+
+// importFormats maps the media types of import bodies onto their formats, a
+// format given as parameter takes precedence.
+var importFormats = map[string]transfer.Format{
+	"application/json": transfer.FormatJSON,
+	"text/csv":         transfer.FormatCSV,
+	"text/plain":       transfer.FormatTodoTxt,
+}
+
+// exportTodos streams all todos in the format chosen by the format parameter,
+// JSON by default.
+func (s *Server) exportTodos() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := transfer.ParseFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, err, http.StatusBadRequest)
+			return
+		}
+
+		headers := map[string]string{
+			contentTypeKey:        format.ContentType(),
+			contentDispositionKey: fmt.Sprintf("attachment; filename=\"todos.%s\"", format.Extension()),
+		}
+
+		s.streamTodos(w, r, ErrExportFailed, headers, func(out io.Writer) (transfer.Writer, error) {
+			return transfer.NewWriter(format, out)
+		})
+	}
+}
+
+// streamTodos sends all todos of the user encoded by the writer newWriter
+// returns, along with headers. Once the first bytes are sent a failure can no
+// longer be reported to the client, it is logged and the response is cut
+// short.
+func (s *Server) streamTodos(w http.ResponseWriter, r *http.Request, errMsg string, headers map[string]string, newWriter func(io.Writer) (transfer.Writer, error)) {
+	sent := &sentWriter{w: w}
+	buffered := bufio.NewWriter(sent)
+
+	out, err := newWriter(buffered)
+	if err != nil {
+		s.sendFailure(w, ErrInvalidParameter, err, http.StatusBadRequest)
+		return
+	}
+
+	for key, value := range headers {
+		w.Header().Set(key, value)
+	}
+
+	err = s.service.ExportTodos(r.Context(), owner(r), out)
+	if err == nil {
+		err = buffered.Flush()
+	}
+
+	if err != nil {
+		if sent.started {
+			log.Printf("server: export cut short: %v", err)
+			return
+		}
+
+		for key := range headers {
+			w.Header().Del(key)
+		}
+		s.sendError(w, errMsg, err)
+	}
+}
+
+// importTodos adds the todos of the body and sends a transfer.Report, rows
+// that failed do not fail the request. The format is taken from the format
+// parameter or else the Content-Type, dry_run=true only checks the rows.
+func (s *Server) importTodos() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		format, err := transfer.ParseFormat(params.Get("format"))
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, err, http.StatusBadRequest)
+			return
+		}
+
+		if params.Get("format") == "" {
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get(contentTypeKey))
+			if byType, ok := importFormats[mediaType]; ok {
+				format = byType
+			}
+		}
+
+		dryRun := false
+		if value := params.Get("dry_run"); value != "" {
+			dryRun, err = strconv.ParseBool(value)
+			if err != nil {
+				s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("dry_run must be true or false, not '%s'", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		in, err := transfer.NewReader(format, r.Body)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, err, http.StatusBadRequest)
+			return
+		}
+
+		report, err := s.service.ImportTodos(r.Context(), owner(r), in, dryRun)
+		if err != nil {
+			s.sendError(w, ErrImportFailed, err)
+			return
+		}
+
+		s.sendSuccess(w, report)
+	}
+}
+
+// sentWriter records whether anything was written to the response yet.
+type sentWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (sw *sentWriter) Write(p []byte) (int, error) {
+	sw.started = true
+
+	return sw.w.Write(p)
+}
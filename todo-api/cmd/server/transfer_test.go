@@ -0,0 +1,129 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"todoapp"
+	"todoapp/cmd/server"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// csvTimestampPattern matches the timestamps of CSV exports.
+var csvTimestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z`)
+
+func TestHandler_Transfer(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	steps := []struct {
+		name            string
+		method          string
+		path            string
+		contentType     string
+		body            string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "Export nothing",
+			method:          http.MethodGet,
+			path:            "/v0/export",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        "[]",
+		},
+		{
+			name:        "Dry run import",
+			method:      http.MethodPost,
+			path:        "/v0/import?dry_run=true",
+			contentType: "text/plain",
+			body:        "(A) Call mom +Family @phone\nx Water plants\n(B)\n",
+			wantStatus:  http.StatusOK,
+			wantBody: "{\"dry_run\":true,\"imported\":2,\"failed\":1,\"created_lists\":[\"Family\"]," +
+				"\"errors\":[{\"row\":3,\"error\":\"invalid todo: title must not be empty\"}]}",
+		},
+		{
+			name:            "Dry run saved nothing",
+			method:          http.MethodGet,
+			path:            "/v0/export?format=todotxt",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "",
+		},
+		{
+			name:        "Import todo.txt",
+			method:      http.MethodPost,
+			path:        "/v0/import?format=todotxt",
+			contentType: "application/octet-stream",
+			body:        "(A) Call mom +Family @phone\nx Water plants\n",
+			wantStatus:  http.StatusOK,
+			wantBody:    "{\"dry_run\":false,\"imported\":2,\"failed\":0,\"created_lists\":[\"Family\"],\"errors\":[]}",
+		},
+		{
+			name:        "Import JSON",
+			method:      http.MethodPost,
+			path:        "/v0/import",
+			contentType: "application/json",
+			body:        "[{\"title\":\"Mow lawn\",\"list\":\"Family\",\"tags\":[\"garden\"]}]",
+			wantStatus:  http.StatusOK,
+			wantBody:    "{\"dry_run\":false,\"imported\":1,\"failed\":0,\"created_lists\":[],\"errors\":[]}",
+		},
+		{
+			name:            "Export CSV",
+			method:          http.MethodGet,
+			path:            "/v0/export?format=csv",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody: "id,title,completed,description,due,priority,tags,recurrence,list,parent_id,auto_complete,blocked_by,created_at,completed_at\n" +
+				"1,Call mom,false,,,1,phone,,Family,,false,,<time>,\n" +
+				"2,Water plants,true,,,,,,,,false,,<time>,<time>\n" +
+				"3,Mow lawn,false,,,,garden,,Family,,false,,<time>,\n",
+		},
+		{
+			name:        "Import malformed JSON",
+			method:      http.MethodPost,
+			path:        "/v0/import",
+			contentType: "application/json",
+			body:        "{\"title\":\"Mow lawn\"}",
+			wantStatus:  http.StatusBadRequest,
+			wantBody:    "{\"error\":\"failed importing todos: malformed import: todos must be a JSON array\"}",
+		},
+		{
+			name:       "Export unknown format",
+			method:     http.MethodGet,
+			path:       "/v0/export?format=xml",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: format must be one of json, csv or todotxt, not 'xml'\"}",
+		},
+		{
+			name:       "Import with invalid dry run",
+			method:     http.MethodPost,
+			path:       "/v0/import?dry_run=maybe",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "{\"error\":\"invalid parameter: dry_run must be true or false, not 'maybe'\"}",
+		},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequest(step.method, step.path, bytes.NewBuffer([]byte(step.body)))
+		assert.NoError(t, err)
+
+		if step.contentType != "" {
+			req.Header.Set("Content-Type", step.contentType)
+		}
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		assert.Equal(t, step.wantStatus, w.Code, step.name)
+		assert.Equal(t, step.wantBody, csvTimestampPattern.ReplaceAllString(w.Body.String(), "<time>"), step.name)
+
+		if step.wantContentType != "" {
+			assert.Equal(t, step.wantContentType, w.Header().Get("Content-Type"), step.name)
+		}
+	}
+}
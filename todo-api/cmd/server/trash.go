@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	ErrFetchTrashFailed = "failed fetching trash"
+)
+
+// getTrash lists the deleted todos that have not been purged yet, the most
+// recently deleted first.
+func (s *Server) getTrash() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		todos, err := s.service.GetTrash(r.Context(), owner(r))
+		if err != nil {
+			s.sendError(w, ErrFetchTrashFailed, err)
+			return
+		}
+
+		s.sendSuccess(w, todos)
+	}
+}
+
+// restoreTodo takes a todo out of the trash and sends it as restored.
+func (s *Server) restoreTodo() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["id"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		todo, err := s.service.RestoreTodo(r.Context(), owner(r), id)
+		if err != nil {
+			s.sendError(w, "restore with id "+idString, err)
+			return
+		}
+
+		w.Header().Set(etagKey, etag(todo))
+		s.sendSuccess(w, todo)
+	}
+}
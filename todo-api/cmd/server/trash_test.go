@@ -0,0 +1,124 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todoapp"
+	"todoapp/cmd/server"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_Trash(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Create parent",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Plant tulips\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Plant tulips\",\"completed\":false,\"version\":1}",
+		},
+		{
+			name:       "Create subtask",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Buy bulbs\",\"parent_id\":1}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":2,\"title\":\"Buy bulbs\",\"completed\":false,\"parent_id\":1,\"version\":1}",
+		},
+		{
+			name:       "Delete subtask",
+			method:     http.MethodDelete,
+			path:       "/v0/todos/2",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Delete parent",
+			method:     http.MethodDelete,
+			path:       "/v0/todos/1",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Deleted todo is hidden",
+			method:     http.MethodGet,
+			path:       "/v0/todos/1",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"fetch with id 1: todo not found\"}",
+		},
+		{
+			name:       "Deleted todos are not listed",
+			method:     http.MethodGet,
+			path:       "/v0/todos",
+			wantStatus: http.StatusOK,
+			wantBody:   "[]",
+		},
+		{
+			name:       "List trash",
+			method:     http.MethodGet,
+			path:       "/v0/trash",
+			wantStatus: http.StatusOK,
+			wantBody: "[{\"id\":1,\"title\":\"Plant tulips\",\"completed\":false,\"version\":1}," +
+				"{\"id\":2,\"title\":\"Buy bulbs\",\"completed\":false,\"parent_id\":1,\"version\":1}]",
+		},
+		{
+			name:       "Restore subtask before parent",
+			method:     http.MethodPost,
+			path:       "/v0/todos/2/restore",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody: "{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422," +
+				"\"detail\":\"invalid todo: parent_id must refer to an existing todo\"," +
+				"\"invalid-params\":[{\"name\":\"parent_id\",\"rule\":\"exists\",\"reason\":\"must refer to an existing todo\"}]}",
+		},
+		{
+			name:       "Restore parent",
+			method:     http.MethodPost,
+			path:       "/v0/todos/1/restore",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Plant tulips\",\"completed\":false,\"version\":2}",
+		},
+		{
+			name:       "Restore parent again",
+			method:     http.MethodPost,
+			path:       "/v0/todos/1/restore",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"restore with id 1: todo not found\"}",
+		},
+		{
+			name:       "Restore subtask",
+			method:     http.MethodPost,
+			path:       "/v0/todos/2/restore",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":2,\"title\":\"Buy bulbs\",\"completed\":false,\"parent_id\":1,\"version\":2}",
+		},
+		{
+			name:       "Trash is empty",
+			method:     http.MethodGet,
+			path:       "/v0/trash",
+			wantStatus: http.StatusOK,
+			wantBody:   "[]",
+		},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequest(step.method, step.path, bytes.NewBuffer([]byte(step.body)))
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		assert.Equal(t, step.wantStatus, w.Code, step.name)
+		assert.Equal(t, step.wantBody, withoutTimestamps(w.Body.String()), step.name)
+	}
+}
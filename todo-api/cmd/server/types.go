@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"todoapp/model"
 )
 
 const emptyMessagePlaceholder = "an unexpected error has occurred"
@@ -29,3 +30,95 @@ func (fr FailResponse) SendJSON(w io.Writer) error {
 
 	return nil
 }
+
+// ProblemResponse is a RFC 7807 problem details body, InvalidParams lists the
+// fields of a todo that failed validation.
+type ProblemResponse struct {
+	Type          string             `json:"type"`
+	Title         string             `json:"title"`
+	Status        int                `json:"status"`
+	Detail        string             `json:"detail,omitempty"`
+	InvalidParams []model.FieldError `json:"invalid-params,omitempty"`
+}
+
+func (pr ProblemResponse) SendJSON(w io.Writer) error {
+	msg, err := json.Marshal(pr)
+	if err != nil {
+		return fmt.Errorf("problemresponse.Send json marshal: %v", err)
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return fmt.Errorf("problemresponse.Send: %v", err)
+	}
+
+	return nil
+}
+
+// BatchRequest is the body of POST /v0/todos:batch.
+type BatchRequest struct {
+	Operations []model.Operation `json:"operations"`
+}
+
+// BatchResult reports the outcome of one operation of a batch. Todo is the
+// todo as written by a create or update and left out for a delete.
+type BatchResult struct {
+	Op   model.OpKind `json:"op"`
+	Id   int          `json:"id"`
+	Todo *model.Todo  `json:"todo,omitempty"`
+}
+
+// BatchResponse lists the results of a batch in the order of its operations.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// CalendarResult reports the outcome of one VTODO of a calendar upload.
+// Action is created or updated, Error tells why the component was skipped.
+type CalendarResult struct {
+	UID    string `json:"uid,omitempty"`
+	Id     int    `json:"id,omitempty"`
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CalendarResponse lists the results of a calendar upload in the order of its
+// VTODO components.
+type CalendarResponse struct {
+	Results []CalendarResult `json:"results"`
+}
+
+// SocketRequest is a message of the client on the /v0/ws connection. Id is
+// chosen by the client and repeated in the reply. Type is one of subscribe,
+// unsubscribe, create, update, patch or delete.
+type SocketRequest struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+
+	// ListId selects the list of subscribe and unsubscribe, zero for the todos
+	// on no list. Without it the request covers all todos.
+	ListId *int `json:"list_id,omitempty"`
+
+	TodoId int         `json:"todo_id,omitempty"`
+	Todo   *model.Todo `json:"todo,omitempty"`
+	// Patch is a JSON Merge Patch, or a JSON Patch if it is an array.
+	Patch json.RawMessage `json:"patch,omitempty"`
+	// Version makes a patch conditional like If-Match, update uses the
+	// version of Todo instead.
+	Version int `json:"version,omitempty"`
+}
+
+// SocketMessage is a message of the server on the /v0/ws connection: an ack
+// or error replying to the request with the same Id, or a change to a
+// subscribed todo made by another client. Changes are of type created,
+// updated or deleted and carry the id of the event as in /v0/events.
+type SocketMessage struct {
+	Type    string      `json:"type"`
+	Id      string      `json:"id,omitempty"`
+	EventId uint64      `json:"event_id,omitempty"`
+	Todo    *model.Todo `json:"todo,omitempty"`
+
+	Status        int                `json:"status,omitempty"`
+	Error         string             `json:"error,omitempty"`
+	InvalidParams []model.FieldError `json:"invalid-params,omitempty"`
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"testing"
 	"todoapp/cmd/server"
+	"todoapp/model"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -48,3 +49,38 @@ func TestFailResponse_SendJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestProblemResponse_SendJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		problem server.ProblemResponse
+		want    string
+	}{
+		{
+			"Without invalid params",
+			server.ProblemResponse{Type: "about:blank", Title: "Not Found", Status: 404},
+			"{\"type\":\"about:blank\",\"title\":\"Not Found\",\"status\":404}",
+		},
+		{
+			"With invalid params",
+			server.ProblemResponse{
+				Type:          "about:blank",
+				Title:         "Unprocessable Entity",
+				Status:        422,
+				Detail:        "invalid todo",
+				InvalidParams: []model.FieldError{{Field: "title", Rule: model.RuleRequired, Reason: "must not be empty"}},
+			},
+			"{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422,\"detail\":\"invalid todo\"," +
+				"\"invalid-params\":[{\"name\":\"title\",\"rule\":\"required\",\"reason\":\"must not be empty\"}]}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			err := tt.problem.SendJSON(&buf)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
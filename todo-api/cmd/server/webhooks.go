@@ -0,0 +1,162 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"todoapp/model"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	ErrFetchWebhookFailed = "failed fetching webhooks"
+	ErrSaveWebhookFailed  = "failed saving webhook"
+)
+
+// Webhooks manages the webhooks of the users, implemented by
+// webhook.Dispatcher.
+type Webhooks interface {
+	SaveWebhook(owner int, hook *model.Webhook) error
+	UpdateWebhook(owner int, id int, hook *model.Webhook) (*model.Webhook, error)
+	GetWebhook(owner int, id int) (*model.Webhook, error)
+	GetWebhooks(owner int) ([]*model.Webhook, error)
+	DeleteWebhook(owner int, id int) error
+	GetDeliveries(owner int, id int) ([]*model.Delivery, error)
+}
+
+// WithWebhooks serves the webhooks managed by w under /v0/webhooks.
+func WithWebhooks(w Webhooks) Option {
+	return func(s *Server) {
+		s.webhooks = w
+	}
+}
+
+func (s *Server) getWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hooks, err := s.webhooks.GetWebhooks(owner(r))
+		if err != nil {
+			s.sendError(w, ErrFetchWebhookFailed, err)
+			return
+		}
+
+		s.sendSuccess(w, hooks)
+	}
+}
+
+// addWebhook subscribes a URL to events, the response carries the secret of
+// the signatures, which is not shown again.
+func (s *Server) addWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var hook model.Webhook
+
+		err := json.NewDecoder(r.Body).Decode(&hook)
+		if err != nil {
+			s.sendFailure(w, ErrJSONDecodeFailed, err, http.StatusBadRequest)
+			return
+		}
+
+		err = s.webhooks.SaveWebhook(owner(r), &hook)
+		if err != nil {
+			s.sendError(w, ErrSaveWebhookFailed, err)
+			return
+		}
+
+		s.sendSuccess(w, hook)
+	}
+}
+
+func (s *Server) getWebhookById() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["hookId"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		hook, err := s.webhooks.GetWebhook(owner(r), id)
+		if err != nil {
+			s.sendError(w, "fetch webhook with id "+idString, err)
+			return
+		}
+
+		s.sendSuccess(w, hook)
+	}
+}
+
+// updateWebhook replaces a webhook, an empty secret keeps the current one.
+func (s *Server) updateWebhook() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["hookId"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		var hook model.Webhook
+		err = json.NewDecoder(r.Body).Decode(&hook)
+		if err != nil {
+			s.sendFailure(w, ErrJSONDecodeFailed, err, http.StatusBadRequest)
+			return
+		}
+
+		updatedHook, err := s.webhooks.UpdateWebhook(owner(r), id, &hook)
+		if err != nil {
+			s.sendError(w, "update webhook with id "+idString, err)
+			return
+		}
+
+		s.sendSuccess(w, updatedHook)
+	}
+}
+
+func (s *Server) deleteWebhook() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["hookId"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		err = s.webhooks.DeleteWebhook(owner(r), id)
+		if err != nil {
+			s.sendError(w, "delete webhook with id "+idString, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// getDeliveries lists the recent deliveries of a webhook, newest first, with
+// the outcome of their last attempt.
+func (s *Server) getDeliveries() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString := mux.Vars(r)["hookId"]
+
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			s.sendFailure(w, ErrInvalidParameter, fmt.Errorf("'%s' cannot be converted to int", idString), http.StatusBadRequest)
+			return
+		}
+
+		deliveries, err := s.webhooks.GetDeliveries(owner(r), id)
+		if err != nil {
+			s.sendError(w, "fetch deliveries of webhook with id "+idString, err)
+			return
+		}
+
+		s.sendSuccess(w, deliveries)
+	}
+}
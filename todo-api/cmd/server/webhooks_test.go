@@ -0,0 +1,147 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todoapp"
+	"todoapp/cmd/server"
+	"todoapp/store"
+	"todoapp/webhook"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_Webhooks(t *testing.T) {
+	dispatcher := webhook.NewDispatcher(webhook.NewMemoryStore())
+	service := todoapp.New(store.WithChangeHook(store.NewInMemoryStore(), dispatcher.Publish))
+	srv := server.New(service, server.WithWebhooks(dispatcher))
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Create webhook",
+			method:     http.MethodPost,
+			path:       "/v0/webhooks",
+			body:       "{\"url\":\"https://example.com/hooks\",\"events\":[\"todo.completed\"],\"secret\":\"s3cret\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"url\":\"https://example.com/hooks\",\"events\":[\"todo.completed\"],\"secret\":\"s3cret\"}",
+		},
+		{
+			name:       "Create webhook with unknown event",
+			method:     http.MethodPost,
+			path:       "/v0/webhooks",
+			body:       "{\"url\":\"https://example.com/hooks\",\"events\":[\"todo.exploded\"]}",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody: "{\"type\":\"about:blank\",\"title\":\"Unprocessable Entity\",\"status\":422," +
+				"\"detail\":\"invalid webhook: events must be one of todo.created, todo.updated, todo.completed, todo.deleted\"," +
+				"\"invalid-params\":[{\"name\":\"events[0]\",\"rule\":\"format\",\"reason\":\"must be one of todo.created, todo.updated, todo.completed, todo.deleted\"}]}",
+		},
+		{
+			name:       "Secret is not shown again",
+			method:     http.MethodGet,
+			path:       "/v0/webhooks/1",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"url\":\"https://example.com/hooks\",\"events\":[\"todo.completed\"]}",
+		},
+		{
+			name:       "Fetch missing webhook",
+			method:     http.MethodGet,
+			path:       "/v0/webhooks/9",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"fetch webhook with id 9: webhook not found\"}",
+		},
+		{
+			name:       "Add todo",
+			method:     http.MethodPost,
+			path:       "/v0/todos",
+			body:       "{\"title\":\"Water plants\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Water plants\",\"completed\":false,\"version\":1}",
+		},
+		{
+			name:       "Creating is not sent",
+			method:     http.MethodGet,
+			path:       "/v0/webhooks/1/deliveries",
+			wantStatus: http.StatusOK,
+			wantBody:   "[]",
+		},
+		{
+			name:       "Complete todo",
+			method:     http.MethodPut,
+			path:       "/v0/todos/1",
+			body:       "{\"title\":\"Water plants\",\"completed\":true}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"title\":\"Water plants\",\"completed\":true,\"version\":2}",
+		},
+		{
+			name:       "Completing is queued",
+			method:     http.MethodGet,
+			path:       "/v0/webhooks/1/deliveries",
+			wantStatus: http.StatusOK,
+			wantBody: "[{\"id\":1,\"webhook_id\":1,\"event\":\"todo.completed\"," +
+				"\"payload\":{\"event\":\"todo.completed\",\"todo\":{\"id\":1,\"title\":\"Water plants\",\"completed\":true,\"version\":2}}," +
+				"\"status\":\"pending\",\"attempts\":0}]",
+		},
+		{
+			name:       "Update webhook",
+			method:     http.MethodPut,
+			path:       "/v0/webhooks/1",
+			body:       "{\"url\":\"https://example.com/v2\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"id\":1,\"url\":\"https://example.com/v2\"}",
+		},
+		{
+			name:       "List webhooks",
+			method:     http.MethodGet,
+			path:       "/v0/webhooks",
+			wantStatus: http.StatusOK,
+			wantBody:   "[{\"id\":1,\"url\":\"https://example.com/v2\"}]",
+		},
+		{
+			name:       "Delete webhook",
+			method:     http.MethodDelete,
+			path:       "/v0/webhooks/1",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Deliveries are gone",
+			method:     http.MethodGet,
+			path:       "/v0/webhooks/1/deliveries",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "{\"error\":\"fetch deliveries of webhook with id 1: webhook not found\"}",
+		},
+	}
+	for _, step := range steps {
+		// Without Run the deliveries of the previous steps wait to be stored.
+		dispatcher.Flush()
+
+		req, err := http.NewRequest(step.method, step.path, bytes.NewBuffer([]byte(step.body)))
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		assert.Equal(t, step.wantStatus, w.Code, step.name)
+		assert.Equal(t, step.wantBody, withoutTimestamps(w.Body.String()), step.name)
+	}
+}
+
+func TestHandler_WebhooksDisabled(t *testing.T) {
+	srv := server.New(todoapp.New(store.NewInMemoryStore()))
+
+	req, err := http.NewRequest(http.MethodGet, "/v0/webhooks", nil)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"todoapp/events"
+	"todoapp/model"
+	"todoapp/store"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	socketWriteWait  = 10 * time.Second
+	socketPongWait   = 60 * time.Second
+	socketPingPeriod = socketPongWait * 9 / 10
+	socketMaxMessage = 1 << 20
+
+	socketAck   = "ack"
+	socketError = "error"
+)
+
+var upgrader = websocket.Upgrader{
+	// Requests are authenticated by a bearer token the page has to send in
+	// the Authorization header or the access_token parameter, never by
+	// cookies a browser adds on its own. Like the REST API the socket is
+	// therefore open to every origin.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// socketKey identifies a change made through a connection, so that it is
+// acknowledged once instead of being echoed as another client's change.
+type socketKey struct {
+	id      int
+	version int
+	deleted bool
+}
+
+// socket is a /v0/ws connection of one user.
+type socket struct {
+	server *Server
+	conn   *websocket.Conn
+	owner  int
+
+	// all is set while subscribed to all todos, lists holds the subscribed
+	// lists otherwise.
+	all   bool
+	lists map[int]bool
+	own   map[socketKey]bool
+}
+
+// serveSocket upgrades the request to a WebSocket carrying SocketRequest and
+// SocketMessage values. Mutations go through the TodoService like their REST
+// counterparts, changes to subscribed todos made by others are forwarded from
+// the event broker.
+func (s *Server) serveSocket() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has replied already.
+			return
+		}
+		defer conn.Close()
+
+		sock := &socket{
+			server: s,
+			conn:   conn,
+			owner:  owner(r),
+			lists:  make(map[int]bool),
+			own:    make(map[socketKey]bool),
+		}
+
+		sub, _, _ := s.events.Subscribe(sock.owner, 0)
+		defer sub.Cancel()
+
+		sock.run(r.Context(), sub)
+	}
+}
+
+// run handles requests and events until the connection is closed. Both are
+// handled on this goroutine, so the events caused by a request are only
+// looked at after it was acknowledged. Requests are carried out with ctx.
+func (sock *socket) run(ctx context.Context, sub *events.Subscription) {
+	requests := make(chan SocketRequest)
+	done := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	sock.conn.SetReadLimit(socketMaxMessage)
+	sock.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	sock.conn.SetPongHandler(func(string) error {
+		return sock.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	go func() {
+		for {
+			var req SocketRequest
+			if err := sock.conn.ReadJSON(&req); err != nil {
+				done <- err
+				close(requests)
+				return
+			}
+
+			select {
+			case requests <- req:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(socketPingPeriod)
+	defer ping.Stop()
+
+	for {
+		var err error
+
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				err = <-done
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					log.Printf("websocket: %v", err)
+				}
+				return
+			}
+
+			err = sock.send(sock.handle(ctx, req))
+		case event, ok := <-sub.Events():
+			if !ok {
+				sock.close(websocket.CloseTryAgainLater, "too far behind")
+				return
+			}
+
+			if sock.wants(event) {
+				err = sock.send(SocketMessage{Type: string(event.Type), EventId: event.Id, Todo: event.Todo})
+			}
+		case <-ping.C:
+			err = sock.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait))
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (sock *socket) send(msg SocketMessage) error {
+	sock.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+
+	return sock.conn.WriteJSON(msg)
+}
+
+func (sock *socket) close(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	sock.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(socketWriteWait))
+}
+
+// handle carries out req and returns the reply to it.
+func (sock *socket) handle(ctx context.Context, req SocketRequest) SocketMessage {
+	s := sock.server
+	idString := strconv.Itoa(req.TodoId)
+
+	switch req.Type {
+	case "subscribe":
+		if req.ListId == nil {
+			sock.all = true
+			return SocketMessage{Type: socketAck, Id: req.Id}
+		}
+
+		if *req.ListId != 0 {
+			if _, err := s.service.GetList(ctx, sock.owner, *req.ListId); err != nil {
+				return sock.failure(req, "fetch list with id "+strconv.Itoa(*req.ListId), err)
+			}
+		}
+
+		sock.lists[*req.ListId] = true
+
+		return SocketMessage{Type: socketAck, Id: req.Id}
+	case "unsubscribe":
+		if req.ListId == nil {
+			sock.all = false
+			sock.lists = make(map[int]bool)
+		} else {
+			delete(sock.lists, *req.ListId)
+		}
+
+		return SocketMessage{Type: socketAck, Id: req.Id}
+	case "create":
+		if req.Todo == nil {
+			return sock.failure(req, ErrInvalidParameter, errors.New("todo is missing"))
+		}
+
+		if err := s.service.SaveTodo(ctx, sock.owner, req.Todo); err != nil {
+			return sock.failure(req, ErrSaveFailed, err)
+		}
+
+		return sock.ack(req, req.Todo, false)
+	case "update":
+		if req.Todo == nil {
+			return sock.failure(req, ErrInvalidParameter, errors.New("todo is missing"))
+		}
+
+		updatedTodo, err := s.service.UpdateTodo(ctx, sock.owner, req.TodoId, req.Todo)
+		if err != nil {
+			return sock.failure(req, "update with id "+idString, err)
+		}
+
+		return sock.ack(req, updatedTodo, false)
+	case "patch":
+		var patch model.Patch = model.MergePatch(req.Patch)
+		if len(req.Patch) > 0 && req.Patch[0] == '[' {
+			patch = model.JSONPatch(req.Patch)
+		}
+
+		patchedTodo, err := s.service.PatchTodo(ctx, sock.owner, req.TodoId, req.Version, patch)
+		if err != nil {
+			return sock.failure(req, "patch with id "+idString, err)
+		}
+
+		return sock.ack(req, patchedTodo, false)
+	case "delete":
+		todo, err := s.service.GetTodo(ctx, sock.owner, req.TodoId)
+		if err == nil {
+			err = s.service.DeleteTodo(ctx, sock.owner, req.TodoId)
+		}
+		if err != nil {
+			return sock.failure(req, "delete with id "+idString, err)
+		}
+
+		return sock.ack(req, todo, true)
+	default:
+		return sock.failure(req, ErrInvalidParameter, fmt.Errorf("unknown request type '%s'", req.Type))
+	}
+}
+
+// ack acknowledges req, which wrote todo, and remembers the change so that
+// its event is not sent back.
+func (sock *socket) ack(req SocketRequest, todo *model.Todo, deleted bool) SocketMessage {
+	sock.own[socketKey{id: todo.Id, version: todo.Version, deleted: deleted}] = true
+
+	return SocketMessage{Type: socketAck, Id: req.Id, Todo: todo}
+}
+
+// failure reports a failed request with the status a REST request failing
+// the same way would get.
+func (sock *socket) failure(req SocketRequest, errMsg string, err error) SocketMessage {
+	var verr *model.ValidationError
+	if errors.As(err, &verr) {
+		return SocketMessage{
+			Type:          socketError,
+			Id:            req.Id,
+			Status:        http.StatusUnprocessableEntity,
+			Error:         verr.Error(),
+			InvalidParams: verr.Fields,
+		}
+	}
+
+	status := errorStatus(err)
+	if errMsg == ErrInvalidParameter {
+		status = http.StatusBadRequest
+	}
+
+	return SocketMessage{Type: socketError, Id: req.Id, Status: status, Error: fmt.Sprintf("%v: %v", errMsg, err)}
+}
+
+// wants reports whether event is to be sent, that is it concerns a subscribed
+// todo and was not caused by this connection. A todo moved off a subscribed
+// list is sent once more, so that the client learns it left.
+func (sock *socket) wants(event events.Event) bool {
+	key := socketKey{id: event.Todo.Id, version: event.Todo.Version, deleted: event.Type == store.ChangeDeleted}
+	if sock.own[key] {
+		delete(sock.own, key)
+		return false
+	}
+
+	if sock.all || sock.lists[event.Todo.ListId] {
+		return true
+	}
+
+	return event.Previous != nil && sock.lists[event.Previous.ListId]
+}
@@ -0,0 +1,228 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"todoapp"
+	"todoapp/auth"
+	"todoapp/cmd/server"
+	"todoapp/events"
+	"todoapp/model"
+	"todoapp/store"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func dialSocket(t *testing.T, url string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/v0/ws", nil)
+	if err != nil {
+		t.Fatalf("dialing websocket failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// roundTrip sends req and returns the next message received.
+func roundTrip(t *testing.T, conn *websocket.Conn, req server.SocketRequest) server.SocketMessage {
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatalf("sending %s failed: %v", req.Type, err)
+	}
+
+	return receive(t, conn)
+}
+
+func receive(t *testing.T, conn *websocket.Conn) server.SocketMessage {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg server.SocketMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("receiving message failed: %v", err)
+	}
+
+	if msg.Todo != nil {
+		clearTimestamps([]*model.Todo{msg.Todo})
+	}
+
+	return msg
+}
+
+func TestHandler_Socket(t *testing.T) {
+	ctx := context.Background()
+
+	broker := events.NewBroker(10)
+	service := todoapp.New(store.WithChangeHook(store.NewInMemoryStore(), broker.Publish))
+	assert.NoError(t, service.SaveList(ctx, store.Anonymous, &model.List{Name: "Groceries"}))
+	assert.NoError(t, service.SaveList(ctx, store.Anonymous, &model.List{Name: "Bakery"}))
+
+	ts := httptest.NewServer(server.New(service, server.WithEvents(broker)))
+	defer ts.Close()
+
+	alice, bob := dialSocket(t, ts.URL), dialSocket(t, ts.URL)
+	listId := 1
+
+	assert.Equal(t, server.SocketMessage{Type: "ack", Id: "a1"},
+		roundTrip(t, alice, server.SocketRequest{Id: "a1", Type: "subscribe", ListId: &listId}))
+	assert.Equal(t, server.SocketMessage{Type: "ack", Id: "b1"},
+		roundTrip(t, bob, server.SocketRequest{Id: "b1", Type: "subscribe"}))
+
+	milk := &model.Todo{Id: 1, Title: "Buy milk", ListId: 1, Version: 1}
+	assert.Equal(t, server.SocketMessage{Type: "ack", Id: "b2", Todo: milk},
+		roundTrip(t, bob, server.SocketRequest{Id: "b2", Type: "create", Todo: &model.Todo{Title: "Buy milk", ListId: 1}}))
+	assert.Equal(t, server.SocketMessage{Type: "created", EventId: 1, Todo: milk}, receive(t, alice))
+
+	// A todo on no list is not sent to alice, and bob does not get his own
+	// change echoed.
+	assert.Equal(t, "ack", roundTrip(t, bob, server.SocketRequest{Id: "b3", Type: "create", Todo: &model.Todo{Title: "Call mum"}}).Type)
+
+	patched := &model.Todo{Id: 1, Title: "Buy milk", Completed: true, ListId: 1, Version: 2}
+	assert.Equal(t, server.SocketMessage{Type: "ack", Id: "a2", Todo: patched},
+		roundTrip(t, alice, server.SocketRequest{Id: "a2", Type: "patch", TodoId: 1, Patch: []byte(`{"completed":true}`)}))
+	assert.Equal(t, server.SocketMessage{Type: "updated", EventId: 3, Todo: patched}, receive(t, bob))
+
+	assert.Equal(t, server.SocketMessage{Type: "ack", Id: "b4", Todo: patched},
+		roundTrip(t, bob, server.SocketRequest{Id: "b4", Type: "delete", TodoId: 1}))
+	assert.Equal(t, server.SocketMessage{Type: "deleted", EventId: 4, Todo: patched}, receive(t, alice))
+
+	// A todo moved off a subscribed list is sent once more, so that alice
+	// can drop it, but its changes on the other list are not.
+	assert.Equal(t, "ack", roundTrip(t, bob, server.SocketRequest{Id: "b5", Type: "create", Todo: &model.Todo{Title: "Buy bread", ListId: 1}}).Type)
+	assert.Equal(t, "created", receive(t, alice).Type)
+
+	moved := &model.Todo{Id: 3, Title: "Buy bread", ListId: 2, Version: 2}
+	assert.Equal(t, server.SocketMessage{Type: "ack", Id: "b6", Todo: moved},
+		roundTrip(t, bob, server.SocketRequest{Id: "b6", Type: "patch", TodoId: 3, Patch: []byte(`{"list_id":2}`)}))
+	assert.Equal(t, server.SocketMessage{Type: "updated", EventId: 6, Todo: moved}, receive(t, alice))
+
+	assert.Equal(t, "ack", roundTrip(t, bob, server.SocketRequest{Id: "b7", Type: "patch", TodoId: 3, Patch: []byte(`{"completed":true}`)}).Type)
+	assert.Equal(t, "ack", roundTrip(t, bob, server.SocketRequest{Id: "b8", Type: "create", Todo: &model.Todo{Title: "Buy eggs", ListId: 1}}).Type)
+	assert.Equal(t, uint64(8), receive(t, alice).EventId)
+}
+
+func TestHandler_SocketErrors(t *testing.T) {
+	broker := events.NewBroker(10)
+	ts := httptest.NewServer(server.New(todoapp.New(store.NewInMemoryStore()), server.WithEvents(broker)))
+	defer ts.Close()
+
+	conn := dialSocket(t, ts.URL)
+	missingList := 9
+
+	tests := []struct {
+		name string
+		req  server.SocketRequest
+		want server.SocketMessage
+	}{
+		{
+			name: "invalid todo",
+			req:  server.SocketRequest{Id: "1", Type: "create", Todo: &model.Todo{Priority: 12, Title: "Say hello"}},
+			want: server.SocketMessage{
+				Type: "error", Id: "1", Status: 422,
+				Error:         "invalid todo: priority must be between 0 and 9",
+				InvalidParams: []model.FieldError{{Field: "priority", Rule: "range", Reason: "must be between 0 and 9"}},
+			},
+		},
+		{
+			name: "missing todo",
+			req:  server.SocketRequest{Id: "2", Type: "update", TodoId: 5, Todo: &model.Todo{Title: "Say hello"}},
+			want: server.SocketMessage{Type: "error", Id: "2", Status: 404, Error: "update with id 5: todo not found"},
+		},
+		{
+			name: "missing list",
+			req:  server.SocketRequest{Id: "3", Type: "subscribe", ListId: &missingList},
+			want: server.SocketMessage{Type: "error", Id: "3", Status: 404, Error: "fetch list with id 9: list not found"},
+		},
+		{
+			name: "unknown type",
+			req:  server.SocketRequest{Id: "4", Type: "rename"},
+			want: server.SocketMessage{Type: "error", Id: "4", Status: 400, Error: "invalid parameter: unknown request type 'rename'"},
+		},
+		{
+			name: "create without todo",
+			req:  server.SocketRequest{Id: "5", Type: "create"},
+			want: server.SocketMessage{Type: "error", Id: "5", Status: 400, Error: "invalid parameter: todo is missing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, roundTrip(t, conn, tt.req))
+		})
+	}
+}
+
+func TestHandler_StreamAuth(t *testing.T) {
+	users, err := auth.NewUsers([]auth.User{{Id: 1, Name: "alice", TokenHash: auth.HashToken("alice-token")}})
+	if err != nil {
+		t.Fatalf("NewUsers() failed: %v", err)
+	}
+
+	broker := events.NewBroker(10)
+	service := todoapp.New(store.WithChangeHook(store.NewInMemoryStore(), broker.Publish))
+
+	ts := httptest.NewServer(server.New(service, server.WithEvents(broker), server.WithAuthenticator(users)))
+	defer ts.Close()
+
+	tests := []struct {
+		name          string
+		query         string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "Missing token", wantStatus: http.StatusUnauthorized},
+		{name: "Unknown token parameter", query: "?access_token=mallory-token", wantStatus: http.StatusUnauthorized},
+		{name: "Unknown token", authorization: "Bearer mallory-token", wantStatus: http.StatusUnauthorized},
+		{name: "Token parameter", query: "?access_token=alice-token", wantStatus: http.StatusOK},
+		{name: "Token header", authorization: "Bearer alice-token", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run("events/"+tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/v0/events"+tt.query, nil)
+			if err != nil {
+				t.Fatalf("creating request failed: %v", err)
+			}
+
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("opening event stream failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+
+		t.Run("ws/"+tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.authorization != "" {
+				header.Set("Authorization", tt.authorization)
+			}
+
+			conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/v0/ws"+tt.query, header)
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, websocket.ErrBadHandshake, err)
+				if assert.NotNil(t, resp) {
+					assert.Equal(t, tt.wantStatus, resp.StatusCode)
+				}
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer conn.Close()
+
+			assert.Equal(t, server.SocketMessage{Type: "ack", Id: "1"},
+				roundTrip(t, conn, server.SocketRequest{Id: "1", Type: "subscribe"}))
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"todoapp/cmd/server"
+	"todoapp/model"
+)
+
+const (
+	applicationJSON = "application/json"
+	mergePatchJSON  = "application/merge-patch+json"
+
+	requestTimeout = 30 * time.Second
+)
+
+// apiClient sends requests to the /v0 API of a todoapp server.
+type apiClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newAPIClient(baseURL, token string) *apiClient {
+	return &apiClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// apiError is a request the server answered with an error status, Message
+// is the error it sent.
+type apiError struct {
+	Status        int
+	Message       string
+	InvalidParams []model.FieldError
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// do sends a request with body encoded as JSON of the given content type
+// unless it is nil, and decodes the response into out unless it is nil. It
+// returns the headers of a successful response and an *apiError for an error
+// status.
+func (c *apiClient) do(method, path string, query url.Values, contentType string, body, out interface{}) (http.Header, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Accept", applicationJSON)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, decodeError(resp)
+	}
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+	}
+
+	return resp.Header, nil
+}
+
+// decodeError turns an error response into an *apiError, understanding both
+// the {"error": ...} bodies and the problem details of validation errors.
+func decodeError(resp *http.Response) error {
+	apiErr := &apiError{Status: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || len(data) == 0 {
+		return apiErr
+	}
+
+	var problem server.ProblemResponse
+	if err := json.Unmarshal(data, &problem); err == nil && problem.Detail != "" {
+		apiErr.Message = problem.Detail
+		apiErr.InvalidParams = problem.InvalidParams
+		return apiErr
+	}
+
+	var fail server.FailResponse
+	if err := json.Unmarshal(data, &fail); err == nil && fail.Error != "" {
+		apiErr.Message = fail.Error
+		return apiErr
+	}
+
+	apiErr.Message = strings.TrimSpace(string(data))
+
+	return apiErr
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"todoapp/model"
+	"todoapp/search"
+)
+
+const (
+	dateLayout     = "2006-01-02"
+	dateTimeLayout = "2006-01-02 15:04"
+)
+
+// usageError reports an invalid command line, msg is empty if the usage of
+// the command has been printed instead.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	if e.msg == "" {
+		return "invalid usage"
+	}
+
+	return e.msg
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// flags returns the flag set of a command, usage describes its arguments.
+func (c *cli) flags(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: todo %s %s\n", name, usage)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// parse parses args allowing flags between the arguments, as in
+// "todo add Buy milk -tag shopping". Everything after "--" is an argument.
+// It fails unless there are at least min arguments.
+func (c *cli) parse(flags *flag.FlagSet, args []string, min int) ([]string, error) {
+	var positional []string
+
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, &usageError{}
+		}
+
+		rest := flags.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+
+		if len(rest) == 0 {
+			break
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	if len(positional) < min {
+		flags.Usage()
+		return nil, &usageError{}
+	}
+
+	return positional, nil
+}
+
+func (c *cli) list(args []string) error {
+	flags := c.flags("list", "[flags]")
+	completed := flags.String("completed", "", "only todos that are (true) or are not (false) completed")
+	listId := flags.String("list", "", "only todos on the list with this id, 0 for todos on no list")
+	text := flags.String("q", "", "only todos whose title or description contains this text")
+	sort := flags.String("sort", "", "fields to sort by separated by commas, prefixed with - for descending order")
+	limit := flags.String("limit", "", "maximum number of todos")
+
+	if _, err := c.parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	for name, value := range map[string]string{"completed": *completed, "list_id": *listId, "q": *text, "sort": *sort, "limit": *limit} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	var todos []*model.Todo
+	if _, err := c.client.do(http.MethodGet, "/v0/todos", query, "", nil, &todos); err != nil {
+		return err
+	}
+
+	return c.printTodos(todos)
+}
+
+func (c *cli) add(args []string) error {
+	flags := c.flags("add", "[flags] title")
+	description := flags.String("description", "", "longer description of the todo")
+	due := flags.String("due", "", "due date like 2026-10-19, or time like '2026-10-19 17:00'")
+	priority := flags.Int("priority", 0, "priority from 1 (highest) to 9 (lowest)")
+	listId := flags.Int("list", 0, "id of the list to put the todo on")
+	parentId := flags.Int("parent", 0, "id of the todo this one is a subtask of")
+	var tags tagList
+	flags.Var(&tags, "tag", "tag of the todo, may be repeated")
+
+	words, err := c.parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	todo := &model.Todo{
+		Title:       strings.Join(words, " "),
+		Description: *description,
+		Priority:    *priority,
+		Tags:        tags,
+		ListId:      *listId,
+		ParentId:    *parentId,
+	}
+
+	if todo.Due, err = c.parseDue(*due); err != nil {
+		return err
+	}
+
+	var created model.Todo
+	if _, err := c.client.do(http.MethodPost, "/v0/todos", nil, applicationJSON, todo, &created); err != nil {
+		return err
+	}
+
+	return c.printTodos([]*model.Todo{&created})
+}
+
+func (c *cli) done(args []string) error {
+	flags := c.flags("done", "id...")
+
+	ids, err := c.parseIds(flags, args)
+	if err != nil {
+		return err
+	}
+
+	var todos []*model.Todo
+	for _, id := range ids {
+		todo, err := c.patch(id, map[string]interface{}{"completed": true})
+		if err != nil {
+			return err
+		}
+
+		todos = append(todos, todo)
+	}
+
+	return c.printTodos(todos)
+}
+
+func (c *cli) edit(args []string) error {
+	flags := c.flags("edit", "[flags] id")
+	title := flags.String("title", "", "new title")
+	description := flags.String("description", "", "new description, empty to remove it")
+	due := flags.String("due", "", "new due date or time, empty to remove it")
+	priority := flags.Int("priority", 0, "new priority, 0 to remove it")
+	tags := flags.String("tags", "", "new tags separated by commas, empty to remove them")
+	listId := flags.Int("list", 0, "id of the new list, 0 to take the todo off its list")
+	parentId := flags.Int("parent", 0, "id of the new parent, 0 to make the todo a top level todo")
+	completed := flags.Bool("completed", false, "whether the todo is completed")
+
+	positional, err := c.parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) > 1 {
+		return usageErrorf("edit takes a single id, not %s", strings.Join(positional, " "))
+	}
+
+	id, err := parseId(positional[0])
+	if err != nil {
+		return err
+	}
+
+	// Only the flags given change the todo, empty values remove a field.
+	patch := make(map[string]interface{})
+	orNil := func(set bool, value interface{}) interface{} {
+		if !set {
+			return nil
+		}
+		return value
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "title":
+			patch["title"] = *title
+		case "description":
+			patch["description"] = orNil(*description != "", *description)
+		case "due":
+			var dueAt *time.Time
+			if dueAt, err = c.parseDue(*due); err == nil {
+				patch["due"] = orNil(dueAt != nil, dueAt)
+			}
+		case "priority":
+			patch["priority"] = orNil(*priority != 0, *priority)
+		case "tags":
+			patch["tags"] = orNil(*tags != "", strings.Split(*tags, ","))
+		case "list":
+			patch["list_id"] = orNil(*listId != 0, *listId)
+		case "parent":
+			patch["parent_id"] = orNil(*parentId != 0, *parentId)
+		case "completed":
+			patch["completed"] = *completed
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(patch) == 0 {
+		return usageErrorf("edit needs at least one flag saying what to change")
+	}
+
+	todo, err := c.patch(id, patch)
+	if err != nil {
+		return err
+	}
+
+	return c.printTodos([]*model.Todo{todo})
+}
+
+func (c *cli) remove(args []string) error {
+	flags := c.flags("rm", "id...")
+
+	ids, err := c.parseIds(flags, args)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := c.client.do(http.MethodDelete, todoPath(id), nil, "", nil, nil); err != nil {
+			return err
+		}
+
+		if c.output == outputTable {
+			fmt.Fprintf(c.stdout, "moved todo %d to the trash\n", id)
+		}
+	}
+
+	return nil
+}
+
+func (c *cli) search(args []string) error {
+	flags := c.flags("search", "[flags] words...")
+	limit := flags.String("limit", "", "maximum number of results")
+
+	words, err := c.parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"q": {strings.Join(words, " ")}}
+	if *limit != "" {
+		query.Set("limit", *limit)
+	}
+
+	var results []*search.Result
+	if _, err := c.client.do(http.MethodGet, "/v0/search", query, "", nil, &results); err != nil {
+		return err
+	}
+
+	if c.output == outputJSON {
+		return c.printJSON(results)
+	}
+
+	todos := make([]*model.Todo, len(results))
+	for idx, result := range results {
+		todos[idx] = result.Todo
+	}
+
+	return c.printTodos(todos)
+}
+
+// patch applies a merge patch to the todo with the given id.
+func (c *cli) patch(id int, patch map[string]interface{}) (*model.Todo, error) {
+	var todo model.Todo
+	if _, err := c.client.do(http.MethodPatch, todoPath(id), nil, mergePatchJSON, patch, &todo); err != nil {
+		return nil, fmt.Errorf("todo %d: %w", id, err)
+	}
+
+	return &todo, nil
+}
+
+// parseIds parses the todo ids of a command taking one or more of them.
+func (c *cli) parseIds(flags *flag.FlagSet, args []string) ([]int, error) {
+	positional, err := c.parse(flags, args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(positional))
+	for idx, arg := range positional {
+		if ids[idx], err = parseId(arg); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+func parseId(arg string) (int, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil || id <= 0 {
+		return 0, usageErrorf("'%s' is not a todo id", arg)
+	}
+
+	return id, nil
+}
+
+// parseDue parses a date or a date and time in the local time zone, or a
+// time as in RFC 3339. The empty string is no due date.
+func (c *cli) parseDue(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if due, err := time.Parse(time.RFC3339, value); err == nil {
+		return &due, nil
+	}
+
+	for _, layout := range []string{dateTimeLayout, dateLayout} {
+		if due, err := time.ParseInLocation(layout, value, c.loc); err == nil {
+			return &due, nil
+		}
+	}
+
+	return nil, usageErrorf("due must be a date like 2026-10-19 or a time like '2026-10-19 17:00', not '%s'", value)
+}
+
+func todoPath(id int) string {
+	return "/v0/todos/" + strconv.Itoa(id)
+}
+
+// tagList collects the values of a repeated flag.
+type tagList []string
+
+func (tl *tagList) String() string {
+	return strings.Join(*tl, ",")
+}
+
+func (tl *tagList) Set(value string) error {
+	*tl = append(*tl, value)
+	return nil
+}
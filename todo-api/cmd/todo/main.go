@@ -0,0 +1,161 @@
+// Command todo manages the todos of a todoapp server from the terminal.
+//
+// Usage:
+//
+//	todo [-server url] [-token token] [-output table|json] command [arguments]
+//
+// The commands are list, add, done, edit, rm and search, "todo command -h"
+// describes their flags. The exit status tells how a request failed:
+//
+//	0  success
+//	1  the server could not be reached or failed
+//	2  invalid command line
+//	3  the server rejected the request as invalid (400, 422)
+//	4  the token is missing or invalid (401, 403)
+//	5  the todo does not exist (404)
+//	6  the todo changed meanwhile or is still needed (409, 412)
+//	7  the server is unavailable (503)
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	exitOK           = 0
+	exitFailure      = 1
+	exitUsage        = 2
+	exitInvalid      = 3
+	exitUnauthorized = 4
+	exitNotFound     = 5
+	exitConflict     = 6
+	exitUnavailable  = 7
+
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// environment is what the command runs in, tests replace it.
+type environment struct {
+	stdout, stderr io.Writer
+	getenv         func(string) string
+	// loc is the time zone dates are read and shown in.
+	loc *time.Location
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], environment{stdout: os.Stdout, stderr: os.Stderr, getenv: os.Getenv, loc: time.Local}))
+}
+
+// cli runs one command against the server.
+type cli struct {
+	environment
+	client *apiClient
+	output string
+}
+
+// command runs a subcommand with its arguments.
+type command func(c *cli, args []string) error
+
+var commands = map[string]command{
+	"list":   (*cli).list,
+	"add":    (*cli).add,
+	"done":   (*cli).done,
+	"edit":   (*cli).edit,
+	"rm":     (*cli).remove,
+	"search": (*cli).search,
+}
+
+// run executes the command line args and returns the exit status.
+func run(args []string, env environment) int {
+	flags := flag.NewFlagSet("todo", flag.ContinueOnError)
+	flags.SetOutput(env.stderr)
+	serverURL := flags.String("server", envOr(env.getenv, "TODO_SERVER", "http://localhost:8000"), "URL of the todoapp server (env TODO_SERVER)")
+	token := flags.String("token", env.getenv("TODO_TOKEN"), "API token sent as bearer token (env TODO_TOKEN)")
+	output := flags.String("output", outputTable, "output format: table or json")
+	flags.Usage = func() {
+		fmt.Fprintln(env.stderr, "usage: todo [flags] list|add|done|edit|rm|search [arguments]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *output != outputTable && *output != outputJSON {
+		fmt.Fprintf(env.stderr, "todo: output must be table or json, not '%s'\n", *output)
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(env.stderr, "todo: unknown command '%s'\n", flags.Arg(0))
+		flags.Usage()
+		return exitUsage
+	}
+
+	c := &cli{environment: env, client: newAPIClient(*serverURL, *token), output: *output}
+
+	err := cmd(c, flags.Args()[1:])
+	if err == nil {
+		return exitOK
+	}
+
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		if usageErr.msg != "" {
+			fmt.Fprintf(env.stderr, "todo: %s\n", usageErr.msg)
+		}
+		return exitUsage
+	}
+
+	fmt.Fprintf(env.stderr, "todo: %v\n", err)
+
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return exitFailure
+	}
+
+	for _, param := range apiErr.InvalidParams {
+		fmt.Fprintf(env.stderr, "  %s: %s\n", param.Field, param.Reason)
+	}
+
+	return exitStatus(apiErr.Status)
+}
+
+// exitStatus maps the HTTP status of a failed request onto the exit status.
+func exitStatus(status int) int {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return exitInvalid
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return exitUnauthorized
+	case http.StatusNotFound:
+		return exitNotFound
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return exitConflict
+	case http.StatusServiceUnavailable:
+		return exitUnavailable
+	default:
+		return exitFailure
+	}
+}
+
+func envOr(getenv func(string) string, key, fallback string) string {
+	if value := getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+	"todoapp"
+	"todoapp/auth"
+	"todoapp/cmd/server"
+	"todoapp/search"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonTimestampPattern matches the store managed timestamps of JSON output.
+var jsonTimestampPattern = regexp.MustCompile(`"(created_at|updated_at|completed_at)": "[^"]*"`)
+
+func TestRun(t *testing.T) {
+	users, err := auth.NewUsers([]auth.User{{Id: 1, Name: "alice", TokenHash: auth.HashToken("alice-token")}})
+	if err != nil {
+		t.Fatalf("NewUsers() failed: %v", err)
+	}
+
+	backend := store.NewInMemoryStore()
+	index := search.NewIndex(backend.GetAll)
+	service := todoapp.New(store.WithChangeHook(backend, index.Apply))
+
+	ts := httptest.NewServer(server.New(service, server.WithAuthenticator(users), server.WithSearch(index)))
+	defer ts.Close()
+
+	vars := map[string]string{"TODO_SERVER": ts.URL, "TODO_TOKEN": "alice-token"}
+
+	steps := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "List nothing",
+			args:       []string{"list"},
+			wantCode:   exitOK,
+			wantStdout: "ID  DONE  PRI  DUE  TITLE  TAGS\n",
+		},
+		{
+			name:     "Add todo",
+			args:     []string{"add", "-priority", "2", "Buy", "milk", "-tag", "shop", "-tag", "food", "-due", "2026-10-19"},
+			wantCode: exitOK,
+			wantStdout: "ID  DONE  PRI  DUE         TITLE     TAGS\n" +
+				"1         2    2026-10-19  Buy milk  shop,food\n",
+		},
+		{
+			name:     "Add todo as JSON",
+			args:     []string{"-output", "json", "add", "-due", "2026-10-20 17:30", "--", "-", "Call", "mum"},
+			wantCode: exitOK,
+			wantStdout: "[\n  {\n    \"id\": 2,\n    \"title\": \"- Call mum\",\n    \"completed\": false,\n    \"due\": \"2026-10-20T17:30:00Z\",\n" +
+				"    \"version\": 1,\n    \"created_at\": \"<time>\",\n    \"updated_at\": \"<time>\"\n  }\n]\n",
+		},
+		{
+			name:       "Add invalid todo",
+			args:       []string{"add", "-priority", "12", "Fly"},
+			wantCode:   exitInvalid,
+			wantStderr: "todo: invalid todo: priority must be between 0 and 9\n  priority: must be between 0 and 9\n",
+		},
+		{
+			name:       "Add without title",
+			args:       []string{"add", "-priority", "1"},
+			wantCode:   exitUsage,
+			wantStderr: "usage: todo add [flags] title\n",
+		},
+		{
+			name:     "Complete todo",
+			args:     []string{"done", "2"},
+			wantCode: exitOK,
+			wantStdout: "ID  DONE  PRI  DUE               TITLE       TAGS\n" +
+				"2   x          2026-10-20 17:30  - Call mum  \n",
+		},
+		{
+			name:     "Edit todo",
+			args:     []string{"edit", "1", "-title", "Buy oat milk", "-tags", "", "-due", ""},
+			wantCode: exitOK,
+			wantStdout: "ID  DONE  PRI  DUE  TITLE         TAGS\n" +
+				"1         2         Buy oat milk  \n",
+		},
+		{
+			name:       "Edit without changes",
+			args:       []string{"edit", "1"},
+			wantCode:   exitUsage,
+			wantStderr: "todo: edit needs at least one flag saying what to change\n",
+		},
+		{
+			name:       "Edit missing todo",
+			args:       []string{"edit", "-completed", "9"},
+			wantCode:   exitNotFound,
+			wantStderr: "todo: todo 9: patch with id 9: todo not found\n",
+		},
+		{
+			name:     "List open todos",
+			args:     []string{"list", "-completed", "false"},
+			wantCode: exitOK,
+			wantStdout: "ID  DONE  PRI  DUE  TITLE         TAGS\n" +
+				"1         2         Buy oat milk  \n",
+		},
+		{
+			name:       "List with invalid filter",
+			args:       []string{"list", "-sort", "colour"},
+			wantCode:   exitInvalid,
+			wantStderr: "todo: invalid parameter: invalid sort: unknown field 'colour'\n",
+		},
+		{
+			name:     "Search",
+			args:     []string{"search", "oat"},
+			wantCode: exitOK,
+			wantStdout: "ID  DONE  PRI  DUE  TITLE         TAGS\n" +
+				"1         2         Buy oat milk  \n",
+		},
+		{
+			name:       "Remove todos",
+			args:       []string{"rm", "1", "2"},
+			wantCode:   exitOK,
+			wantStdout: "moved todo 1 to the trash\nmoved todo 2 to the trash\n",
+		},
+		{
+			name:       "Remove with invalid id",
+			args:       []string{"-output", "json", "rm", "x"},
+			wantCode:   exitUsage,
+			wantStderr: "todo: 'x' is not a todo id\n",
+		},
+		{
+			name:       "Wrong token",
+			args:       []string{"-token", "mallory-token", "list"},
+			wantCode:   exitUnauthorized,
+			wantStderr: "todo: unauthorized: invalid token\n",
+		},
+		{
+			name:       "Unknown command",
+			args:       []string{"frobnicate"},
+			wantCode:   exitUsage,
+			wantStderr: "todo: unknown command 'frobnicate'\nusage: todo [flags] list|add|done|edit|rm|search [arguments]\n",
+		},
+		{
+			name:       "Unreachable server",
+			args:       []string{"-server", "http://127.0.0.1:1", "list"},
+			wantCode:   exitFailure,
+			wantStderr: "todo: Get \"http://127.0.0.1:1/v0/todos\": ",
+		},
+	}
+	for _, step := range steps {
+		var stdout, stderr bytes.Buffer
+		env := environment{stdout: &stdout, stderr: &stderr, getenv: func(key string) string { return vars[key] }, loc: time.UTC}
+
+		code := run(step.args, env)
+
+		assert.Equal(t, step.wantCode, code, step.name)
+		assert.Equal(t, step.wantStdout, jsonTimestampPattern.ReplaceAllString(stdout.String(), "\"$1\": \"<time>\""), step.name)
+		if step.wantStderr != "" {
+			assert.True(t, bytes.HasPrefix(stderr.Bytes(), []byte(step.wantStderr)), "%s: got stderr %q", step.name, stderr.String())
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   int
+	}{
+		{400, exitInvalid},
+		{401, exitUnauthorized},
+		{404, exitNotFound},
+		{409, exitConflict},
+		{412, exitConflict},
+		{422, exitInvalid},
+		{500, exitFailure},
+		{503, exitUnavailable},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, exitStatus(tt.status), "status %d", tt.status)
+	}
+}
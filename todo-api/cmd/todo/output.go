@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"todoapp/model"
+)
+
+// printTodos prints todos as a table or as JSON.
+func (c *cli) printTodos(todos []*model.Todo) error {
+	if c.output == outputJSON {
+		if todos == nil {
+			todos = []*model.Todo{}
+		}
+
+		return c.printJSON(todos)
+	}
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDONE\tPRI\tDUE\tTITLE\tTAGS")
+
+	for _, todo := range todos {
+		done := ""
+		if todo.Completed {
+			done = "x"
+		}
+
+		priority := ""
+		if todo.Priority != model.PriorityNone {
+			priority = strconv.Itoa(todo.Priority)
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", todo.Id, done, priority, c.formatDue(todo.Due), todo.Title, strings.Join(todo.Tags, ","))
+	}
+
+	return tw.Flush()
+}
+
+// formatDue shows a due time in the local time zone, without the time of day
+// if it is midnight.
+func (c *cli) formatDue(due *time.Time) string {
+	if due == nil {
+		return ""
+	}
+
+	local := due.In(c.loc)
+	if local.Hour() == 0 && local.Minute() == 0 && local.Second() == 0 {
+		return local.Format(dateLayout)
+	}
+
+	return local.Format(dateTimeLayout)
+}
+
+func (c *cli) printJSON(value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode output: %w", err)
+	}
+
+	_, err = fmt.Fprintln(c.stdout, string(data))
+
+	return err
+}
@@ -0,0 +1,133 @@
+// Package events fans the changes of a store out to subscribers and keeps the
+// latest of them for subscribers resuming after a disconnect.
+package events
+
+import (
+	"sync"
+	"time"
+	"todoapp/model"
+	"todoapp/store"
+)
+
+// subscriberBuffer is the number of events a subscriber may fall behind before
+// it is dropped.
+const subscriberBuffer = 64
+
+// Event is a change to a todo numbered in the order it was published.
+// Previous is the todo before an update, if the store knew it.
+type Event struct {
+	Id       uint64
+	Type     store.ChangeType
+	Owner    int
+	Todo     *model.Todo
+	Previous *model.Todo
+	At       time.Time
+}
+
+// Broker numbers published changes, keeps the last of them in a bounded
+// replay buffer and delivers them to the subscribers of their owner.
+type Broker struct {
+	sync.Mutex
+
+	lastId      uint64
+	replay      []Event
+	size        int
+	subscribers map[*Subscription]struct{}
+	now         func() time.Time
+}
+
+// NewBroker returns a broker keeping the last size events for replay.
+func NewBroker(size int) *Broker {
+	return &Broker{
+		size:        size,
+		subscribers: make(map[*Subscription]struct{}),
+		now:         time.Now,
+	}
+}
+
+// Publish records change as the next event, it is a store.ChangeHook.
+func (b *Broker) Publish(change store.Change) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.lastId++
+	event := Event{Id: b.lastId, Type: change.Type, Owner: change.Owner, Todo: change.Todo, Previous: change.Previous, At: b.now().UTC()}
+
+	if b.size > 0 {
+		if len(b.replay) == b.size {
+			copy(b.replay, b.replay[1:])
+			b.replay = b.replay[:b.size-1]
+		}
+		b.replay = append(b.replay, event)
+	}
+
+	for sub := range b.subscribers {
+		if sub.owner != event.Owner {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			// The subscriber is too slow, dropping it lets the client
+			// reconnect and resume from the replay buffer.
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscription receives the events of one owner.
+type Subscription struct {
+	owner  int
+	events chan Event
+	broker *Broker
+}
+
+// Events delivers the events of the subscription, it is closed when the
+// subscription is cancelled or dropped for falling behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Cancel ends the subscription, it may be called more than once.
+func (s *Subscription) Cancel() {
+	s.broker.Lock()
+	defer s.broker.Unlock()
+
+	s.broker.remove(s)
+}
+
+// Subscribe subscribes to the events of owner. Events of owner newer than
+// lastId that are still in the replay buffer are returned for the caller to
+// send first, complete is false if some of them were already discarded. A
+// lastId of zero starts with the next event without replay.
+func (b *Broker) Subscribe(owner int, lastId uint64) (sub *Subscription, replay []Event, complete bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	sub = &Subscription{owner: owner, events: make(chan Event, subscriberBuffer), broker: b}
+	b.subscribers[sub] = struct{}{}
+
+	if lastId == 0 || lastId >= b.lastId {
+		return sub, nil, lastId <= b.lastId
+	}
+
+	complete = len(b.replay) > 0 && b.replay[0].Id <= lastId+1
+	for _, event := range b.replay {
+		if event.Id > lastId && event.Owner == owner {
+			replay = append(replay, event)
+		}
+	}
+
+	return sub, replay, complete
+}
+
+// remove drops sub, callers must hold the lock.
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
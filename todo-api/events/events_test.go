@@ -0,0 +1,93 @@
+package events
+
+import (
+	"testing"
+	"todoapp/model"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func publish(b *Broker, owner int, titles ...string) {
+	for _, title := range titles {
+		b.Publish(store.Change{Type: store.ChangeCreated, Owner: owner, Todo: &model.Todo{Title: title}})
+	}
+}
+
+func ids(events []Event) []uint64 {
+	var ids []uint64
+	for _, event := range events {
+		ids = append(ids, event.Id)
+	}
+
+	return ids
+}
+
+func TestBroker_Subscribe(t *testing.T) {
+	b := NewBroker(10)
+
+	sub, replay, complete := b.Subscribe(1, 0)
+	defer sub.Cancel()
+
+	assert.Empty(t, replay)
+	assert.True(t, complete)
+
+	publish(b, 2, "Bob's todo")
+	publish(b, 1, "Alice's todo")
+
+	event := <-sub.Events()
+	assert.Equal(t, uint64(2), event.Id)
+	assert.Equal(t, store.ChangeCreated, event.Type)
+	assert.Equal(t, "Alice's todo", event.Todo.Title)
+	assert.False(t, event.At.IsZero())
+
+	assert.Empty(t, sub.Events())
+}
+
+func TestBroker_Replay(t *testing.T) {
+	b := NewBroker(3)
+	publish(b, 1, "first", "second")
+	publish(b, 2, "other")
+	publish(b, 1, "third", "fourth")
+
+	tests := []struct {
+		name         string
+		lastId       uint64
+		wantIds      []uint64
+		wantComplete bool
+	}{
+		{name: "fresh subscription", lastId: 0, wantComplete: true},
+		{name: "up to date", lastId: 5, wantComplete: true},
+		{name: "missed one", lastId: 4, wantIds: []uint64{5}, wantComplete: true},
+		{name: "oldest buffered", lastId: 2, wantIds: []uint64{4, 5}, wantComplete: true},
+		{name: "beyond buffer", lastId: 1, wantIds: []uint64{4, 5}, wantComplete: false},
+		{name: "from before restart", lastId: 9, wantComplete: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, replay, complete := b.Subscribe(1, tt.lastId)
+			defer sub.Cancel()
+
+			assert.Equal(t, tt.wantIds, ids(replay))
+			assert.Equal(t, tt.wantComplete, complete)
+		})
+	}
+}
+
+func TestBroker_DropsSlowSubscriber(t *testing.T) {
+	b := NewBroker(0)
+
+	sub, _, _ := b.Subscribe(1, 0)
+	for i := 0; i <= subscriberBuffer; i++ {
+		publish(b, 1, "todo")
+	}
+
+	received := 0
+	for range sub.Events() {
+		received++
+	}
+
+	assert.Equal(t, subscriberBuffer, received)
+
+	sub.Cancel()
+}
@@ -0,0 +1,85 @@
+package todoapp
+
+import (
+	"context"
+	"log"
+	"todoapp/model"
+	"todoapp/store"
+)
+
+// GetHistory returns the revisions of the todo with the given id, oldest
+// first. The history of a todo in the trash can still be read.
+func (t *TodoApp) GetHistory(ctx context.Context, owner int, id int) ([]*model.Revision, error) {
+	revisions, err := t.backend.GetRevisions(ctx, owner, id)
+	if err != nil {
+		return nil, backendError("get history", err)
+	}
+
+	return revisions, nil
+}
+
+// RevertTodo sets the todo with the given id back to the state recorded by
+// one of its revisions. The revert is a write of its own, it is validated like
+// any other update and recorded as a new revision.
+func (t *TodoApp) RevertTodo(ctx context.Context, owner int, id int, number int) (*model.Todo, error) {
+	revisions, err := t.backend.GetRevisions(ctx, owner, id)
+	if err != nil {
+		return nil, backendError("get history", err)
+	}
+
+	var target *model.Revision
+	for _, rev := range revisions {
+		if rev.Number == number {
+			target = rev
+			break
+		}
+	}
+
+	if target == nil || target.Todo == nil {
+		return nil, store.ErrRevisionNotFound
+	}
+
+	current, err := t.backend.GetById(ctx, owner, id)
+	if err != nil {
+		return nil, backendError("get todo", err)
+	}
+
+	reverted := *target.Todo
+	reverted.Version = 0
+
+	if err := reverted.IsValid(); err != nil {
+		return nil, err
+	}
+
+	return t.update(ctx, owner, current, &reverted, &model.Revision{Action: model.ActionReverted, Reverts: number})
+}
+
+// record adds rev for a write that has already been made, before and after
+// are the todo as it was and as it is now, either of them may be nil. Like
+// completeParents it runs after the write, so failures are logged rather than
+// failing the write, and it goes on even if ctx is cancelled meanwhile.
+func (t *TodoApp) record(ctx context.Context, owner int, rev *model.Revision, before, after *model.Todo) {
+	ctx = context.WithoutCancel(ctx)
+
+	state := after
+	if state == nil {
+		state = before
+	}
+
+	changes, err := model.Diff(before, after)
+	if err != nil {
+		log.Printf("todoapp: recording revision of todo %d: %v", state.Id, err)
+		return
+	}
+
+	snapshot := *state
+
+	rev.TodoId = state.Id
+	rev.Actor = owner
+	rev.Changes = changes
+	rev.Todo = &snapshot
+
+	if err := t.backend.AddRevision(ctx, owner, rev); err != nil {
+		log.Printf("todoapp: recording revision of todo %d: %v", state.Id, err)
+	}
+}
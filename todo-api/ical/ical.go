@@ -0,0 +1,291 @@
+// Package ical writes todos as iCalendar VTODO components as described in
+// RFC 5545 and reads VTODO components uploaded by calendar apps.
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"todoapp/transfer"
+	"unicode/utf8"
+)
+
+const (
+	ContentType = "text/calendar; charset=utf-8"
+
+	// prodId identifies todoapp as the producer of a calendar.
+	prodId = "-//todoapp//todoapp//EN"
+	// uidDomain makes the UIDs of todos globally unique, as required for
+	// calendar components.
+	uidDomain = "todoapp"
+
+	// maxLineLength is the length of a content line in octets, longer lines
+	// are folded.
+	maxLineLength = 75
+	// maxReadLine bounds the length of a line of a calendar read, before
+	// unfolding.
+	maxReadLine = 1 << 20
+
+	dateTimeUTC  = "20060102T150405Z"
+	dateTimeFree = "20060102T150405"
+	date         = "20060102"
+)
+
+// ErrMalformed is matched by errors that stop reading a calendar altogether,
+// e.g. a missing VCALENDAR or an unterminated component.
+var ErrMalformed = errors.New("malformed calendar")
+
+// UID returns the UID of the VTODO of the todo with the given id.
+func UID(id int) string {
+	return fmt.Sprintf("todo-%d@%s", id, uidDomain)
+}
+
+// ParseUID returns the id of the todo a UID returned by UID refers to, false
+// if the UID was made by someone else.
+func ParseUID(uid string) (int, bool) {
+	local, ok := strings.CutSuffix(uid, "@"+uidDomain)
+	if !ok {
+		return 0, false
+	}
+
+	digits, ok := strings.CutPrefix(local, "todo-")
+	if !ok {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(digits)
+	if err != nil || id <= 0 || strconv.Itoa(id) != digits {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// Writer writes todos as the VTODO components of a VCALENDAR, it is a
+// transfer.Writer so that a calendar can be streamed like an export.
+type Writer struct {
+	w       io.Writer
+	started bool
+	buf     bytes.Buffer
+}
+
+var _ transfer.Writer = (*Writer)(nil)
+
+// NewWriter returns a Writer writing a calendar to w. Nothing is written
+// before the first todo or Close.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write adds the VTODO of item. The list of the item is not part of it, lists
+// have no counterpart in iCalendar.
+func (cw *Writer) Write(item *transfer.Item) error {
+	if err := cw.start(); err != nil {
+		return err
+	}
+
+	todo := &item.Todo
+
+	cw.line("BEGIN", "VTODO")
+	cw.line("UID", UID(todo.Id))
+	cw.line("DTSTAMP", todo.UpdatedAt.UTC().Format(dateTimeUTC))
+	cw.line("CREATED", todo.CreatedAt.UTC().Format(dateTimeUTC))
+	cw.line("LAST-MODIFIED", todo.UpdatedAt.UTC().Format(dateTimeUTC))
+	cw.line("SUMMARY", escape(todo.Title))
+
+	if todo.Description != "" {
+		cw.line("DESCRIPTION", escape(todo.Description))
+	}
+
+	if todo.Completed {
+		cw.line("STATUS", "COMPLETED")
+		if todo.CompletedAt != nil {
+			cw.line("COMPLETED", todo.CompletedAt.UTC().Format(dateTimeUTC))
+		}
+	} else {
+		cw.line("STATUS", "NEEDS-ACTION")
+	}
+
+	if todo.Due != nil {
+		cw.line("DUE", todo.Due.UTC().Format(dateTimeUTC))
+	}
+
+	if todo.Priority != 0 {
+		cw.line("PRIORITY", strconv.Itoa(todo.Priority))
+	}
+
+	if todo.Recurrence != "" {
+		cw.line("RRULE", strings.TrimPrefix(todo.Recurrence, "RRULE:"))
+	}
+
+	if len(todo.Tags) > 0 {
+		tags := make([]string, len(todo.Tags))
+		for idx, tag := range todo.Tags {
+			tags[idx] = escape(tag)
+		}
+		cw.line("CATEGORIES", strings.Join(tags, ","))
+	}
+
+	if todo.ParentId != 0 {
+		cw.line("RELATED-TO", UID(todo.ParentId))
+	}
+
+	// The version counts every write starting at 1, SEQUENCE starts at 0.
+	if todo.Version > 0 {
+		cw.line("SEQUENCE", strconv.Itoa(todo.Version-1))
+	}
+
+	cw.line("END", "VTODO")
+
+	return cw.flush()
+}
+
+// Close ends the calendar, an empty calendar is written if there were no
+// todos.
+func (cw *Writer) Close() error {
+	if err := cw.start(); err != nil {
+		return err
+	}
+
+	cw.line("END", "VCALENDAR")
+
+	return cw.flush()
+}
+
+func (cw *Writer) start() error {
+	if cw.started {
+		return nil
+	}
+	cw.started = true
+
+	cw.line("BEGIN", "VCALENDAR")
+	cw.line("VERSION", "2.0")
+	cw.line("PRODID", prodId)
+
+	return cw.flush()
+}
+
+// line adds a content line, folded after maxLineLength octets without
+// splitting characters. Continuation lines start with a space.
+func (cw *Writer) line(name, value string) {
+	line := name + ":" + value
+
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		cw.buf.WriteString(line[:cut])
+		cw.buf.WriteString("\r\n ")
+		line = line[cut:]
+
+		// The leading space counts towards the length of the next line.
+		limit = maxLineLength - 1
+	}
+
+	cw.buf.WriteString(line)
+	cw.buf.WriteString("\r\n")
+}
+
+func (cw *Writer) flush() error {
+	defer cw.buf.Reset()
+
+	if _, err := cw.w.Write(cw.buf.Bytes()); err != nil {
+		return fmt.Errorf("write calendar: %w", err)
+	}
+
+	return nil
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// escape encodes a TEXT value.
+func escape(text string) string {
+	return escaper.Replace(text)
+}
+
+// unescape decodes a TEXT value, unknown escapes are kept as they are.
+func unescape(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+
+	var b strings.Builder
+	for idx := 0; idx < len(text); idx++ {
+		if text[idx] != '\\' || idx == len(text)-1 {
+			b.WriteByte(text[idx])
+			continue
+		}
+
+		idx++
+		switch text[idx] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		case '\\', ';', ',':
+			b.WriteByte(text[idx])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(text[idx])
+		}
+	}
+
+	return b.String()
+}
+
+// splitText splits a list of TEXT values at the commas that are not escaped
+// and decodes each of them.
+func splitText(value string) []string {
+	var values []string
+
+	start := 0
+	for idx := 0; idx < len(value); idx++ {
+		switch value[idx] {
+		case '\\':
+			idx++
+		case ',':
+			values = append(values, unescape(value[start:idx]))
+			start = idx + 1
+		}
+	}
+
+	return append(values, unescape(value[start:]))
+}
+
+// parseTime parses a DATE-TIME or, with VALUE=DATE, a DATE. Times without
+// zone are in the zone named by TZID, or in UTC if they are floating, as are
+// dates.
+func parseTime(p *property) (time.Time, error) {
+	if p.params["VALUE"] == "DATE" {
+		return time.Parse(date, p.value)
+	}
+
+	if strings.HasSuffix(p.value, "Z") {
+		return time.Parse(dateTimeUTC, p.value)
+	}
+
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID '%s'", tzid)
+		}
+	}
+
+	t, err := time.ParseInLocation(dateTimeFree, p.value, loc)
+	if err != nil {
+		// Some apps leave out VALUE=DATE.
+		if t, dateErr := time.ParseInLocation(date, p.value, loc); dateErr == nil {
+			return t.UTC(), nil
+		}
+
+		return time.Time{}, err
+	}
+
+	return t.UTC(), nil
+}
@@ -0,0 +1,314 @@
+package ical
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"todoapp/model"
+	"todoapp/transfer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func calendar(lines ...string) string {
+	return strings.Join(append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...), "END:VCALENDAR"), "\r\n") + "\r\n"
+}
+
+func TestWriter(t *testing.T) {
+	due := time.Date(2026, time.October, 19, 17, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	created := time.Date(2026, time.October, 1, 9, 0, 0, 0, time.UTC)
+	updated := time.Date(2026, time.October, 2, 9, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	assert.NoError(t, w.Write(&transfer.Item{Todo: model.Todo{
+		Id: 2, Title: "Buy milk, eggs; bread", Description: "From the\nmarket", Due: &due, Priority: 1,
+		Tags: []string{"shop", "food"}, Recurrence: "FREQ=WEEKLY", ParentId: 1, Version: 3, CreatedAt: created, UpdatedAt: updated,
+	}}))
+	assert.NoError(t, w.Write(&transfer.Item{Todo: model.Todo{
+		Id: 3, Title: "Done", Completed: true, Version: 1, CreatedAt: created, UpdatedAt: updated, CompletedAt: &updated,
+	}}))
+	assert.NoError(t, w.Close())
+
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//todoapp//todoapp//EN",
+		"BEGIN:VTODO",
+		"UID:todo-2@todoapp",
+		"DTSTAMP:20261002T090000Z",
+		"CREATED:20261001T090000Z",
+		"LAST-MODIFIED:20261002T090000Z",
+		`SUMMARY:Buy milk\, eggs\; bread`,
+		`DESCRIPTION:From the\nmarket`,
+		"STATUS:NEEDS-ACTION",
+		"DUE:20261019T150000Z",
+		"PRIORITY:1",
+		"RRULE:FREQ=WEEKLY",
+		"CATEGORIES:shop,food",
+		"RELATED-TO:todo-1@todoapp",
+		"SEQUENCE:2",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:todo-3@todoapp",
+		"DTSTAMP:20261002T090000Z",
+		"CREATED:20261001T090000Z",
+		"LAST-MODIFIED:20261002T090000Z",
+		"SUMMARY:Done",
+		"STATUS:COMPLETED",
+		"COMPLETED:20261002T090000Z",
+		"SEQUENCE:0",
+		"END:VTODO",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	assert.Equal(t, want, buf.String())
+}
+
+func TestWriter_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, NewWriter(&buf).Close())
+
+	assert.Equal(t, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//todoapp//todoapp//EN\r\nEND:VCALENDAR\r\n", buf.String())
+}
+
+func TestWriter_Folding(t *testing.T) {
+	title := strings.Repeat("ä", 100)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	assert.NoError(t, w.Write(&transfer.Item{Todo: model.Todo{Id: 1, Title: title}}))
+	assert.NoError(t, w.Close())
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		assert.True(t, len(line) <= maxLineLength, "line '%s' is %d octets long", line, len(line))
+	}
+
+	entries, err := Parse(&buf)
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, title, entries[0].Todo.Title)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	due := time.Date(2026, time.October, 19, 15, 0, 0, 0, time.UTC)
+	todos := []*model.Todo{
+		{Id: 1, Title: "Move house", Description: "All of it,\nreally", Due: &due, Priority: 2, Tags: []string{"home", "a,b"}, Recurrence: "FREQ=MONTHLY;BYDAY=-1FR"},
+		{Id: 2, Title: "Pack boxes", Completed: true, ParentId: 1},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, todo := range todos {
+		assert.NoError(t, w.Write(&transfer.Item{Todo: *todo}))
+	}
+	assert.NoError(t, w.Close())
+
+	entries, err := Parse(&buf)
+	if !assert.NoError(t, err) || !assert.Len(t, entries, len(todos)) {
+		return
+	}
+
+	for idx, entry := range entries {
+		assert.NoError(t, entry.Err)
+		assert.Equal(t, idx, entry.Index)
+		assert.Equal(t, UID(todos[idx].Id), entry.UID)
+
+		want := *todos[idx]
+		want.Id = 0
+		assert.Equal(t, &want, entry.Todo)
+	}
+}
+
+func TestParse(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	at := func(t time.Time) *time.Time {
+		t = t.UTC()
+		return &t
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  *model.Todo
+		uid   string
+	}{
+		{
+			name:  "Minimal",
+			lines: []string{"SUMMARY:Call mum"},
+			want:  &model.Todo{Title: "Call mum"},
+		},
+		{
+			name: "FoldedAndLowerCase",
+			lines: []string{
+				"uid:abc@example.com",
+				"summary:Call",
+				"  mum",
+			},
+			want: &model.Todo{Title: "Call mum"},
+			uid:  "abc@example.com",
+		},
+		{
+			name:  "DueDate",
+			lines: []string{"SUMMARY:x", "DUE;VALUE=DATE:20261019"},
+			want:  &model.Todo{Title: "x", Due: at(time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC))},
+		},
+		{
+			name:  "DueInZone",
+			lines: []string{"SUMMARY:x", `DUE;TZID="Europe/Berlin":20261019T170000`},
+			want:  &model.Todo{Title: "x", Due: at(time.Date(2026, time.October, 19, 17, 0, 0, 0, berlin))},
+		},
+		{
+			name:  "DueFloating",
+			lines: []string{"SUMMARY:x", "DUE:20261019T170000"},
+			want:  &model.Todo{Title: "x", Due: at(time.Date(2026, time.October, 19, 17, 0, 0, 0, time.UTC))},
+		},
+		{
+			name:  "CompletedWithoutStatus",
+			lines: []string{"SUMMARY:x", "COMPLETED:20261019T170000Z"},
+			want:  &model.Todo{Title: "x", Completed: true},
+		},
+		{
+			name:  "StatusOverridesCompleted",
+			lines: []string{"SUMMARY:x", "STATUS:NEEDS-ACTION", "COMPLETED:20261019T170000Z"},
+			want:  &model.Todo{Title: "x"},
+		},
+		{
+			name:  "Categories",
+			lines: []string{"SUMMARY:x", "CATEGORIES:work, home", "CATEGORIES:later"},
+			want:  &model.Todo{Title: "x", Tags: []string{"work", "home", "later"}},
+		},
+		{
+			name:  "ParentOfTodoapp",
+			lines: []string{"SUMMARY:x", "RELATED-TO;RELTYPE=PARENT:todo-4@todoapp"},
+			want:  &model.Todo{Title: "x", ParentId: 4},
+		},
+		{
+			name:  "ForeignParentAndSibling",
+			lines: []string{"SUMMARY:x", "RELATED-TO:abc@example.com", "RELATED-TO;RELTYPE=SIBLING:todo-4@todoapp"},
+			want:  &model.Todo{Title: "x"},
+		},
+		{
+			name:  "AlarmIgnored",
+			lines: []string{"SUMMARY:x", "BEGIN:VALARM", "DESCRIPTION:Wake up", "END:VALARM", "X-APPLE-SORT-ORDER:3"},
+			want:  &model.Todo{Title: "x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := append(append([]string{"BEGIN:VTODO"}, tt.lines...), "END:VTODO")
+			entries, err := Parse(strings.NewReader(calendar(lines...)))
+			if !assert.NoError(t, err) || !assert.Len(t, entries, 1) {
+				return
+			}
+
+			assert.NoError(t, entries[0].Err)
+			assert.Equal(t, tt.uid, entries[0].UID)
+			assert.Equal(t, tt.want, entries[0].Todo)
+		})
+	}
+}
+
+func TestParse_SkipsOtherComponents(t *testing.T) {
+	entries, err := Parse(strings.NewReader(calendar(
+		"BEGIN:VEVENT", "SUMMARY:Party", "END:VEVENT",
+		"BEGIN:VTODO", "SUMMARY:Bring cake", "END:VTODO",
+		"BEGIN:VTODO", "SUMMARY:Bad", "PRIORITY:high", "END:VTODO",
+	)))
+	if !assert.NoError(t, err) || !assert.Len(t, entries, 2) {
+		return
+	}
+
+	assert.Equal(t, "Bring cake", entries[0].Todo.Title)
+	assert.Equal(t, 1, entries[1].Index)
+	assert.Nil(t, entries[1].Todo)
+	assert.EqualError(t, entries[1].Err, "PRIORITY 'high' is not an integer")
+}
+
+func TestParse_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"Empty", ""},
+		{"NoCalendar", "BEGIN:VTODO\r\nEND:VTODO\r\n"},
+		{"PropertyOutside", "SUMMARY:x\r\n"},
+		{"NotTerminated", "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:x\r\n"},
+		{"MismatchedEnd", "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+		{"NoValue", calendar("BEGIN:VTODO", "SUMMARY", "END:VTODO")},
+		{"UnterminatedParam", calendar("BEGIN:VTODO", `DUE;TZID="Europe/Berlin:20261019T170000`, "END:VTODO")},
+		{"LeadingContinuation", " BEGIN:VCALENDAR\r\n"},
+		{"LineTooLong", calendar("BEGIN:VTODO", "SUMMARY:"+strings.Repeat("x", maxReadLine), "END:VTODO")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.body))
+			assert.True(t, errors.Is(err, ErrMalformed), "got error %v, want %v", err, ErrMalformed)
+		})
+	}
+}
+
+func TestParseUID(t *testing.T) {
+	tests := []struct {
+		uid    string
+		wantId int
+		wantOk bool
+	}{
+		{"todo-12@todoapp", 12, true},
+		{UID(7), 7, true},
+		{"todo-0@todoapp", 0, false},
+		{"todo-012@todoapp", 0, false},
+		{"todo--1@todoapp", 0, false},
+		{"todo-12@example.com", 0, false},
+		{"12@todoapp", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uid, func(t *testing.T) {
+			id, ok := ParseUID(tt.uid)
+			assert.Equal(t, tt.wantId, id)
+			assert.Equal(t, tt.wantOk, ok)
+		})
+	}
+}
+
+func TestPatch(t *testing.T) {
+	due := time.Date(2026, time.October, 19, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		todo *model.Todo
+		want string
+	}{
+		{
+			name: "Minimal",
+			todo: &model.Todo{Title: "x"},
+			want: `{"completed":false,"description":null,"due":null,"parent_id":null,"priority":null,"recurrence":null,"tags":null,"title":"x"}`,
+		},
+		{
+			name: "Full",
+			todo: &model.Todo{Title: "x", Completed: true, Description: "d", Due: &due, Priority: 3, Tags: []string{"a"}, Recurrence: "FREQ=DAILY", ParentId: 2},
+			want: `{"completed":true,"description":"d","due":"2026-10-19T15:00:00Z","parent_id":2,"priority":3,"recurrence":"FREQ=DAILY","tags":["a"],"title":"x"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := Patch(tt.todo)
+			assert.True(t, json.Valid(patch))
+			assert.JSONEq(t, tt.want, string(patch))
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package ical
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"todoapp/model"
+)
+
+// maxComponents bounds the number of VTODO components of an upload.
+const maxComponents = 1000
+
+// Entry is a VTODO read from a calendar. Err reports a component that could
+// not be turned into a todo, Todo is nil then.
+type Entry struct {
+	// Index is the position of the component among the VTODOs of the
+	// calendar, starting at 0.
+	Index int
+	UID   string
+	Todo  *model.Todo
+	Err   error
+}
+
+// Parse reads the VTODO components of the calendar in r, other components
+// like VEVENT are skipped. Properties without counterpart in a todo are
+// ignored, a RELATED-TO referring to a component not made by todoapp as
+// well. Parse fails with ErrMalformed if r is no calendar at all.
+func Parse(r io.Reader) ([]*Entry, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		entries []*Entry
+		stack   []string
+		current []*property
+	)
+
+	for idx, line := range lines {
+		p, err := parseProperty(line)
+		if err != nil {
+			return nil, malformed(fmt.Errorf("line %d: %w", idx+1, err))
+		}
+
+		switch p.name {
+		case "BEGIN":
+			if len(stack) == 0 && p.value != "VCALENDAR" {
+				return nil, malformed(fmt.Errorf("line %d: calendar must start with BEGIN:VCALENDAR", idx+1))
+			}
+
+			stack = append(stack, p.value)
+			if isTodo(stack) {
+				current = nil
+			}
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != p.value {
+				return nil, malformed(fmt.Errorf("line %d: unexpected END:%s", idx+1, p.value))
+			}
+
+			if isTodo(stack) {
+				if len(entries) == maxComponents {
+					return nil, malformed(fmt.Errorf("calendar must not contain more than %d todos", maxComponents))
+				}
+
+				entries = append(entries, newEntry(len(entries), current))
+			}
+
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return entries, nil
+			}
+		default:
+			if len(stack) == 0 {
+				return nil, malformed(fmt.Errorf("line %d: calendar must start with BEGIN:VCALENDAR", idx+1))
+			}
+
+			if isTodo(stack) {
+				current = append(current, p)
+			}
+		}
+	}
+
+	if len(stack) == 0 {
+		return nil, malformed(errors.New("calendar is empty"))
+	}
+
+	return nil, malformed(fmt.Errorf("%s is not terminated", stack[len(stack)-1]))
+}
+
+// isTodo tells whether stack is at a VTODO of the calendar itself, the
+// components nested in it like VALARM are not part of the todo.
+func isTodo(stack []string) bool {
+	return len(stack) == 2 && stack[1] == "VTODO"
+}
+
+// unfold splits r into content lines, joining the continuation lines that
+// start with a space or tab. Both CRLF and bare LF end a line.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxReadLine)
+
+	read := 0
+	for scanner.Scan() {
+		read++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if len(lines) == 0 {
+				return nil, malformed(errors.New("line 1: calendar must not start with a continuation line"))
+			}
+
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, malformed(fmt.Errorf("line %d: %w", read+1, err))
+	}
+
+	return lines, nil
+}
+
+// property is a content line, names and parameter names are upper case.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseProperty parses a content line of the form
+// NAME;PARAM=VALUE;PARAM="QUOTED VALUE":VALUE.
+func parseProperty(line string) (*property, error) {
+	p := &property{params: map[string]string{}}
+
+	end := strings.IndexAny(line, ";:")
+	if end <= 0 {
+		return nil, fmt.Errorf("'%s' is not a property", line)
+	}
+	p.name = strings.ToUpper(line[:end])
+	line = line[end:]
+
+	for strings.HasPrefix(line, ";") {
+		name, rest, ok := strings.Cut(line[1:], "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("parameter of %s has no value", p.name)
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return nil, fmt.Errorf("parameter %s of %s is not terminated", name, p.name)
+			}
+
+			value, rest = rest[1:closing+1], rest[closing+2:]
+		} else {
+			end := strings.IndexAny(rest, ";:")
+			if end < 0 {
+				return nil, fmt.Errorf("property %s has no value", p.name)
+			}
+
+			value, rest = rest[:end], rest[end:]
+		}
+
+		p.params[strings.ToUpper(name)] = value
+		line = rest
+	}
+
+	if !strings.HasPrefix(line, ":") {
+		return nil, fmt.Errorf("property %s has no value", p.name)
+	}
+	p.value = line[1:]
+
+	if p.name == "BEGIN" || p.name == "END" {
+		p.value = strings.ToUpper(p.value)
+	}
+
+	return p, nil
+}
+
+// newEntry turns the properties of a VTODO into a todo.
+func newEntry(index int, props []*property) *Entry {
+	entry := &Entry{Index: index}
+
+	todo, err := newTodo(entry, props)
+	if err != nil {
+		entry.Err = err
+		return entry
+	}
+
+	entry.Todo = todo
+
+	return entry
+}
+
+func newTodo(entry *Entry, props []*property) (*model.Todo, error) {
+	todo := &model.Todo{}
+	status := ""
+	completed := false
+
+	for _, p := range props {
+		switch p.name {
+		case "UID":
+			entry.UID = p.value
+		case "SUMMARY":
+			todo.Title = unescape(p.value)
+		case "DESCRIPTION":
+			todo.Description = unescape(p.value)
+		case "STATUS":
+			status = strings.ToUpper(p.value)
+		case "COMPLETED":
+			completed = true
+		case "DUE":
+			due, err := parseTime(p)
+			if err != nil {
+				return nil, fmt.Errorf("DUE '%s' is not a date or time: %w", p.value, err)
+			}
+			todo.Due = &due
+		case "PRIORITY":
+			priority, err := strconv.Atoi(p.value)
+			if err != nil {
+				return nil, fmt.Errorf("PRIORITY '%s' is not an integer", p.value)
+			}
+			todo.Priority = priority
+		case "RRULE":
+			todo.Recurrence = p.value
+		case "CATEGORIES":
+			for _, tag := range splitText(p.value) {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					todo.Tags = append(todo.Tags, tag)
+				}
+			}
+		case "RELATED-TO":
+			relType := strings.ToUpper(p.params["RELTYPE"])
+			if relType != "" && relType != "PARENT" {
+				continue
+			}
+
+			if parent, ok := ParseUID(p.value); ok {
+				todo.ParentId = parent
+			}
+		}
+	}
+
+	// COMPLETED alone marks a todo done, unless STATUS says otherwise.
+	todo.Completed = status == "COMPLETED" || (status == "" && completed)
+
+	return todo, nil
+}
+
+// Patch returns a merge patch setting the fields of a todo that a VTODO
+// carries to those of todo. The fields missing from todo are removed, the
+// others like the list are left alone.
+func Patch(todo *model.Todo) model.MergePatch {
+	fields := map[string]interface{}{
+		"title":       todo.Title,
+		"completed":   todo.Completed,
+		"description": nil,
+		"due":         nil,
+		"priority":    nil,
+		"tags":        nil,
+		"recurrence":  nil,
+		"parent_id":   nil,
+	}
+
+	if todo.Description != "" {
+		fields["description"] = todo.Description
+	}
+	if todo.Due != nil {
+		fields["due"] = todo.Due
+	}
+	if todo.Priority != 0 {
+		fields["priority"] = todo.Priority
+	}
+	if len(todo.Tags) > 0 {
+		fields["tags"] = todo.Tags
+	}
+	if todo.Recurrence != "" {
+		fields["recurrence"] = todo.Recurrence
+	}
+	if todo.ParentId != 0 {
+		fields["parent_id"] = todo.ParentId
+	}
+
+	// A map of strings, numbers, times and slices always encodes.
+	patch, _ := json.Marshal(fields)
+
+	return model.MergePatch(patch)
+}
+
+// malformed wraps an error that stops reading a calendar.
+func malformed(err error) error {
+	return fmt.Errorf("%w: %w", ErrMalformed, err)
+}
@@ -0,0 +1,94 @@
+package todoapp
+
+import (
+	"context"
+	"log"
+	"todoapp/model"
+)
+
+func (t *TodoApp) GetList(ctx context.Context, owner int, id int) (*model.List, error) {
+	list, err := t.backend.GetList(ctx, owner, id)
+	if err != nil {
+		return nil, backendError("get list", err)
+	}
+
+	return list, nil
+}
+
+func (t *TodoApp) GetLists(ctx context.Context, owner int) ([]*model.List, error) {
+	lists, err := t.backend.GetLists(ctx, owner)
+	if err != nil {
+		return nil, backendError("get lists", err)
+	}
+
+	return lists, nil
+}
+
+func (t *TodoApp) SaveList(ctx context.Context, owner int, list *model.List) error {
+	if err := list.IsValid(); err != nil {
+		return err
+	}
+
+	if err := t.backend.AddList(ctx, owner, list); err != nil {
+		return backendError("save list", err)
+	}
+
+	return nil
+}
+
+func (t *TodoApp) UpdateList(ctx context.Context, owner int, id int, list *model.List) (*model.List, error) {
+	if err := list.IsValid(); err != nil {
+		return nil, err
+	}
+
+	updatedList, err := t.backend.UpdateList(ctx, owner, id, list)
+	if err != nil {
+		return nil, backendError("update list", err)
+	}
+
+	return updatedList, nil
+}
+
+// DeleteList deletes the list with the given id, cascade decides what happens
+// to the todos still on it. The todos deleted or detached along with the list
+// get a revision like any other write.
+func (t *TodoApp) DeleteList(ctx context.Context, owner int, id int, cascade model.Cascade) error {
+	var todos []*model.Todo
+	if cascade != model.CascadeRestrict {
+		var err error
+
+		todos, _, err = t.backend.Query(ctx, owner, model.Query{ListId: &id})
+		if err != nil {
+			return backendError("get todos", err)
+		}
+	}
+
+	if err := t.backend.DeleteList(ctx, owner, id, cascade); err != nil {
+		return backendError("delete list", err)
+	}
+
+	t.recordCascade(ctx, owner, cascade, todos)
+
+	return nil
+}
+
+// recordCascade records the revisions of the todos a deleted list took along.
+// Like record, it is not stopped by the end of ctx since the list is gone.
+func (t *TodoApp) recordCascade(ctx context.Context, owner int, cascade model.Cascade, todos []*model.Todo) {
+	ctx = context.WithoutCancel(ctx)
+
+	for _, todo := range todos {
+		if cascade == model.CascadeDelete {
+			t.record(ctx, owner, &model.Revision{Action: model.ActionDeleted}, todo, nil)
+			continue
+		}
+
+		detached, err := t.backend.GetById(ctx, owner, todo.Id)
+		if err != nil {
+			log.Printf("todoapp: recording revision of todo %d: %v", todo.Id, err)
+			continue
+		}
+
+		t.record(ctx, owner, &model.Revision{Action: model.ActionUpdated}, todo, detached)
+	}
+}
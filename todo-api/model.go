@@ -1,10 +1,35 @@
 package todoapp
 
-import "todoapp/model"
+import (
+	"context"
+	"todoapp/model"
+	"todoapp/transfer"
+)
 
+// TodoService manages the todos of its users, the owner passed to every method
+// is the id of the user the call is made for. A call stops with the error of
+// ctx once ctx is done, e.g. because the client of a request went away.
 type TodoService interface {
-	GetTodo(int) (*model.Todo, error)
-	GetTodos() ([]*model.Todo, error)
-	SaveTodo(*model.Todo) error
-	UpdateTodo(int, *model.Todo) (*model.Todo, error)
+	GetTodo(ctx context.Context, owner int, id int) (*model.Todo, error)
+	GetTodos(ctx context.Context, owner int) ([]*model.Todo, error)
+	QueryTodos(ctx context.Context, owner int, q model.Query) ([]*model.Todo, int, error)
+	SaveTodo(ctx context.Context, owner int, todo *model.Todo) error
+	UpdateTodo(ctx context.Context, owner int, id int, todo *model.Todo) (*model.Todo, error)
+	PatchTodo(ctx context.Context, owner int, id int, version int, patch model.Patch) (*model.Todo, error)
+	DeleteTodo(ctx context.Context, owner int, id int) error
+	GetTodoTree(ctx context.Context, owner int, id int) (*model.Tree, error)
+	GetBlockers(ctx context.Context, owner int, id int) ([]*model.Todo, error)
+	GetTrash(ctx context.Context, owner int) ([]*model.Todo, error)
+	RestoreTodo(ctx context.Context, owner int, id int) (*model.Todo, error)
+	GetHistory(ctx context.Context, owner int, id int) ([]*model.Revision, error)
+	RevertTodo(ctx context.Context, owner int, id int, number int) (*model.Todo, error)
+	BatchTodos(ctx context.Context, owner int, ops []model.Operation) ([]*model.Todo, error)
+	ExportTodos(ctx context.Context, owner int, w transfer.Writer) error
+	ImportTodos(ctx context.Context, owner int, r transfer.Reader, dryRun bool) (*transfer.Report, error)
+
+	GetList(ctx context.Context, owner int, id int) (*model.List, error)
+	GetLists(ctx context.Context, owner int) ([]*model.List, error)
+	SaveList(ctx context.Context, owner int, list *model.List) error
+	UpdateList(ctx context.Context, owner int, id int, list *model.List) (*model.List, error)
+	DeleteList(ctx context.Context, owner int, id int, cascade model.Cascade) error
 }
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxBatchSize bounds the number of operations applied as one batch.
+const MaxBatchSize = 100
+
+var (
+	ErrInvalidBatch = errors.New("invalid batch")
+
+	ErrEmptyBatch    = fmt.Errorf("%w: a batch must contain at least one operation", ErrInvalidBatch)
+	ErrBatchTooLarge = fmt.Errorf("%w: a batch must not contain more than %d operations", ErrInvalidBatch, MaxBatchSize)
+	ErrUnknownOp     = fmt.Errorf("%w: op must be one of %s, %s or %s", ErrInvalidBatch, OpCreate, OpUpdate, OpDelete)
+	ErrMissingId     = fmt.Errorf("%w: id must be set to update or delete a todo", ErrInvalidBatch)
+)
+
+// OpKind tells what an Operation does.
+type OpKind string
+
+const (
+	OpCreate OpKind = "create"
+	OpUpdate OpKind = "update"
+	OpDelete OpKind = "delete"
+)
+
+// Operation is one write of a batch. OpCreate takes the new Todo, OpUpdate the
+// Id of the todo to replace along with the replacing Todo, and OpDelete only
+// the Id.
+type Operation struct {
+	Op   OpKind `json:"op"`
+	Id   int    `json:"id,omitempty"`
+	Todo *Todo  `json:"todo,omitempty"`
+}
+
+// IsValid checks the shape of the operation and validates its todo, it does
+// not check whether the todos it refers to exist.
+func (op *Operation) IsValid() error {
+	switch op.Op {
+	case OpCreate:
+		return op.Todo.IsValid()
+	case OpUpdate:
+		if op.Id <= 0 {
+			return ErrMissingId
+		}
+
+		return op.Todo.IsValid()
+	case OpDelete:
+		if op.Id <= 0 {
+			return ErrMissingId
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w, not '%s'", ErrUnknownOp, op.Op)
+	}
+}
+
+// OperationError reports the operation that failed a batch. A batch is
+// applied as a whole or not at all, so none of its operations took effect.
+type OperationError struct {
+	Index int
+	Err   error
+}
+
+func (oe *OperationError) Error() string {
+	return fmt.Sprintf("operation %d: %v", oe.Index, oe.Err)
+}
+
+func (oe *OperationError) Unwrap() error {
+	return oe.Err
+}
+
+// CheckBatch validates every operation of a batch and returns an
+// *OperationError for the first invalid one.
+func CheckBatch(ops []Operation) error {
+	if len(ops) == 0 {
+		return ErrEmptyBatch
+	}
+
+	if len(ops) > MaxBatchSize {
+		return ErrBatchTooLarge
+	}
+
+	for idx := range ops {
+		if err := ops[idx].IsValid(); err != nil {
+			return &OperationError{Index: idx, Err: err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckBatch(t *testing.T) {
+	tooMany := make([]Operation, MaxBatchSize+1)
+	for idx := range tooMany {
+		tooMany[idx] = Operation{Op: OpDelete, Id: idx + 1}
+	}
+
+	tests := []struct {
+		name      string
+		ops       []Operation
+		wantErr   error
+		wantIndex int
+	}{
+		{name: "valid", ops: []Operation{
+			{Op: OpCreate, Todo: &Todo{Title: "Say hello"}},
+			{Op: OpUpdate, Id: 1, Todo: &Todo{Title: "Say goodbye"}},
+			{Op: OpDelete, Id: 2},
+		}},
+		{name: "empty", ops: nil, wantErr: ErrEmptyBatch, wantIndex: -1},
+		{name: "too many", ops: tooMany, wantErr: ErrBatchTooLarge, wantIndex: -1},
+		{name: "unknown op", ops: []Operation{{Op: "upsert", Id: 1}}, wantErr: ErrUnknownOp},
+		{name: "update without id", ops: []Operation{{Op: OpUpdate, Todo: &Todo{Title: "Say hello"}}}, wantErr: ErrMissingId},
+		{name: "delete without id", ops: []Operation{{Op: OpDelete}}, wantErr: ErrMissingId},
+		{name: "create without todo", ops: []Operation{{Op: OpCreate}}, wantErr: ErrNilTodo},
+		{
+			name:      "invalid todo",
+			ops:       []Operation{{Op: OpDelete, Id: 1}, {Op: OpUpdate, Id: 2, Todo: &Todo{}}},
+			wantErr:   ErrEmptyTitle,
+			wantIndex: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckBatch(tt.ops)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+
+			var operr *OperationError
+			if tt.wantIndex < 0 {
+				assert.False(t, errors.As(err, &operr), "got operation error %v", err)
+			} else if assert.True(t, errors.As(err, &operr), "got error %v, want operation error", err) {
+				assert.Equal(t, tt.wantIndex, operr.Index)
+			}
+		})
+	}
+}
+
+func TestValidationError_WithPrefix(t *testing.T) {
+	err := (&Todo{Title: "", Priority: 12}).IsValid()
+
+	var verr *ValidationError
+	if !assert.True(t, errors.As(err, &verr)) {
+		return
+	}
+
+	prefixed := verr.WithPrefix("operations[3].todo.")
+	assert.Equal(t, verr.Error(), prefixed.Error())
+	assert.True(t, errors.Is(prefixed, ErrEmptyTitle))
+	assert.Equal(t, []string{"operations[3].todo.title", "operations[3].todo.priority"},
+		[]string{prefixed.Fields[0].Field, prefixed.Fields[1].Field})
+	assert.Equal(t, "title", verr.Fields[0].Field)
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+const MaxListNameLength = 100
+
+var (
+	ErrInvalidList = errors.New("invalid list")
+	ErrNilList     = errors.New("nil list")
+
+	ErrEmptyListName   = fmt.Errorf("%w: name must not be empty", ErrInvalidList)
+	ErrListNameTooLong = fmt.Errorf("%w: name must not exceed %d characters", ErrInvalidList, MaxListNameLength)
+
+	ErrInvalidCascade = errors.New("invalid cascade")
+)
+
+// List groups todos, e.g. the backlog of a project. A todo belongs to at most
+// one list, see Todo.ListId.
+type List struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+
+	// The timestamps are maintained by the store, values sent by clients are
+	// ignored.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsValid returns ErrNilList for a nil list and a *ValidationError listing
+// every failed field otherwise, or nil if the list is valid.
+func (l *List) IsValid() error {
+	if l == nil {
+		return ErrNilList
+	}
+
+	verr := &ValidationError{kind: ErrInvalidList}
+
+	nameLength := utf8.RuneCountInString(l.Name)
+	if nameLength == 0 {
+		verr.add("name", RuleRequired, "must not be empty", ErrEmptyListName)
+	}
+
+	if nameLength > MaxListNameLength {
+		verr.add("name", RuleMaxLength, fmt.Sprintf("must not exceed %d characters", MaxListNameLength), ErrListNameTooLong)
+	}
+
+	return verr.errOrNil()
+}
+
+// Cascade decides what happens to the todos on a list when it is deleted.
+type Cascade string
+
+const (
+	// CascadeRestrict refuses to delete a list that still has todos.
+	CascadeRestrict Cascade = "restrict"
+	// CascadeDelete deletes the todos together with their list, unless todos
+	// on other lists are subtasks of or blocked by them.
+	CascadeDelete Cascade = "delete"
+	// CascadeDetach keeps the todos but takes them off the deleted list.
+	CascadeDetach Cascade = "detach"
+)
+
+// ParseCascade parses one of the Cascade* values, the empty string is
+// CascadeRestrict.
+func ParseCascade(value string) (Cascade, error) {
+	switch cascade := Cascade(value); cascade {
+	case "":
+		return CascadeRestrict, nil
+	case CascadeRestrict, CascadeDelete, CascadeDetach:
+		return cascade, nil
+	default:
+		return "", fmt.Errorf("%w: '%s' is not one of %s, %s or %s", ErrInvalidCascade, value,
+			CascadeRestrict, CascadeDelete, CascadeDetach)
+	}
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestList_IsValid(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    *List
+		wantErr error
+	}{
+		{name: "nil list", list: nil, wantErr: ErrNilList},
+		{name: "valid list", list: &List{Name: "Groceries"}},
+		{name: "empty name", list: &List{Name: ""}, wantErr: ErrEmptyListName},
+		{name: "long name", list: &List{Name: strings.Repeat("ü", MaxListNameLength+1)}, wantErr: ErrListNameTooLong},
+		{name: "longest name", list: &List{Name: strings.Repeat("ü", MaxListNameLength)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.list.IsValid()
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+
+			if tt.wantErr != ErrNilList {
+				assert.True(t, errors.Is(err, ErrInvalidList))
+				assert.False(t, errors.Is(err, ErrInvalidTodo))
+				assert.Equal(t, tt.wantErr.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestParseCascade(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Cascade
+		wantErr bool
+	}{
+		{value: "", want: CascadeRestrict},
+		{value: "restrict", want: CascadeRestrict},
+		{value: "delete", want: CascadeDelete},
+		{value: "detach", want: CascadeDetach},
+		{value: "nullify", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseCascade(tt.value)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrInvalidCascade), "got error %v, want %v", err, ErrInvalidCascade)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -2,37 +2,258 @@ package model
 
 import (
 	"errors"
+	"fmt"
 	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 10000
+	MaxTags              = 20
+	MaxTagLength         = 32
+
+	// PriorityNone marks a todo without priority, otherwise priorities range
+	// from PriorityHighest to PriorityLowest like in iCalendar.
+	PriorityNone    = 0
+	PriorityHighest = 1
+	PriorityLowest  = 9
 )
 
 var (
 	ErrInvalidTodo = errors.New("invalid todo")
 	ErrNilTodo     = errors.New("nil todo")
+	ErrInvalidSort = errors.New("invalid sort")
+
+	ErrEmptyTitle         = fmt.Errorf("%w: title must not be empty", ErrInvalidTodo)
+	ErrTitleTooLong       = fmt.Errorf("%w: title must not exceed %d characters", ErrInvalidTodo, MaxTitleLength)
+	ErrDescriptionTooLong = fmt.Errorf("%w: description must not exceed %d characters", ErrInvalidTodo, MaxDescriptionLength)
+	ErrInvalidPriority    = fmt.Errorf("%w: priority must be between %d and %d", ErrInvalidTodo, PriorityNone, PriorityLowest)
+	ErrTooManyTags        = fmt.Errorf("%w: a todo must not have more than %d tags", ErrInvalidTodo, MaxTags)
+	ErrInvalidTag         = fmt.Errorf("%w: tags must be 1 to %d characters without whitespace", ErrInvalidTodo, MaxTagLength)
+	ErrDuplicateTag       = fmt.Errorf("%w: tags must be unique", ErrInvalidTodo)
+	ErrInvalidListId      = fmt.Errorf("%w: list_id must not be negative", ErrInvalidTodo)
+)
+
+const (
+	SortFieldId        = "id"
+	SortFieldTitle     = "title"
+	SortFieldCompleted = "completed"
+	SortFieldDue       = "due"
+	SortFieldPriority  = "priority"
+	SortFieldCreatedAt = "created_at"
+	SortFieldUpdatedAt = "updated_at"
+	SortFieldListId    = "list_id"
 )
 
 // Todo is the underlying structure that is bein handled by the TodoService
 type Todo struct {
-	Id        int    `json:"id"`
-	Title     string `json:"title"`
-	Completed bool   `json:"completed"`
+	Id          int        `json:"id"`
+	Title       string     `json:"title"`
+	Completed   bool       `json:"completed"`
+	Description string     `json:"description,omitempty"`
+	Due         *time.Time `json:"due,omitempty"`
+	Priority    int        `json:"priority,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	// Recurrence is a rule as accepted by ParseRule, completing a recurring
+	// todo creates its next occurrence, which the rule moves on to. The rule
+	// applies to the due date in UTC.
+	Recurrence string `json:"recurrence,omitempty"`
+
+	// ListId is the list the todo belongs to, zero if it is not on any list.
+	ListId int `json:"list_id,omitempty"`
+	// ParentId is the todo this one is a subtask of, zero for top level todos.
+	ParentId int `json:"parent_id,omitempty"`
+	// AutoComplete completes the todo once all of its subtasks are completed.
+	AutoComplete bool `json:"auto_complete,omitempty"`
+	// BlockedBy lists the todos that have to be completed before this one.
+	BlockedBy []int `json:"blocked_by,omitempty"`
+
+	// Version is maintained by the store and incremented on every write. An
+	// update carrying a non-zero Version only succeeds if it is still current.
+	Version int `json:"version"`
+
+	// The timestamps are maintained by the store, values sent by clients are
+	// ignored.
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// DeletedAt is set while the todo is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// IsValid returns ErrNilTodo for a nil todo and a *ValidationError listing
+// every failed field otherwise, or nil if the todo is valid.
 func (t *Todo) IsValid() error {
 	if t == nil {
 		return ErrNilTodo
 	}
 
-	if t.Title == "" {
-		return ErrInvalidTodo
+	verr := &ValidationError{kind: ErrInvalidTodo}
+
+	titleLength := utf8.RuneCountInString(t.Title)
+	if titleLength == 0 {
+		verr.add("title", RuleRequired, "must not be empty", ErrEmptyTitle)
+	}
+
+	if titleLength > MaxTitleLength {
+		verr.add("title", RuleMaxLength, fmt.Sprintf("must not exceed %d characters", MaxTitleLength), ErrTitleTooLong)
+	}
+
+	if utf8.RuneCountInString(t.Description) > MaxDescriptionLength {
+		verr.add("description", RuleMaxLength, fmt.Sprintf("must not exceed %d characters", MaxDescriptionLength), ErrDescriptionTooLong)
+	}
+
+	if t.Priority < PriorityNone || t.Priority > PriorityLowest {
+		verr.add("priority", RuleRange, fmt.Sprintf("must be between %d and %d", PriorityNone, PriorityLowest), ErrInvalidPriority)
+	}
+
+	if t.ListId < 0 {
+		verr.add("list_id", RuleMin, "must not be negative", ErrInvalidListId)
+	}
+
+	t.validateRecurrence(verr)
+	t.validateRelations(verr)
+
+	if len(t.Tags) > MaxTags {
+		verr.add("tags", RuleMaxItems, fmt.Sprintf("must not contain more than %d tags", MaxTags), ErrTooManyTags)
+	}
+
+	seen := make(map[string]bool, len(t.Tags))
+	for idx, tag := range t.Tags {
+		field := fmt.Sprintf("tags[%d]", idx)
+
+		if !validTag(tag) {
+			verr.add(field, RuleFormat, fmt.Sprintf("must be 1 to %d characters without whitespace", MaxTagLength), ErrInvalidTag)
+			continue
+		}
+
+		if seen[tag] {
+			verr.add(field, RuleUnique, "must not repeat an earlier tag", ErrDuplicateTag)
+		}
+		seen[tag] = true
+	}
+
+	return verr.errOrNil()
+}
+
+func validTag(tag string) bool {
+	if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength {
+		return false
 	}
 
-	return nil
+	return strings.IndexFunc(tag, unicode.IsSpace) == -1
+}
+
+// SortKey orders todos by one of the SortField* fields, Desc reverses the
+// order for that field.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+func (k SortKey) String() string {
+	if k.Desc {
+		return "-" + k.Field
+	}
+
+	return k.Field
+}
+
+var sortComparators = map[string]func(a, b *Todo) int{
+	SortFieldId:        func(a, b *Todo) int { return a.Id - b.Id },
+	SortFieldTitle:     func(a, b *Todo) int { return strings.Compare(a.Title, b.Title) },
+	SortFieldCompleted: func(a, b *Todo) int { return boolToInt(a.Completed) - boolToInt(b.Completed) },
+	SortFieldDue:       func(a, b *Todo) int { return compareTimes(a.Due, b.Due) },
+	SortFieldPriority:  func(a, b *Todo) int { return a.Priority - b.Priority },
+	SortFieldCreatedAt: func(a, b *Todo) int { return compareTimes(&a.CreatedAt, &b.CreatedAt) },
+	SortFieldUpdatedAt: func(a, b *Todo) int { return compareTimes(&a.UpdatedAt, &b.UpdatedAt) },
+	SortFieldListId:    func(a, b *Todo) int { return a.ListId - b.ListId },
+}
+
+// ParseSort parses a comma separated list of fields, each optionally prefixed
+// with '-' for descending order, e.g. "completed,-title".
+func ParseSort(spec string) ([]SortKey, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	var keys []SortKey
+	for _, field := range strings.Split(spec, ",") {
+		key := SortKey{Field: strings.TrimSpace(field)}
+		if strings.HasPrefix(key.Field, "-") {
+			key.Field = key.Field[1:]
+			key.Desc = true
+		}
+
+		if _, ok := sortComparators[key.Field]; !ok {
+			return nil, fmt.Errorf("%w: unknown field '%s'", ErrInvalidSort, key.Field)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Sort orders todos by keys, ties are broken by ascending id so the result is
+// always deterministic.
+func Sort(todos []*Todo, keys ...SortKey) {
+	sort.SliceStable(todos, func(i, j int) bool {
+		for _, key := range keys {
+			cmp, ok := sortComparators[key.Field]
+			if !ok {
+				continue
+			}
+
+			c := cmp(todos[i], todos[j])
+			if key.Desc {
+				c = -c
+			}
+
+			if c != 0 {
+				return c < 0
+			}
+		}
+
+		return todos[i].Id < todos[j].Id
+	})
 }
 
 func SortByTitle(todos []*Todo) {
-	sort.Slice(todos, func(i, j int) bool { return todos[i].Title < todos[j].Title })
+	Sort(todos, SortKey{Field: SortFieldTitle})
 }
 
 func SortById(todos []*Todo) {
-	sort.Slice(todos, func(i, j int) bool { return todos[i].Id < todos[j].Id })
+	Sort(todos, SortKey{Field: SortFieldId})
+}
+
+// compareTimes orders missing times before all others, matching how SQL
+// orders NULL values.
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	case a.Before(*b):
+		return -1
+	case a.After(*b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
 }
@@ -1,7 +1,11 @@
 package model
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -93,3 +97,304 @@ func TestSortById(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []SortKey
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			spec: "",
+			want: nil,
+		},
+		{
+			name: "single ascending",
+			spec: "title",
+			want: []SortKey{{Field: SortFieldTitle}},
+		},
+		{
+			name: "multiple with descending",
+			spec: "completed,-id",
+			want: []SortKey{{Field: SortFieldCompleted}, {Field: SortFieldId, Desc: true}},
+		},
+		{
+			name:    "unknown field",
+			spec:    "title,colour",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSort(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSort(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+				return
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []SortKey
+		unsorted []*Todo
+		wantIds  []int
+	}{
+		{
+			name: "no keys sorts by id",
+			unsorted: []*Todo{
+				{Id: 3, Title: "a"},
+				{Id: 1, Title: "c"},
+				{Id: 2, Title: "b"},
+			},
+			wantIds: []int{1, 2, 3},
+		},
+		{
+			name: "descending id",
+			keys: []SortKey{{Field: SortFieldId, Desc: true}},
+			unsorted: []*Todo{
+				{Id: 1, Title: "a"},
+				{Id: 3, Title: "c"},
+				{Id: 2, Title: "b"},
+			},
+			wantIds: []int{3, 2, 1},
+		},
+		{
+			name: "title ties broken by id",
+			keys: []SortKey{{Field: SortFieldTitle}},
+			unsorted: []*Todo{
+				{Id: 3, Title: "same"},
+				{Id: 2, Title: "other"},
+				{Id: 1, Title: "same"},
+			},
+			wantIds: []int{2, 1, 3},
+		},
+		{
+			name: "open first then title descending",
+			keys: []SortKey{{Field: SortFieldCompleted}, {Field: SortFieldTitle, Desc: true}},
+			unsorted: []*Todo{
+				{Id: 1, Title: "a", Completed: true},
+				{Id: 2, Title: "b"},
+				{Id: 3, Title: "c"},
+				{Id: 4, Title: "d", Completed: true},
+			},
+			wantIds: []int{3, 2, 4, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Sort(tt.unsorted, tt.keys...)
+
+			ids := make([]int, len(tt.unsorted))
+			for idx, todo := range tt.unsorted {
+				ids[idx] = todo.Id
+			}
+
+			assert.Equal(t, tt.wantIds, ids)
+		})
+	}
+}
+
+func TestTodo_IsValid(t *testing.T) {
+	tests := []struct {
+		name       string
+		todo       *Todo
+		wantErr    error
+		wantFields []string
+	}{
+		{
+			name:    "nil todo",
+			todo:    nil,
+			wantErr: ErrNilTodo,
+		},
+		{
+			name: "title only",
+			todo: &Todo{Title: "Say hello"},
+		},
+		{
+			name: "all fields",
+			todo: &Todo{
+				Title:       "Say hello",
+				Description: "To everyone",
+				Priority:    PriorityHighest,
+				Tags:        []string{"social", "@home"},
+			},
+		},
+		{
+			name:       "empty title",
+			todo:       &Todo{Title: ""},
+			wantErr:    ErrEmptyTitle,
+			wantFields: []string{"title:required"},
+		},
+		{
+			name:       "long title",
+			todo:       &Todo{Title: strings.Repeat("ä", MaxTitleLength+1)},
+			wantErr:    ErrTitleTooLong,
+			wantFields: []string{"title:max_length"},
+		},
+		{
+			name:       "long description",
+			todo:       &Todo{Title: "Say hello", Description: strings.Repeat("a", MaxDescriptionLength+1)},
+			wantErr:    ErrDescriptionTooLong,
+			wantFields: []string{"description:max_length"},
+		},
+		{
+			name:       "priority too low",
+			todo:       &Todo{Title: "Say hello", Priority: PriorityLowest + 1},
+			wantErr:    ErrInvalidPriority,
+			wantFields: []string{"priority:range"},
+		},
+		{
+			name:       "negative priority",
+			todo:       &Todo{Title: "Say hello", Priority: -1},
+			wantErr:    ErrInvalidPriority,
+			wantFields: []string{"priority:range"},
+		},
+		{
+			name:       "tag with whitespace",
+			todo:       &Todo{Title: "Say hello", Tags: []string{"ok", "two words"}},
+			wantErr:    ErrInvalidTag,
+			wantFields: []string{"tags[1]:format"},
+		},
+		{
+			name:       "empty tag",
+			todo:       &Todo{Title: "Say hello", Tags: []string{""}},
+			wantErr:    ErrInvalidTag,
+			wantFields: []string{"tags[0]:format"},
+		},
+		{
+			name:       "duplicate tag",
+			todo:       &Todo{Title: "Say hello", Tags: []string{"a", "b", "a"}},
+			wantErr:    ErrDuplicateTag,
+			wantFields: []string{"tags[2]:unique"},
+		},
+		{
+			name:       "too many tags",
+			todo:       &Todo{Title: "Say hello", Tags: distinctTags(MaxTags + 1)},
+			wantErr:    ErrTooManyTags,
+			wantFields: []string{"tags:max_items"},
+		},
+		{
+			name:       "negative list id",
+			todo:       &Todo{Title: "Say hello", ListId: -1},
+			wantErr:    ErrInvalidListId,
+			wantFields: []string{"list_id:min"},
+		},
+		{
+			name: "recurring todo",
+			todo: &Todo{Title: "Say hello", Due: &time.Time{}, Recurrence: "FREQ=WEEKLY;BYDAY=MO"},
+		},
+		{
+			name:       "unsupported recurrence",
+			todo:       &Todo{Title: "Say hello", Due: &time.Time{}, Recurrence: "FREQ=YEARLY"},
+			wantErr:    ErrInvalidRecurrence,
+			wantFields: []string{"recurrence:format"},
+		},
+		{
+			name:       "recurrence without due date",
+			todo:       &Todo{Title: "Say hello", Recurrence: "FREQ=DAILY"},
+			wantErr:    ErrRecurrenceWithoutDue,
+			wantFields: []string{"due:required"},
+		},
+		{
+			name:       "negative parent id",
+			todo:       &Todo{Title: "Say hello", ParentId: -1},
+			wantErr:    ErrInvalidParentId,
+			wantFields: []string{"parent_id:min"},
+		},
+		{
+			name:       "invalid blocker",
+			todo:       &Todo{Title: "Say hello", BlockedBy: []int{1, 0}},
+			wantErr:    ErrInvalidBlockerId,
+			wantFields: []string{"blocked_by[1]:min"},
+		},
+		{
+			name:       "duplicate blocker",
+			todo:       &Todo{Title: "Say hello", BlockedBy: []int{1, 2, 1}},
+			wantErr:    ErrDuplicateBlocker,
+			wantFields: []string{"blocked_by[2]:unique"},
+		},
+		{
+			name:       "every failing field is reported",
+			todo:       &Todo{Priority: 10, Tags: []string{"a b"}},
+			wantErr:    ErrInvalidPriority,
+			wantFields: []string{"title:required", "priority:range", "tags[0]:format"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.todo.IsValid()
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+
+			if tt.wantErr == ErrNilTodo {
+				return
+			}
+
+			assert.True(t, errors.Is(err, ErrInvalidTodo))
+
+			var verr *ValidationError
+			if assert.True(t, errors.As(err, &verr)) {
+				fields := make([]string, len(verr.Fields))
+				for idx, field := range verr.Fields {
+					fields[idx] = field.Field + ":" + field.Rule
+				}
+
+				assert.Equal(t, tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestSort_Details(t *testing.T) {
+	early := time.Date(2019, time.May, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		keys    []SortKey
+		wantIds []int
+	}{
+		{"due with missing first", []SortKey{{Field: SortFieldDue}}, []int{3, 2, 1}},
+		{"due descending", []SortKey{{Field: SortFieldDue, Desc: true}}, []int{1, 2, 3}},
+		{"priority", []SortKey{{Field: SortFieldPriority}}, []int{2, 1, 3}},
+		{"created at", []SortKey{{Field: SortFieldCreatedAt}}, []int{2, 3, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todos := []*Todo{
+				{Id: 1, Due: &late, Priority: 3, CreatedAt: late},
+				{Id: 2, Due: &early, Priority: 1, CreatedAt: early},
+				{Id: 3, Priority: 5, CreatedAt: early},
+			}
+
+			Sort(todos, tt.keys...)
+
+			ids := make([]int, len(todos))
+			for idx, todo := range todos {
+				ids[idx] = todo.Id
+			}
+
+			assert.Equal(t, tt.wantIds, ids)
+		})
+	}
+}
+
+func distinctTags(n int) []string {
+	tags := make([]string, n)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	return tags
+}
@@ -0,0 +1,191 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch_Apply(t *testing.T) {
+	tests := []struct {
+		name    string
+		todo    *Todo
+		patch   string
+		want    *Todo
+		wantErr error
+	}{
+		{
+			name:  "complete only",
+			todo:  &Todo{Id: 1, Title: "Hey"},
+			patch: `{"completed":true}`,
+			want:  &Todo{Id: 1, Title: "Hey", Completed: true},
+		},
+		{
+			name:  "change title",
+			todo:  &Todo{Id: 1, Title: "Hey", Completed: true},
+			patch: `{"title":"Updated"}`,
+			want:  &Todo{Id: 1, Title: "Updated", Completed: true},
+		},
+		{
+			name:  "null removes member",
+			todo:  &Todo{Id: 1, Title: "Hey"},
+			patch: `{"title":null}`,
+			want:  &Todo{Id: 1},
+		},
+		{
+			name:  "empty patch",
+			todo:  &Todo{Id: 1, Title: "Hey"},
+			patch: `{}`,
+			want:  &Todo{Id: 1, Title: "Hey"},
+		},
+		{
+			name:    "not an object",
+			todo:    &Todo{Id: 1, Title: "Hey"},
+			patch:   `["title"]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "malformed",
+			todo:    &Todo{Id: 1, Title: "Hey"},
+			patch:   `{"title":`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "wrong type",
+			todo:    &Todo{Id: 1, Title: "Hey"},
+			patch:   `{"completed":"yes"}`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "nil todo",
+			todo:    nil,
+			patch:   `{}`,
+			wantErr: ErrNilTodo,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var original Todo
+			if tt.todo != nil {
+				original = *tt.todo
+			}
+
+			got, err := MergePatch(tt.patch).Apply(tt.todo)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+				assert.Equal(t, original, *tt.todo)
+			}
+		})
+	}
+}
+
+func TestJSONPatch_Apply(t *testing.T) {
+	tests := []struct {
+		name    string
+		todo    *Todo
+		patch   string
+		want    *Todo
+		wantErr error
+	}{
+		{
+			name:  "replace completed",
+			todo:  &Todo{Id: 1, Title: "Hey"},
+			patch: `[{"op":"replace","path":"/completed","value":true}]`,
+			want:  &Todo{Id: 1, Title: "Hey", Completed: true},
+		},
+		{
+			name:  "add replaces existing member",
+			todo:  &Todo{Id: 1, Title: "Hey"},
+			patch: `[{"op":"add","path":"/title","value":"Added"}]`,
+			want:  &Todo{Id: 1, Title: "Added"},
+		},
+		{
+			name:  "test then replace",
+			todo:  &Todo{Id: 1, Title: "Hey"},
+			patch: `[{"op":"test","path":"/title","value":"Hey"},{"op":"replace","path":"/title","value":"Updated"}]`,
+			want:  &Todo{Id: 1, Title: "Updated"},
+		},
+		{
+			name:  "remove member",
+			todo:  &Todo{Id: 1, Title: "Hey", Completed: true},
+			patch: `[{"op":"remove","path":"/completed"}]`,
+			want:  &Todo{Id: 1, Title: "Hey"},
+		},
+		{
+			name:  "copy and move",
+			todo:  &Todo{Id: 1, Title: "Hey"},
+			patch: `[{"op":"copy","from":"/title","path":"/scratch"},{"op":"remove","path":"/title"},{"op":"move","from":"/scratch","path":"/title"}]`,
+			want:  &Todo{Id: 1, Title: "Hey"},
+		},
+		{
+			name:  "escaped pointer",
+			todo:  &Todo{Id: 1, Title: "Hey"},
+			patch: `[{"op":"add","path":"/a~1b~0c","value":[1]},{"op":"add","path":"/a~1b~0c/0","value":0},{"op":"test","path":"/a~1b~0c","value":[0,1]}]`,
+			want:  &Todo{Id: 1, Title: "Hey"},
+		},
+		{
+			name:    "failed test",
+			todo:    &Todo{Id: 1, Title: "Hey"},
+			patch:   `[{"op":"test","path":"/title","value":"Other"},{"op":"replace","path":"/completed","value":true}]`,
+			wantErr: ErrPatchTestFailed,
+		},
+		{
+			name:    "replace missing member",
+			todo:    &Todo{Id: 1, Title: "Hey"},
+			patch:   `[{"op":"replace","path":"/missing","value":1}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "unknown op",
+			todo:    &Todo{Id: 1, Title: "Hey"},
+			patch:   `[{"op":"frobnicate","path":"/title"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "missing value",
+			todo:    &Todo{Id: 1, Title: "Hey"},
+			patch:   `[{"op":"add","path":"/title"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "relative pointer",
+			todo:    &Todo{Id: 1, Title: "Hey"},
+			patch:   `[{"op":"remove","path":"title"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "remove document",
+			todo:    &Todo{Id: 1, Title: "Hey"},
+			patch:   `[{"op":"remove","path":""}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "not an array",
+			todo:    &Todo{Id: 1, Title: "Hey"},
+			patch:   `{"op":"remove","path":"/title"}`,
+			wantErr: ErrInvalidPatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := *tt.todo
+
+			got, err := JSONPatch(tt.patch).Apply(tt.todo)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+				assert.Equal(t, original, *tt.todo)
+			}
+		})
+	}
+}
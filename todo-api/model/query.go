@@ -0,0 +1,77 @@
+package model
+
+import "strings"
+
+// Query selects, orders and pages through todos. The zero value matches every
+// todo ordered by id.
+type Query struct {
+	// Completed, if set, only matches todos with that completion state.
+	Completed *bool
+	// ListId, if set, only matches todos on that list, zero matches todos
+	// that are not on any list.
+	ListId *int
+	// ParentId, if set, only matches subtasks of that todo, zero matches top
+	// level todos.
+	ParentId *int
+	// Search matches todos whose title or description contains it, ignoring
+	// case.
+	Search string
+	Sort   []SortKey
+	// Limit caps the number of returned todos, zero means no limit.
+	Limit  int
+	Offset int
+}
+
+// Matches reports whether todo passes the filters of q.
+func (q Query) Matches(todo *Todo) bool {
+	if q.Completed != nil && todo.Completed != *q.Completed {
+		return false
+	}
+
+	if q.ListId != nil && todo.ListId != *q.ListId {
+		return false
+	}
+
+	if q.ParentId != nil && todo.ParentId != *q.ParentId {
+		return false
+	}
+
+	if q.Search != "" {
+		search := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(todo.Title), search) &&
+			!strings.Contains(strings.ToLower(todo.Description), search) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Apply runs q against todos in memory. It returns the requested page together
+// with the number of todos that matched before paging.
+func (q Query) Apply(todos []*Todo) ([]*Todo, int) {
+	matched := make([]*Todo, 0, len(todos))
+	for _, todo := range todos {
+		if q.Matches(todo) {
+			matched = append(matched, todo)
+		}
+	}
+
+	Sort(matched, q.Sort...)
+
+	total := len(matched)
+
+	if q.Offset >= total {
+		return []*Todo{}, total
+	}
+
+	if q.Offset > 0 {
+		matched = matched[q.Offset:]
+	}
+
+	if q.Limit > 0 && q.Limit < len(matched) {
+		matched = matched[:q.Limit]
+	}
+
+	return matched, total
+}
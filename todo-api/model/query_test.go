@@ -0,0 +1,101 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery_Apply(t *testing.T) {
+	yes, no := true, false
+	unlisted, groceries := 0, 7
+
+	todos := []*Todo{
+		{Id: 4, Title: "Water plants", Completed: true},
+		{Id: 1, Title: "Buy milk", ListId: groceries},
+		{Id: 3, Title: "Buy bread", Completed: true, ListId: groceries},
+		{Id: 2, Title: "Call mum"},
+		{Id: 5, Title: "BUY stamps"},
+	}
+
+	tests := []struct {
+		name      string
+		query     Query
+		wantIds   []int
+		wantTotal int
+	}{
+		{
+			name:      "zero query",
+			query:     Query{},
+			wantIds:   []int{1, 2, 3, 4, 5},
+			wantTotal: 5,
+		},
+		{
+			name:      "completed only",
+			query:     Query{Completed: &yes},
+			wantIds:   []int{3, 4},
+			wantTotal: 2,
+		},
+		{
+			name:      "open only",
+			query:     Query{Completed: &no},
+			wantIds:   []int{1, 2, 5},
+			wantTotal: 3,
+		},
+		{
+			name:      "on list",
+			query:     Query{ListId: &groceries},
+			wantIds:   []int{1, 3},
+			wantTotal: 2,
+		},
+		{
+			name:      "on no list",
+			query:     Query{ListId: &unlisted},
+			wantIds:   []int{2, 4, 5},
+			wantTotal: 3,
+		},
+		{
+			name:      "search ignores case",
+			query:     Query{Search: "buy"},
+			wantIds:   []int{1, 3, 5},
+			wantTotal: 3,
+		},
+		{
+			name:      "search and filter sorted by title",
+			query:     Query{Search: "buy", Completed: &no, Sort: []SortKey{{Field: SortFieldTitle}}},
+			wantIds:   []int{5, 1},
+			wantTotal: 2,
+		},
+		{
+			name:      "first page",
+			query:     Query{Limit: 2},
+			wantIds:   []int{1, 2},
+			wantTotal: 5,
+		},
+		{
+			name:      "last partial page",
+			query:     Query{Limit: 2, Offset: 4},
+			wantIds:   []int{5},
+			wantTotal: 5,
+		},
+		{
+			name:      "offset past the end",
+			query:     Query{Limit: 2, Offset: 10},
+			wantIds:   []int{},
+			wantTotal: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, total := tt.query.Apply(todos)
+
+			ids := make([]int, len(page))
+			for idx, todo := range page {
+				ids[idx] = todo.Id
+			}
+
+			assert.Equal(t, tt.wantIds, ids)
+			assert.Equal(t, tt.wantTotal, total)
+		})
+	}
+}
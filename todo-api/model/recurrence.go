@@ -0,0 +1,434 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecurrenceSteps bounds the search for the next monthly occurrence in
+// months, it may be years away, e.g. for February 29th with INTERVAL=12.
+const maxRecurrenceSteps = 1000
+
+var (
+	ErrInvalidRule = errors.New("invalid recurrence rule")
+
+	ErrInvalidRecurrence    = fmt.Errorf("%w: recurrence must be a supported RRULE", ErrInvalidTodo)
+	ErrRecurrenceWithoutDue = fmt.Errorf("%w: due must be set for recurring todos", ErrInvalidTodo)
+)
+
+// Frequency is the FREQ of a Rule.
+type Frequency string
+
+const (
+	FreqDaily   Frequency = "DAILY"
+	FreqWeekly  Frequency = "WEEKLY"
+	FreqMonthly Frequency = "MONTHLY"
+)
+
+// weekdays maps the two letter weekdays of iCalendar onto time.Weekday.
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// WeekdayNum is an element of BYDAY, e.g. "TU" or "-1FR". A non-zero Ordinal
+// selects the n-th such weekday of the month, counting from the end if
+// negative, and is only allowed for monthly rules.
+type WeekdayNum struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+func (wn WeekdayNum) String() string {
+	day := strings.ToUpper(wn.Weekday.String()[:2])
+	if wn.Ordinal == 0 {
+		return day
+	}
+
+	return strconv.Itoa(wn.Ordinal) + day
+}
+
+// Rule is the subset of an iCalendar RRULE supported for recurring todos:
+// FREQ=DAILY|WEEKLY|MONTHLY with INTERVAL, BYDAY and either UNTIL or COUNT.
+// Occurrences are anchored on the due date of the todo, weeks start on Monday.
+// Todos recur in UTC, where the stores keep due dates: a todo due late on a
+// Monday in America follows a rule from the Tuesday it is in UTC.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []WeekdayNum
+	// Until is the last moment an occurrence may fall on, nil if the rule has
+	// no end date.
+	Until *time.Time
+	// Count is the number of occurrences left including the current one, zero
+	// if the rule is not limited by count.
+	Count int
+}
+
+// ParseRule parses a rule like "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=6",
+// an "RRULE:" prefix is accepted. UNTIL is either a UTC date-time like
+// "20261231T170000Z" or a date, which includes the whole day in UTC.
+func ParseRule(value string) (*Rule, error) {
+	rule := &Rule{Interval: 1}
+	seen := map[string]bool{}
+
+	value = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "RRULE:")
+	if value == "" {
+		return nil, fmt.Errorf("%w: rule must not be empty", ErrInvalidRule)
+	}
+
+	for _, part := range strings.Split(value, ";") {
+		name, arg, ok := strings.Cut(part, "=")
+		if !ok || arg == "" {
+			return nil, fmt.Errorf("%w: '%s' is not of the form NAME=VALUE", ErrInvalidRule, part)
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s must not be repeated", ErrInvalidRule, name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			rule.Freq, err = parseFrequency(arg)
+		case "INTERVAL":
+			rule.Interval, err = parsePositive(name, arg)
+		case "COUNT":
+			rule.Count, err = parsePositive(name, arg)
+		case "UNTIL":
+			rule.Until, err = parseUntil(arg)
+		case "BYDAY":
+			rule.ByDay, err = parseByDay(arg)
+		default:
+			err = fmt.Errorf("%w: %s is not supported", ErrInvalidRule, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+
+	if rule.Count != 0 && rule.Until != nil {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL must not be combined", ErrInvalidRule)
+	}
+
+	if rule.Freq != FreqMonthly {
+		for _, day := range rule.ByDay {
+			if day.Ordinal != 0 {
+				return nil, fmt.Errorf("%w: BYDAY '%s' needs FREQ=MONTHLY", ErrInvalidRule, day)
+			}
+		}
+	}
+
+	return rule, nil
+}
+
+func parseFrequency(value string) (Frequency, error) {
+	switch freq := Frequency(value); freq {
+	case FreqDaily, FreqWeekly, FreqMonthly:
+		return freq, nil
+	default:
+		return "", fmt.Errorf("%w: FREQ '%s' is not one of %s, %s or %s", ErrInvalidRule, value,
+			FreqDaily, FreqWeekly, FreqMonthly)
+	}
+}
+
+func parsePositive(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%w: %s must be a positive integer, got '%s'", ErrInvalidRule, name, value)
+	}
+
+	return n, nil
+}
+
+func parseUntil(value string) (*time.Time, error) {
+	if until, err := time.Parse("20060102T150405Z", value); err == nil {
+		return &until, nil
+	}
+
+	day, err := time.Parse("20060102", value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: UNTIL '%s' is neither a date nor a UTC date-time", ErrInvalidRule, value)
+	}
+
+	until := day.Add(24*time.Hour - time.Second)
+
+	return &until, nil
+}
+
+func parseByDay(value string) ([]WeekdayNum, error) {
+	var days []WeekdayNum
+	seen := map[WeekdayNum]bool{}
+
+	for _, item := range strings.Split(value, ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("%w: BYDAY '%s' is not a weekday", ErrInvalidRule, item)
+		}
+
+		weekday, ok := weekdays[item[len(item)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("%w: BYDAY '%s' is not a weekday", ErrInvalidRule, item)
+		}
+
+		day := WeekdayNum{Weekday: weekday}
+		if prefix := item[:len(item)-2]; prefix != "" {
+			ordinal, err := strconv.Atoi(prefix)
+			if err != nil || ordinal == 0 || ordinal < -5 || ordinal > 5 {
+				return nil, fmt.Errorf("%w: BYDAY '%s' must be numbered from -5 to 5", ErrInvalidRule, item)
+			}
+
+			day.Ordinal = ordinal
+		}
+
+		if seen[day] {
+			return nil, fmt.Errorf("%w: BYDAY '%s' must not be repeated", ErrInvalidRule, item)
+		}
+		seen[day] = true
+
+		days = append(days, day)
+	}
+
+	return days, nil
+}
+
+// String formats the rule in the canonical form accepted by ParseRule.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for idx, day := range r.ByDay {
+			days[idx] = day.String()
+		}
+
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence after prev, which is an occurrence of the
+// rule itself. The time of day and location of prev are kept. The second
+// result is false if the rule has no further occurrence; Count is left to the
+// caller, see Todo.NextOccurrence.
+func (r *Rule) Next(prev time.Time) (time.Time, bool) {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	var (
+		next time.Time
+		ok   bool
+	)
+
+	switch r.Freq {
+	case FreqDaily:
+		next, ok = r.nextDaily(prev, interval)
+	case FreqWeekly:
+		next, ok = r.nextWeekly(prev, interval)
+	case FreqMonthly:
+		next, ok = r.nextMonthly(prev, interval)
+	}
+
+	if !ok || (r.Until != nil && next.After(*r.Until)) {
+		return time.Time{}, false
+	}
+
+	return next, true
+}
+
+func (r *Rule) nextDaily(prev time.Time, interval int) (time.Time, bool) {
+	// The weekdays repeat after seven steps at the latest.
+	for step := 1; step <= 7; step++ {
+		next := prev.AddDate(0, 0, step*interval)
+		if r.onDay(next) {
+			return next, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func (r *Rule) nextWeekly(prev time.Time, interval int) (time.Time, bool) {
+	if len(r.ByDay) == 0 {
+		return prev.AddDate(0, 0, 7*interval), true
+	}
+
+	start := startOfWeek(prev)
+
+	for day := 1; day <= 7*interval+7; day++ {
+		next := prev.AddDate(0, 0, day)
+
+		weeks := int(startOfWeek(next).Sub(start).Hours()+12) / (7 * 24)
+		if weeks%interval == 0 && r.onDay(next) {
+			return next, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func (r *Rule) nextMonthly(prev time.Time, interval int) (time.Time, bool) {
+	year, month, day := prev.Date()
+	hour, minute, sec := prev.Clock()
+
+	for step := 0; step <= maxRecurrenceSteps; step += interval {
+		// The first day of the month never overflows into the next one.
+		first := time.Date(year, month+time.Month(step), 1, hour, minute, sec, prev.Nanosecond(), prev.Location())
+
+		if len(r.ByDay) == 0 {
+			if step == 0 {
+				continue
+			}
+
+			next := first.AddDate(0, 0, day-1)
+			if next.Month() == first.Month() {
+				return next, true
+			}
+
+			continue
+		}
+
+		for next := first; next.Month() == first.Month(); next = next.AddDate(0, 0, 1) {
+			if next.After(prev) && r.onMonthDay(next) {
+				return next, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// onDay reports whether t falls on one of the weekdays of BYDAY, every day
+// matches if BYDAY is empty.
+func (r *Rule) onDay(t time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+
+	for _, day := range r.ByDay {
+		if day.Weekday == t.Weekday() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// onMonthDay is onDay for monthly rules, which also honour the ordinals of
+// BYDAY.
+func (r *Rule) onMonthDay(t time.Time) bool {
+	nth := (t.Day()-1)/7 + 1
+	lastNth := -((daysIn(t) - t.Day()) / 7) - 1
+
+	for _, day := range r.ByDay {
+		if day.Weekday != t.Weekday() {
+			continue
+		}
+
+		if day.Ordinal == 0 || day.Ordinal == nth || day.Ordinal == lastNth {
+			return true
+		}
+	}
+
+	return false
+}
+
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// startOfWeek returns midnight of the Monday of the week t falls in.
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	year, month, day := t.Date()
+
+	return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+}
+
+// validateRecurrence checks that the recurrence of t can be parsed and that
+// it has a due date to be anchored on.
+func (t *Todo) validateRecurrence(verr *ValidationError) {
+	if t.Recurrence == "" {
+		return
+	}
+
+	if _, err := ParseRule(t.Recurrence); err != nil {
+		verr.add("recurrence", RuleFormat, strings.TrimPrefix(err.Error(), ErrInvalidRule.Error()+": "), ErrInvalidRecurrence)
+	}
+
+	if t.Due == nil {
+		verr.add("due", RuleRequired, "must be set for recurring todos", ErrRecurrenceWithoutDue)
+	}
+}
+
+// NextOccurrence returns the open todo that follows t in its recurrence, due
+// at the next occurrence of the rule in UTC, or nil if t does not recur or its
+// rule has no further occurrence. The COUNT of the returned todo is one less than
+// that of t.
+func (t *Todo) NextOccurrence() (*Todo, error) {
+	if t.Recurrence == "" || t.Due == nil {
+		return nil, nil
+	}
+
+	rule, err := ParseRule(t.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.Count == 1 {
+		return nil, nil
+	}
+
+	due, ok := rule.Next(t.Due.UTC())
+	if !ok {
+		return nil, nil
+	}
+
+	if rule.Count > 1 {
+		rule.Count--
+	}
+
+	next := &Todo{
+		Title:        t.Title,
+		Description:  t.Description,
+		Due:          &due,
+		Priority:     t.Priority,
+		Recurrence:   rule.String(),
+		ListId:       t.ListId,
+		ParentId:     t.ParentId,
+		AutoComplete: t.AutoComplete,
+	}
+
+	if len(t.Tags) > 0 {
+		next.Tags = append([]string(nil), t.Tags...)
+	}
+
+	return next, nil
+}
@@ -0,0 +1,272 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRule(t *testing.T) {
+	until := time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC)
+	untilTime := time.Date(2026, 12, 31, 17, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value      string
+		want       *Rule
+		wantString string
+		wantErr    bool
+	}{
+		{
+			value:      "FREQ=DAILY",
+			want:       &Rule{Freq: FreqDaily, Interval: 1},
+			wantString: "FREQ=DAILY",
+		},
+		{
+			value:      "RRULE:freq=weekly;interval=2;byday=mo,th;count=6",
+			want:       &Rule{Freq: FreqWeekly, Interval: 2, ByDay: []WeekdayNum{{Weekday: time.Monday}, {Weekday: time.Thursday}}, Count: 6},
+			wantString: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=6",
+		},
+		{
+			value:      "FREQ=MONTHLY;BYDAY=-1FR,2TU;UNTIL=20261231",
+			want:       &Rule{Freq: FreqMonthly, Interval: 1, ByDay: []WeekdayNum{{-1, time.Friday}, {2, time.Tuesday}}, Until: &until},
+			wantString: "FREQ=MONTHLY;BYDAY=-1FR,2TU;UNTIL=20261231T235959Z",
+		},
+		{
+			value:      "FREQ=MONTHLY;UNTIL=20261231T170000Z",
+			want:       &Rule{Freq: FreqMonthly, Interval: 1, Until: &untilTime},
+			wantString: "FREQ=MONTHLY;UNTIL=20261231T170000Z",
+		},
+		{value: "", wantErr: true},
+		{value: "INTERVAL=2", wantErr: true},
+		{value: "FREQ=YEARLY", wantErr: true},
+		{value: "FREQ=DAILY;FREQ=WEEKLY", wantErr: true},
+		{value: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+		{value: "FREQ=DAILY;COUNT=-1", wantErr: true},
+		{value: "FREQ=DAILY;COUNT=2;UNTIL=20261231", wantErr: true},
+		{value: "FREQ=DAILY;UNTIL=tomorrow", wantErr: true},
+		{value: "FREQ=DAILY;BYMONTH=1", wantErr: true},
+		{value: "FREQ=DAILY;INTERVAL", wantErr: true},
+		{value: "FREQ=WEEKLY;BYDAY=XX", wantErr: true},
+		{value: "FREQ=WEEKLY;BYDAY=MO,MO", wantErr: true},
+		{value: "FREQ=WEEKLY;BYDAY=1MO", wantErr: true},
+		{value: "FREQ=MONTHLY;BYDAY=6MO", wantErr: true},
+		{value: "FREQ=MONTHLY;BYDAY=0MO", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseRule(tt.value)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrInvalidRule), "got error %v, want %v", err, ErrInvalidRule)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+				assert.Equal(t, tt.wantString, got.String())
+			}
+		})
+	}
+}
+
+func TestRule_Next(t *testing.T) {
+	day := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		rule   string
+		prev   time.Time
+		want   []time.Time
+		ending bool
+	}{
+		{
+			name: "daily",
+			rule: "FREQ=DAILY",
+			prev: day(2026, time.January, 30),
+			want: []time.Time{day(2026, time.January, 31), day(2026, time.February, 1)},
+		},
+		{
+			name: "every third day",
+			rule: "FREQ=DAILY;INTERVAL=3",
+			prev: day(2026, time.February, 27),
+			want: []time.Time{day(2026, time.March, 2), day(2026, time.March, 5)},
+		},
+		{
+			name: "weekdays",
+			rule: "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR",
+			prev: day(2026, time.October, 15), // Thursday
+			want: []time.Time{day(2026, time.October, 16), day(2026, time.October, 19), day(2026, time.October, 20)},
+		},
+		{
+			name: "weekly",
+			rule: "FREQ=WEEKLY",
+			prev: day(2026, time.October, 18),
+			want: []time.Time{day(2026, time.October, 25), day(2026, time.November, 1)},
+		},
+		{
+			name: "twice a week",
+			rule: "FREQ=WEEKLY;BYDAY=TU,FR",
+			prev: day(2026, time.October, 13), // Tuesday
+			want: []time.Time{day(2026, time.October, 16), day(2026, time.October, 20), day(2026, time.October, 23)},
+		},
+		{
+			name: "every other week on monday and wednesday",
+			rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE",
+			prev: day(2026, time.October, 12), // Monday
+			want: []time.Time{day(2026, time.October, 14), day(2026, time.October, 26), day(2026, time.October, 28)},
+		},
+		{
+			name: "every other week from a sunday",
+			rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,MO",
+			prev: day(2026, time.October, 18), // Sunday, the end of the week
+			want: []time.Time{day(2026, time.October, 26), day(2026, time.November, 1), day(2026, time.November, 9)},
+		},
+		{
+			name: "monthly",
+			rule: "FREQ=MONTHLY",
+			prev: day(2026, time.November, 15),
+			want: []time.Time{day(2026, time.December, 15), day(2027, time.January, 15)},
+		},
+		{
+			name: "monthly skips short months",
+			rule: "FREQ=MONTHLY",
+			prev: day(2027, time.January, 31),
+			want: []time.Time{day(2027, time.March, 31), day(2027, time.May, 31)},
+		},
+		{
+			name: "quarterly",
+			rule: "FREQ=MONTHLY;INTERVAL=3",
+			prev: day(2026, time.November, 30),
+			want: []time.Time{day(2027, time.May, 30), day(2027, time.August, 30)},
+		},
+		{
+			name: "second tuesday",
+			rule: "FREQ=MONTHLY;BYDAY=2TU",
+			prev: day(2026, time.October, 13),
+			want: []time.Time{day(2026, time.November, 10), day(2026, time.December, 8)},
+		},
+		{
+			name: "last friday",
+			rule: "FREQ=MONTHLY;BYDAY=-1FR",
+			prev: day(2026, time.October, 1),
+			want: []time.Time{day(2026, time.October, 30), day(2026, time.November, 27)},
+		},
+		{
+			name: "every monday of the month",
+			rule: "FREQ=MONTHLY;BYDAY=MO",
+			prev: day(2026, time.October, 26),
+			want: []time.Time{day(2026, time.November, 2), day(2026, time.November, 9)},
+		},
+		{
+			name:   "until",
+			rule:   "FREQ=DAILY;UNTIL=20261020",
+			prev:   day(2026, time.October, 18),
+			want:   []time.Time{day(2026, time.October, 19), day(2026, time.October, 20)},
+			ending: true,
+		},
+		{
+			name: "leap day",
+			rule: "FREQ=MONTHLY;INTERVAL=12",
+			prev: day(2028, time.February, 29),
+			want: []time.Time{day(2032, time.February, 29)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.rule)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			prev := tt.prev
+			for _, want := range tt.want {
+				next, ok := rule.Next(prev)
+				assert.True(t, ok)
+				assert.Equal(t, want, next)
+
+				prev = next
+			}
+
+			if tt.ending {
+				_, ok := rule.Next(prev)
+				assert.False(t, ok)
+			}
+		})
+	}
+}
+
+func TestRule_NextKeepsLocalTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	rule, err := ParseRule("FREQ=WEEKLY")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Daylight saving time ends in between.
+	next, ok := rule.Next(time.Date(2026, time.October, 21, 8, 0, 0, 0, berlin))
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2026, time.October, 28, 8, 0, 0, 0, berlin), next)
+}
+
+func TestTodo_NextOccurrence(t *testing.T) {
+	due := time.Date(2026, time.October, 19, 18, 0, 0, 0, time.UTC)
+	nextDue := due.AddDate(0, 0, 7)
+
+	// Monday evening in Los Angeles is Tuesday in UTC.
+	mondayEvening := time.Date(2026, time.October, 19, 20, 0, 0, 0, time.FixedZone("PDT", -7*60*60))
+	thursdayUTC := time.Date(2026, time.October, 22, 3, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		todo *Todo
+		want *Todo
+	}{
+		{
+			name: "not recurring",
+			todo: &Todo{Id: 1, Title: "Take out the trash", Due: &due},
+		},
+		{
+			name: "next week",
+			todo: &Todo{
+				Id: 1, Title: "Take out the trash", Completed: true, Due: &due, Priority: 3, Tags: []string{"chores"},
+				Recurrence: "FREQ=WEEKLY", ListId: 2, BlockedBy: []int{4}, Version: 3,
+			},
+			want: &Todo{
+				Title: "Take out the trash", Due: &nextDue, Priority: 3, Tags: []string{"chores"},
+				Recurrence: "FREQ=WEEKLY", ListId: 2,
+			},
+		},
+		{
+			name: "count goes down",
+			todo: &Todo{Title: "Water plants", Due: &due, Recurrence: "FREQ=WEEKLY;COUNT=3"},
+			want: &Todo{Title: "Water plants", Due: &nextDue, Recurrence: "FREQ=WEEKLY;COUNT=2"},
+		},
+		{
+			name: "last of count",
+			todo: &Todo{Title: "Water plants", Due: &due, Recurrence: "FREQ=WEEKLY;COUNT=1"},
+		},
+		{
+			name: "weekdays in UTC",
+			todo: &Todo{Title: "Call mum", Due: &mondayEvening, Recurrence: "FREQ=WEEKLY;BYDAY=TU,TH"},
+			want: &Todo{Title: "Call mum", Due: &thursdayUTC, Recurrence: "FREQ=WEEKLY;BYDAY=TU,TH"},
+		},
+		{
+			name: "past until",
+			todo: &Todo{Title: "Water plants", Due: &due, Recurrence: "FREQ=WEEKLY;UNTIL=20261025"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.todo.NextOccurrence()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
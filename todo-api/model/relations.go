@@ -0,0 +1,145 @@
+package model
+
+import "fmt"
+
+const MaxBlockers = 50
+
+var (
+	ErrInvalidParentId  = fmt.Errorf("%w: parent_id must not be negative", ErrInvalidTodo)
+	ErrTooManyBlockers  = fmt.Errorf("%w: a todo must not be blocked by more than %d todos", ErrInvalidTodo, MaxBlockers)
+	ErrInvalidBlockerId = fmt.Errorf("%w: blocked_by must only contain positive ids", ErrInvalidTodo)
+	ErrDuplicateBlocker = fmt.Errorf("%w: blocked_by must be unique", ErrInvalidTodo)
+	ErrUnknownParent    = fmt.Errorf("%w: parent_id must refer to an existing todo", ErrInvalidTodo)
+	ErrUnknownBlocker   = fmt.Errorf("%w: blocked_by must refer to existing todos", ErrInvalidTodo)
+	ErrParentCycle      = fmt.Errorf("%w: parent_id must not make a todo its own ancestor", ErrInvalidTodo)
+	ErrDependencyCycle  = fmt.Errorf("%w: blocked_by must not make a todo wait for itself", ErrInvalidTodo)
+)
+
+// Tree is a todo together with its subtasks, recursively.
+type Tree struct {
+	*Todo
+	Children []*Tree `json:"children"`
+}
+
+// validateRelations checks the relations of t that can be checked without
+// knowing the other todos.
+func (t *Todo) validateRelations(verr *ValidationError) {
+	if t.ParentId < 0 {
+		verr.add("parent_id", RuleMin, "must not be negative", ErrInvalidParentId)
+	}
+
+	if len(t.BlockedBy) > MaxBlockers {
+		verr.add("blocked_by", RuleMaxItems, fmt.Sprintf("must not contain more than %d todos", MaxBlockers), ErrTooManyBlockers)
+	}
+
+	seen := make(map[int]bool, len(t.BlockedBy))
+	for idx, blocker := range t.BlockedBy {
+		field := fmt.Sprintf("blocked_by[%d]", idx)
+
+		if blocker <= 0 {
+			verr.add(field, RuleMin, "must be a positive id", ErrInvalidBlockerId)
+			continue
+		}
+
+		if seen[blocker] {
+			verr.add(field, RuleUnique, "must not repeat an earlier todo", ErrDuplicateBlocker)
+		}
+		seen[blocker] = true
+	}
+}
+
+// TodoLookup returns the todo with the given id, or nil if there is none.
+type TodoLookup func(id int) (*Todo, error)
+
+// CheckRelations verifies that the parent and the blockers of todo exist and
+// that storing todo under id does not create a cycle of subtasks or of
+// dependencies. id is zero for a todo that is not stored yet, nothing can
+// refer to it then. Lookup errors are returned as they are, failed checks as
+// a *ValidationError.
+func CheckRelations(id int, todo *Todo, lookup TodoLookup) error {
+	verr := &ValidationError{kind: ErrInvalidTodo}
+
+	if todo.ParentId != 0 {
+		cycle, found, err := reaches(todo.ParentId, id, lookup, func(t *Todo) []int {
+			if t.ParentId == 0 {
+				return nil
+			}
+
+			return []int{t.ParentId}
+		})
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case cycle:
+			verr.add("parent_id", RuleAcyclic, "must not make the todo its own ancestor", ErrParentCycle)
+		case !found:
+			verr.add("parent_id", RuleExists, "must refer to an existing todo", ErrUnknownParent)
+		}
+	}
+
+	for idx, blocker := range todo.BlockedBy {
+		cycle, found, err := reaches(blocker, id, lookup, func(t *Todo) []int { return t.BlockedBy })
+		if err != nil {
+			return err
+		}
+
+		field := fmt.Sprintf("blocked_by[%d]", idx)
+
+		switch {
+		case cycle:
+			verr.add(field, RuleAcyclic, "must not make the todo wait for itself", ErrDependencyCycle)
+		case !found:
+			verr.add(field, RuleExists, "must refer to an existing todo", ErrUnknownBlocker)
+		}
+	}
+
+	return verr.errOrNil()
+}
+
+// reaches walks the graph spanned by next starting at from and reports
+// whether target can be reached, and whether from exists at all. Todos that
+// do not exist end the walk along their edge.
+func reaches(from, target int, lookup TodoLookup, next func(*Todo) []int) (cycle bool, found bool, err error) {
+	if target != 0 && from == target {
+		return true, true, nil
+	}
+
+	start, err := lookup(from)
+	if err != nil || start == nil {
+		return false, false, err
+	}
+
+	if target == 0 {
+		return false, true, nil
+	}
+
+	seen := map[int]bool{from: true}
+	queue := next(start)
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		if id == target {
+			return true, true, nil
+		}
+
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		todo, err := lookup(id)
+		if err != nil {
+			return false, true, err
+		}
+
+		if todo != nil {
+			queue = append(queue, next(todo)...)
+		}
+	}
+
+	return false, true, nil
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRelations(t *testing.T) {
+	// 1 <- 2 <- 3 are subtasks of each other, 4 waits for 5 and 5 for 6.
+	todos := map[int]*Todo{
+		1: {Id: 1},
+		2: {Id: 2, ParentId: 1},
+		3: {Id: 3, ParentId: 2},
+		4: {Id: 4, BlockedBy: []int{5}},
+		5: {Id: 5, BlockedBy: []int{6}},
+		6: {Id: 6},
+	}
+	lookup := func(id int) (*Todo, error) { return todos[id], nil }
+
+	tests := []struct {
+		name       string
+		id         int
+		todo       *Todo
+		wantErr    error
+		wantFields []string
+	}{
+		{name: "no relations", id: 0, todo: &Todo{}},
+		{name: "new subtask", id: 0, todo: &Todo{ParentId: 3}},
+		{name: "new blocked todo", id: 0, todo: &Todo{BlockedBy: []int{4, 6}}},
+		{name: "move subtree", id: 2, todo: &Todo{ParentId: 0}},
+		{name: "extend dependency chain", id: 6, todo: &Todo{BlockedBy: []int{1}}},
+		{
+			name:       "unknown parent",
+			id:         0,
+			todo:       &Todo{ParentId: 99},
+			wantErr:    ErrUnknownParent,
+			wantFields: []string{"parent_id:exists"},
+		},
+		{
+			name:       "unknown blocker",
+			id:         0,
+			todo:       &Todo{BlockedBy: []int{6, 99}},
+			wantErr:    ErrUnknownBlocker,
+			wantFields: []string{"blocked_by[1]:exists"},
+		},
+		{
+			name:       "own parent",
+			id:         1,
+			todo:       &Todo{ParentId: 1},
+			wantErr:    ErrParentCycle,
+			wantFields: []string{"parent_id:acyclic"},
+		},
+		{
+			name:       "parent cycle",
+			id:         1,
+			todo:       &Todo{ParentId: 3},
+			wantErr:    ErrParentCycle,
+			wantFields: []string{"parent_id:acyclic"},
+		},
+		{
+			name:       "blocked by itself",
+			id:         6,
+			todo:       &Todo{BlockedBy: []int{6}},
+			wantErr:    ErrDependencyCycle,
+			wantFields: []string{"blocked_by[0]:acyclic"},
+		},
+		{
+			name:       "dependency cycle",
+			id:         6,
+			todo:       &Todo{BlockedBy: []int{1, 4}},
+			wantErr:    ErrDependencyCycle,
+			wantFields: []string{"blocked_by[1]:acyclic"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckRelations(tt.id, tt.todo, lookup)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+
+			var verr *ValidationError
+			if assert.True(t, errors.As(err, &verr)) {
+				fields := make([]string, len(verr.Fields))
+				for idx, field := range verr.Fields {
+					fields[idx] = field.Field + ":" + field.Rule
+				}
+
+				assert.Equal(t, tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestCheckRelations_LookupError(t *testing.T) {
+	lookupErr := errors.New("database is gone")
+
+	err := CheckRelations(0, &Todo{ParentId: 1}, func(int) (*Todo, error) { return nil, lookupErr })
+	assert.Equal(t, lookupErr, err)
+}
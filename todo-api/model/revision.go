@@ -0,0 +1,116 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Action tells what kind of write a Revision records.
+type Action string
+
+const (
+	ActionCreated  Action = "created"
+	ActionUpdated  Action = "updated"
+	ActionDeleted  Action = "deleted"
+	ActionRestored Action = "restored"
+	ActionReverted Action = "reverted"
+)
+
+// untracked lists the fields maintained by the store, they change with every
+// write and are left out of diffs.
+var untracked = map[string]bool{
+	"id":           true,
+	"version":      true,
+	"created_at":   true,
+	"updated_at":   true,
+	"completed_at": true,
+	"deleted_at":   true,
+}
+
+// FieldChange is the JSON value of a todo field before and after a write. A
+// missing value means the field was empty.
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Revision records one write to a todo. Revisions are numbered per todo
+// starting at 1 and never change once recorded.
+type Revision struct {
+	TodoId int    `json:"todo_id"`
+	Number int    `json:"number"`
+	Action Action `json:"action"`
+	// Actor is the user the write was made for.
+	Actor int `json:"actor"`
+	// Reverts is the number of the revision an ActionReverted went back to.
+	Reverts int           `json:"reverts,omitempty"`
+	Changes []FieldChange `json:"changes,omitempty"`
+	// Todo is the todo as written, or as it was before an ActionDeleted.
+	Todo *Todo `json:"todo"`
+
+	// At is maintained by the store, like the timestamps of a todo.
+	At time.Time `json:"at"`
+}
+
+// Diff returns the changes of the fields of a todo from before to after,
+// ordered by field name. Either of them may be nil.
+func Diff(before, after *Todo) ([]FieldChange, error) {
+	old, err := todoFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := todoFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(updated))
+	for name := range old {
+		names[name] = true
+	}
+	for name := range updated {
+		names[name] = true
+	}
+
+	var changes []FieldChange
+	for name := range names {
+		if untracked[name] || bytes.Equal(old[name], updated[name]) {
+			continue
+		}
+
+		changes = append(changes, FieldChange{Field: name, Before: old[name], After: updated[name]})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes, nil
+}
+
+// todoFields returns the JSON values of the non-empty fields of todo.
+func todoFields(todo *Todo) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if todo == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return nil, fmt.Errorf("encode todo: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("decode todo fields: %w", err)
+	}
+
+	// Completed is always encoded, false is its empty value.
+	if string(fields["completed"]) == "false" {
+		delete(fields, "completed")
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		before *Todo
+		after  *Todo
+		want   []FieldChange
+	}{
+		{name: "nothing", before: nil, after: nil, want: nil},
+		{
+			name:  "created",
+			after: &Todo{Id: 1, Title: "Say hello", Tags: []string{"home"}, Version: 1, CreatedAt: now},
+			want: []FieldChange{
+				{Field: "tags", After: json.RawMessage(`["home"]`)},
+				{Field: "title", After: json.RawMessage(`"Say hello"`)},
+			},
+		},
+		{
+			name:   "deleted",
+			before: &Todo{Id: 1, Title: "Say hello", Completed: true, CompletedAt: &now},
+			want: []FieldChange{
+				{Field: "completed", Before: json.RawMessage(`true`)},
+				{Field: "title", Before: json.RawMessage(`"Say hello"`)},
+			},
+		},
+		{
+			name:   "updated",
+			before: &Todo{Id: 1, Title: "Say hello", Priority: 2, Version: 1},
+			after:  &Todo{Id: 1, Title: "Say goodbye", Priority: 2, Completed: true, Version: 2, UpdatedAt: now},
+			want: []FieldChange{
+				{Field: "completed", After: json.RawMessage(`true`)},
+				{Field: "title", Before: json.RawMessage(`"Say hello"`), After: json.RawMessage(`"Say goodbye"`)},
+			},
+		},
+		{
+			name:   "only store fields",
+			before: &Todo{Id: 1, Title: "Say hello", Version: 1},
+			after:  &Todo{Id: 1, Title: "Say hello", Version: 2, UpdatedAt: now, DeletedAt: &now},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := Diff(tt.before, tt.after)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, changes)
+		})
+	}
+}
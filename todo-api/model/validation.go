@@ -0,0 +1,94 @@
+package model
+
+import "strings"
+
+// Validation rules reported in FieldError.Rule.
+const (
+	RuleRequired  = "required"
+	RuleMaxLength = "max_length"
+	RuleRange     = "range"
+	RuleMaxItems  = "max_items"
+	RuleFormat    = "format"
+	RuleUnique    = "unique"
+	RuleMin       = "min"
+	RuleExists    = "exists"
+	RuleAcyclic   = "acyclic"
+)
+
+// FieldError describes a single field of a todo that failed validation. Field
+// uses the JSON name of the field, elements of lists are addressed by index,
+// e.g. "tags[2]".
+type FieldError struct {
+	Field  string `json:"name"`
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+
+	// err is the sentinel matching the failed rule, e.g. ErrEmptyTitle.
+	err error
+}
+
+// ValidationError lists every field of a todo, list or webhook that failed
+// validation. It matches ErrInvalidTodo, ErrInvalidList or ErrInvalidWebhook
+// and the sentinels of all failed rules with errors.Is.
+type ValidationError struct {
+	Fields []FieldError
+
+	// kind is ErrInvalidTodo, ErrInvalidList or ErrInvalidWebhook, nil means
+	// ErrInvalidTodo.
+	kind error
+}
+
+func (ve *ValidationError) Error() string {
+	kind := ve.kindOrDefault()
+
+	reasons := make([]string, len(ve.Fields))
+	for idx, field := range ve.Fields {
+		reasons[idx] = strings.TrimPrefix(field.err.Error(), kind.Error()+": ")
+	}
+
+	return kind.Error() + ": " + strings.Join(reasons, "; ")
+}
+
+func (ve *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(ve.Fields)+1)
+	errs = append(errs, ve.kindOrDefault())
+
+	for _, field := range ve.Fields {
+		errs = append(errs, field.err)
+	}
+
+	return errs
+}
+
+func (ve *ValidationError) add(field, rule, reason string, err error) {
+	ve.Fields = append(ve.Fields, FieldError{Field: field, Rule: rule, Reason: reason, err: err})
+}
+
+func (ve *ValidationError) kindOrDefault() error {
+	if ve.kind == nil {
+		return ErrInvalidTodo
+	}
+
+	return ve.kind
+}
+
+// errOrNil avoids returning a typed nil through the error interface.
+func (ve *ValidationError) errOrNil() error {
+	if len(ve.Fields) == 0 {
+		return nil
+	}
+
+	return ve
+}
+
+// WithPrefix returns a copy of ve with prefix prepended to the name of every
+// field, e.g. to address the todo of a batch operation.
+func (ve *ValidationError) WithPrefix(prefix string) *ValidationError {
+	prefixed := &ValidationError{Fields: make([]FieldError, len(ve.Fields)), kind: ve.kind}
+	for idx, field := range ve.Fields {
+		field.Field = prefix + field.Field
+		prefixed.Fields[idx] = field
+	}
+
+	return prefixed
+}
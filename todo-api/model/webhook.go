@@ -0,0 +1,138 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Events sent to webhooks. A todo that is updated to completed is announced
+// as both EventTodoUpdated and EventTodoCompleted.
+const (
+	EventTodoCreated   = "todo.created"
+	EventTodoUpdated   = "todo.updated"
+	EventTodoCompleted = "todo.completed"
+	EventTodoDeleted   = "todo.deleted"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to.
+var WebhookEvents = []string{EventTodoCreated, EventTodoUpdated, EventTodoCompleted, EventTodoDeleted}
+
+var (
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	ErrNilWebhook     = errors.New("nil webhook")
+
+	ErrInvalidWebhookURL = fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	ErrUnknownEvent      = fmt.Errorf("%w: events must be one of %s", ErrInvalidWebhook, strings.Join(WebhookEvents, ", "))
+	ErrDuplicateEvent    = fmt.Errorf("%w: events must be unique", ErrInvalidWebhook)
+)
+
+// Webhook subscribes a URL to the events of the todos of its owner.
+type Webhook struct {
+	Id  int    `json:"id"`
+	URL string `json:"url"`
+	// Events lists the events sent to the webhook, all of them if empty.
+	Events []string `json:"events,omitempty"`
+	// Secret is the key of the HMAC-SHA256 signature of every payload. It is
+	// generated if empty and only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+
+	// The timestamps are maintained by the store, values sent by clients are
+	// ignored.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsValid returns ErrNilWebhook for a nil webhook and a *ValidationError
+// listing every failed field otherwise, or nil if the webhook is valid. The
+// addresses the host of the URL resolves to are only checked when delivering,
+// since they may change meanwhile.
+func (w *Webhook) IsValid() error {
+	if w == nil {
+		return ErrNilWebhook
+	}
+
+	verr := &ValidationError{kind: ErrInvalidWebhook}
+
+	if w.URL == "" {
+		verr.add("url", RuleRequired, "must not be empty", ErrInvalidWebhookURL)
+	} else if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		verr.add("url", RuleFormat, "must be an absolute http or https URL", ErrInvalidWebhookURL)
+	}
+
+	seen := make(map[string]bool, len(w.Events))
+	for idx, event := range w.Events {
+		field := fmt.Sprintf("events[%d]", idx)
+
+		if !knownEvent(event) {
+			verr.add(field, RuleFormat, "must be one of "+strings.Join(WebhookEvents, ", "), ErrUnknownEvent)
+			continue
+		}
+
+		if seen[event] {
+			verr.add(field, RuleUnique, "must not repeat an earlier event", ErrDuplicateEvent)
+		}
+		seen[event] = true
+	}
+
+	return verr.errOrNil()
+}
+
+// Wants reports whether event is sent to the webhook.
+func (w *Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, wanted := range w.Events {
+		if wanted == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+func knownEvent(event string) bool {
+	for _, known := range WebhookEvents {
+		if known == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeliveryStatus is the state of a Delivery.
+type DeliveryStatus string
+
+const (
+	// DeliveryPending is waiting for its first or next attempt.
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDelivered was accepted by the receiver with a 2xx status.
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed was given up after its last attempt.
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// Delivery is an event queued for a webhook along with the outcome of the
+// attempts to send it.
+type Delivery struct {
+	Id        int             `json:"id"`
+	WebhookId int             `json:"webhook_id"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+
+	Status   DeliveryStatus `json:"status"`
+	Attempts int            `json:"attempts"`
+	// ResponseStatus and LastError describe the outcome of the last attempt.
+	ResponseStatus int        `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttempt    *time.Time `json:"next_attempt,omitempty"`
+
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
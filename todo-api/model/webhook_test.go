@@ -0,0 +1,80 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook_IsValid(t *testing.T) {
+	tests := []struct {
+		name       string
+		hook       *Webhook
+		wantErr    error
+		wantFields []string
+	}{
+		{name: "nil webhook", hook: nil, wantErr: ErrNilWebhook},
+		{name: "all events", hook: &Webhook{URL: "https://example.com/hooks"}},
+		{name: "some events", hook: &Webhook{URL: "http://localhost:9000", Events: []string{EventTodoCompleted, EventTodoDeleted}}},
+		{name: "empty url", hook: &Webhook{}, wantErr: ErrInvalidWebhookURL, wantFields: []string{"url"}},
+		{name: "relative url", hook: &Webhook{URL: "/hooks"}, wantErr: ErrInvalidWebhookURL, wantFields: []string{"url"}},
+		{name: "ftp url", hook: &Webhook{URL: "ftp://example.com"}, wantErr: ErrInvalidWebhookURL, wantFields: []string{"url"}},
+		{
+			name:       "unknown event",
+			hook:       &Webhook{URL: "https://example.com", Events: []string{EventTodoCreated, "todo.exploded"}},
+			wantErr:    ErrUnknownEvent,
+			wantFields: []string{"events[1]"},
+		},
+		{
+			name:       "repeated event",
+			hook:       &Webhook{URL: "https://example.com", Events: []string{EventTodoCreated, EventTodoCreated}},
+			wantErr:    ErrDuplicateEvent,
+			wantFields: []string{"events[1]"},
+		},
+		{
+			name:       "everything wrong",
+			hook:       &Webhook{URL: "example", Events: []string{"todo"}},
+			wantErr:    ErrInvalidWebhookURL,
+			wantFields: []string{"url", "events[0]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hook.IsValid()
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+
+			if tt.wantErr == ErrNilWebhook {
+				return
+			}
+
+			assert.True(t, errors.Is(err, ErrInvalidWebhook))
+			assert.False(t, errors.Is(err, ErrInvalidTodo))
+
+			var verr *ValidationError
+			if assert.True(t, errors.As(err, &verr)) {
+				var fields []string
+				for _, field := range verr.Fields {
+					fields = append(fields, field.Field)
+				}
+
+				assert.Equal(t, tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestWebhook_Wants(t *testing.T) {
+	all := &Webhook{}
+	assert.True(t, all.Wants(EventTodoCreated))
+	assert.True(t, all.Wants(EventTodoDeleted))
+
+	some := &Webhook{Events: []string{EventTodoCompleted}}
+	assert.True(t, some.Wants(EventTodoCompleted))
+	assert.False(t, some.Wants(EventTodoUpdated))
+}
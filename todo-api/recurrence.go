@@ -0,0 +1,47 @@
+package todoapp
+
+import (
+	"context"
+	"log"
+	"todoapp/model"
+)
+
+// takeRecurrence returns a copy of todo, which is being completed, without
+// its recurrence along with its next occurrence, nil if it has none. The
+// recurrence moves on to the next occurrence, so completing todo once more
+// after reopening it does not schedule the next occurrence twice.
+func takeRecurrence(todo *model.Todo) (*model.Todo, *model.Todo) {
+	if todo.Recurrence == "" {
+		return todo, nil
+	}
+
+	next, err := todo.NextOccurrence()
+	if err != nil {
+		log.Printf("todoapp: scheduling next occurrence of todo %d: %v", todo.Id, err)
+		return todo, nil
+	}
+
+	completed := *todo
+	completed.Recurrence = ""
+
+	return &completed, next
+}
+
+// scheduleNext adds next, the next occurrence of the recurring todo with the
+// given id that was just completed, if it has one. Like completeParents it
+// runs after the write, so failures are logged rather than failing the
+// update, and a cancelled ctx does not stop it.
+func (t *TodoApp) scheduleNext(ctx context.Context, owner int, id int, next *model.Todo) {
+	ctx = context.WithoutCancel(ctx)
+
+	if next == nil {
+		return
+	}
+
+	if err := t.backend.Add(ctx, owner, next); err != nil {
+		log.Printf("todoapp: scheduling next occurrence of todo %d: %v", id, err)
+		return
+	}
+
+	t.record(ctx, owner, &model.Revision{Action: model.ActionCreated}, nil, next)
+}
@@ -0,0 +1,153 @@
+package todoapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"todoapp/model"
+	"todoapp/store"
+)
+
+// ErrBlocked is returned when a todo is completed while one of the todos it is
+// blocked by is still open.
+var ErrBlocked = errors.New("todo is blocked by open todos")
+
+// GetTodoTree returns the todo with the given id along with all of its
+// subtasks, recursively.
+func (t *TodoApp) GetTodoTree(ctx context.Context, owner int, id int) (*model.Tree, error) {
+	todo, err := t.backend.GetById(ctx, owner, id)
+	if err != nil {
+		return nil, backendError("get todo", err)
+	}
+
+	root := &model.Tree{Todo: todo, Children: []*model.Tree{}}
+	seen := map[int]bool{id: true}
+
+	for queue := []*model.Tree{root}; len(queue) > 0; queue = queue[1:] {
+		node := queue[0]
+
+		children, _, err := t.backend.Query(ctx, owner, model.Query{ParentId: &node.Id, Sort: []model.SortKey{{Field: model.SortFieldId}}})
+		if err != nil {
+			return nil, backendError("get subtasks", err)
+		}
+
+		for _, child := range children {
+			if seen[child.Id] {
+				continue
+			}
+			seen[child.Id] = true
+
+			subtree := &model.Tree{Todo: child, Children: []*model.Tree{}}
+			node.Children = append(node.Children, subtree)
+			queue = append(queue, subtree)
+		}
+	}
+
+	return root, nil
+}
+
+// GetBlockers returns the todos the todo with the given id is blocked by.
+// Blockers that were deleted in the meantime are left out.
+func (t *TodoApp) GetBlockers(ctx context.Context, owner int, id int) ([]*model.Todo, error) {
+	todo, err := t.backend.GetById(ctx, owner, id)
+	if err != nil {
+		return nil, backendError("get todo", err)
+	}
+
+	blockers := []*model.Todo{}
+	for _, blockerId := range todo.BlockedBy {
+		blocker, err := t.backend.GetById(ctx, owner, blockerId)
+		if errors.Is(err, store.ErrTodoNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, backendError("get blocker", err)
+		}
+
+		blockers = append(blockers, blocker)
+	}
+
+	return blockers, nil
+}
+
+// checkBlockers returns ErrBlocked if any todo that todo is blocked by is
+// still open.
+func (t *TodoApp) checkBlockers(ctx context.Context, owner int, todo *model.Todo) error {
+	for _, blockerId := range todo.BlockedBy {
+		blocker, err := t.backend.GetById(ctx, owner, blockerId)
+		if errors.Is(err, store.ErrTodoNotFound) {
+			continue
+		}
+		if err != nil {
+			return backendError("get blocker", err)
+		}
+
+		if !blocker.Completed {
+			return fmt.Errorf("%w: todo %d is still open", ErrBlocked, blockerId)
+		}
+	}
+
+	return nil
+}
+
+// completeParents completes the ancestors of todo that have AutoComplete set
+// once all of their subtasks are completed. It runs after todo was saved, so
+// failures are logged rather than failing the write, and a parent that was
+// changed concurrently is left alone. The write being done, cancelling ctx
+// does not stop it halfway up the tree.
+func (t *TodoApp) completeParents(ctx context.Context, owner int, todo *model.Todo) {
+	ctx = context.WithoutCancel(ctx)
+
+	for parentId := todo.ParentId; parentId != 0; {
+		parent, err := t.backend.GetById(ctx, owner, parentId)
+		if err != nil {
+			if !errors.Is(err, store.ErrTodoNotFound) {
+				log.Printf("todoapp: auto-completing todo %d: %v", parentId, err)
+			}
+			return
+		}
+
+		if parent.Completed || !parent.AutoComplete {
+			return
+		}
+
+		done, err := t.subtasksDone(ctx, owner, parent.Id)
+		if err != nil {
+			log.Printf("todoapp: auto-completing todo %d: %v", parent.Id, err)
+			return
+		}
+
+		if !done || t.checkBlockers(ctx, owner, parent) != nil {
+			return
+		}
+
+		completed := *parent
+		completed.Completed = true
+
+		updated, err := t.backend.Update(ctx, owner, parent.Id, &completed)
+		if err != nil {
+			if !errors.Is(err, store.ErrVersionConflict) {
+				log.Printf("todoapp: auto-completing todo %d: %v", parent.Id, err)
+			}
+			return
+		}
+
+		t.record(ctx, owner, &model.Revision{Action: model.ActionUpdated}, parent, updated)
+
+		parentId = parent.ParentId
+	}
+}
+
+// subtasksDone reports whether every subtask of the todo with the given id is
+// completed.
+func (t *TodoApp) subtasksDone(ctx context.Context, owner int, id int) (bool, error) {
+	open := false
+
+	_, total, err := t.backend.Query(ctx, owner, model.Query{ParentId: &id, Completed: &open, Limit: 1})
+	if err != nil {
+		return false, err
+	}
+
+	return total == 0, nil
+}
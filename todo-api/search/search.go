@@ -0,0 +1,426 @@
+// Package search finds todos by the words of their title, tags and
+// description. It keeps an inverted index of the todos of every owner in
+// memory, which follows the writes to a store through its change hook.
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"todoapp/model"
+	"todoapp/store"
+)
+
+const (
+	// The weights of the fields count a word of the title thrice and a tag
+	// twice as much as a word of the description.
+	titleWeight       = 3
+	tagWeight         = 2
+	descriptionWeight = 1
+
+	// prefixWeight discounts terms that only start with a word searched for,
+	// so that "plan" ranks todos about plans before those about planets.
+	prefixWeight = 0.5
+	// minPrefixLength is the length a word searched for needs to match longer
+	// terms, shorter ones only match exactly.
+	minPrefixLength = 2
+
+	// bm25K1 and bm25B tune the saturation of repeated words and the
+	// normalization by length of Okapi BM25.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// excerptWidth is the approximate length of the excerpt of a matching
+	// description in bytes.
+	excerptWidth = 160
+)
+
+// Result is a todo found by a search. Highlights holds the title and, if it
+// matched, an excerpt of the description as HTML, with the matching words
+// wrapped in <mark>.
+type Result struct {
+	Todo       *model.Todo       `json:"todo"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// Loader returns all todos of an owner, like store.Store.GetAll.
+type Loader func(ctx context.Context, owner int) ([]*model.Todo, error)
+
+// Index is an inverted index of the todos of every owner. The todos of an
+// owner are loaded when the owner is first searched for or rebuilt, from then
+// on Apply keeps them up to date.
+type Index struct {
+	sync.RWMutex
+
+	load   Loader
+	owners map[int]*shard
+}
+
+// NewIndex returns an empty index loading todos with load.
+func NewIndex(load Loader) *Index {
+	return &Index{load: load, owners: make(map[int]*shard)}
+}
+
+// Rebuild replaces the todos of owner in the index by those load returns.
+// Changes applied meanwhile wait for it, so none of them gets lost.
+func (ix *Index) Rebuild(ctx context.Context, owner int) error {
+	ix.Lock()
+	defer ix.Unlock()
+
+	return ix.rebuild(ctx, owner)
+}
+
+// rebuild loads the todos of owner, callers must hold the lock.
+func (ix *Index) rebuild(ctx context.Context, owner int) error {
+	todos, err := ix.load(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	sh := newShard()
+	for _, todo := range todos {
+		sh.add(todo)
+	}
+
+	ix.owners[owner] = sh
+
+	return nil
+}
+
+// Apply updates the index with change, it is a store.ChangeHook. Changes to
+// the todos of owners that are not loaded yet are left to loading them.
+func (ix *Index) Apply(change store.Change) {
+	ix.Lock()
+	defer ix.Unlock()
+
+	sh, ok := ix.owners[change.Owner]
+	if !ok {
+		return
+	}
+
+	if change.Type == store.ChangeDeleted || change.Todo.DeletedAt != nil {
+		sh.remove(change.Todo.Id)
+		return
+	}
+
+	sh.add(change.Todo)
+}
+
+// Search returns the page of todos of owner selected by q, ordered by how
+// well they match the words of q.Search, along with the number of todos that
+// matched. A todo has to match every word, or a longer word starting with it
+// so that results show up while typing. The other filters of q apply as in
+// a query, the sort order is ignored.
+func (ix *Index) Search(ctx context.Context, owner int, q model.Query) ([]*Result, int, error) {
+	words := queryTerms(q.Search)
+	if len(words) == 0 {
+		return []*Result{}, 0, nil
+	}
+
+	filters := q
+	filters.Search = ""
+
+	if err := ix.ensureLoaded(ctx, owner); err != nil {
+		return nil, 0, err
+	}
+
+	ix.RLock()
+	scored, matched := ix.owners[owner].search(words, filters)
+	ix.RUnlock()
+
+	total := len(scored)
+	if q.Offset >= total {
+		return []*Result{}, total, nil
+	}
+
+	scored = scored[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(scored) {
+		scored = scored[:q.Limit]
+	}
+
+	results := make([]*Result, len(scored))
+	for idx, hit := range scored {
+		// The todos of the index are never changed, only replaced.
+		todo := *hit.todo
+
+		highlights := map[string]string{"title": highlight(todo.Title, matched)}
+		if description := excerpt(todo.Description, matched, excerptWidth); description != "" {
+			highlights["description"] = description
+		}
+
+		results[idx] = &Result{Todo: &todo, Score: math.Round(hit.score*1000) / 1000, Highlights: highlights}
+	}
+
+	return results, total, nil
+}
+
+// ensureLoaded loads the todos of owner unless they are loaded already.
+func (ix *Index) ensureLoaded(ctx context.Context, owner int) error {
+	ix.RLock()
+	_, ok := ix.owners[owner]
+	ix.RUnlock()
+
+	if ok {
+		return nil
+	}
+
+	ix.Lock()
+	defer ix.Unlock()
+
+	if _, ok := ix.owners[owner]; ok {
+		return nil
+	}
+
+	return ix.rebuild(ctx, owner)
+}
+
+// queryTerms returns the words of a search with distinct terms in the order
+// they appear.
+func queryTerms(search string) []token {
+	var words []token
+
+	seen := make(map[string]bool)
+	for _, tok := range tokenize(search) {
+		if !seen[tok.term] {
+			seen[tok.term] = true
+			words = append(words, tok)
+		}
+	}
+
+	return words
+}
+
+// shard holds the todos of one owner.
+type shard struct {
+	docs map[int]*document
+	// postings maps each term onto the todos containing it and the weighted
+	// number of times they do.
+	postings map[string]map[int]float64
+	// terms are the keys of postings in order, for finding terms by prefix.
+	terms []string
+	// words are the words of the todos in lower case and in order, mapped
+	// onto their terms by wordTerms along with the number of todos containing
+	// them. A word being typed often only is a prefix of a word, not of its
+	// stem: "plann" of "planning", indexed as "plan".
+	words       []string
+	wordTerms   map[string]string
+	wordCounts  map[string]int
+	totalLength float64
+}
+
+// document is an indexed todo.
+type document struct {
+	todo   *model.Todo
+	terms  map[string]float64
+	words  map[string]bool
+	length float64
+}
+
+type hit struct {
+	todo  *model.Todo
+	score float64
+}
+
+func newShard() *shard {
+	return &shard{
+		docs:       make(map[int]*document),
+		postings:   make(map[string]map[int]float64),
+		wordTerms:  make(map[string]string),
+		wordCounts: make(map[string]int),
+	}
+}
+
+func (sh *shard) add(todo *model.Todo) {
+	sh.remove(todo.Id)
+
+	copied := *todo
+	doc := &document{todo: &copied, terms: make(map[string]float64), words: make(map[string]bool)}
+
+	count := func(text string, weight float64) {
+		for _, tok := range tokenize(text) {
+			doc.terms[tok.term] += weight
+			doc.words[tok.word] = true
+			doc.length += weight
+		}
+	}
+
+	count(todo.Title, titleWeight)
+	count(todo.Description, descriptionWeight)
+	for _, tag := range todo.Tags {
+		count(tag, tagWeight)
+	}
+
+	for term, weight := range doc.terms {
+		postings, ok := sh.postings[term]
+		if !ok {
+			postings = make(map[int]float64)
+			sh.postings[term] = postings
+
+			sh.terms = insertSorted(sh.terms, term)
+		}
+
+		postings[todo.Id] = weight
+	}
+
+	for word := range doc.words {
+		if sh.wordCounts[word] == 0 {
+			sh.words = insertSorted(sh.words, word)
+			sh.wordTerms[word] = stem(word)
+		}
+		sh.wordCounts[word]++
+	}
+
+	sh.docs[todo.Id] = doc
+	sh.totalLength += doc.length
+}
+
+func (sh *shard) remove(id int) {
+	doc, ok := sh.docs[id]
+	if !ok {
+		return
+	}
+
+	for term := range doc.terms {
+		postings := sh.postings[term]
+		delete(postings, id)
+
+		if len(postings) == 0 {
+			delete(sh.postings, term)
+
+			sh.terms = removeSorted(sh.terms, term)
+		}
+	}
+
+	for word := range doc.words {
+		sh.wordCounts[word]--
+		if sh.wordCounts[word] == 0 {
+			delete(sh.wordCounts, word)
+			delete(sh.wordTerms, word)
+			sh.words = removeSorted(sh.words, word)
+		}
+	}
+
+	delete(sh.docs, id)
+	sh.totalLength -= doc.length
+}
+
+// insertSorted inserts s into the sorted strings list.
+func insertSorted(list []string, s string) []string {
+	at := sort.SearchStrings(list, s)
+	list = append(list, "")
+	copy(list[at+1:], list[at:])
+	list[at] = s
+
+	return list
+}
+
+// removeSorted removes s from the sorted strings list.
+func removeSorted(list []string, s string) []string {
+	at := sort.SearchStrings(list, s)
+
+	return append(list[:at], list[at+1:]...)
+}
+
+// expand returns the terms a word searched for matches, each with its
+// weight: the term of the word itself and, unless the word is short, the
+// longer terms starting with its term and the terms of the longer words
+// starting with it.
+func (sh *shard) expand(word token) map[string]float64 {
+	matches := make(map[string]float64)
+	if _, ok := sh.postings[word.term]; ok {
+		matches[word.term] = 1
+	}
+
+	if len(word.word) < minPrefixLength {
+		return matches
+	}
+
+	for at := sort.SearchStrings(sh.terms, word.term); at < len(sh.terms) && strings.HasPrefix(sh.terms[at], word.term); at++ {
+		if sh.terms[at] != word.term {
+			matches[sh.terms[at]] = prefixWeight
+		}
+	}
+
+	for at := sort.SearchStrings(sh.words, word.word); at < len(sh.words) && strings.HasPrefix(sh.words[at], word.word); at++ {
+		if term := sh.wordTerms[sh.words[at]]; term != word.term {
+			matches[term] = prefixWeight
+		}
+	}
+
+	return matches
+}
+
+// search scores the todos matching every word with Okapi BM25. Each word
+// counts with the best of the terms it matches in a todo. It returns the
+// hits, best first, and all terms that matched for highlighting.
+func (sh *shard) search(words []token, filters model.Query) ([]hit, map[string]bool) {
+	if len(sh.docs) == 0 {
+		return []hit{}, nil
+	}
+
+	avgLength := sh.totalLength / float64(len(sh.docs))
+	if avgLength == 0 {
+		avgLength = 1
+	}
+
+	scores := make(map[int]float64)
+	for idx, word := range words {
+		best := make(map[int]float64)
+
+		for term, weight := range sh.expand(word) {
+			postings := sh.postings[term]
+			df := float64(len(postings))
+			idf := math.Log(1 + (float64(len(sh.docs))-df+0.5)/(df+0.5))
+
+			for id, tf := range postings {
+				norm := 1 - bm25B + bm25B*sh.docs[id].length/avgLength
+				score := weight * idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+				if score > best[id] {
+					best[id] = score
+				}
+			}
+		}
+
+		// A todo has to match all words, those missing one drop out.
+		if idx == 0 {
+			scores = best
+			continue
+		}
+
+		for id, score := range scores {
+			if wordScore, ok := best[id]; ok {
+				scores[id] = score + wordScore
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]hit, 0, len(scores))
+	for id, score := range scores {
+		todo := sh.docs[id].todo
+		if filters.Matches(todo) {
+			hits = append(hits, hit{todo: todo, score: score})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+
+		return hits[i].todo.Id < hits[j].todo.Id
+	})
+
+	matched := make(map[string]bool)
+	for _, word := range words {
+		for term := range sh.expand(word) {
+			matched[term] = true
+		}
+	}
+
+	return hits, matched
+}
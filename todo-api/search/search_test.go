@@ -0,0 +1,226 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"todoapp/model"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testTodos() []*model.Todo {
+	return []*model.Todo{
+		{Id: 1, Title: "Buy groceries", Description: "Milk, eggs and bread from the market", Tags: []string{"shopping"}},
+		{Id: 2, Title: "Plan the garden", Description: "Which vegetables to plant where"},
+		{Id: 3, Title: "Read about planets", Completed: true},
+		{Id: 4, Title: "Call the plumber", Description: "The kitchen tap is running again, buy a new washer first", ListId: 2},
+		{Id: 5, Title: "Bake <bread> & cake", Tags: []string{"baking"}},
+	}
+}
+
+func newTestIndex(todos []*model.Todo) (*Index, *int) {
+	loads := 0
+
+	return NewIndex(func(_ context.Context, owner int) ([]*model.Todo, error) {
+		loads++
+		if owner != store.Anonymous {
+			return nil, nil
+		}
+
+		return todos, nil
+	}), &loads
+}
+
+func resultIds(results []*Result) []int {
+	ids := make([]int, len(results))
+	for idx, result := range results {
+		ids[idx] = result.Todo.Id
+	}
+
+	return ids
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("The Running dogs' bowls, 2 cafés!")
+
+	assert.Equal(t, []token{
+		{term: "run", word: "running", start: 4, end: 11},
+		{term: "dog", word: "dogs", start: 12, end: 16},
+		{term: "bowl", word: "bowls", start: 18, end: 23},
+		{term: "2", word: "2", start: 25, end: 26},
+		{term: "cafés", word: "cafés", start: 27, end: 33},
+	}, tokens)
+}
+
+func TestHighlight(t *testing.T) {
+	matched := map[string]bool{"bread": true, "cake": true}
+
+	assert.Equal(t, "Bake &lt;<mark>bread</mark>&gt; &amp; <mark>cake</mark>", highlight("Bake <bread> & cake", matched))
+	assert.Equal(t, "Nothing &amp; more", highlight("Nothing & more", matched))
+}
+
+func TestExcerpt(t *testing.T) {
+	matched := map[string]bool{"washer": true}
+	long := strings.Repeat("lorem ipsum ", 30) + "buy a washer " + strings.Repeat("dolor sit ", 30)
+
+	got := excerpt(long, matched, 60)
+	assert.True(t, strings.HasPrefix(got, "…"), got)
+	assert.True(t, strings.HasSuffix(got, "…"), got)
+	assert.Contains(t, got, "buy a <mark>washer</mark>")
+	assert.True(t, len(got) < 100, got)
+
+	assert.Equal(t, "buy a <mark>washer</mark>", excerpt("buy a washer", matched, 60))
+	assert.Equal(t, "", excerpt("buy a hammer", matched, 60))
+}
+
+func TestIndex_Search(t *testing.T) {
+	completed := true
+	listId := 2
+
+	tests := []struct {
+		name    string
+		query   model.Query
+		wantIds []int
+	}{
+		{"Word", model.Query{Search: "bread"}, []int{5, 1}},
+		{"Stemmed", model.Query{Search: "grocery"}, []int{1}},
+		{"AllWords", model.Query{Search: "buy bread"}, []int{1}},
+		{"StopWordsIgnored", model.Query{Search: "the bread"}, []int{5, 1}},
+		{"Prefix", model.Query{Search: "pla"}, []int{3, 2}},
+		{"ExactBeforePrefix", model.Query{Search: "plan"}, []int{2, 3}},
+		{"Tag", model.Query{Search: "shopping"}, []int{1}},
+		{"CaseInsensitive", model.Query{Search: "PLUMBER"}, []int{4}},
+		{"NoMatch", model.Query{Search: "holiday"}, []int{}},
+		{"OneWordMissing", model.Query{Search: "bread holiday"}, []int{}},
+		{"OnlyStopWords", model.Query{Search: "the and"}, []int{}},
+		{"Completed", model.Query{Search: "pla", Completed: &completed}, []int{3}},
+		{"List", model.Query{Search: "buy", ListId: &listId}, []int{4}},
+		{"Limit", model.Query{Search: "bread", Limit: 1}, []int{5}},
+		{"Offset", model.Query{Search: "bread", Offset: 1}, []int{1}},
+		{"OffsetPastEnd", model.Query{Search: "bread", Offset: 5}, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ix, _ := newTestIndex(testTodos())
+
+			results, _, err := ix.Search(context.Background(), store.Anonymous, tt.query)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantIds, resultIds(results))
+			}
+		})
+	}
+}
+
+func TestIndex_SearchResults(t *testing.T) {
+	ix, _ := newTestIndex(testTodos())
+
+	results, total, err := ix.Search(context.Background(), store.Anonymous, model.Query{Search: "buy", Limit: 1})
+	if !assert.NoError(t, err) || !assert.Len(t, results, 1) {
+		return
+	}
+
+	assert.Equal(t, 2, total)
+	assert.Equal(t, testTodos()[0], results[0].Todo)
+	assert.True(t, results[0].Score > 0)
+	assert.Equal(t, map[string]string{"title": "<mark>Buy</mark> groceries"}, results[0].Highlights)
+
+	results, _, err = ix.Search(context.Background(), store.Anonymous, model.Query{Search: "washer"})
+	if assert.NoError(t, err) && assert.Len(t, results, 1) {
+		assert.Equal(t, map[string]string{
+			"title":       "Call the plumber",
+			"description": "The kitchen tap is running again, buy a new <mark>washer</mark> first",
+		}, results[0].Highlights)
+	}
+}
+
+func TestIndex_SearchPartialWords(t *testing.T) {
+	ix, _ := newTestIndex([]*model.Todo{
+		{Id: 1, Title: "Planning meeting"},
+		{Id: 2, Title: "Running shoes"},
+		{Id: 3, Title: "Happiness report"},
+	})
+
+	// Words being typed match the words they start, whatever their stem.
+	tests := []struct {
+		search  string
+		wantIds []int
+	}{
+		{"plan", []int{1}},
+		{"plann", []int{1}},
+		{"planni", []int{1}},
+		{"planning", []int{1}},
+		{"runni", []int{2}},
+		{"happin", []int{3}},
+		{"happiness rep", []int{3}},
+		{"plant", []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			results, _, err := ix.Search(context.Background(), store.Anonymous, model.Query{Search: tt.search})
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantIds, resultIds(results))
+			}
+		})
+	}
+
+	results, _, err := ix.Search(context.Background(), store.Anonymous, model.Query{Search: "plann"})
+	if assert.NoError(t, err) && assert.Len(t, results, 1) {
+		assert.Equal(t, "<mark>Planning</mark> meeting", results[0].Highlights["title"])
+	}
+}
+
+func TestIndex_Apply(t *testing.T) {
+	ix, loads := newTestIndex(testTodos())
+
+	search := func(q string) []int {
+		results, _, err := ix.Search(context.Background(), store.Anonymous, model.Query{Search: q})
+		assert.NoError(t, err)
+
+		return resultIds(results)
+	}
+
+	// Changes before the first search are left to loading the todos.
+	ix.Apply(store.Change{Type: store.ChangeCreated, Owner: store.Anonymous, Todo: &model.Todo{Id: 9, Title: "Lost bread"}})
+	assert.Equal(t, []int{5, 1}, search("bread"))
+	assert.Equal(t, 1, *loads)
+
+	ix.Apply(store.Change{Type: store.ChangeCreated, Owner: store.Anonymous, Todo: &model.Todo{Id: 6, Title: "Bread", Tags: []string{"bread"}}})
+	assert.Equal(t, []int{6, 5, 1}, search("bread"))
+
+	ix.Apply(store.Change{Type: store.ChangeUpdated, Owner: store.Anonymous, Todo: &model.Todo{Id: 5, Title: "Bake cake"}})
+	assert.Equal(t, []int{6, 1}, search("bread"))
+	assert.Equal(t, []int{5}, search("cake"))
+
+	ix.Apply(store.Change{Type: store.ChangeDeleted, Owner: store.Anonymous, Todo: &model.Todo{Id: 1, Title: "Buy groceries"}})
+	assert.Equal(t, []int{6}, search("bread"))
+	assert.Equal(t, []int{}, search("groceries"))
+
+	trashed := time.Now()
+	ix.Apply(store.Change{Type: store.ChangeUpdated, Owner: store.Anonymous, Todo: &model.Todo{Id: 6, Title: "Bread", DeletedAt: &trashed}})
+	assert.Equal(t, []int{}, search("bread"))
+
+	// Other owners are loaded on their own.
+	results, _, err := ix.Search(context.Background(), 1, model.Query{Search: "bread"})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Equal(t, 2, *loads)
+
+	assert.NoError(t, ix.Rebuild(context.Background(), store.Anonymous))
+	assert.Equal(t, []int{5, 1}, search("bread"))
+	assert.Equal(t, 3, *loads)
+}
+
+func TestIndex_LoadError(t *testing.T) {
+	failure := errors.New("boom")
+	ix := NewIndex(func(context.Context, int) ([]*model.Todo, error) { return nil, failure })
+
+	_, _, err := ix.Search(context.Background(), store.Anonymous, model.Query{Search: "bread"})
+	assert.True(t, errors.Is(err, failure), "got error %v, want %v", err, failure)
+
+	assert.True(t, errors.Is(ix.Rebuild(context.Background(), store.Anonymous), failure))
+}
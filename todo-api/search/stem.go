@@ -0,0 +1,311 @@
+package search
+
+import "strings"
+
+// stem reduces an English word in lower case to its stem with the algorithm
+// of M.F. Porter, "An algorithm for suffix stripping" (1980), following his
+// reference implementation. Words of up to two letters and words with other
+// characters than a to z are left as they are.
+func stem(word string) string {
+	if len(word) <= 2 || strings.IndexFunc(word, func(r rune) bool { return r < 'a' || r > 'z' }) >= 0 {
+		return word
+	}
+
+	s := &stemmer{b: []byte(word)}
+
+	s.step1ab()
+	if len(s.b) > 1 {
+		s.step1c()
+		s.step2()
+		s.step3()
+		s.step4()
+		s.step5()
+	}
+
+	return string(s.b)
+}
+
+// stemmer holds the word being stemmed, its last letter is at k. j marks the
+// end of the stem before the suffix matched by the last successful ends.
+type stemmer struct {
+	b []byte
+	j int
+}
+
+func (s *stemmer) k() int {
+	return len(s.b) - 1
+}
+
+// cons tells whether the letter at i is a consonant, y is one at the start
+// of the word or after a vowel.
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	default:
+		return true
+	}
+}
+
+// m measures the number of vowel-consonant sequences of the stem up to j,
+// the m of [C](VC){m}[V].
+func (s *stemmer) m() int {
+	n := 0
+	i := 0
+
+	for {
+		if i > s.j {
+			return n
+		}
+		if !s.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+
+	for {
+		for {
+			if i > s.j {
+				return n
+			}
+			if s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+
+		for {
+			if i > s.j {
+				return n
+			}
+			if !s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+// vowelInStem tells whether the stem up to j contains a vowel.
+func (s *stemmer) vowelInStem() bool {
+	for i := 0; i <= s.j; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// doubleCons tells whether the letters at i-1 and i are the same consonant.
+func (s *stemmer) doubleCons(i int) bool {
+	return i >= 1 && s.b[i] == s.b[i-1] && s.cons(i)
+}
+
+// cvc tells whether the letters at i-2, i-1 and i are consonant, vowel and
+// consonant, the last one not being w, x or y. It holds for e.g. hop, but
+// not for snow.
+func (s *stemmer) cvc(i int) bool {
+	if i < 2 || !s.cons(i) || s.cons(i-1) || !s.cons(i-2) {
+		return false
+	}
+
+	switch s.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	default:
+		return true
+	}
+}
+
+// ends tells whether the word ends with suffix and sets j to the end of the
+// stem in front of it.
+func (s *stemmer) ends(suffix string) bool {
+	if len(suffix) > len(s.b) || string(s.b[len(s.b)-len(suffix):]) != suffix {
+		return false
+	}
+
+	s.j = len(s.b) - len(suffix) - 1
+
+	return true
+}
+
+// setTo replaces what follows j with suffix.
+func (s *stemmer) setTo(suffix string) {
+	s.b = append(s.b[:s.j+1], suffix...)
+}
+
+// replace replaces what follows j with suffix if the stem has a measure
+// above zero.
+func (s *stemmer) replace(suffix string) {
+	if s.m() > 0 {
+		s.setTo(suffix)
+	}
+}
+
+func (s *stemmer) chop() {
+	s.b = s.b[:len(s.b)-1]
+}
+
+// step1ab removes plurals as well as -ed and -ing, e.g. caresses to caress,
+// ponies to poni, agreed to agree, motoring to motor and hopping to hop.
+func (s *stemmer) step1ab() {
+	if s.b[s.k()] == 's' {
+		switch {
+		case s.ends("sses"):
+			s.chop()
+			s.chop()
+		case s.ends("ies"):
+			s.setTo("i")
+		case s.b[s.k()-1] != 's':
+			s.chop()
+		}
+	}
+
+	if s.ends("eed") {
+		if s.m() > 0 {
+			s.chop()
+		}
+		return
+	}
+
+	if !(s.ends("ed") || s.ends("ing")) || !s.vowelInStem() {
+		return
+	}
+
+	s.b = s.b[:s.j+1]
+
+	switch {
+	case s.ends("at"):
+		s.setTo("ate")
+	case s.ends("bl"):
+		s.setTo("ble")
+	case s.ends("iz"):
+		s.setTo("ize")
+	case s.doubleCons(s.k()):
+		switch s.b[s.k()] {
+		case 'l', 's', 'z':
+		default:
+			s.chop()
+		}
+	default:
+		s.j = s.k()
+		if s.m() == 1 && s.cvc(s.k()) {
+			s.setTo("e")
+		}
+	}
+}
+
+// step1c turns a final y into i if there is another vowel in the stem.
+func (s *stemmer) step1c() {
+	if s.ends("y") && s.vowelInStem() {
+		s.b[s.k()] = 'i'
+	}
+}
+
+// replacements are tried in order, the first suffix the word ends with is
+// replaced if the measure of the stem in front of it is above zero.
+type replacement struct {
+	suffix, with string
+}
+
+// step2Replacements map double suffixes onto single ones, e.g. -ization onto
+// -ize.
+var step2Replacements = []replacement{
+	{"ational", "ate"},
+	{"tional", "tion"},
+	{"enci", "ence"},
+	{"anci", "ance"},
+	{"izer", "ize"},
+	{"bli", "ble"},
+	{"alli", "al"},
+	{"entli", "ent"},
+	{"eli", "e"},
+	{"ousli", "ous"},
+	{"ization", "ize"},
+	{"ation", "ate"},
+	{"ator", "ate"},
+	{"alism", "al"},
+	{"iveness", "ive"},
+	{"fulness", "ful"},
+	{"ousness", "ous"},
+	{"aliti", "al"},
+	{"iviti", "ive"},
+	{"biliti", "ble"},
+	{"logi", "log"},
+}
+
+// step3Replacements deal with -ic-, -full, -ness and the like.
+var step3Replacements = []replacement{
+	{"icate", "ic"},
+	{"ative", ""},
+	{"alize", "al"},
+	{"iciti", "ic"},
+	{"ical", "ic"},
+	{"ful", ""},
+	{"ness", ""},
+}
+
+// step4Suffixes are removed if the measure of the stem is above one.
+var step4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment", "ent",
+	"ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+func (s *stemmer) step2() {
+	s.replaceFirst(step2Replacements)
+}
+
+func (s *stemmer) step3() {
+	s.replaceFirst(step3Replacements)
+}
+
+func (s *stemmer) replaceFirst(replacements []replacement) {
+	for _, r := range replacements {
+		if s.ends(r.suffix) {
+			s.replace(r.with)
+			return
+		}
+	}
+}
+
+// step4 takes off -ant, -ence and the like in context <c>vcvc<v>.
+func (s *stemmer) step4() {
+	for _, suffix := range step4Suffixes {
+		if !s.ends(suffix) {
+			continue
+		}
+
+		// -ion only goes after s or t, as in adoption.
+		if suffix == "ion" && (s.j < 0 || (s.b[s.j] != 's' && s.b[s.j] != 't')) {
+			return
+		}
+
+		if s.m() > 1 {
+			s.b = s.b[:s.j+1]
+		}
+		return
+	}
+}
+
+// step5 removes a final -e and turns -ll into -l if the measure of the stem
+// is above one.
+func (s *stemmer) step5() {
+	s.j = s.k()
+
+	if s.b[s.k()] == 'e' {
+		if a := s.m(); a > 1 || (a == 1 && !s.cvc(s.k()-1)) {
+			s.chop()
+		}
+	}
+
+	if s.b[s.k()] == 'l' && s.doubleCons(s.k()) && s.m() > 1 {
+		s.chop()
+	}
+}
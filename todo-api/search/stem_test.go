@@ -0,0 +1,53 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"ties", "ti"},
+		{"cats", "cat"},
+		{"feed", "feed"},
+		{"agreed", "agre"},
+		{"plastered", "plaster"},
+		{"motoring", "motor"},
+		{"sing", "sing"},
+		{"conflated", "conflat"},
+		{"troubled", "troubl"},
+		{"sized", "size"},
+		{"hopping", "hop"},
+		{"falling", "fall"},
+		{"filing", "file"},
+		{"happy", "happi"},
+		{"sky", "sky"},
+		{"relational", "relat"},
+		{"conditional", "condit"},
+		{"hopefulness", "hope"},
+		{"adoption", "adopt"},
+		{"generalizations", "gener"},
+		{"oscillators", "oscil"},
+		{"controlling", "control"},
+		{"groceries", "groceri"},
+		{"grocery", "groceri"},
+		{"connection", "connect"},
+		{"connected", "connect"},
+		{"running", "run"},
+		{"as", "as"},
+		{"2026", "2026"},
+		{"café", "café"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			assert.Equal(t, tt.want, stem(tt.word))
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxTokenLength leaves out what is unlikely to be a word, like a pasted
+	// hash or URL, in bytes.
+	maxTokenLength = 64
+
+	markOpen  = "<mark>"
+	markClose = "</mark>"
+)
+
+// stopWords are too common in English to tell todos apart, they are neither
+// indexed nor searched for.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "so": true, "such": true, "that": true, "the": true,
+	"their": true, "then": true, "there": true, "these": true, "they": true,
+	"this": true, "to": true, "was": true, "will": true, "with": true,
+}
+
+// token is a word of a text reduced to the term it is indexed under, along
+// with the word in lower case and its position in the text in bytes.
+type token struct {
+	term       string
+	word       string
+	start, end int
+}
+
+// tokenize splits text into words of letters and digits and returns the
+// terms of those that are no stop words: lower case and stemmed.
+func tokenize(text string) []token {
+	var tokens []token
+
+	start := -1
+	for idx, r := range text + " " {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = idx
+			}
+			continue
+		}
+
+		if start < 0 {
+			continue
+		}
+
+		word := strings.ToLower(text[start:idx])
+		if len(word) <= maxTokenLength && !stopWords[word] {
+			tokens = append(tokens, token{term: stem(word), word: word, start: start, end: idx})
+		}
+		start = -1
+	}
+
+	return tokens
+}
+
+// highlight returns text as HTML with the words whose terms are in matched
+// wrapped in <mark>.
+func highlight(text string, matched map[string]bool) string {
+	var b strings.Builder
+
+	last := 0
+	for _, tok := range tokenize(text) {
+		if !matched[tok.term] {
+			continue
+		}
+
+		b.WriteString(html.EscapeString(text[last:tok.start]))
+		b.WriteString(markOpen)
+		b.WriteString(html.EscapeString(text[tok.start:tok.end]))
+		b.WriteString(markClose)
+		last = tok.end
+	}
+
+	b.WriteString(html.EscapeString(text[last:]))
+
+	return b.String()
+}
+
+// excerpt cuts the part around the first word of text whose term is in
+// matched out of a long text, at most about width bytes, and highlights it.
+// It returns the empty string if no word matched.
+func excerpt(text string, matched map[string]bool, width int) string {
+	first := -1
+	for _, tok := range tokenize(text) {
+		if matched[tok.term] {
+			first = tok.start
+			break
+		}
+	}
+
+	if first < 0 {
+		return ""
+	}
+
+	if len(text) <= width {
+		return highlight(text, matched)
+	}
+
+	// Start a little before the match, at the beginning of a word.
+	from := first - width/4
+	if from <= 0 {
+		from = 0
+	} else if space := strings.IndexByte(text[from:first], ' '); space >= 0 {
+		from += space + 1
+	} else {
+		from = first
+	}
+
+	to := from + width
+	if to >= len(text) {
+		to = len(text)
+	} else {
+		if space := strings.LastIndexByte(text[first:to], ' '); space > 0 {
+			to = first + space
+		}
+		for to > first && !utf8.RuneStart(text[to]) {
+			to--
+		}
+	}
+
+	snippet := highlight(strings.TrimSpace(text[from:to]), matched)
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(text) {
+		snippet += "…"
+	}
+
+	return snippet
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+	"todoapp/model"
+)
+
+func (ims *InMemoryStore) Batch(ctx context.Context, owner int, ops []model.Operation) ([]*model.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := model.CheckBatch(ops); err != nil {
+		return nil, err
+	}
+
+	ims.Lock()
+	defer ims.Unlock()
+
+	results, _, err := ims.batch(owner, ops, ims.now())
+
+	return results, err
+}
+
+// batch applies ops one after the other, callers must hold the lock. If an
+// operation fails the ones before it are undone, otherwise the returned
+// function undoes the whole batch for callers that fail to persist it.
+func (ims *InMemoryStore) batch(owner int, ops []model.Operation, now time.Time) ([]*model.Todo, func(), error) {
+	counter := ims.counter
+	replaced := make(map[int]*model.Todo)
+	var created []int
+
+	undo := func() {
+		for id, todo := range replaced {
+			ims.todoMap[id] = todo
+		}
+
+		// A todo both created and changed by the batch goes away entirely.
+		for _, id := range created {
+			delete(ims.todoMap, id)
+			delete(ims.owners, id)
+		}
+
+		atomic.StoreInt64(&ims.counter, counter)
+	}
+
+	results := make([]*model.Todo, len(ops))
+	for idx, op := range ops {
+		if prev, ok := ims.todoMap[op.Id]; ok && op.Op != model.OpCreate {
+			if _, seen := replaced[op.Id]; !seen {
+				replaced[op.Id] = prev
+			}
+		}
+
+		var err error
+		switch op.Op {
+		case model.OpCreate:
+			err = ims.add(owner, op.Todo, now)
+			if err == nil {
+				created = append(created, op.Todo.Id)
+				results[idx] = op.Todo
+			}
+		case model.OpUpdate:
+			results[idx], err = ims.update(owner, op.Id, op.Todo, now)
+		case model.OpDelete:
+			results[idx], err = ims.trash(owner, op.Id, now)
+		}
+
+		if err != nil {
+			undo()
+			return nil, nil, &model.OperationError{Index: idx, Err: err}
+		}
+	}
+
+	return results, undo, nil
+}
@@ -0,0 +1,718 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"todoapp/model"
+)
+
+const (
+	snapshotFile = "todos.snapshot"
+	journalFile  = "todos.journal"
+
+	opPut        = "put"
+	opDelete     = "delete"
+	opPutList    = "put_list"
+	opDeleteList = "delete_list"
+	opRevision   = "revision"
+	opBatch      = "batch"
+
+	// DefaultCompactAfter is the number of journal records after which the
+	// FileStore folds the journal into a fresh snapshot.
+	DefaultCompactAfter = 1000
+)
+
+var (
+	ErrCorruptRecord = errors.New("corrupt journal record")
+)
+
+// FileStore is a Store that serves reads from memory and persists every write
+// to an append-only journal. The journal is periodically compacted into a
+// snapshot that is replaced atomically, so a crash at any point leaves either
+// the old or the new state on disk, never a mix of both.
+type FileStore struct {
+	dir          string
+	mem          *InMemoryStore
+	journal      journal
+	records      int
+	compactAfter int
+
+	// broken is set when a failed write could not be removed from the
+	// journal, writes are refused until a compaction rewrites it.
+	broken error
+
+	sync.Mutex
+}
+
+// journal is the file the records are appended to, an *os.File outside of
+// tests.
+type journal interface {
+	io.WriteSeeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+type snapshot struct {
+	Counter int64         `json:"counter"`
+	Todos   []*model.Todo `json:"todos"`
+	// Owners maps the id of every todo not owned by Anonymous to its owner.
+	Owners map[int]int `json:"owners,omitempty"`
+
+	ListCounter int64         `json:"list_counter,omitempty"`
+	Lists       []*model.List `json:"lists,omitempty"`
+	ListOwners  map[int]int   `json:"list_owners,omitempty"`
+
+	Revisions []*model.Revision `json:"revisions,omitempty"`
+}
+
+type journalRecord struct {
+	Op    string      `json:"op"`
+	Id    int         `json:"id"`
+	Owner int         `json:"owner,omitempty"`
+	Todo  *model.Todo `json:"todo,omitempty"`
+	List  *model.List `json:"list,omitempty"`
+
+	Revision *model.Revision `json:"revision,omitempty"`
+
+	// Todos are the todos written by a batch, journalled as one record so
+	// that replay applies either all or none of them.
+	Todos []*model.Todo `json:"todos,omitempty"`
+
+	// Cascade and At describe a list deletion, so that replaying it changes
+	// the todos on the list exactly like the original deletion did.
+	Cascade model.Cascade `json:"cascade,omitempty"`
+	At      *time.Time    `json:"at,omitempty"`
+}
+
+// NewFileStore opens the store kept in dir, creating it if necessary, and
+// restores its state from the snapshot and the journal found there.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, unavailable("create data dir", err)
+	}
+
+	fs := &FileStore{
+		dir:          dir,
+		mem:          NewInMemoryStore(),
+		compactAfter: DefaultCompactAfter,
+	}
+
+	// A leftover temporary snapshot means we crashed before the rename, the
+	// previous snapshot and the journal are still authoritative.
+	_ = os.Remove(fs.path(snapshotFile + ".tmp"))
+
+	if err := fs.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	if err := fs.openJournal(); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStore) Add(ctx context.Context, owner int, todo *model.Todo) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err := fs.mem.Add(ctx, owner, todo); err != nil {
+		return err
+	}
+
+	err := fs.append(journalRecord{Op: opPut, Id: todo.Id, Owner: owner, Todo: todo})
+	if err != nil {
+		fs.mem.remove(todo.Id)
+		return err
+	}
+
+	return nil
+}
+
+func (fs *FileStore) Update(ctx context.Context, owner int, id int, todo *model.Todo) (*model.Todo, error) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	prev, err := fs.mem.GetById(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := fs.mem.Update(ctx, owner, id, todo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.append(journalRecord{Op: opPut, Id: id, Owner: owner, Todo: updated})
+	if err != nil {
+		fs.mem.put(owner, prev)
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (fs *FileStore) GetById(ctx context.Context, owner int, id int) (*model.Todo, error) {
+	return fs.mem.GetById(ctx, owner, id)
+}
+
+func (fs *FileStore) GetAll(ctx context.Context, owner int) ([]*model.Todo, error) {
+	return fs.mem.GetAll(ctx, owner)
+}
+
+func (fs *FileStore) Query(ctx context.Context, owner int, q model.Query) ([]*model.Todo, int, error) {
+	return fs.mem.Query(ctx, owner, q)
+}
+
+func (fs *FileStore) Delete(ctx context.Context, owner int, todo *model.Todo) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	prev, err := fs.mem.GetById(ctx, owner, todo.Id)
+	if err == ErrTodoNotFound {
+		return nil
+	}
+
+	if err := fs.mem.Delete(ctx, owner, todo); err != nil {
+		return err
+	}
+
+	// The trashed todo is journalled like any other write, opDelete is left
+	// to purging.
+	fs.mem.RLock()
+	deleted := fs.mem.todoMap[todo.Id]
+	fs.mem.RUnlock()
+
+	err = fs.append(journalRecord{Op: opPut, Id: todo.Id, Owner: owner, Todo: deleted})
+	if err != nil {
+		fs.mem.put(owner, prev)
+		return err
+	}
+
+	return nil
+}
+
+func (fs *FileStore) GetTrash(ctx context.Context, owner int) ([]*model.Todo, error) {
+	return fs.mem.GetTrash(ctx, owner)
+}
+
+func (fs *FileStore) Restore(ctx context.Context, owner int, id int) (*model.Todo, error) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	fs.mem.RLock()
+	prev, err := fs.mem.lookupTrashed(owner, id)
+	fs.mem.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := fs.mem.Restore(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.append(journalRecord{Op: opPut, Id: id, Owner: owner, Todo: restored})
+	if err != nil {
+		fs.mem.put(owner, prev)
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// Purge removes and journals the expired todos one at a time, a failed write
+// or the end of ctx leaves the remaining ones in the trash.
+func (fs *FileStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	purged := 0
+	for _, id := range fs.mem.expired(before) {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+
+		fs.mem.RLock()
+		todo, owner, history := fs.mem.todoMap[id], fs.mem.owners[id], fs.mem.revisions[id]
+		fs.mem.RUnlock()
+
+		fs.mem.remove(id)
+
+		if err := fs.append(journalRecord{Op: opDelete, Id: id}); err != nil {
+			fs.mem.put(owner, todo)
+			for _, rev := range history {
+				fs.mem.putRevision(rev)
+			}
+			return purged, err
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (fs *FileStore) AddRevision(ctx context.Context, owner int, rev *model.Revision) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err := fs.mem.AddRevision(ctx, owner, rev); err != nil {
+		return err
+	}
+
+	err := fs.append(journalRecord{Op: opRevision, Id: rev.TodoId, Owner: owner, Revision: rev})
+	if err != nil {
+		fs.mem.dropRevision(rev.TodoId)
+		return err
+	}
+
+	return nil
+}
+
+func (fs *FileStore) GetRevisions(ctx context.Context, owner int, todoId int) ([]*model.Revision, error) {
+	return fs.mem.GetRevisions(ctx, owner, todoId)
+}
+
+func (fs *FileStore) Batch(ctx context.Context, owner int, ops []model.Operation) ([]*model.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := model.CheckBatch(ops); err != nil {
+		return nil, err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	fs.mem.Lock()
+	results, undo, err := fs.mem.batch(owner, ops, fs.mem.now())
+	fs.mem.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.append(journalRecord{Op: opBatch, Owner: owner, Todos: results})
+	if err != nil {
+		fs.mem.Lock()
+		undo()
+		fs.mem.Unlock()
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (fs *FileStore) AddList(ctx context.Context, owner int, list *model.List) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err := fs.mem.AddList(ctx, owner, list); err != nil {
+		return err
+	}
+
+	err := fs.append(journalRecord{Op: opPutList, Id: list.Id, Owner: owner, List: list})
+	if err != nil {
+		fs.mem.removeList(list.Id)
+		return err
+	}
+
+	return nil
+}
+
+func (fs *FileStore) UpdateList(ctx context.Context, owner int, id int, list *model.List) (*model.List, error) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	prev, err := fs.mem.GetList(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := fs.mem.UpdateList(ctx, owner, id, list)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.append(journalRecord{Op: opPutList, Id: id, Owner: owner, List: updated})
+	if err != nil {
+		fs.mem.putList(owner, prev)
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (fs *FileStore) GetList(ctx context.Context, owner int, id int) (*model.List, error) {
+	return fs.mem.GetList(ctx, owner, id)
+}
+
+func (fs *FileStore) GetLists(ctx context.Context, owner int) ([]*model.List, error) {
+	return fs.mem.GetLists(ctx, owner)
+}
+
+func (fs *FileStore) DeleteList(ctx context.Context, owner int, id int, cascade model.Cascade) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	now := fs.mem.now().UTC()
+
+	fs.mem.Lock()
+	list, todos, err := fs.mem.deleteList(owner, id, cascade, now)
+	fs.mem.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = fs.append(journalRecord{Op: opDeleteList, Id: id, Owner: owner, Cascade: cascade, At: &now})
+	if err != nil {
+		fs.mem.putList(owner, list)
+		for _, todo := range todos {
+			fs.mem.put(owner, todo)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Compact writes the current state to a new snapshot and truncates the
+// journal.
+func (fs *FileStore) Compact() error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	return fs.compact()
+}
+
+// Close compacts the journal and releases the underlying files.
+func (fs *FileStore) Close() error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err := fs.compact(); err != nil {
+		return err
+	}
+
+	return fs.journal.Close()
+}
+
+func (fs *FileStore) path(name string) string {
+	return filepath.Join(fs.dir, name)
+}
+
+func (fs *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(fs.path(snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return unavailable("read snapshot", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	for _, todo := range snap.Todos {
+		fs.mem.put(snap.Owners[todo.Id], todo)
+	}
+	fs.mem.counter = snap.Counter
+
+	for _, list := range snap.Lists {
+		fs.mem.putList(snap.ListOwners[list.Id], list)
+	}
+	fs.mem.listCounter = snap.ListCounter
+
+	for _, rev := range snap.Revisions {
+		fs.mem.putRevision(rev)
+	}
+
+	return nil
+}
+
+// openJournal replays the journal on top of the snapshot. Replay stops at the
+// first record that is incomplete or fails its checksum, which is what a
+// write interrupted by a crash leaves behind, and the journal is truncated
+// back to the last intact record.
+func (fs *FileStore) openJournal() error {
+	f, err := os.OpenFile(fs.path(journalFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return unavailable("open journal", err)
+	}
+
+	var offset int64
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+
+		var rec journalRecord
+		if err == nil {
+			err = decodeRecord(line, &rec)
+		}
+		if err != nil {
+			log.Printf("filestore: discarding journal tail at offset %d: %v", offset, err)
+			break
+		}
+
+		fs.replay(rec)
+		offset += int64(len(line))
+		fs.records++
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return unavailable("truncate journal", err)
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return unavailable("seek journal", err)
+	}
+
+	fs.journal = f
+
+	return nil
+}
+
+func (fs *FileStore) replay(rec journalRecord) {
+	switch rec.Op {
+	case opPut:
+		fs.mem.put(rec.Owner, rec.Todo)
+	case opDelete:
+		fs.mem.remove(rec.Id)
+	case opPutList:
+		fs.mem.putList(rec.Owner, rec.List)
+		return
+	case opRevision:
+		fs.mem.putRevision(rec.Revision)
+		return
+	case opBatch:
+		for _, todo := range rec.Todos {
+			fs.mem.put(rec.Owner, todo)
+			if int64(todo.Id) > fs.mem.counter {
+				fs.mem.counter = int64(todo.Id)
+			}
+		}
+		return
+	case opDeleteList:
+		fs.mem.Lock()
+		if _, _, err := fs.mem.deleteList(rec.Owner, rec.Id, rec.Cascade, *rec.At); err != nil {
+			log.Printf("filestore: replaying deletion of list %d: %v", rec.Id, err)
+		}
+		fs.mem.Unlock()
+		return
+	}
+
+	if int64(rec.Id) > fs.mem.counter {
+		fs.mem.counter = int64(rec.Id)
+	}
+}
+
+// append writes rec to the end of the journal. A record that fails to be
+// written or synced is cut off again, so that neither its torn remains hide
+// the records appended after it on replay nor does a write reported as failed
+// come back on restart.
+func (fs *FileStore) append(rec journalRecord) error {
+	if fs.broken != nil {
+		return fs.broken
+	}
+
+	line, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	offset, err := fs.journal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return unavailable("seek journal", err)
+	}
+
+	if _, err := fs.journal.Write(line); err != nil {
+		return fs.rewind(offset, unavailable("write journal", err))
+	}
+
+	if err := fs.journal.Sync(); err != nil {
+		return fs.rewind(offset, unavailable("sync journal", err))
+	}
+
+	fs.records++
+	if fs.records >= fs.compactAfter {
+		if err := fs.compact(); err != nil {
+			log.Printf("filestore: compaction failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// rewind truncates the journal back to offset after a failed append and
+// returns cause. If that fails as well, the store refuses further writes.
+func (fs *FileStore) rewind(offset int64, cause error) error {
+	err := fs.journal.Truncate(offset)
+	if err == nil {
+		_, err = fs.journal.Seek(offset, io.SeekStart)
+	}
+	if err == nil {
+		err = fs.journal.Sync()
+	}
+
+	if err != nil {
+		fs.broken = unavailable("rewind journal", err)
+		log.Printf("filestore: refusing writes: %v", fs.broken)
+	}
+
+	return cause
+}
+
+func (fs *FileStore) compact() error {
+	todos, owners := fs.mem.all()
+	model.SortById(todos)
+
+	for id, owner := range owners {
+		if owner == Anonymous {
+			delete(owners, id)
+		}
+	}
+
+	lists, listOwners := fs.mem.allLists()
+	for id, owner := range listOwners {
+		if owner == Anonymous {
+			delete(listOwners, id)
+		}
+	}
+
+	data, err := json.Marshal(snapshot{
+		Counter:     fs.mem.currentId(),
+		Todos:       todos,
+		Owners:      owners,
+		ListCounter: fs.mem.listCounter,
+		Lists:       lists,
+		ListOwners:  listOwners,
+		Revisions:   fs.mem.allRevisions(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	if err := WriteFileAtomic(fs.path(snapshotFile), data, 0644); err != nil {
+		return err
+	}
+
+	// A crash before the truncate below replays the old journal over the new
+	// snapshot. Its todos and lists are put or deleted again, ending in the
+	// same state, deleting a list again fails since it is gone, and putRevision
+	// skips the revisions the snapshot already has, so nothing is lost or
+	// duplicated.
+	if err := fs.journal.Truncate(0); err != nil {
+		return unavailable("truncate journal", err)
+	}
+
+	if _, err := fs.journal.Seek(0, io.SeekStart); err != nil {
+		return unavailable("seek journal", err)
+	}
+
+	fs.records = 0
+	fs.broken = nil
+
+	return nil
+}
+
+func encodeRecord(rec journalRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("encode journal record: %w", err)
+	}
+
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload)), nil
+}
+
+func decodeRecord(line []byte, rec *journalRecord) error {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	if len(line) < 10 || line[8] != ' ' {
+		return ErrCorruptRecord
+	}
+
+	var sum uint32
+	if _, err := fmt.Sscanf(string(line[:8]), "%08x", &sum); err != nil {
+		return ErrCorruptRecord
+	}
+
+	payload := line[9:]
+	if crc32.ChecksumIEEE(payload) != sum {
+		return ErrCorruptRecord
+	}
+
+	if err := json.Unmarshal(payload, rec); err != nil {
+		return ErrCorruptRecord
+	}
+
+	return nil
+}
+
+// WriteFileAtomic replaces path with data by writing a synced temporary file
+// and renaming it over the original. Failures match ErrUnavailable.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return unavailable("create snapshot", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return unavailable("write snapshot", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return unavailable("sync snapshot", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return unavailable("close snapshot", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return unavailable("replace snapshot", err)
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return unavailable("open data dir", err)
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return unavailable("sync data dir", err)
+	}
+
+	return nil
+}
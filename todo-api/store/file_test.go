@@ -0,0 +1,632 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"todoapp/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		addTodos  []*model.Todo
+		update    *model.Todo
+		deleteId  int
+		wantTodos []*model.Todo
+		wantNext  int
+	}{
+		{
+			name:      "empty store",
+			addTodos:  []*model.Todo{},
+			wantTodos: []*model.Todo{},
+			wantNext:  1,
+		},
+		{
+			name: "added todos",
+			addTodos: []*model.Todo{
+				{Title: "First"},
+				{Title: "Second", Completed: true},
+			},
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Version: 1},
+				{Id: 2, Title: "Second", Completed: true, Version: 1},
+			},
+			wantNext: 3,
+		},
+		{
+			name: "updated todo",
+			addTodos: []*model.Todo{
+				{Title: "First"},
+				{Title: "Second"},
+			},
+			update: &model.Todo{Id: 2, Title: "Updated", Completed: true},
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Version: 1},
+				{Id: 2, Title: "Updated", Completed: true, Version: 2},
+			},
+			wantNext: 3,
+		},
+		{
+			name: "deleted last todo keeps counter",
+			addTodos: []*model.Todo{
+				{Title: "First"},
+				{Title: "Second"},
+			},
+			deleteId: 2,
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "First", Version: 1},
+			},
+			wantNext: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			fs, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileStore() failed: %v", err)
+			}
+
+			for _, todo := range tt.addTodos {
+				assert.NoError(t, fs.Add(ctx, Anonymous, todo))
+			}
+
+			if tt.update != nil {
+				_, err := fs.Update(ctx, Anonymous, tt.update.Id, tt.update)
+				assert.NoError(t, err)
+			}
+
+			if tt.deleteId != 0 {
+				assert.NoError(t, fs.Delete(ctx, Anonymous, &model.Todo{Id: tt.deleteId}))
+			}
+
+			// Reopen without Close to simulate a crash after the last write.
+			reopened, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileStore() reopen failed: %v", err)
+			}
+
+			todos, err := reopened.GetAll(ctx, Anonymous)
+			assert.NoError(t, err)
+
+			model.SortById(todos)
+			assert.Equal(t, tt.wantTodos, withoutTimes(todos...))
+
+			next := &model.Todo{Title: "Next"}
+			assert.NoError(t, reopened.Add(ctx, Anonymous, next))
+			assert.Equal(t, tt.wantNext, next.Id)
+		})
+	}
+}
+
+func TestFileStore_TornJournal(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{"partial record", "1a2b3c4d {\"op\":\"put\",\"id\":3,\"todo\":{\"id\":3,\"ti"},
+		{"bad checksum", "00000000 {\"op\":\"put\",\"id\":3,\"todo\":{\"id\":3,\"title\":\"Lost\"}}\n"},
+		{"garbage", "\x00\x00\x00\x00\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			fs, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileStore() failed: %v", err)
+			}
+
+			assert.NoError(t, fs.Add(ctx, Anonymous, &model.Todo{Title: "First"}))
+			assert.NoError(t, fs.Add(ctx, Anonymous, &model.Todo{Title: "Second"}))
+
+			journal := filepath.Join(dir, journalFile)
+			before, err := os.Stat(journal)
+			assert.NoError(t, err)
+
+			f, err := os.OpenFile(journal, os.O_WRONLY|os.O_APPEND, 0644)
+			assert.NoError(t, err)
+			_, err = f.WriteString(tt.tail)
+			assert.NoError(t, err)
+			assert.NoError(t, f.Close())
+
+			reopened, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileStore() reopen failed: %v", err)
+			}
+
+			todos, err := reopened.GetAll(ctx, Anonymous)
+			assert.NoError(t, err)
+
+			model.SortById(todos)
+			assert.Equal(t, []*model.Todo{{Id: 1, Title: "First", Version: 1}, {Id: 2, Title: "Second", Version: 1}}, withoutTimes(todos...))
+
+			after, err := os.Stat(journal)
+			assert.NoError(t, err)
+			assert.Equal(t, before.Size(), after.Size())
+
+			assert.NoError(t, reopened.Add(ctx, Anonymous, &model.Todo{Title: "Third"}))
+
+			again, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileStore() second reopen failed: %v", err)
+			}
+
+			third, err := again.GetById(ctx, Anonymous, 3)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "Third", third.Title)
+			}
+		})
+	}
+}
+
+// faultyJournal fails the next write after writing half of it, or the next
+// sync or truncate, as set.
+type faultyJournal struct {
+	journal
+	failWrite, failSync, failTruncate bool
+}
+
+var errFault = errors.New("injected fault")
+
+func (fj *faultyJournal) Write(p []byte) (int, error) {
+	if !fj.failWrite {
+		return fj.journal.Write(p)
+	}
+
+	fj.failWrite = false
+	n, _ := fj.journal.Write(p[:len(p)/2])
+
+	return n, errFault
+}
+
+func (fj *faultyJournal) Sync() error {
+	if fj.failSync {
+		fj.failSync = false
+		return errFault
+	}
+
+	return fj.journal.Sync()
+}
+
+func (fj *faultyJournal) Truncate(size int64) error {
+	if fj.failTruncate {
+		return errFault
+	}
+
+	return fj.journal.Truncate(size)
+}
+
+func TestFileStore_FailedAppend(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		journal faultyJournal
+	}{
+		{"torn write", faultyJournal{failWrite: true}},
+		{"failed sync", faultyJournal{failSync: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			fs, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileStore() failed: %v", err)
+			}
+
+			assert.NoError(t, fs.Add(ctx, Anonymous, &model.Todo{Title: "First"}))
+
+			fj := tt.journal
+			fj.journal = fs.journal
+			fs.journal = &fj
+
+			err = fs.Add(ctx, Anonymous, &model.Todo{Title: "Failed"})
+			assert.True(t, errors.Is(err, ErrUnavailable), "got error %v, want %v", err, ErrUnavailable)
+
+			assert.NoError(t, fs.Add(ctx, Anonymous, &model.Todo{Title: "Second"}))
+
+			reopened, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileStore() reopen failed: %v", err)
+			}
+
+			todos, err := reopened.GetAll(ctx, Anonymous)
+			assert.NoError(t, err)
+
+			model.SortById(todos)
+			titles := make([]string, len(todos))
+			for idx, todo := range todos {
+				titles[idx] = todo.Title
+			}
+			assert.Equal(t, []string{"First", "Second"}, titles)
+		})
+	}
+}
+
+func TestFileStore_BrokenJournal(t *testing.T) {
+	ctx := context.Background()
+
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	fj := &faultyJournal{journal: fs.journal, failWrite: true, failTruncate: true}
+	fs.journal = fj
+
+	// A failed write that cannot be cut off again stops all further writes.
+	for _, title := range []string{"Failed", "Refused"} {
+		err = fs.Add(ctx, Anonymous, &model.Todo{Title: title})
+		assert.True(t, errors.Is(err, ErrUnavailable), "got error %v, want %v", err, ErrUnavailable)
+	}
+
+	todos, err := fs.GetAll(ctx, Anonymous)
+	assert.NoError(t, err)
+	assert.Empty(t, todos)
+
+	// Compacting replaces the journal and lets writes through again.
+	fj.failTruncate = false
+	assert.NoError(t, fs.Compact())
+	assert.NoError(t, fs.Add(ctx, Anonymous, &model.Todo{Title: "Accepted"}))
+}
+
+func TestFileStore_Compact(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+	fs.compactAfter = 3
+
+	for _, title := range []string{"First", "Second", "Third", "Fourth"} {
+		assert.NoError(t, fs.Add(ctx, Anonymous, &model.Todo{Title: title}))
+	}
+	assert.NoError(t, fs.Delete(ctx, Anonymous, &model.Todo{Id: 4}))
+
+	assert.Equal(t, 2, fs.records)
+
+	_, err = os.Stat(filepath.Join(dir, snapshotFile))
+	assert.NoError(t, err)
+
+	// A snapshot left half written by a crash must not be picked up.
+	err = os.WriteFile(filepath.Join(dir, snapshotFile+".tmp"), []byte("{\"counter\":"), 0644)
+	assert.NoError(t, err)
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() reopen failed: %v", err)
+	}
+
+	todos, err := reopened.GetAll(ctx, Anonymous)
+	assert.NoError(t, err)
+
+	model.SortById(todos)
+	assert.Equal(t, []*model.Todo{
+		{Id: 1, Title: "First", Version: 1},
+		{Id: 2, Title: "Second", Version: 1},
+		{Id: 3, Title: "Third", Version: 1},
+	}, withoutTimes(todos...))
+
+	assert.NoError(t, reopened.Close())
+
+	_, err = os.Stat(filepath.Join(dir, snapshotFile+".tmp"))
+	assert.True(t, os.IsNotExist(err))
+
+	closed, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() after close failed: %v", err)
+	}
+
+	assert.Equal(t, 0, closed.records)
+
+	next := &model.Todo{Title: "Next"}
+	assert.NoError(t, closed.Add(ctx, Anonymous, next))
+	assert.Equal(t, 5, next.Id)
+}
+
+func TestFileStore_Query(t *testing.T) {
+	testStoreQuery(t, func() Store {
+		fs, err := NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileStore() failed: %v", err)
+		}
+
+		return fs
+	})
+}
+
+func TestFileStore_Versioning(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	testStoreVersioning(t, fs)
+}
+
+func TestFileStore_Timestamps(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	testStoreTimestamps(t, fs, func(now func() time.Time) { fs.mem.now = now })
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() reopen failed: %v", err)
+	}
+
+	before, err := fs.GetById(ctx, Anonymous, 1)
+	assert.NoError(t, err)
+
+	after, err := reopened.GetById(ctx, Anonymous, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, before, after)
+	}
+}
+
+func TestFileStore_Owners(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	testStoreOwners(t, fs)
+
+	// The owners have to survive both replaying the journal and a snapshot.
+	for _, compact := range []bool{false, true} {
+		if compact {
+			assert.NoError(t, fs.Compact())
+		}
+
+		reopened, err := NewFileStore(dir)
+		if err != nil {
+			t.Fatalf("NewFileStore() reopen failed: %v", err)
+		}
+
+		for owner, want := range map[int]string{1: "Alice's todo", 2: "Bob's todo", Anonymous: "Nobody's todo"} {
+			todos, err := reopened.GetAll(ctx, owner)
+			assert.NoError(t, err)
+
+			if assert.Len(t, todos, 1) {
+				assert.Equal(t, want, todos[0].Title)
+			}
+		}
+	}
+}
+
+func TestFileStore_Relations(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	testStoreRelations(t, fs)
+}
+
+func TestFileStore_Context(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	testStoreContext(t, fs)
+}
+
+func TestFileStore_Trash(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	testStoreTrash(t, fs, func(now func() time.Time) { fs.mem.now = now })
+
+	// Both the restored and the purged todos stay that way.
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() reopen failed: %v", err)
+	}
+
+	all, err := reopened.GetAll(ctx, Anonymous)
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	trash, err := reopened.GetTrash(ctx, Anonymous)
+	assert.NoError(t, err)
+	assert.Empty(t, trash)
+}
+
+func TestFileStore_Batch(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	testStoreBatch(t, fs)
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() reopen failed: %v", err)
+	}
+
+	all, err := reopened.GetAll(ctx, Anonymous)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	trash, err := reopened.GetTrash(ctx, Anonymous)
+	if assert.NoError(t, err) && assert.Len(t, trash, 1) {
+		assert.Equal(t, "Mow lawn", trash[0].Title)
+	}
+
+	next := &model.Todo{Title: "Rake leaves"}
+	assert.NoError(t, reopened.Add(ctx, Anonymous, next))
+	assert.Equal(t, 5, next.Id)
+}
+
+func TestFileStore_Revisions(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	testStoreRevisions(t, fs, func(now func() time.Time) { fs.mem.now = now })
+
+	todo := &model.Todo{Title: "Water plants"}
+	assert.NoError(t, fs.Add(ctx, Anonymous, todo))
+	assert.NoError(t, fs.AddRevision(ctx, Anonymous, &model.Revision{TodoId: todo.Id, Action: model.ActionCreated, Todo: todo}))
+
+	// Compacting keeps the history of the todos, both journaled and
+	// snapshotted revisions survive a reopen.
+	assert.NoError(t, fs.Compact())
+	assert.NoError(t, fs.AddRevision(ctx, Anonymous, &model.Revision{TodoId: todo.Id, Action: model.ActionUpdated, Todo: todo}))
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() reopen failed: %v", err)
+	}
+
+	history, err := reopened.GetRevisions(ctx, Anonymous, todo.Id)
+	if assert.NoError(t, err) && assert.Len(t, history, 2) {
+		assert.Equal(t, model.ActionCreated, history[0].Action)
+		assert.Equal(t, model.ActionUpdated, history[1].Action)
+	}
+
+	history, err = reopened.GetRevisions(ctx, Anonymous, 2)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	rev := &model.Revision{TodoId: todo.Id, Action: model.ActionUpdated, Todo: todo}
+	assert.NoError(t, reopened.AddRevision(ctx, Anonymous, rev))
+	assert.Equal(t, 3, rev.Number)
+}
+
+func TestFileStore_CrashedCompact(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	todo := &model.Todo{Title: "Water plants"}
+	assert.NoError(t, fs.Add(ctx, Anonymous, todo))
+	for _, action := range []model.Action{model.ActionCreated, model.ActionUpdated} {
+		assert.NoError(t, fs.AddRevision(ctx, Anonymous, &model.Revision{TodoId: todo.Id, Action: action, Todo: todo}))
+	}
+
+	// The snapshot is written but the journal is left as if the process died
+	// before truncating it.
+	fs.journal = &faultyJournal{journal: fs.journal, failTruncate: true}
+	err = fs.Compact()
+	assert.True(t, errors.Is(err, ErrUnavailable), "got error %v, want %v", err, ErrUnavailable)
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() reopen failed: %v", err)
+	}
+
+	history, err := reopened.GetRevisions(ctx, Anonymous, todo.Id)
+	if assert.NoError(t, err) && assert.Len(t, history, 2) {
+		assert.Equal(t, []int{1, 2}, []int{history[0].Number, history[1].Number})
+	}
+
+	rev := &model.Revision{TodoId: todo.Id, Action: model.ActionUpdated, Todo: todo}
+	assert.NoError(t, reopened.AddRevision(ctx, Anonymous, rev))
+	assert.Equal(t, 3, rev.Number)
+}
+
+func TestFileStore_Lists(t *testing.T) {
+	testStoreLists(t, func() Store {
+		fs, err := NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileStore() failed: %v", err)
+		}
+
+		return fs
+	})
+}
+
+func TestFileStore_ReopenLists(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+
+	first, second := &model.List{Name: "First"}, &model.List{Name: "Second"}
+	assert.NoError(t, fs.AddList(ctx, Anonymous, first))
+	assert.NoError(t, fs.AddList(ctx, 1, second))
+	assert.NoError(t, fs.Add(ctx, Anonymous, &model.Todo{Title: "On list", ListId: first.Id}))
+	assert.NoError(t, fs.DeleteList(ctx, Anonymous, first.Id, model.CascadeDetach))
+
+	want := []*model.Todo{{Id: 1, Title: "On list", Version: 2}}
+
+	// The lists have to survive both replaying the journal and a snapshot.
+	for _, compact := range []bool{false, true} {
+		if compact {
+			assert.NoError(t, fs.Compact())
+		}
+
+		reopened, err := NewFileStore(dir)
+		if err != nil {
+			t.Fatalf("NewFileStore() reopen failed: %v", err)
+		}
+
+		todos, err := reopened.GetAll(ctx, Anonymous)
+		assert.NoError(t, err)
+		assert.Equal(t, want, withoutTimes(todos...))
+
+		lists, err := reopened.GetLists(ctx, 1)
+		assert.NoError(t, err)
+		if assert.Len(t, lists, 1) {
+			assert.Equal(t, "Second", lists[0].Name)
+		}
+
+		_, err = reopened.GetList(ctx, Anonymous, first.Id)
+		assert.Equal(t, ErrListNotFound, err)
+
+		assert.Equal(t, int64(second.Id), reopened.mem.listCounter)
+	}
+}
@@ -0,0 +1,248 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"todoapp/model"
+)
+
+func (ims *InMemoryStore) AddList(ctx context.Context, owner int, list *model.List) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := list.IsValid(); err != nil {
+		return err
+	}
+
+	ims.Lock()
+	defer ims.Unlock()
+
+	ims.listCounter++
+	list.Id = int(ims.listCounter)
+	stampListTimes(list, nil, ims.now())
+
+	ims.lists[list.Id] = list
+	ims.listOwners[list.Id] = owner
+
+	return nil
+}
+
+func (ims *InMemoryStore) UpdateList(ctx context.Context, owner int, id int, list *model.List) (*model.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := list.IsValid(); err != nil {
+		return nil, err
+	}
+
+	ims.Lock()
+	defer ims.Unlock()
+
+	current, err := ims.lookupList(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	list.Id = id
+	stampListTimes(list, current, ims.now())
+	ims.lists[id] = list
+
+	return list, nil
+}
+
+func (ims *InMemoryStore) GetList(ctx context.Context, owner int, id int) (*model.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ims.RLock()
+	defer ims.RUnlock()
+
+	return ims.lookupList(owner, id)
+}
+
+func (ims *InMemoryStore) GetLists(ctx context.Context, owner int) ([]*model.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ims.RLock()
+	defer ims.RUnlock()
+
+	lists := []*model.List{}
+	for id, list := range ims.lists {
+		if ims.listOwners[id] == owner {
+			lists = append(lists, list)
+		}
+	}
+
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Id < lists[j].Id })
+
+	return lists, nil
+}
+
+func (ims *InMemoryStore) DeleteList(ctx context.Context, owner int, id int, cascade model.Cascade) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ims.Lock()
+	defer ims.Unlock()
+
+	_, _, err := ims.deleteList(owner, id, cascade, ims.now())
+
+	return err
+}
+
+// deleteList deletes a list and applies cascade to its todos, callers must
+// hold the lock. It returns the deleted list and the todos on it as they were
+// before, so the caller can restore them.
+func (ims *InMemoryStore) deleteList(owner int, id int, cascade model.Cascade, now time.Time) (*model.List, []*model.Todo, error) {
+	list, err := ims.lookupList(owner, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Todos in the trash keep referring to the list, they are restored without
+	// list once it is gone.
+	var todos []*model.Todo
+	for todoId, todo := range ims.todoMap {
+		if ims.owners[todoId] == owner && todo.ListId == id && todo.DeletedAt == nil {
+			todos = append(todos, todo)
+		}
+	}
+
+	switch cascade {
+	case model.CascadeRestrict:
+		if len(todos) > 0 {
+			return nil, nil, fmt.Errorf("%w: %d todos left", ErrListNotEmpty, len(todos))
+		}
+	case model.CascadeDelete:
+		if err := ims.checkReferrers(owner, id, todos); err != nil {
+			return nil, nil, err
+		}
+
+		for _, todo := range todos {
+			ims.todoMap[todo.Id] = trashed(todo, now)
+		}
+	case model.CascadeDetach:
+		for _, todo := range todos {
+			detached := *todo
+			detached.ListId = 0
+			detached.Version++
+			detached.UpdatedAt = now.UTC()
+			ims.todoMap[todo.Id] = &detached
+		}
+	default:
+		return nil, nil, fmt.Errorf("%w: '%s'", model.ErrInvalidCascade, cascade)
+	}
+
+	delete(ims.lists, id)
+	delete(ims.listOwners, id)
+
+	return list, todos, nil
+}
+
+// checkReferrers refuses like trash to delete the todos on the list with the
+// given id while todos off the list still refer to them, callers must hold
+// the lock.
+func (ims *InMemoryStore) checkReferrers(owner int, id int, todos []*model.Todo) error {
+	referrer, referenced := 0, 0
+	for otherId, other := range ims.todoMap {
+		if ims.owners[otherId] != owner || other.DeletedAt != nil || other.ListId == id {
+			continue
+		}
+
+		for _, todo := range todos {
+			if references(other, todo.Id) && (referrer == 0 || otherId < referrer || otherId == referrer && todo.Id < referenced) {
+				referrer, referenced = otherId, todo.Id
+			}
+		}
+	}
+
+	if referrer != 0 {
+		return fmt.Errorf("%w: todo %d refers to todo %d", ErrTodoReferenced, referrer, referenced)
+	}
+
+	return nil
+}
+
+// lookupList returns the list with the given id if it belongs to owner,
+// callers must hold the lock.
+func (ims *InMemoryStore) lookupList(owner int, id int) (*model.List, error) {
+	list, ok := ims.lists[id]
+	if !ok || ims.listOwners[id] != owner {
+		return nil, ErrListNotFound
+	}
+
+	return list, nil
+}
+
+// checkList verifies that a todo of owner may refer to the list with the
+// given id, callers must hold the lock.
+func (ims *InMemoryStore) checkList(owner int, id int) error {
+	if id == 0 {
+		return nil
+	}
+
+	_, err := ims.lookupList(owner, id)
+
+	return err
+}
+
+// putList stores list under its own id without validation, it is used to
+// restore previously persisted state.
+func (ims *InMemoryStore) putList(owner int, list *model.List) {
+	ims.Lock()
+	defer ims.Unlock()
+
+	ims.lists[list.Id] = list
+	ims.listOwners[list.Id] = owner
+
+	if int64(list.Id) > ims.listCounter {
+		ims.listCounter = int64(list.Id)
+	}
+}
+
+func (ims *InMemoryStore) removeList(id int) {
+	ims.Lock()
+	defer ims.Unlock()
+
+	delete(ims.lists, id)
+	delete(ims.listOwners, id)
+}
+
+// allLists returns the lists of every owner along with their owners, it is
+// used to persist the complete state.
+func (ims *InMemoryStore) allLists() ([]*model.List, map[int]int) {
+	ims.RLock()
+	defer ims.RUnlock()
+
+	lists := make([]*model.List, 0, len(ims.lists))
+	owners := make(map[int]int, len(ims.listOwners))
+	for id, list := range ims.lists {
+		lists = append(lists, list)
+		owners[id] = ims.listOwners[id]
+	}
+
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Id < lists[j].Id })
+
+	return lists, owners
+}
+
+// stampListTimes sets the store managed timestamps of list, prev is the
+// stored list that is being replaced, or nil if list is new.
+func stampListTimes(list, prev *model.List, now time.Time) {
+	now = now.UTC()
+
+	list.CreatedAt = now
+	if prev != nil {
+		list.CreatedAt = prev.CreatedAt
+	}
+
+	list.UpdatedAt = now
+}
@@ -0,0 +1,252 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration is one step in the evolution of the SQL schema. Migrations are
+// applied in order and each one runs in its own transaction. Apply, if set,
+// runs after the statements for changes SQL cannot express.
+type migration struct {
+	version    int
+	name       string
+	statements []string
+	apply      func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create todos",
+		statements: []string{
+			`CREATE TABLE todos (
+				id        INTEGER PRIMARY KEY AUTOINCREMENT,
+				title     TEXT    NOT NULL,
+				completed BOOLEAN NOT NULL DEFAULT 0
+			)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "index todo query columns",
+		statements: []string{
+			`CREATE INDEX todos_completed_idx ON todos (completed)`,
+			`CREATE INDEX todos_title_idx ON todos (title COLLATE NOCASE)`,
+		},
+	},
+	{
+		version: 3,
+		name:    "add todo version",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		version: 4,
+		name:    "add todo details and timestamps",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN description TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE todos ADD COLUMN due TEXT`,
+			`ALTER TABLE todos ADD COLUMN priority INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE todos ADD COLUMN tags TEXT NOT NULL DEFAULT '[]'`,
+			`ALTER TABLE todos ADD COLUMN created_at TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE todos ADD COLUMN updated_at TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE todos ADD COLUMN completed_at TEXT`,
+			`UPDATE todos SET
+				created_at = strftime('%Y-%m-%dT%H:%M:%S.000000000Z', 'now'),
+				updated_at = strftime('%Y-%m-%dT%H:%M:%S.000000000Z', 'now'),
+				completed_at = CASE WHEN completed THEN strftime('%Y-%m-%dT%H:%M:%S.000000000Z', 'now') END`,
+			`CREATE INDEX todos_due_idx ON todos (due)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "add todo owner",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN owner INTEGER NOT NULL DEFAULT 0`,
+			`CREATE INDEX todos_owner_idx ON todos (owner)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "create lists",
+		statements: []string{
+			`CREATE TABLE lists (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				owner      INTEGER NOT NULL DEFAULT 0,
+				name       TEXT    NOT NULL,
+				created_at TEXT    NOT NULL,
+				updated_at TEXT    NOT NULL
+			)`,
+			`CREATE INDEX lists_owner_idx ON lists (owner)`,
+			`ALTER TABLE todos ADD COLUMN list_id INTEGER NOT NULL DEFAULT 0`,
+			`CREATE INDEX todos_list_id_idx ON todos (list_id)`,
+		},
+	},
+	{
+		version: 7,
+		name:    "add todo relations",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN parent_id INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE todos ADD COLUMN auto_complete BOOLEAN NOT NULL DEFAULT 0`,
+			`ALTER TABLE todos ADD COLUMN blocked_by TEXT NOT NULL DEFAULT '[]'`,
+			`CREATE INDEX todos_parent_id_idx ON todos (parent_id)`,
+		},
+	},
+	{
+		version: 8,
+		name:    "add todo recurrence",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN recurrence TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 9,
+		name:    "add todo trash",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN deleted_at TEXT`,
+			`CREATE INDEX todos_deleted_at_idx ON todos (deleted_at)`,
+		},
+	},
+	{
+		version: 10,
+		name:    "create revisions",
+		statements: []string{
+			`CREATE TABLE revisions (
+				todo_id INTEGER NOT NULL,
+				number  INTEGER NOT NULL,
+				owner   INTEGER NOT NULL,
+				action  TEXT    NOT NULL,
+				actor   INTEGER NOT NULL,
+				reverts INTEGER NOT NULL DEFAULT 0,
+				changes TEXT    NOT NULL DEFAULT '[]',
+				todo    TEXT    NOT NULL,
+				at      TEXT    NOT NULL,
+				PRIMARY KEY (todo_id, number)
+			)`,
+		},
+	},
+	{
+		version: 11,
+		name:    "add folded todo text",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN title_folded TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE todos ADD COLUMN description_folded TEXT NOT NULL DEFAULT ''`,
+		},
+		apply: foldTodoText,
+	},
+}
+
+// foldTodoText fills the folded columns of the todos written before they
+// existed. The lower function of SQLite only folds ASCII, so it is done here.
+func foldTodoText(tx *sql.Tx) error {
+	type text struct {
+		id                 int
+		title, description string
+	}
+
+	rows, err := tx.Query(`SELECT id, title, description FROM todos`)
+	if err != nil {
+		return err
+	}
+
+	var texts []text
+	for rows.Next() {
+		var t text
+		if err := rows.Scan(&t.id, &t.title, &t.description); err != nil {
+			rows.Close()
+			return err
+		}
+		texts = append(texts, t)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range texts {
+		_, err := tx.Exec(`UPDATE todos SET title_folded = ?, description_folded = ? WHERE id = ?`,
+			fold(t.title), fold(t.description), t.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Migrate brings the schema of db up to the latest version. It is safe to call
+// on every start, migrations that were applied before are skipped.
+func Migrate(db *sql.DB) error {
+	return migrate(db, migrations)
+}
+
+func migrate(db *sql.DB, steps []migration) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT      NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		if step.version <= current {
+			continue
+		}
+
+		if err := applyMigration(db, step); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", step.version, step.name, err)
+		}
+	}
+
+	return nil
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version sql.NullInt64
+
+	err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+
+	return int(version.Int64), nil
+}
+
+func applyMigration(db *sql.DB, step migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range step.statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if step.apply != nil {
+		if err := step.apply(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, step.version, step.name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
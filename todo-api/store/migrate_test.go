@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"todoapp/model"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", SQLiteDSN(filepath.Join(t.TempDir(), "todos.db")))
+	if err != nil {
+		t.Fatalf("sql.Open() failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name        string
+		runs        [][]migration
+		wantVersion int
+		wantErr     bool
+	}{
+		{
+			name:        "fresh database",
+			runs:        [][]migration{migrations},
+			wantVersion: migrations[len(migrations)-1].version,
+		},
+		{
+			name:        "repeated run is a no-op",
+			runs:        [][]migration{migrations, migrations},
+			wantVersion: migrations[len(migrations)-1].version,
+		},
+		{
+			name: "evolves existing schema",
+			runs: [][]migration{
+				{{1, "create", []string{`CREATE TABLE items (id INTEGER PRIMARY KEY)`}, nil}},
+				{
+					{1, "create", []string{`CREATE TABLE items (id INTEGER PRIMARY KEY)`}, nil},
+					{2, "add name", []string{`ALTER TABLE items ADD COLUMN name TEXT`}, nil},
+				},
+			},
+			wantVersion: 2,
+		},
+		{
+			name: "failed step is rolled back",
+			runs: [][]migration{
+				{
+					{1, "create", []string{`CREATE TABLE items (id INTEGER PRIMARY KEY)`}, nil},
+					{2, "broken", []string{`ALTER TABLE items ADD COLUMN name TEXT`, `NOT SQL`}, nil},
+				},
+			},
+			wantVersion: 1,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+
+			var err error
+			for _, steps := range tt.runs {
+				err = migrate(db, steps)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("migrate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			version, err := schemaVersion(db)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantVersion, version)
+			}
+		})
+	}
+}
+
+func TestMigrate_FoldTodoText(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	if err := migrate(db, migrations[:len(migrations)-1]); err != nil {
+		t.Fatalf("migrate() failed: %v", err)
+	}
+
+	_, err := db.Exec(`INSERT INTO todos (owner, title, description) VALUES (?, ?, ?), (?, ?, ?)`,
+		Anonymous, "Été à Évian", "", Anonymous, "Call mum", "Ask about ÉVIAN")
+	if err != nil {
+		t.Fatalf("Failed adding todos: %v", err)
+	}
+
+	s, err := NewSQLStore(db)
+	if err != nil {
+		t.Fatalf("NewSQLStore() failed: %v", err)
+	}
+
+	page, total, err := s.Query(ctx, Anonymous, model.Query{Search: "évian"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, total)
+		assert.Len(t, page, 2)
+	}
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"todoapp/model"
+)
+
+// ChangeType tells what happened to the todo of a Change.
+type ChangeType string
+
+const (
+	ChangeCreated ChangeType = "created"
+	ChangeUpdated ChangeType = "updated"
+	ChangeDeleted ChangeType = "deleted"
+)
+
+// Change describes a successful write to a todo. Todo is the todo as stored
+// after the write, or as it was before for ChangeDeleted. Previous is the todo
+// replaced by ChangeUpdated, if it could be read.
+type Change struct {
+	Type     ChangeType
+	Owner    int
+	Todo     *model.Todo
+	Previous *model.Todo
+}
+
+// ChangeHook is called after every successful write to a todo. It runs on the
+// goroutine of the write and must not block.
+type ChangeHook func(Change)
+
+// NotifyingStore is a Store calling a ChangeHook for every todo that is
+// created, updated or deleted through it, including todos changed by deleting
+// their list.
+type NotifyingStore struct {
+	Store
+	hook ChangeHook
+}
+
+// WithChangeHook wraps s so that hook learns about every change to a todo.
+func WithChangeHook(s Store, hook ChangeHook) *NotifyingStore {
+	return &NotifyingStore{Store: s, hook: hook}
+}
+
+func (ns *NotifyingStore) Add(ctx context.Context, owner int, todo *model.Todo) error {
+	if err := ns.Store.Add(ctx, owner, todo); err != nil {
+		return err
+	}
+
+	ns.publish(Change{Type: ChangeCreated, Owner: owner, Todo: todo})
+
+	return nil
+}
+
+func (ns *NotifyingStore) Update(ctx context.Context, owner int, id int, todo *model.Todo) (*model.Todo, error) {
+	// A concurrent write may slip in between, Previous is for information
+	// only.
+	prev, _ := ns.Store.GetById(ctx, owner, id)
+
+	updated, err := ns.Store.Update(ctx, owner, id, todo)
+	if err != nil {
+		return nil, err
+	}
+
+	ns.publish(Change{Type: ChangeUpdated, Owner: owner, Todo: updated, Previous: prev})
+
+	return updated, nil
+}
+
+func (ns *NotifyingStore) Delete(ctx context.Context, owner int, todo *model.Todo) error {
+	// Deleting a todo that does not exist succeeds, it must not be announced.
+	prev, err := ns.Store.GetById(ctx, owner, todo.Id)
+	if err != nil && !errors.Is(err, ErrTodoNotFound) {
+		return err
+	}
+
+	if err := ns.Store.Delete(ctx, owner, todo); err != nil {
+		return err
+	}
+
+	if prev != nil {
+		ns.publish(Change{Type: ChangeDeleted, Owner: owner, Todo: prev})
+	}
+
+	return nil
+}
+
+// Restore announces the restored todo as created, to subscribers it comes
+// back like a new todo.
+func (ns *NotifyingStore) Restore(ctx context.Context, owner int, id int) (*model.Todo, error) {
+	restored, err := ns.Store.Restore(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ns.publish(Change{Type: ChangeCreated, Owner: owner, Todo: restored})
+
+	return restored, nil
+}
+
+// Batch announces the changes of a batch once all of them are applied, in
+// the order of its operations.
+func (ns *NotifyingStore) Batch(ctx context.Context, owner int, ops []model.Operation) ([]*model.Todo, error) {
+	// Like in Update the previous todos are for information only.
+	prevs := make([]*model.Todo, len(ops))
+	for idx, op := range ops {
+		if op.Op != model.OpCreate {
+			prevs[idx], _ = ns.Store.GetById(ctx, owner, op.Id)
+		}
+	}
+
+	results, err := ns.Store.Batch(ctx, owner, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, op := range ops {
+		switch op.Op {
+		case model.OpCreate:
+			ns.publish(Change{Type: ChangeCreated, Owner: owner, Todo: results[idx]})
+		case model.OpUpdate:
+			ns.publish(Change{Type: ChangeUpdated, Owner: owner, Todo: results[idx], Previous: prevs[idx]})
+		case model.OpDelete:
+			deleted := prevs[idx]
+			if deleted == nil {
+				deleted = results[idx]
+			}
+			ns.publish(Change{Type: ChangeDeleted, Owner: owner, Todo: deleted})
+		}
+	}
+
+	return results, nil
+}
+
+func (ns *NotifyingStore) DeleteList(ctx context.Context, owner int, id int, cascade model.Cascade) error {
+	var todos []*model.Todo
+	if cascade != model.CascadeRestrict {
+		var err error
+
+		todos, _, err = ns.Store.Query(ctx, owner, model.Query{ListId: &id})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := ns.Store.DeleteList(ctx, owner, id, cascade); err != nil {
+		return err
+	}
+
+	for _, todo := range todos {
+		if cascade == model.CascadeDelete {
+			ns.publish(Change{Type: ChangeDeleted, Owner: owner, Todo: todo})
+			continue
+		}
+
+		detached, err := ns.Store.GetById(ctx, owner, todo.Id)
+		if err != nil {
+			continue
+		}
+
+		ns.publish(Change{Type: ChangeUpdated, Owner: owner, Todo: detached, Previous: todo})
+	}
+
+	return nil
+}
+
+// publish passes change to the hook with a copy of the todo, so that the
+// hook does not share it with the caller of the store.
+func (ns *NotifyingStore) publish(change Change) {
+	copied := *change.Todo
+	change.Todo = &copied
+
+	ns.hook(change)
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"todoapp/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyingStore(t *testing.T) {
+	ctx := context.Background()
+
+	var changes []string
+	ns := WithChangeHook(NewInMemoryStore(), func(change Change) {
+		entry := string(change.Type) + " " + change.Todo.Title
+		if change.Previous != nil {
+			entry += " was " + change.Previous.Title
+		}
+
+		changes = append(changes, entry)
+	})
+
+	todo := &model.Todo{Title: "Say hello"}
+	assert.NoError(t, ns.Add(ctx, Anonymous, todo))
+
+	_, err := ns.Update(ctx, Anonymous, todo.Id, &model.Todo{Title: "Say goodbye"})
+	assert.NoError(t, err)
+
+	// Failed writes are not announced.
+	assert.Error(t, ns.Add(ctx, Anonymous, &model.Todo{}))
+	_, err = ns.Update(ctx, Anonymous, 99, &model.Todo{Title: "Missing"})
+	assert.Error(t, err)
+	assert.NoError(t, ns.Delete(ctx, Anonymous, &model.Todo{Id: 99}))
+
+	assert.NoError(t, ns.Delete(ctx, Anonymous, todo))
+
+	_, err = ns.Restore(ctx, Anonymous, todo.Id)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"created Say hello", "updated Say goodbye was Say hello", "deleted Say goodbye", "created Say goodbye"}, changes)
+}
+
+func TestNotifyingStore_DeleteList(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		cascade model.Cascade
+		want    []string
+	}{
+		{cascade: model.CascadeRestrict, want: nil},
+		{cascade: model.CascadeDelete, want: []string{"deleted On list"}},
+		{cascade: model.CascadeDetach, want: []string{"updated On list"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.cascade), func(t *testing.T) {
+			var changes []string
+			ns := WithChangeHook(NewInMemoryStore(), func(change Change) {
+				if change.Type != ChangeCreated {
+					changes = append(changes, string(change.Type)+" "+change.Todo.Title)
+				}
+			})
+
+			list := &model.List{Name: "Groceries"}
+			assert.NoError(t, ns.AddList(ctx, Anonymous, list))
+			assert.NoError(t, ns.Add(ctx, Anonymous, &model.Todo{Title: "On list", ListId: list.Id}))
+			assert.NoError(t, ns.Add(ctx, Anonymous, &model.Todo{Title: "Unlisted"}))
+
+			ns.DeleteList(ctx, Anonymous, list.Id, tt.cascade)
+
+			assert.Equal(t, tt.want, changes)
+		})
+	}
+}
+
+func TestNotifyingStore_Batch(t *testing.T) {
+	ctx := context.Background()
+
+	var changes []string
+	ns := WithChangeHook(NewInMemoryStore(), func(change Change) {
+		entry := string(change.Type) + " " + change.Todo.Title
+		if change.Previous != nil {
+			entry += " was " + change.Previous.Title
+		}
+
+		changes = append(changes, entry)
+	})
+
+	todo := &model.Todo{Title: "Say hello"}
+	assert.NoError(t, ns.Add(ctx, Anonymous, todo))
+
+	other := &model.Todo{Title: "Wave"}
+	assert.NoError(t, ns.Add(ctx, Anonymous, other))
+	changes = nil
+
+	// A failed batch is not announced at all.
+	_, err := ns.Batch(ctx, Anonymous, []model.Operation{
+		{Op: model.OpCreate, Todo: &model.Todo{Title: "Nod"}},
+		{Op: model.OpDelete, Id: 99},
+	})
+	assert.Error(t, err)
+	assert.Empty(t, changes)
+
+	_, err = ns.Batch(ctx, Anonymous, []model.Operation{
+		{Op: model.OpUpdate, Id: todo.Id, Todo: &model.Todo{Title: "Say goodbye"}},
+		{Op: model.OpCreate, Todo: &model.Todo{Title: "Nod"}},
+		{Op: model.OpDelete, Id: other.Id},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"updated Say goodbye was Say hello", "created Nod", "deleted Wave"}, changes)
+}
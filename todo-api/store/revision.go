@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"todoapp/model"
+)
+
+func (ims *InMemoryStore) AddRevision(ctx context.Context, owner int, rev *model.Revision) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ims.Lock()
+	defer ims.Unlock()
+
+	if _, ok := ims.todoMap[rev.TodoId]; !ok || ims.owners[rev.TodoId] != owner {
+		return ErrTodoNotFound
+	}
+
+	rev.Number = len(ims.revisions[rev.TodoId]) + 1
+	rev.At = ims.now().UTC()
+
+	ims.revisions[rev.TodoId] = append(ims.revisions[rev.TodoId], rev)
+
+	return nil
+}
+
+func (ims *InMemoryStore) GetRevisions(ctx context.Context, owner int, todoId int) ([]*model.Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ims.RLock()
+	defer ims.RUnlock()
+
+	if _, ok := ims.todoMap[todoId]; !ok || ims.owners[todoId] != owner {
+		return nil, ErrTodoNotFound
+	}
+
+	return append([]*model.Revision{}, ims.revisions[todoId]...), nil
+}
+
+// putRevision appends rev to the history of its todo without checks, it is
+// used to restore previously persisted state. A revision whose number the
+// history already has is skipped, so restoring it again changes nothing.
+func (ims *InMemoryStore) putRevision(rev *model.Revision) {
+	ims.Lock()
+	defer ims.Unlock()
+
+	for _, stored := range ims.revisions[rev.TodoId] {
+		if stored.Number == rev.Number {
+			return
+		}
+	}
+
+	ims.revisions[rev.TodoId] = append(ims.revisions[rev.TodoId], rev)
+}
+
+// dropRevision removes the latest revision of a todo, it is used to roll back
+// a revision that could not be persisted.
+func (ims *InMemoryStore) dropRevision(todoId int) {
+	ims.Lock()
+	defer ims.Unlock()
+
+	if history := ims.revisions[todoId]; len(history) > 0 {
+		ims.revisions[todoId] = history[:len(history)-1]
+	}
+}
+
+// allRevisions returns the revisions of every todo ordered by todo and number,
+// it is used to persist the complete state.
+func (ims *InMemoryStore) allRevisions() []*model.Revision {
+	ims.RLock()
+	defer ims.RUnlock()
+
+	var revisions []*model.Revision
+	for _, history := range ims.revisions {
+		revisions = append(revisions, history...)
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		if revisions[i].TodoId != revisions[j].TodoId {
+			return revisions[i].TodoId < revisions[j].TodoId
+		}
+
+		return revisions[i].Number < revisions[j].Number
+	})
+
+	return revisions
+}
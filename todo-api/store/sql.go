@@ -0,0 +1,886 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"todoapp/model"
+)
+
+const (
+	todoColumns = `id, title, completed, list_id, parent_id, auto_complete, blocked_by,
+		description, due, priority, tags, recurrence, version, created_at, updated_at, completed_at, deleted_at`
+
+	listColumns = `id, name, created_at, updated_at`
+
+	// listExists is true if the list_id argument is zero or refers to a list
+	// of the owner argument.
+	listExists = `(? = 0 OR EXISTS (SELECT 1 FROM lists WHERE id = ? AND owner = ?))`
+
+	// sqlTimeFormat is fixed width so that timestamps sort correctly as text.
+	sqlTimeFormat = "2006-01-02T15:04:05.000000000Z"
+)
+
+// sortColumns maps the sortable model fields onto their columns.
+var sortColumns = map[string]string{
+	model.SortFieldId:        "id",
+	model.SortFieldTitle:     "title",
+	model.SortFieldCompleted: "completed",
+	model.SortFieldDue:       "due",
+	model.SortFieldPriority:  "priority",
+	model.SortFieldCreatedAt: "created_at",
+	model.SortFieldUpdatedAt: "updated_at",
+	model.SortFieldListId:    "list_id",
+}
+
+// SQLStore is a Store backed by a database/sql handle. The queries are written
+// for SQLite, registering the driver is left to the caller, who opens the
+// database with SQLiteDSN.
+type SQLStore struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// SQLiteDSN adds the settings the SQLStore needs under concurrent writes to
+// the SQLite data source name dsn: writers wait up to five seconds for the
+// lock instead of failing with SQLITE_BUSY, readers do not block writers in
+// WAL mode, and transactions take the write lock when they begin, since a
+// transaction upgrading from a read lock cannot wait for it.
+func SQLiteDSN(dsn string) string {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+
+	return dsn + separator + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+}
+
+// NewSQLStore migrates db to the latest schema and returns a store using it.
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+
+	return &SQLStore{db: db, now: time.Now}, nil
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx, so that the writes of
+// a todo can run on their own or as part of a batch.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (ss *SQLStore) Add(ctx context.Context, owner int, todo *model.Todo) error {
+	if err := todo.IsValid(); err != nil {
+		return err
+	}
+
+	return ss.add(ctx, ss.db, owner, todo)
+}
+
+// add inserts the already validated todo through q.
+func (ss *SQLStore) add(ctx context.Context, q querier, owner int, todo *model.Todo) error {
+	tags, err := encodeTags(todo.Tags)
+	if err != nil {
+		return err
+	}
+
+	blockedBy, err := encodeIds(todo.BlockedBy)
+	if err != nil {
+		return err
+	}
+
+	if err := model.CheckRelations(0, todo, ss.lookupFunc(ctx, q, owner)); err != nil {
+		return err
+	}
+
+	stampTimes(todo, nil, ss.now())
+
+	res, err := q.ExecContext(ctx, `INSERT INTO todos
+		(owner, title, completed, list_id, parent_id, auto_complete, blocked_by,
+		 description, due, priority, tags, recurrence, version, created_at, updated_at, completed_at,
+		 title_folded, description_folded)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?
+		WHERE `+listExists,
+		owner, todo.Title, todo.Completed, todo.ListId, todo.ParentId, todo.AutoComplete, blockedBy,
+		todo.Description, sqlTime(todo.Due), todo.Priority, tags, todo.Recurrence,
+		sqlTime(&todo.CreatedAt), sqlTime(&todo.UpdatedAt), sqlTime(todo.CompletedAt),
+		fold(todo.Title), fold(todo.Description),
+		todo.ListId, todo.ListId, owner)
+	if err != nil {
+		return unavailable("insert todo", err)
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return unavailable("insert todo", err)
+	}
+
+	if inserted == 0 {
+		return ErrListNotFound
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return unavailable("insert todo", err)
+	}
+
+	todo.Id = int(id)
+	todo.Version = 1
+
+	return nil
+}
+
+func (ss *SQLStore) GetById(ctx context.Context, owner int, id int) (*model.Todo, error) {
+	return ss.getById(ctx, ss.db, owner, id)
+}
+
+func (ss *SQLStore) getById(ctx context.Context, q querier, owner int, id int) (*model.Todo, error) {
+	row := q.QueryRowContext(ctx, `SELECT `+todoColumns+` FROM todos WHERE id = ? AND owner = ? AND deleted_at IS NULL`, id, owner)
+
+	todo, err := scanTodo(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrTodoNotFound
+	}
+	if err != nil {
+		return nil, unavailable("select todo", err)
+	}
+
+	return todo, nil
+}
+
+func (ss *SQLStore) Update(ctx context.Context, owner int, id int, todo *model.Todo) (*model.Todo, error) {
+	if err := todo.IsValid(); err != nil {
+		return nil, err
+	}
+
+	return ss.update(ctx, ss.db, owner, id, todo)
+}
+
+// update replaces the todo with the given id by the already validated todo
+// through q.
+func (ss *SQLStore) update(ctx context.Context, q querier, owner int, id int, todo *model.Todo) (*model.Todo, error) {
+	tags, err := encodeTags(todo.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	blockedBy, err := encodeIds(todo.BlockedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := model.CheckRelations(id, todo, ss.lookupFunc(ctx, q, owner)); err != nil {
+		return nil, err
+	}
+
+	now := ss.now().UTC()
+	normaliseDue(todo)
+
+	var (
+		version                int
+		createdAt, completedAt sql.NullString
+	)
+
+	// The completion time is kept while the todo stays completed, SET
+	// expressions see the values of the row before the update.
+	err = q.QueryRowContext(ctx, `UPDATE todos SET
+			title = ?, completed = ?, list_id = ?, parent_id = ?, auto_complete = ?, blocked_by = ?,
+			description = ?, due = ?, priority = ?, tags = ?, recurrence = ?,
+			title_folded = ?, description_folded = ?,
+			version = version + 1, updated_at = ?,
+			completed_at = CASE WHEN ? THEN COALESCE(CASE WHEN completed THEN completed_at END, ?) END
+		WHERE id = ? AND owner = ? AND deleted_at IS NULL AND (? = 0 OR version = ?) AND `+listExists+`
+		RETURNING version, created_at, completed_at`,
+		todo.Title, todo.Completed, todo.ListId, todo.ParentId, todo.AutoComplete, blockedBy,
+		todo.Description, sqlTime(todo.Due), todo.Priority, tags, todo.Recurrence,
+		fold(todo.Title), fold(todo.Description), sqlTime(&now), todo.Completed, sqlTime(&now), id, owner, todo.Version, todo.Version,
+		todo.ListId, todo.ListId, owner).Scan(&version, &createdAt, &completedAt)
+	if err == sql.ErrNoRows {
+		current, err := ss.getById(ctx, q, owner, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if todo.Version != 0 && todo.Version != current.Version {
+			return nil, ErrVersionConflict
+		}
+
+		return nil, ErrListNotFound
+	}
+	if err != nil {
+		return nil, unavailable("update todo", err)
+	}
+
+	todo.Id = id
+	todo.Version = version
+	todo.UpdatedAt = now
+	todo.CreatedAt = *parseSQLTime(createdAt)
+	todo.CompletedAt = parseSQLTime(completedAt)
+	todo.DeletedAt = nil
+
+	return todo, nil
+}
+
+func (ss *SQLStore) GetAll(ctx context.Context, owner int) ([]*model.Todo, error) {
+	rows, err := ss.db.QueryContext(ctx, `SELECT `+todoColumns+` FROM todos WHERE owner = ? AND deleted_at IS NULL`, owner)
+	if err != nil {
+		return nil, unavailable("select todos", err)
+	}
+	defer rows.Close()
+
+	list := []*model.Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan todo: %w", err)
+		}
+
+		list = append(list, todo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, unavailable("select todos", err)
+	}
+
+	return list, nil
+}
+
+func (ss *SQLStore) Query(ctx context.Context, owner int, q model.Query) ([]*model.Todo, int, error) {
+	where := []string{"owner = ?", "deleted_at IS NULL"}
+	args := []interface{}{owner}
+
+	if q.Completed != nil {
+		where = append(where, "completed = ?")
+		args = append(args, *q.Completed)
+	}
+
+	if q.ListId != nil {
+		where = append(where, "list_id = ?")
+		args = append(args, *q.ListId)
+	}
+
+	if q.ParentId != nil {
+		where = append(where, "parent_id = ?")
+		args = append(args, *q.ParentId)
+	}
+
+	if q.Search != "" {
+		search := fold(q.Search)
+		where = append(where, `(instr(title_folded, ?) > 0 OR instr(description_folded, ?) > 0)`)
+		args = append(args, search, search)
+	}
+
+	filter := " WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	err := ss.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM todos`+filter, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, unavailable("count todos", err)
+	}
+
+	var order []string
+	for _, key := range q.Sort {
+		column, ok := sortColumns[key.Field]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: unknown field '%s'", model.ErrInvalidSort, key.Field)
+		}
+
+		if key.Desc {
+			column += " DESC"
+		}
+
+		order = append(order, column)
+	}
+	order = append(order, "id")
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	query := `SELECT ` + todoColumns + ` FROM todos` + filter +
+		` ORDER BY ` + strings.Join(order, ", ") + ` LIMIT ? OFFSET ?`
+
+	rows, err := ss.db.QueryContext(ctx, query, append(args, limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, unavailable("select todos", err)
+	}
+	defer rows.Close()
+
+	list := []*model.Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan todo: %w", err)
+		}
+
+		list = append(list, todo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, unavailable("select todos", err)
+	}
+
+	return list, total, nil
+}
+
+func (ss *SQLStore) Delete(ctx context.Context, owner int, todo *model.Todo) error {
+	_, err := ss.trash(ctx, ss.db, owner, todo.Id)
+	if err == ErrTodoNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// trash moves the todo with the given id to the trash through q and returns
+// it as trashed.
+func (ss *SQLStore) trash(ctx context.Context, q querier, owner int, id int) (*model.Todo, error) {
+	var referrer int
+
+	// Todos in the trash do not hold on to the todos they refer to.
+	err := q.QueryRowContext(ctx, `SELECT id FROM todos
+		WHERE owner = ? AND deleted_at IS NULL
+			AND (parent_id = ? OR EXISTS (SELECT 1 FROM json_each(blocked_by) WHERE value = ?))
+		ORDER BY id LIMIT 1`, owner, id, id).Scan(&referrer)
+	switch {
+	case err == nil:
+		return nil, fmt.Errorf("%w: todo %d refers to it", ErrTodoReferenced, referrer)
+	case err != sql.ErrNoRows:
+		return nil, unavailable("select referring todos", err)
+	}
+
+	now := ss.now()
+	row := q.QueryRowContext(ctx, `UPDATE todos SET deleted_at = ? WHERE id = ? AND owner = ? AND deleted_at IS NULL
+		RETURNING `+todoColumns, sqlTime(&now), id, owner)
+
+	deleted, err := scanTodo(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrTodoNotFound
+	}
+	if err != nil {
+		return nil, unavailable("trash todo", err)
+	}
+
+	return deleted, nil
+}
+
+func (ss *SQLStore) GetTrash(ctx context.Context, owner int) ([]*model.Todo, error) {
+	rows, err := ss.db.QueryContext(ctx, `SELECT `+todoColumns+` FROM todos
+		WHERE owner = ? AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id`, owner)
+	if err != nil {
+		return nil, unavailable("select trash", err)
+	}
+	defer rows.Close()
+
+	trash := []*model.Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan todo: %w", err)
+		}
+
+		trash = append(trash, todo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, unavailable("select trash", err)
+	}
+
+	return trash, nil
+}
+
+func (ss *SQLStore) Restore(ctx context.Context, owner int, id int) (*model.Todo, error) {
+	row := ss.db.QueryRowContext(ctx, `SELECT `+todoColumns+` FROM todos WHERE id = ? AND owner = ? AND deleted_at IS NOT NULL`, id, owner)
+
+	todo, err := scanTodo(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrTodoNotFound
+	}
+	if err != nil {
+		return nil, unavailable("select todo", err)
+	}
+
+	todo.DeletedAt = nil
+
+	if todo.ListId != 0 {
+		if _, err := ss.GetList(ctx, owner, todo.ListId); errors.Is(err, ErrListNotFound) {
+			todo.ListId = 0
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := model.CheckRelations(id, todo, ss.lookupFunc(ctx, ss.db, owner)); err != nil {
+		return nil, err
+	}
+
+	now := ss.now().UTC()
+
+	err = ss.db.QueryRowContext(ctx, `UPDATE todos SET deleted_at = NULL, list_id = ?, version = version + 1, updated_at = ?
+		WHERE id = ? AND owner = ? AND deleted_at IS NOT NULL
+		RETURNING version`,
+		todo.ListId, sqlTime(&now), id, owner).Scan(&todo.Version)
+	if err == sql.ErrNoRows {
+		// Restored or purged in the meantime.
+		return nil, ErrTodoNotFound
+	}
+	if err != nil {
+		return nil, unavailable("restore todo", err)
+	}
+
+	todo.UpdatedAt = now
+
+	return todo, nil
+}
+
+// Purge deletes the expired todos and their revisions in one transaction.
+func (ss *SQLStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, unavailable("begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM revisions WHERE todo_id IN
+		(SELECT id FROM todos WHERE deleted_at IS NOT NULL AND deleted_at < ?)`, sqlTime(&before))
+	if err != nil {
+		return 0, unavailable("purge revisions", err)
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM todos WHERE deleted_at IS NOT NULL AND deleted_at < ?`, sqlTime(&before))
+	if err != nil {
+		return 0, unavailable("purge trash", err)
+	}
+
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, unavailable("purge trash", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, unavailable("commit transaction", err)
+	}
+
+	return int(purged), nil
+}
+
+func (ss *SQLStore) AddRevision(ctx context.Context, owner int, rev *model.Revision) error {
+	changes, err := json.Marshal(rev.Changes)
+	if err != nil {
+		return fmt.Errorf("encode changes: %w", err)
+	}
+
+	todo, err := json.Marshal(rev.Todo)
+	if err != nil {
+		return fmt.Errorf("encode todo: %w", err)
+	}
+
+	now := ss.now().UTC()
+
+	// The primary key makes a concurrent revision with the same number fail
+	// rather than silently share it.
+	err = ss.db.QueryRowContext(ctx, `INSERT INTO revisions (todo_id, number, owner, action, actor, reverts, changes, todo, at)
+		SELECT ?, COALESCE((SELECT MAX(number) FROM revisions WHERE todo_id = ?), 0) + 1, ?, ?, ?, ?, ?, ?, ?
+		WHERE EXISTS (SELECT 1 FROM todos WHERE id = ? AND owner = ?)
+		RETURNING number`,
+		rev.TodoId, rev.TodoId, owner, rev.Action, rev.Actor, rev.Reverts, changes, todo, sqlTime(&now),
+		rev.TodoId, owner).Scan(&rev.Number)
+	if err == sql.ErrNoRows {
+		return ErrTodoNotFound
+	}
+	if err != nil {
+		return unavailable("insert revision", err)
+	}
+
+	rev.At = now
+
+	return nil
+}
+
+func (ss *SQLStore) GetRevisions(ctx context.Context, owner int, todoId int) ([]*model.Revision, error) {
+	var exists bool
+
+	err := ss.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM todos WHERE id = ? AND owner = ?)`, todoId, owner).Scan(&exists)
+	if err != nil {
+		return nil, unavailable("select todo", err)
+	}
+
+	if !exists {
+		return nil, ErrTodoNotFound
+	}
+
+	rows, err := ss.db.QueryContext(ctx, `SELECT todo_id, number, action, actor, reverts, changes, todo, at
+		FROM revisions WHERE todo_id = ? AND owner = ? ORDER BY number`, todoId, owner)
+	if err != nil {
+		return nil, unavailable("select revisions", err)
+	}
+	defer rows.Close()
+
+	revisions := []*model.Revision{}
+	for rows.Next() {
+		var (
+			rev           model.Revision
+			changes, todo string
+			at            sql.NullString
+		)
+
+		err := rows.Scan(&rev.TodoId, &rev.Number, &rev.Action, &rev.Actor, &rev.Reverts, &changes, &todo, &at)
+		if err != nil {
+			return nil, fmt.Errorf("scan revision: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(changes), &rev.Changes); err != nil {
+			return nil, fmt.Errorf("decode changes: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(todo), &rev.Todo); err != nil {
+			return nil, fmt.Errorf("decode todo: %w", err)
+		}
+
+		rev.At = *parseSQLTime(at)
+
+		revisions = append(revisions, &rev)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, unavailable("select revisions", err)
+	}
+
+	return revisions, nil
+}
+
+// lookupFunc adapts getById for model.CheckRelations. The relations are
+// checked before the write, a concurrent write may still slip in between.
+func (ss *SQLStore) lookupFunc(ctx context.Context, q querier, owner int) model.TodoLookup {
+	return func(id int) (*model.Todo, error) {
+		todo, err := ss.getById(ctx, q, owner, id)
+		if errors.Is(err, ErrTodoNotFound) {
+			return nil, nil
+		}
+
+		return todo, err
+	}
+}
+
+// Batch runs the operations in one transaction, the relations of each todo
+// are checked against the todos written by the operations before it.
+func (ss *SQLStore) Batch(ctx context.Context, owner int, ops []model.Operation) ([]*model.Todo, error) {
+	if err := model.CheckBatch(ops); err != nil {
+		return nil, err
+	}
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, unavailable("begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]*model.Todo, len(ops))
+	for idx, op := range ops {
+		var err error
+		switch op.Op {
+		case model.OpCreate:
+			err = ss.add(ctx, tx, owner, op.Todo)
+			results[idx] = op.Todo
+		case model.OpUpdate:
+			results[idx], err = ss.update(ctx, tx, owner, op.Id, op.Todo)
+		case model.OpDelete:
+			results[idx], err = ss.trash(ctx, tx, owner, op.Id)
+		}
+
+		if err != nil {
+			return nil, &model.OperationError{Index: idx, Err: err}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, unavailable("commit transaction", err)
+	}
+
+	return results, nil
+}
+
+func (ss *SQLStore) AddList(ctx context.Context, owner int, list *model.List) error {
+	if err := list.IsValid(); err != nil {
+		return err
+	}
+
+	stampListTimes(list, nil, ss.now())
+
+	res, err := ss.db.ExecContext(ctx, `INSERT INTO lists (owner, name, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+		owner, list.Name, sqlTime(&list.CreatedAt), sqlTime(&list.UpdatedAt))
+	if err != nil {
+		return unavailable("insert list", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return unavailable("insert list", err)
+	}
+
+	list.Id = int(id)
+
+	return nil
+}
+
+func (ss *SQLStore) UpdateList(ctx context.Context, owner int, id int, list *model.List) (*model.List, error) {
+	if err := list.IsValid(); err != nil {
+		return nil, err
+	}
+
+	now := ss.now().UTC()
+
+	var createdAt sql.NullString
+
+	err := ss.db.QueryRowContext(ctx, `UPDATE lists SET name = ?, updated_at = ?
+		WHERE id = ? AND owner = ?
+		RETURNING created_at`,
+		list.Name, sqlTime(&now), id, owner).Scan(&createdAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrListNotFound
+	}
+	if err != nil {
+		return nil, unavailable("update list", err)
+	}
+
+	list.Id = id
+	list.CreatedAt = *parseSQLTime(createdAt)
+	list.UpdatedAt = now
+
+	return list, nil
+}
+
+func (ss *SQLStore) GetList(ctx context.Context, owner int, id int) (*model.List, error) {
+	row := ss.db.QueryRowContext(ctx, `SELECT `+listColumns+` FROM lists WHERE id = ? AND owner = ?`, id, owner)
+
+	list, err := scanList(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrListNotFound
+	}
+	if err != nil {
+		return nil, unavailable("select list", err)
+	}
+
+	return list, nil
+}
+
+func (ss *SQLStore) GetLists(ctx context.Context, owner int) ([]*model.List, error) {
+	rows, err := ss.db.QueryContext(ctx, `SELECT `+listColumns+` FROM lists WHERE owner = ? ORDER BY id`, owner)
+	if err != nil {
+		return nil, unavailable("select lists", err)
+	}
+	defer rows.Close()
+
+	lists := []*model.List{}
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan list: %w", err)
+		}
+
+		lists = append(lists, list)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, unavailable("select lists", err)
+	}
+
+	return lists, nil
+}
+
+// DeleteList applies cascade and deletes the list in one transaction, so the
+// todos are never left referring to a list that is gone.
+func (ss *SQLStore) DeleteList(ctx context.Context, owner int, id int, cascade model.Cascade) error {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return unavailable("begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	// Todos in the trash keep referring to the list, they are restored without
+	// list once it is gone.
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM todos WHERE owner = ? AND list_id = ? AND deleted_at IS NULL`, owner, id).Scan(&count)
+	if err != nil {
+		return unavailable("count todos", err)
+	}
+
+	switch cascade {
+	case model.CascadeRestrict:
+		if count > 0 {
+			return fmt.Errorf("%w: %d todos left", ErrListNotEmpty, count)
+		}
+	case model.CascadeDelete:
+		var referrer, referenced int
+
+		// Like trash, refuse while todos off the list still refer to the todos
+		// on it.
+		err = tx.QueryRowContext(ctx, `SELECT other.id, todo.id FROM todos AS other
+			JOIN todos AS todo ON todo.owner = other.owner AND todo.list_id = ? AND todo.deleted_at IS NULL
+			WHERE other.owner = ? AND other.list_id != ? AND other.deleted_at IS NULL
+				AND (other.parent_id = todo.id OR EXISTS (SELECT 1 FROM json_each(other.blocked_by) WHERE value = todo.id))
+			ORDER BY other.id, todo.id LIMIT 1`, id, owner, id).Scan(&referrer, &referenced)
+		switch {
+		case err == nil:
+			return fmt.Errorf("%w: todo %d refers to todo %d", ErrTodoReferenced, referrer, referenced)
+		case err != sql.ErrNoRows:
+			return unavailable("select referring todos", err)
+		}
+
+		now := ss.now()
+		_, err = tx.ExecContext(ctx, `UPDATE todos SET deleted_at = ?
+			WHERE owner = ? AND list_id = ? AND deleted_at IS NULL`, sqlTime(&now), owner, id)
+	case model.CascadeDetach:
+		now := ss.now()
+		_, err = tx.ExecContext(ctx, `UPDATE todos SET list_id = 0, version = version + 1, updated_at = ?
+			WHERE owner = ? AND list_id = ? AND deleted_at IS NULL`, sqlTime(&now), owner, id)
+	default:
+		return fmt.Errorf("%w: '%s'", model.ErrInvalidCascade, cascade)
+	}
+	if err != nil {
+		return unavailable("cascade list deletion", err)
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM lists WHERE id = ? AND owner = ?`, id, owner)
+	if err != nil {
+		return unavailable("delete list", err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return unavailable("delete list", err)
+	}
+
+	if deleted == 0 {
+		return ErrListNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return unavailable("commit transaction", err)
+	}
+
+	return nil
+}
+
+// fold lowers the case of s for searches the way model.Query.Matches does,
+// which the LIKE operator of SQLite does only for ASCII letters.
+func fold(s string) string {
+	return strings.ToLower(s)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTodo(row scanner) (*model.Todo, error) {
+	var (
+		todo                                              model.Todo
+		tags, blockedBy                                   string
+		due, createdAt, updatedAt, completedAt, deletedAt sql.NullString
+	)
+
+	err := row.Scan(&todo.Id, &todo.Title, &todo.Completed, &todo.ListId, &todo.ParentId, &todo.AutoComplete,
+		&blockedBy, &todo.Description, &due, &todo.Priority, &tags, &todo.Recurrence, &todo.Version,
+		&createdAt, &updatedAt, &completedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(blockedBy), &todo.BlockedBy); err != nil {
+		return nil, fmt.Errorf("decode blocked_by: %w", err)
+	}
+	if len(todo.BlockedBy) == 0 {
+		todo.BlockedBy = nil
+	}
+
+	if err := json.Unmarshal([]byte(tags), &todo.Tags); err != nil {
+		return nil, fmt.Errorf("decode tags: %w", err)
+	}
+	if len(todo.Tags) == 0 {
+		todo.Tags = nil
+	}
+
+	todo.Due = parseSQLTime(due)
+	todo.CreatedAt = *parseSQLTime(createdAt)
+	todo.UpdatedAt = *parseSQLTime(updatedAt)
+	todo.CompletedAt = parseSQLTime(completedAt)
+	todo.DeletedAt = parseSQLTime(deletedAt)
+
+	return &todo, nil
+}
+
+func scanList(row scanner) (*model.List, error) {
+	var (
+		list                 model.List
+		createdAt, updatedAt sql.NullString
+	)
+
+	err := row.Scan(&list.Id, &list.Name, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	list.CreatedAt = *parseSQLTime(createdAt)
+	list.UpdatedAt = *parseSQLTime(updatedAt)
+
+	return &list, nil
+}
+
+func encodeTags(tags []string) (string, error) {
+	if len(tags) == 0 {
+		return "[]", nil
+	}
+
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("encode tags: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func encodeIds(ids []int) (string, error) {
+	if len(ids) == 0 {
+		return "[]", nil
+	}
+
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return "", fmt.Errorf("encode blocked_by: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// sqlTime formats t for storage, nil is stored as NULL.
+func sqlTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: t.UTC().Format(sqlTimeFormat), Valid: true}
+}
+
+// parseSQLTime is the inverse of sqlTime. Values that cannot be parsed are
+// treated as the zero time rather than failing the whole read.
+func parseSQLTime(value sql.NullString) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+
+	t, err := time.Parse(sqlTimeFormat, value.String)
+	if err != nil {
+		return &time.Time{}
+	}
+
+	return &t
+}
@@ -0,0 +1,303 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"todoapp/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSQLStore(t *testing.T) *SQLStore {
+	t.Helper()
+
+	ss, err := NewSQLStore(openTestDB(t))
+	if err != nil {
+		t.Fatalf("NewSQLStore() failed: %v", err)
+	}
+
+	return ss
+}
+
+func TestSQLStore_Add(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		todo    *model.Todo
+		wantErr bool
+	}{
+		{
+			"make it successful",
+			&model.Todo{Title: "Say hello", Completed: true},
+			false,
+		},
+		{
+			"missing title",
+			&model.Todo{Title: ""},
+			true,
+		},
+		{
+			"nil todo",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := newTestSQLStore(t)
+
+			if err := ss.Add(ctx, Anonymous, tt.todo); (err != nil) != tt.wantErr {
+				t.Errorf("SQLStore.Add() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			readTodo, err := ss.GetById(ctx, Anonymous, tt.todo.Id)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.todo, readTodo)
+			}
+		})
+	}
+}
+
+func TestSQLStore_GetById(t *testing.T) {
+	ctx := context.Background()
+
+	ss := newTestSQLStore(t)
+
+	assert.NoError(t, ss.Add(ctx, Anonymous, &model.Todo{Title: "Say hello"}))
+
+	todo, err := ss.GetById(ctx, Anonymous, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*model.Todo{{Id: 1, Title: "Say hello", Version: 1}}, withoutTimes(todo))
+	}
+
+	_, err = ss.GetById(ctx, Anonymous, 2)
+	assert.Equal(t, ErrTodoNotFound, err)
+}
+
+func TestSQLStore_Update(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		addTodos []*model.Todo
+		updateId int
+		todo     *model.Todo
+		wantErr  error
+	}{
+		{
+			name:     "update non-existing",
+			addTodos: []*model.Todo{},
+			updateId: 1,
+			todo:     &model.Todo{Title: "Say hello"},
+			wantErr:  ErrTodoNotFound,
+		},
+		{
+			name: "update second of three",
+			addTodos: []*model.Todo{
+				{Title: "First"},
+				{Title: "Second"},
+				{Title: "Third"},
+			},
+			updateId: 2,
+			todo:     &model.Todo{Id: 1, Title: "Updated", Completed: true},
+		},
+		{
+			name:     "invalid todo",
+			addTodos: []*model.Todo{{Title: "First"}},
+			updateId: 1,
+			todo:     &model.Todo{Title: ""},
+			wantErr:  model.ErrEmptyTitle,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := newTestSQLStore(t)
+
+			for _, todo := range tt.addTodos {
+				assert.NoError(t, ss.Add(ctx, Anonymous, todo))
+			}
+
+			updated, err := ss.Update(ctx, Anonymous, tt.updateId, tt.todo)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.updateId, updated.Id)
+
+			readTodo, err := ss.GetById(ctx, Anonymous, tt.updateId)
+			if assert.NoError(t, err) {
+				assert.Equal(t, updated, readTodo)
+			}
+
+			all, err := ss.GetAll(ctx, Anonymous)
+			if assert.NoError(t, err) {
+				assert.Equal(t, len(tt.addTodos), len(all))
+			}
+		})
+	}
+}
+
+func TestSQLStore_Delete(t *testing.T) {
+	ctx := context.Background()
+
+	ss := newTestSQLStore(t)
+
+	assert.NoError(t, ss.Add(ctx, Anonymous, &model.Todo{Title: "First"}))
+	assert.NoError(t, ss.Add(ctx, Anonymous, &model.Todo{Title: "Second"}))
+
+	assert.NoError(t, ss.Delete(ctx, Anonymous, &model.Todo{Id: 2}))
+	assert.NoError(t, ss.Delete(ctx, Anonymous, &model.Todo{Id: 99}))
+
+	all, err := ss.GetAll(ctx, Anonymous)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*model.Todo{{Id: 1, Title: "First", Version: 1}}, withoutTimes(all...))
+	}
+
+	// Ids of deleted todos are never handed out again.
+	next := &model.Todo{Title: "Next"}
+	assert.NoError(t, ss.Add(ctx, Anonymous, next))
+	assert.Equal(t, 3, next.Id)
+}
+
+func TestSQLStore_Query(t *testing.T) {
+	testStoreQuery(t, func() Store { return newTestSQLStore(t) })
+}
+
+func TestSQLStore_Versioning(t *testing.T) {
+	testStoreVersioning(t, newTestSQLStore(t))
+}
+
+func TestSQLStore_Timestamps(t *testing.T) {
+	ss := newTestSQLStore(t)
+
+	testStoreTimestamps(t, ss, func(now func() time.Time) { ss.now = now })
+}
+
+func TestSQLStore_Details(t *testing.T) {
+	ctx := context.Background()
+
+	ss := newTestSQLStore(t)
+
+	due := time.Date(2019, time.May, 3, 9, 30, 0, 0, time.UTC)
+	todo := &model.Todo{
+		Title:       "Plan trip",
+		Description: "Book trains and hotel",
+		Due:         &due,
+		Priority:    2,
+		Tags:        []string{"travel", "family"},
+		Recurrence:  "FREQ=MONTHLY;BYDAY=1FR",
+	}
+	assert.NoError(t, ss.Add(ctx, Anonymous, todo))
+
+	stored, err := ss.GetById(ctx, Anonymous, todo.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, todo, stored)
+	}
+
+	todo.Tags = nil
+	todo.Priority = model.PriorityNone
+	todo.Recurrence = ""
+	_, err = ss.Update(ctx, Anonymous, todo.Id, todo)
+	assert.NoError(t, err)
+
+	stored, err = ss.GetById(ctx, Anonymous, todo.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, todo, stored)
+	}
+}
+
+func TestSQLStore_Unavailable(t *testing.T) {
+	ctx := context.Background()
+
+	ss := newTestSQLStore(t)
+	assert.NoError(t, ss.Add(ctx, Anonymous, &model.Todo{Title: "Say hello"}))
+	assert.NoError(t, ss.db.Close())
+
+	_, err := ss.GetById(ctx, Anonymous, 1)
+	assert.True(t, errors.Is(err, ErrUnavailable), "got error %v, want %v", err, ErrUnavailable)
+
+	_, _, err = ss.Query(ctx, Anonymous, model.Query{})
+	assert.True(t, errors.Is(err, ErrUnavailable), "got error %v, want %v", err, ErrUnavailable)
+
+	err = ss.Add(ctx, Anonymous, &model.Todo{Title: "Say goodbye"})
+	assert.True(t, errors.Is(err, ErrUnavailable), "got error %v, want %v", err, ErrUnavailable)
+}
+
+func TestSQLStore_Owners(t *testing.T) {
+	testStoreOwners(t, newTestSQLStore(t))
+}
+
+func TestSQLStore_Lists(t *testing.T) {
+	testStoreLists(t, func() Store { return newTestSQLStore(t) })
+}
+
+func TestSQLStore_Relations(t *testing.T) {
+	testStoreRelations(t, newTestSQLStore(t))
+}
+
+func TestSQLStore_Trash(t *testing.T) {
+	ss := newTestSQLStore(t)
+
+	testStoreTrash(t, ss, func(now func() time.Time) { ss.now = now })
+}
+
+func TestSQLStore_Batch(t *testing.T) {
+	testStoreBatch(t, newTestSQLStore(t))
+}
+
+func TestSQLStore_Revisions(t *testing.T) {
+	ss := newTestSQLStore(t)
+
+	testStoreRevisions(t, ss, func(now func() time.Time) { ss.now = now })
+}
+
+func TestSQLStore_Context(t *testing.T) {
+	testStoreContext(t, newTestSQLStore(t))
+}
+
+func TestSQLStore_ConcurrentWriters(t *testing.T) {
+	ctx := context.Background()
+
+	ss := newTestSQLStore(t)
+
+	const writers = 50
+
+	errs := make(chan error, 2*writers)
+	var wg sync.WaitGroup
+	for idx := 0; idx < writers; idx++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- ss.Add(ctx, Anonymous, &model.Todo{Title: "Water plants"})
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := ss.Batch(ctx, Anonymous, []model.Operation{{Op: model.OpCreate, Todo: &model.Todo{Title: "Mow lawn"}}})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	todos, err := ss.GetAll(ctx, Anonymous)
+	assert.NoError(t, err)
+	assert.Len(t, todos, 2*writers)
+}
@@ -1,103 +1,359 @@
 package store
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 	"todoapp/model"
 )
 
+// Store keeps the todos of all users. Every operation is scoped to the todos
+// of the owner passed after the context, todos of other owners are reported
+// as not found. A call whose context is done fails with the error of the
+// context and leaves the store unchanged.
 type Store interface {
-	Add(*model.Todo) error
-	Update(int, *model.Todo) (*model.Todo, error)
-	GetById(int) (*model.Todo, error)
-	GetAll() ([]*model.Todo, error)
-	Delete(*model.Todo) error
+	Add(ctx context.Context, owner int, todo *model.Todo) error
+	Update(ctx context.Context, owner int, id int, todo *model.Todo) (*model.Todo, error)
+	GetById(ctx context.Context, owner int, id int) (*model.Todo, error)
+	GetAll(ctx context.Context, owner int) ([]*model.Todo, error)
+	// Query returns the page of todos selected by the query and the total
+	// number of todos matching its filters.
+	Query(ctx context.Context, owner int, q model.Query) ([]*model.Todo, int, error)
+	// Delete moves a todo to the trash, hiding it from the methods above. It
+	// refuses with ErrTodoReferenced to delete a todo that still has subtasks
+	// or blocks other todos.
+	Delete(ctx context.Context, owner int, todo *model.Todo) error
+
+	// GetTrash returns the todos of owner in the trash, the most recently
+	// deleted first.
+	GetTrash(ctx context.Context, owner int) ([]*model.Todo, error)
+	// Restore takes a todo out of the trash. A todo whose list is gone is
+	// restored without list, relations to todos that are gone fail
+	// model.CheckRelations.
+	Restore(ctx context.Context, owner int, id int) (*model.Todo, error)
+	// Purge permanently removes the todos of all owners that were moved to the
+	// trash before the given time along with their revisions, and returns how
+	// many todos there were.
+	Purge(ctx context.Context, before time.Time) (int, error)
+
+	// AddRevision appends rev to the history of its todo, which has to exist
+	// in the store or its trash. The store numbers and timestamps it.
+	AddRevision(ctx context.Context, owner int, rev *model.Revision) error
+	// GetRevisions returns the history of a todo in the store or its trash,
+	// oldest first.
+	GetRevisions(ctx context.Context, owner int, todoId int) ([]*model.Revision, error)
+
+	// Batch applies the operations in order as one atomic write: either all
+	// of them succeed or the store is left unchanged. It returns the todo
+	// written by each operation, a deleted todo as moved to the trash. The
+	// failing operation is reported as *model.OperationError, deleting a todo
+	// that does not exist fails with ErrTodoNotFound unlike Delete.
+	Batch(ctx context.Context, owner int, ops []model.Operation) ([]*model.Todo, error)
+
+	// Todos referring to a list that does not exist are rejected with
+	// ErrListNotFound by Add and Update, relations to other todos are checked
+	// with model.CheckRelations.
+	AddList(ctx context.Context, owner int, list *model.List) error
+	UpdateList(ctx context.Context, owner int, id int, list *model.List) (*model.List, error)
+	GetList(ctx context.Context, owner int, id int) (*model.List, error)
+	// GetLists returns the lists of owner ordered by id.
+	GetLists(ctx context.Context, owner int) ([]*model.List, error)
+	// DeleteList deletes the list with the given id, cascade decides what
+	// happens to the todos still on it. Like Delete, deleting them refuses
+	// with ErrTodoReferenced while todos off the list refer to them.
+	DeleteList(ctx context.Context, owner int, id int, cascade model.Cascade) error
 }
 
+// Anonymous owns the todos when the server runs without authentication.
+const Anonymous = 0
+
 var (
-	ErrTodoNotFound = errors.New("todo not found")
+	ErrTodoNotFound     = errors.New("todo not found")
+	ErrVersionConflict  = errors.New("todo version conflict")
+	ErrListNotFound     = errors.New("list not found")
+	ErrListNotEmpty     = errors.New("list is not empty")
+	ErrTodoReferenced   = errors.New("todo has subtasks or blocks other todos")
+	ErrRevisionNotFound = errors.New("revision not found")
+	// ErrUnavailable is matched by errors caused by the underlying storage
+	// failing, e.g. a lost database connection or a failed disk write.
+	ErrUnavailable = errors.New("store unavailable")
 )
 
+// unavailable wraps a storage failure so that it matches both ErrUnavailable
+// and err.
+func unavailable(op string, err error) error {
+	// A call given up by its caller is no failure of the storage.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return fmt.Errorf("%s: %w: %w", op, ErrUnavailable, err)
+}
+
 type InMemoryStore struct {
 	counter int64
 	todoMap map[int]*model.Todo
+	owners  map[int]int
+	now     func() time.Time
+
+	listCounter int64
+	lists       map[int]*model.List
+	listOwners  map[int]int
+
+	// revisions maps the id of a todo to its history, oldest first.
+	revisions map[int][]*model.Revision
 
 	sync.RWMutex
 }
 
 func NewInMemoryStore() *InMemoryStore {
-	return &InMemoryStore{todoMap: make(map[int]*model.Todo)}
+	return &InMemoryStore{
+		todoMap:    make(map[int]*model.Todo),
+		owners:     make(map[int]int),
+		now:        time.Now,
+		lists:      make(map[int]*model.List),
+		listOwners: make(map[int]int),
+		revisions:  make(map[int][]*model.Revision),
+	}
 }
 
-func (ims *InMemoryStore) Add(todo *model.Todo) error {
-	if err := todo.IsValid(); err != nil {
+func (ims *InMemoryStore) Add(ctx context.Context, owner int, todo *model.Todo) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	todo.Id = ims.getId()
+	if err := todo.IsValid(); err != nil {
+		return err
+	}
 
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.todoMap[todo.Id] = todo
-
-	return nil
+	return ims.add(owner, todo, ims.now())
 }
 
-func (ims *InMemoryStore) GetById(id int) (*model.Todo, error) {
+func (ims *InMemoryStore) GetById(ctx context.Context, owner int, id int) (*model.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	ims.RLock()
 	defer ims.RUnlock()
 
-	todo, ok := ims.todoMap[id]
-	if !ok {
-		return nil, ErrTodoNotFound
+	return ims.lookup(owner, id)
+}
+
+func (ims *InMemoryStore) Update(ctx context.Context, owner int, id int, todo *model.Todo) (*model.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	return todo, nil
+	if err := todo.IsValid(); err != nil {
+		return nil, err
+	}
+
+	ims.Lock()
+	defer ims.Unlock()
+
+	return ims.update(owner, id, todo, ims.now())
 }
 
-func (ims *InMemoryStore) Update(id int, todo *model.Todo) (*model.Todo, error) {
-	if err := todo.IsValid(); err != nil {
+func (ims *InMemoryStore) GetAll(ctx context.Context, owner int) ([]*model.Todo, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
+	ims.RLock()
+	defer ims.RUnlock()
+
+	list := []*model.Todo{}
+	for id, todo := range ims.todoMap {
+		if ims.owners[id] == owner && todo.DeletedAt == nil {
+			list = append(list, todo)
+		}
+	}
+
+	return list, nil
+}
+
+func (ims *InMemoryStore) Query(ctx context.Context, owner int, q model.Query) ([]*model.Todo, int, error) {
+	all, err := ims.GetAll(ctx, owner)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page, total := q.Apply(all)
+
+	return page, total, nil
+}
+
+func (ims *InMemoryStore) Delete(ctx context.Context, owner int, todo *model.Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	ims.Lock()
 	defer ims.Unlock()
 
-	_, ok := ims.todoMap[id]
-	if !ok {
-		return nil, ErrTodoNotFound
+	_, err := ims.trash(owner, todo.Id, ims.now())
+	if err == ErrTodoNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// add stores the already validated todo as a new todo, callers must hold the
+// lock.
+func (ims *InMemoryStore) add(owner int, todo *model.Todo, now time.Time) error {
+	if err := ims.checkList(owner, todo.ListId); err != nil {
+		return err
+	}
+
+	if err := model.CheckRelations(0, todo, ims.lookupFunc(owner)); err != nil {
+		return err
+	}
+
+	todo.Id = ims.getId()
+	todo.Version = 1
+	stampTimes(todo, nil, now)
+
+	ims.todoMap[todo.Id] = todo
+	ims.owners[todo.Id] = owner
+
+	return nil
+}
+
+// update replaces the todo with the given id by the already validated todo,
+// callers must hold the lock.
+func (ims *InMemoryStore) update(owner int, id int, todo *model.Todo, now time.Time) (*model.Todo, error) {
+	current, err := ims.lookup(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if todo.Version != 0 && todo.Version != current.Version {
+		return nil, ErrVersionConflict
+	}
+
+	if err := ims.checkList(owner, todo.ListId); err != nil {
+		return nil, err
+	}
+
+	if err := model.CheckRelations(id, todo, ims.lookupFunc(owner)); err != nil {
+		return nil, err
 	}
 
 	todo.Id = id
+	todo.Version = current.Version + 1
+	stampTimes(todo, current, now)
 	ims.todoMap[id] = todo
 
 	return todo, nil
 }
 
-func (ims *InMemoryStore) GetAll() ([]*model.Todo, error) {
-	ims.RLock()
-	defer ims.RUnlock()
+// trash moves the todo with the given id to the trash and returns it as
+// trashed, callers must hold the lock.
+func (ims *InMemoryStore) trash(owner int, id int, now time.Time) (*model.Todo, error) {
+	current, err := ims.lookup(owner, id)
+	if err != nil {
+		return nil, err
+	}
 
-	list := make([]*model.Todo, len(ims.todoMap))
+	// Todos in the trash do not hold on to the todos they refer to.
+	referrer := 0
+	for otherId, other := range ims.todoMap {
+		if ims.owners[otherId] == owner && other.DeletedAt == nil && references(other, id) && (referrer == 0 || otherId < referrer) {
+			referrer = otherId
+		}
+	}
 
-	counter := 0
-	for _, todo := range ims.todoMap {
-		list[counter] = todo
-		counter++
+	if referrer != 0 {
+		return nil, fmt.Errorf("%w: todo %d refers to it", ErrTodoReferenced, referrer)
 	}
 
-	return list, nil
+	deleted := trashed(current, now)
+	ims.todoMap[id] = deleted
+
+	return deleted, nil
 }
 
-func (ims *InMemoryStore) Delete(todo *model.Todo) error {
-	ims.Lock()
-	defer ims.Unlock()
+// lookupFunc adapts lookup for model.CheckRelations, callers must hold the
+// lock while the returned function is used.
+func (ims *InMemoryStore) lookupFunc(owner int) model.TodoLookup {
+	return func(id int) (*model.Todo, error) {
+		todo, err := ims.lookup(owner, id)
+		if err != nil {
+			return nil, nil
+		}
 
-	delete(ims.todoMap, todo.Id)
+		return todo, nil
+	}
+}
 
-	return nil
+// references reports whether todo is a subtask of or blocked by the todo with
+// the given id.
+func references(todo *model.Todo, id int) bool {
+	if todo.ParentId == id {
+		return true
+	}
+
+	for _, blocker := range todo.BlockedBy {
+		if blocker == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookup returns the todo with the given id if it belongs to owner and is not
+// in the trash, callers must hold the lock.
+func (ims *InMemoryStore) lookup(owner int, id int) (*model.Todo, error) {
+	todo, ok := ims.todoMap[id]
+	if !ok || ims.owners[id] != owner || todo.DeletedAt != nil {
+		return nil, ErrTodoNotFound
+	}
+
+	return todo, nil
+}
+
+// stampTimes sets the store managed timestamps of todo and normalises its
+// due date to UTC. prev is the stored todo that is being replaced, or nil if
+// todo is new.
+func stampTimes(todo, prev *model.Todo, now time.Time) {
+	now = now.UTC()
+
+	normaliseDue(todo)
+
+	todo.CreatedAt = now
+	if prev != nil {
+		todo.CreatedAt = prev.CreatedAt
+	}
+
+	todo.UpdatedAt = now
+	todo.DeletedAt = nil
+
+	switch {
+	case !todo.Completed:
+		todo.CompletedAt = nil
+	case prev != nil && prev.Completed && prev.CompletedAt != nil:
+		todo.CompletedAt = prev.CompletedAt
+	default:
+		todo.CompletedAt = &now
+	}
+}
+
+// normaliseDue converts the due date of todo to UTC, so that it reads the
+// same from every store.
+func normaliseDue(todo *model.Todo) {
+	if todo.Due != nil {
+		due := todo.Due.UTC()
+		todo.Due = &due
+	}
 }
 
 func (ims *InMemoryStore) getId() int {
@@ -105,3 +361,42 @@ func (ims *InMemoryStore) getId() int {
 
 	return int(ims.counter)
 }
+
+func (ims *InMemoryStore) currentId() int64 {
+	return atomic.LoadInt64(&ims.counter)
+}
+
+// put stores todo under its own id without validation, it is used to restore
+// previously persisted state.
+func (ims *InMemoryStore) put(owner int, todo *model.Todo) {
+	ims.Lock()
+	defer ims.Unlock()
+
+	ims.todoMap[todo.Id] = todo
+	ims.owners[todo.Id] = owner
+}
+
+func (ims *InMemoryStore) remove(id int) {
+	ims.Lock()
+	defer ims.Unlock()
+
+	delete(ims.todoMap, id)
+	delete(ims.owners, id)
+	delete(ims.revisions, id)
+}
+
+// all returns the todos of every owner along with their owners, it is used to
+// persist the complete state.
+func (ims *InMemoryStore) all() ([]*model.Todo, map[int]int) {
+	ims.RLock()
+	defer ims.RUnlock()
+
+	todos := make([]*model.Todo, 0, len(ims.todoMap))
+	owners := make(map[int]int, len(ims.owners))
+	for id, todo := range ims.todoMap {
+		todos = append(todos, todo)
+		owners[id] = ims.owners[id]
+	}
+
+	return todos, owners
+}
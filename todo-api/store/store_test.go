@@ -1,8 +1,11 @@
 package store
 
 import (
+	"context"
+	"errors"
 	"sort"
 	"testing"
+	"time"
 	"todoapp/model"
 
 	"github.com/stretchr/testify/assert"
@@ -15,6 +18,8 @@ func TestNewInMemoryStore(t *testing.T) {
 }
 
 func TestInMemoryStore_Add(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name    string
 		todo    *model.Todo
@@ -49,7 +54,7 @@ func TestInMemoryStore_Add(t *testing.T) {
 		ims := NewInMemoryStore()
 
 		t.Run(tt.name, func(t *testing.T) {
-			if err := ims.Add(tt.todo); (err != nil) != tt.wantErr {
+			if err := ims.Add(ctx, Anonymous, tt.todo); (err != nil) != tt.wantErr {
 				t.Errorf("InMemoryStore.Add() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
@@ -58,7 +63,7 @@ func TestInMemoryStore_Add(t *testing.T) {
 				return
 			}
 
-			readTodo, err := ims.GetById(tt.todo.Id)
+			readTodo, err := ims.GetById(ctx, Anonymous, tt.todo.Id)
 			if assert.NoError(t, err) {
 				assert.Equal(t, tt.todo, readTodo)
 			}
@@ -67,6 +72,8 @@ func TestInMemoryStore_Add(t *testing.T) {
 }
 
 func TestInMemoryStore_GetById(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name    string
 		todo    *model.Todo
@@ -99,13 +106,13 @@ func TestInMemoryStore_GetById(t *testing.T) {
 		ims := NewInMemoryStore()
 
 		t.Run(tt.name, func(t *testing.T) {
-			err := ims.Add(tt.todo)
+			err := ims.Add(ctx, Anonymous, tt.todo)
 			if err != nil {
 				t.Errorf("Failed adding todo: %v", err)
 				return
 			}
 
-			readTodo, err := ims.GetById(tt.byId)
+			readTodo, err := ims.GetById(ctx, Anonymous, tt.byId)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetById(%d) wantErr=%t, but got: %v", tt.byId, tt.wantErr, err)
 				return
@@ -121,6 +128,8 @@ func TestInMemoryStore_GetById(t *testing.T) {
 }
 
 func TestInMemoryStore_GetAll(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name    string
 		todos   []*model.Todo
@@ -162,14 +171,14 @@ func TestInMemoryStore_GetAll(t *testing.T) {
 
 		t.Run(tt.name, func(t *testing.T) {
 			for _, todo := range tt.todos {
-				err := ims.Add(todo)
+				err := ims.Add(ctx, Anonymous, todo)
 				if err != nil {
 					t.Errorf("Failed adding todo: %v", err)
 					return
 				}
 			}
 
-			readTodos, err := ims.GetAll()
+			readTodos, err := ims.GetAll(ctx, Anonymous)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetAll() wantErr=%t, but got: %v", tt.wantErr, err)
 				return
@@ -192,6 +201,8 @@ func TestInMemoryStore_GetAll(t *testing.T) {
 }
 
 func TestInMemoryStore_Delete(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name           string
 		todo           *model.Todo
@@ -226,13 +237,13 @@ func TestInMemoryStore_Delete(t *testing.T) {
 		ims := NewInMemoryStore()
 
 		t.Run(tt.name, func(t *testing.T) {
-			err := ims.Add(tt.todo)
+			err := ims.Add(ctx, Anonymous, tt.todo)
 			if err != nil {
 				t.Errorf("Failed adding todo: %v", err)
 				return
 			}
 
-			err = ims.Delete(&model.Todo{Id: tt.deleteId})
+			err = ims.Delete(ctx, Anonymous, &model.Todo{Id: tt.deleteId})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Delete(%d) wantErr=%t, but got: %v", tt.deleteId, tt.wantErr, err)
 				return
@@ -242,12 +253,18 @@ func TestInMemoryStore_Delete(t *testing.T) {
 				return
 			}
 
-			assert.Equal(t, len(ims.todoMap), tt.expectedLength)
+			// Deleted todos are kept in the trash.
+			todos, err := ims.GetAll(ctx, Anonymous)
+			assert.NoError(t, err)
+			assert.Equal(t, len(todos), tt.expectedLength)
+			assert.Equal(t, len(ims.todoMap), 1)
 		})
 	}
 }
 
 func TestInMemoryStore_Update(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name     string
 		addTodos []*model.Todo
@@ -324,14 +341,14 @@ func TestInMemoryStore_Update(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 
 			for _, addTodo := range tt.addTodos {
-				err := ims.Add(addTodo)
+				err := ims.Add(ctx, Anonymous, addTodo)
 				if err != nil {
 					t.Errorf("failed adding todo: %v", err)
 					return
 				}
 			}
 
-			updatedTodo, err := ims.Update(tt.updateId, tt.todo)
+			updatedTodo, err := ims.Update(ctx, Anonymous, tt.updateId, tt.todo)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("InMemoryStore.Update() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -344,12 +361,12 @@ func TestInMemoryStore_Update(t *testing.T) {
 			tt.todo.Id = tt.updateId
 			assert.Equal(t, updatedTodo, tt.todo)
 
-			readTodo, err := ims.GetById(tt.todo.Id)
+			readTodo, err := ims.GetById(ctx, Anonymous, tt.todo.Id)
 			if assert.NoError(t, err) {
 				assert.Equal(t, tt.todo, readTodo)
 			}
 
-			allTodos, err := ims.GetAll()
+			allTodos, err := ims.GetAll(ctx, Anonymous)
 			if assert.NoError(t, err) {
 				assert.Equal(t, len(allTodos), len(tt.addTodos))
 			}
@@ -357,8 +374,855 @@ func TestInMemoryStore_Update(t *testing.T) {
 	}
 }
 
+func TestInMemoryStore_Query(t *testing.T) {
+	testStoreQuery(t, func() Store { return NewInMemoryStore() })
+}
+
+// testStoreQuery checks that a Store implementation filters, sorts and pages
+// the same way model.Query.Apply does.
+func testStoreQuery(t *testing.T, newStore func() Store) {
+	ctx := context.Background()
+
+	yes := true
+
+	tests := []struct {
+		name      string
+		query     model.Query
+		wantIds   []int
+		wantTotal int
+	}{
+		{
+			name:      "zero query",
+			query:     model.Query{},
+			wantIds:   []int{1, 2, 3, 4, 5},
+			wantTotal: 5,
+		},
+		{
+			name:      "completed",
+			query:     model.Query{Completed: &yes},
+			wantIds:   []int{3, 4},
+			wantTotal: 2,
+		},
+		{
+			name:      "search with like wildcards",
+			query:     model.Query{Search: "50%"},
+			wantIds:   []int{5},
+			wantTotal: 1,
+		},
+		{
+			name:      "search folding non-ASCII case",
+			query:     model.Query{Search: "évian"},
+			wantIds:   []int{2},
+			wantTotal: 1,
+		},
+		{
+			name:      "search sorted by title descending",
+			query:     model.Query{Search: "buy", Sort: []model.SortKey{{Field: model.SortFieldTitle, Desc: true}}},
+			wantIds:   []int{1, 3, 5},
+			wantTotal: 3,
+		},
+		{
+			name:      "completed first then id descending",
+			query:     model.Query{Sort: []model.SortKey{{Field: model.SortFieldCompleted, Desc: true}, {Field: model.SortFieldId, Desc: true}}},
+			wantIds:   []int{4, 3, 5, 2, 1},
+			wantTotal: 5,
+		},
+		{
+			name:      "second page",
+			query:     model.Query{Limit: 2, Offset: 2},
+			wantIds:   []int{3, 4},
+			wantTotal: 5,
+		},
+		{
+			name:      "offset past the end",
+			query:     model.Query{Limit: 2, Offset: 10},
+			wantIds:   []int{},
+			wantTotal: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore()
+
+			for _, todo := range []*model.Todo{
+				{Title: "Buy milk"},
+				{Title: "Call mum", Description: "Ask about the summer in Évian"},
+				{Title: "Buy bread", Completed: true},
+				{Title: "Water plants", Completed: true},
+				{Title: "BUY stamps at 50% off"},
+			} {
+				if err := s.Add(ctx, Anonymous, todo); err != nil {
+					t.Fatalf("Failed adding todo: %v", err)
+				}
+			}
+
+			page, total, err := s.Query(ctx, Anonymous, tt.query)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			ids := make([]int, len(page))
+			for idx, todo := range page {
+				ids[idx] = todo.Id
+			}
+
+			assert.Equal(t, tt.wantIds, ids)
+			assert.Equal(t, tt.wantTotal, total)
+		})
+	}
+}
+
+func TestInMemoryStore_Versioning(t *testing.T) {
+	testStoreVersioning(t, NewInMemoryStore())
+}
+
+// testStoreVersioning checks that a Store implementation bumps versions on
+// every write and rejects updates based on a stale version.
+func testStoreVersioning(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	todo := &model.Todo{Title: "First", Version: 7}
+	if err := s.Add(ctx, Anonymous, todo); err != nil {
+		t.Fatalf("Failed adding todo: %v", err)
+	}
+	assert.Equal(t, 1, todo.Version)
+
+	updated, err := s.Update(ctx, Anonymous, todo.Id, &model.Todo{Title: "Unconditional"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, updated.Version)
+	}
+
+	updated, err = s.Update(ctx, Anonymous, todo.Id, &model.Todo{Title: "Conditional", Version: 2})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, updated.Version)
+	}
+
+	_, err = s.Update(ctx, Anonymous, todo.Id, &model.Todo{Title: "Stale", Version: 2})
+	assert.Equal(t, ErrVersionConflict, err)
+
+	_, err = s.Update(ctx, Anonymous, 99, &model.Todo{Title: "Missing", Version: 2})
+	assert.Equal(t, ErrTodoNotFound, err)
+
+	stored, err := s.GetById(ctx, Anonymous, todo.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Conditional", stored.Title)
+		assert.Equal(t, 3, stored.Version)
+	}
+}
+
+func TestInMemoryStore_Timestamps(t *testing.T) {
+	ims := NewInMemoryStore()
+
+	testStoreTimestamps(t, ims, func(now func() time.Time) { ims.now = now })
+}
+
+// testStoreTimestamps checks that a Store implementation maintains the
+// created, updated and completed timestamps itself.
+func testStoreTimestamps(t *testing.T, s Store, setClock func(func() time.Time)) {
+	ctx := context.Background()
+
+	start := time.Date(2019, time.May, 1, 12, 0, 0, 0, time.UTC)
+	clientTime := time.Date(1999, time.January, 1, 0, 0, 0, 0, time.UTC)
+	due := time.Date(2019, time.May, 3, 9, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	now := start
+	setClock(func() time.Time { return now })
+
+	todo := &model.Todo{Title: "First", Due: &due, CreatedAt: clientTime, CompletedAt: &clientTime}
+	if err := s.Add(ctx, Anonymous, todo); err != nil {
+		t.Fatalf("Failed adding todo: %v", err)
+	}
+
+	assert.Equal(t, start, todo.CreatedAt)
+	assert.Equal(t, start, todo.UpdatedAt)
+	assert.Nil(t, todo.CompletedAt)
+	if assert.NotNil(t, todo.Due) {
+		assert.Equal(t, due.UTC(), *todo.Due)
+	}
+
+	steps := []struct {
+		name          string
+		completed     bool
+		wantCompleted *time.Time
+	}{
+		{"complete", true, timePtr(start.Add(1 * time.Hour))},
+		{"stay completed", true, timePtr(start.Add(1 * time.Hour))},
+		{"reopen", false, nil},
+		{"complete again", true, timePtr(start.Add(4 * time.Hour))},
+	}
+	for idx, step := range steps {
+		now = start.Add(time.Duration(idx+1) * time.Hour)
+
+		updated, err := s.Update(ctx, Anonymous, todo.Id, &model.Todo{Title: "First", Due: &due, Completed: step.completed, CreatedAt: clientTime})
+		if !assert.NoError(t, err, step.name) {
+			return
+		}
+
+		// The returned todo reads like the stored one, whatever the store.
+		if assert.NotNil(t, updated.Due, step.name) {
+			assert.Equal(t, due.UTC(), *updated.Due, step.name)
+		}
+
+		stored, err := s.GetById(ctx, Anonymous, todo.Id)
+		if !assert.NoError(t, err, step.name) {
+			return
+		}
+
+		assert.Equal(t, start, stored.CreatedAt, step.name)
+		assert.Equal(t, now, stored.UpdatedAt, step.name)
+		assert.Equal(t, step.wantCompleted, stored.CompletedAt, step.name)
+		if assert.NotNil(t, stored.Due, step.name) {
+			assert.Equal(t, due.UTC(), *stored.Due, step.name)
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// withoutTimes clears the store managed timestamps so todos can be compared
+// against literals.
+func withoutTimes(todos ...*model.Todo) []*model.Todo {
+	for _, todo := range todos {
+		todo.CreatedAt = time.Time{}
+		todo.UpdatedAt = time.Time{}
+		todo.CompletedAt = nil
+		todo.DeletedAt = nil
+	}
+
+	return todos
+}
+
 type ById []*model.Todo
 
 func (a ById) Len() int           { return len(a) }
 func (a ById) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ById) Less(i, j int) bool { return a[i].Id < a[j].Id }
+
+func TestInMemoryStore_Owners(t *testing.T) {
+	testStoreOwners(t, NewInMemoryStore())
+}
+
+// testStoreOwners checks that the todos of one owner are invisible to all
+// other owners.
+func testStoreOwners(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	const alice, bob = 1, 2
+
+	own := &model.Todo{Title: "Alice's todo"}
+	assert.NoError(t, s.Add(ctx, alice, own))
+	assert.NoError(t, s.Add(ctx, bob, &model.Todo{Title: "Bob's todo"}))
+	assert.NoError(t, s.Add(ctx, Anonymous, &model.Todo{Title: "Nobody's todo"}))
+
+	for _, owner := range []int{alice, bob, Anonymous} {
+		todos, err := s.GetAll(ctx, owner)
+		assert.NoError(t, err)
+		assert.Len(t, todos, 1)
+
+		_, total, err := s.Query(ctx, owner, model.Query{})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, total)
+	}
+
+	_, err := s.GetById(ctx, bob, own.Id)
+	assert.Equal(t, ErrTodoNotFound, err)
+
+	_, err = s.Update(ctx, bob, own.Id, &model.Todo{Title: "Taken over"})
+	assert.Equal(t, ErrTodoNotFound, err)
+
+	assert.NoError(t, s.Delete(ctx, bob, own))
+
+	stored, err := s.GetById(ctx, alice, own.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Alice's todo", stored.Title)
+		assert.Equal(t, 1, stored.Version)
+	}
+}
+
+func TestInMemoryStore_Lists(t *testing.T) {
+	testStoreLists(t, func() Store { return NewInMemoryStore() })
+}
+
+// testStoreLists checks list management, moving todos between lists and the
+// cascade rules applied when a list is deleted.
+func testStoreLists(t *testing.T, newStore func() Store) {
+	ctx := context.Background()
+
+	t.Run("crud", func(t *testing.T) {
+		s := newStore()
+
+		groceries := &model.List{Name: "Groceries"}
+		assert.NoError(t, s.AddList(ctx, Anonymous, groceries))
+		assert.NoError(t, s.AddList(ctx, Anonymous, &model.List{Name: "Chores"}))
+		assert.NoError(t, s.AddList(ctx, 1, &model.List{Name: "Someone else's"}))
+		assert.Equal(t, 1, groceries.Id)
+		assert.False(t, groceries.CreatedAt.IsZero())
+
+		_, err := s.UpdateList(ctx, Anonymous, groceries.Id, &model.List{Name: "Food"})
+		assert.NoError(t, err)
+
+		lists, err := s.GetLists(ctx, Anonymous)
+		assert.NoError(t, err)
+		if assert.Len(t, lists, 2) {
+			assert.Equal(t, "Food", lists[0].Name)
+			assert.Equal(t, "Chores", lists[1].Name)
+		}
+
+		_, err = s.GetList(ctx, Anonymous, 3)
+		assert.Equal(t, ErrListNotFound, err)
+
+		_, err = s.UpdateList(ctx, Anonymous, 3, &model.List{Name: "Taken over"})
+		assert.Equal(t, ErrListNotFound, err)
+
+		assert.True(t, errors.Is(s.AddList(ctx, Anonymous, &model.List{}), model.ErrEmptyListName))
+	})
+
+	t.Run("todos on lists", func(t *testing.T) {
+		s := newStore()
+
+		first, second := &model.List{Name: "First"}, &model.List{Name: "Second"}
+		assert.NoError(t, s.AddList(ctx, Anonymous, first))
+		assert.NoError(t, s.AddList(ctx, Anonymous, second))
+
+		other := &model.List{Name: "Other owner"}
+		assert.NoError(t, s.AddList(ctx, 1, other))
+
+		todo := &model.Todo{Title: "Say hello", ListId: first.Id}
+		assert.NoError(t, s.Add(ctx, Anonymous, todo))
+		assert.NoError(t, s.Add(ctx, Anonymous, &model.Todo{Title: "Unlisted"}))
+
+		assert.Equal(t, ErrListNotFound, s.Add(ctx, Anonymous, &model.Todo{Title: "Lost", ListId: 99}))
+		assert.Equal(t, ErrListNotFound, s.Add(ctx, Anonymous, &model.Todo{Title: "Sneaky", ListId: other.Id}))
+
+		_, err := s.Update(ctx, Anonymous, todo.Id, &model.Todo{Title: "Say hello", ListId: 99})
+		assert.Equal(t, ErrListNotFound, err)
+
+		moved, err := s.Update(ctx, Anonymous, todo.Id, &model.Todo{Title: "Say hello", ListId: second.Id})
+		if assert.NoError(t, err) {
+			assert.Equal(t, second.Id, moved.ListId)
+		}
+
+		for listId, want := range map[int]int{0: 1, first.Id: 0, second.Id: 1} {
+			listId := listId
+			_, total, err := s.Query(ctx, Anonymous, model.Query{ListId: &listId})
+			assert.NoError(t, err)
+			assert.Equal(t, want, total, "todos on list %d", listId)
+		}
+	})
+
+	cascades := []struct {
+		cascade   model.Cascade
+		wantErr   error
+		wantTodos []*model.Todo
+	}{
+		{
+			cascade: model.CascadeRestrict,
+			wantErr: ErrListNotEmpty,
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "On list", ListId: 1, Version: 1},
+				{Id: 2, Title: "Unlisted", Version: 1},
+			},
+		},
+		{
+			cascade: model.CascadeDelete,
+			wantTodos: []*model.Todo{
+				{Id: 2, Title: "Unlisted", Version: 1},
+			},
+		},
+		{
+			cascade: model.CascadeDetach,
+			wantTodos: []*model.Todo{
+				{Id: 1, Title: "On list", Version: 2},
+				{Id: 2, Title: "Unlisted", Version: 1},
+			},
+		},
+	}
+	for _, tt := range cascades {
+		t.Run("delete with "+string(tt.cascade), func(t *testing.T) {
+			s := newStore()
+
+			list := &model.List{Name: "Groceries"}
+			assert.NoError(t, s.AddList(ctx, Anonymous, list))
+			assert.NoError(t, s.Add(ctx, Anonymous, &model.Todo{Title: "On list", ListId: list.Id}))
+			assert.NoError(t, s.Add(ctx, Anonymous, &model.Todo{Title: "Unlisted"}))
+
+			err := s.DeleteList(ctx, Anonymous, list.Id, tt.cascade)
+			assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+
+			_, err = s.GetList(ctx, Anonymous, list.Id)
+			if tt.wantErr == nil {
+				assert.Equal(t, ErrListNotFound, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			todos, err := s.GetAll(ctx, Anonymous)
+			assert.NoError(t, err)
+
+			model.SortById(todos)
+			assert.Equal(t, tt.wantTodos, withoutTimes(todos...))
+		})
+	}
+
+	t.Run("delete referenced todos", func(t *testing.T) {
+		s := newStore()
+
+		list := &model.List{Name: "Groceries"}
+		assert.NoError(t, s.AddList(ctx, Anonymous, list))
+
+		shop := &model.Todo{Title: "Go shopping", ListId: list.Id}
+		assert.NoError(t, s.Add(ctx, Anonymous, shop))
+		assert.NoError(t, s.Add(ctx, Anonymous, &model.Todo{Title: "Buy milk", ListId: list.Id, ParentId: shop.Id}))
+
+		child := &model.Todo{Title: "Bake a cake", ParentId: shop.Id}
+		assert.NoError(t, s.Add(ctx, Anonymous, child))
+
+		blocked := &model.Todo{Title: "Cook dinner", BlockedBy: []int{shop.Id}}
+		assert.NoError(t, s.Add(ctx, Anonymous, blocked))
+
+		err := s.DeleteList(ctx, Anonymous, list.Id, model.CascadeDelete)
+		assert.True(t, errors.Is(err, ErrTodoReferenced), "got error %v, want %v", err, ErrTodoReferenced)
+
+		_, err = s.GetList(ctx, Anonymous, list.Id)
+		assert.NoError(t, err)
+
+		todos, err := s.GetAll(ctx, Anonymous)
+		assert.NoError(t, err)
+		assert.Len(t, todos, 4)
+
+		// Once nothing off the list refers to its todos, they go with it.
+		_, err = s.Update(ctx, Anonymous, child.Id, &model.Todo{Title: "Bake a cake"})
+		assert.NoError(t, err)
+
+		err = s.DeleteList(ctx, Anonymous, list.Id, model.CascadeDelete)
+		assert.True(t, errors.Is(err, ErrTodoReferenced), "got error %v, want %v", err, ErrTodoReferenced)
+
+		_, err = s.Update(ctx, Anonymous, blocked.Id, &model.Todo{Title: "Cook dinner"})
+		assert.NoError(t, err)
+
+		assert.NoError(t, s.DeleteList(ctx, Anonymous, list.Id, model.CascadeDelete))
+
+		todos, err = s.GetAll(ctx, Anonymous)
+		assert.NoError(t, err)
+		assert.Len(t, todos, 2)
+	})
+
+	t.Run("delete missing list", func(t *testing.T) {
+		s := newStore()
+
+		assert.Equal(t, ErrListNotFound, s.DeleteList(ctx, Anonymous, 1, model.CascadeDelete))
+	})
+}
+
+func TestInMemoryStore_Relations(t *testing.T) {
+	testStoreRelations(t, NewInMemoryStore())
+}
+
+// testStoreRelations checks that subtasks and blockers must exist, must not
+// form cycles and keep the todos they refer to from being deleted.
+func testStoreRelations(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	parent := &model.Todo{Title: "Move house"}
+	assert.NoError(t, s.Add(ctx, Anonymous, parent))
+
+	child := &model.Todo{Title: "Pack boxes", ParentId: parent.Id, AutoComplete: true}
+	assert.NoError(t, s.Add(ctx, Anonymous, child))
+
+	blocked := &model.Todo{Title: "Hand over keys", BlockedBy: []int{child.Id}}
+	assert.NoError(t, s.Add(ctx, Anonymous, blocked))
+
+	stored, err := s.GetById(ctx, Anonymous, blocked.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{child.Id}, stored.BlockedBy)
+	}
+
+	_, total, err := s.Query(ctx, Anonymous, model.Query{ParentId: &parent.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+
+	err = s.Add(ctx, Anonymous, &model.Todo{Title: "Orphan", ParentId: 99})
+	assert.True(t, errors.Is(err, model.ErrUnknownParent), "got error %v, want %v", err, model.ErrUnknownParent)
+
+	err = s.Add(ctx, 1, &model.Todo{Title: "Sneaky", BlockedBy: []int{parent.Id}})
+	assert.True(t, errors.Is(err, model.ErrUnknownBlocker), "got error %v, want %v", err, model.ErrUnknownBlocker)
+
+	_, err = s.Update(ctx, Anonymous, parent.Id, &model.Todo{Title: "Move house", ParentId: child.Id})
+	assert.True(t, errors.Is(err, model.ErrParentCycle), "got error %v, want %v", err, model.ErrParentCycle)
+
+	_, err = s.Update(ctx, Anonymous, child.Id, &model.Todo{Title: "Pack boxes", BlockedBy: []int{blocked.Id}})
+	assert.True(t, errors.Is(err, model.ErrDependencyCycle), "got error %v, want %v", err, model.ErrDependencyCycle)
+
+	err = s.Delete(ctx, Anonymous, parent)
+	assert.True(t, errors.Is(err, ErrTodoReferenced), "got error %v, want %v", err, ErrTodoReferenced)
+
+	err = s.Delete(ctx, Anonymous, child)
+	assert.True(t, errors.Is(err, ErrTodoReferenced), "got error %v, want %v", err, ErrTodoReferenced)
+
+	assert.NoError(t, s.Delete(ctx, Anonymous, blocked))
+	assert.NoError(t, s.Delete(ctx, Anonymous, child))
+	assert.NoError(t, s.Delete(ctx, Anonymous, parent))
+}
+
+func TestInMemoryStore_Trash(t *testing.T) {
+	ims := NewInMemoryStore()
+
+	testStoreTrash(t, ims, func(now func() time.Time) { ims.now = now })
+}
+
+// testStoreTrash checks that deleted todos are moved to the trash, from where
+// they can be restored until they are purged.
+func testStoreTrash(t *testing.T, s Store, setClock func(func() time.Time)) {
+	ctx := context.Background()
+
+	monday := time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+
+	list := &model.List{Name: "Garden"}
+	assert.NoError(t, s.AddList(ctx, Anonymous, list))
+
+	parent := &model.Todo{Title: "Plant tulips", ListId: list.Id}
+	assert.NoError(t, s.Add(ctx, Anonymous, parent))
+
+	child := &model.Todo{Title: "Buy bulbs", ParentId: parent.Id}
+	assert.NoError(t, s.Add(ctx, Anonymous, child))
+
+	other := &model.Todo{Title: "Mow lawn"}
+	assert.NoError(t, s.Add(ctx, Anonymous, other))
+
+	setClock(func() time.Time { return monday })
+	assert.NoError(t, s.Delete(ctx, Anonymous, child))
+
+	setClock(func() time.Time { return tuesday })
+	assert.NoError(t, s.Delete(ctx, Anonymous, other))
+
+	// The trashed subtask no longer keeps its parent from being deleted.
+	assert.NoError(t, s.Delete(ctx, Anonymous, parent))
+	assert.NoError(t, s.DeleteList(ctx, Anonymous, list.Id, model.CascadeRestrict))
+
+	_, err := s.GetById(ctx, Anonymous, child.Id)
+	assert.Equal(t, ErrTodoNotFound, err)
+
+	_, err = s.Update(ctx, Anonymous, child.Id, &model.Todo{Title: "Buy bulbs"})
+	assert.Equal(t, ErrTodoNotFound, err)
+
+	all, err := s.GetAll(ctx, Anonymous)
+	assert.NoError(t, err)
+	assert.Empty(t, all)
+
+	page, total, err := s.Query(ctx, Anonymous, model.Query{})
+	assert.NoError(t, err)
+	assert.Empty(t, page)
+	assert.Equal(t, 0, total)
+
+	trash, err := s.GetTrash(ctx, Anonymous)
+	if assert.NoError(t, err) && assert.Len(t, trash, 3) {
+		assert.Equal(t, []int{parent.Id, other.Id, child.Id}, []int{trash[0].Id, trash[1].Id, trash[2].Id})
+		assert.Equal(t, tuesday, *trash[0].DeletedAt)
+		assert.Equal(t, monday, *trash[2].DeletedAt)
+	}
+
+	others, err := s.GetTrash(ctx, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, others)
+
+	_, err = s.Restore(ctx, 1, other.Id)
+	assert.Equal(t, ErrTodoNotFound, err)
+
+	// The subtask cannot come back before its parent.
+	_, err = s.Restore(ctx, Anonymous, child.Id)
+	assert.True(t, errors.Is(err, model.ErrUnknownParent), "got error %v, want %v", err, model.ErrUnknownParent)
+
+	// The list of the parent is gone, it comes back without list.
+	restored, err := s.Restore(ctx, Anonymous, parent.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, restored.ListId)
+		assert.Nil(t, restored.DeletedAt)
+		assert.Equal(t, 2, restored.Version)
+	}
+
+	restored, err = s.Restore(ctx, Anonymous, child.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, parent.Id, restored.ParentId)
+	}
+
+	_, err = s.Restore(ctx, Anonymous, child.Id)
+	assert.Equal(t, ErrTodoNotFound, err)
+
+	stored, err := s.GetById(ctx, Anonymous, child.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*model.Todo{{Id: child.Id, Title: "Buy bulbs", ParentId: parent.Id, Version: 2}}, withoutTimes(stored))
+	}
+
+	purged, err := s.Purge(ctx, tuesday)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, purged)
+
+	purged, err = s.Purge(ctx, tuesday.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	trash, err = s.GetTrash(ctx, Anonymous)
+	assert.NoError(t, err)
+	assert.Empty(t, trash)
+
+	_, err = s.Restore(ctx, Anonymous, other.Id)
+	assert.Equal(t, ErrTodoNotFound, err)
+}
+
+func TestInMemoryStore_Revisions(t *testing.T) {
+	ims := NewInMemoryStore()
+
+	testStoreRevisions(t, ims, func(now func() time.Time) { ims.now = now })
+}
+
+// testStoreRevisions checks that revisions are numbered per todo, kept while
+// the todo is in the trash and dropped when it is purged.
+func testStoreRevisions(t *testing.T, s Store, setClock func(func() time.Time)) {
+	ctx := context.Background()
+
+	now := time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC)
+	setClock(func() time.Time { return now })
+
+	first := &model.Todo{Title: "Plant tulips"}
+	assert.NoError(t, s.Add(ctx, Anonymous, first))
+
+	second := &model.Todo{Title: "Mow lawn"}
+	assert.NoError(t, s.Add(ctx, Anonymous, second))
+
+	changes := []model.FieldChange{{Field: "title", After: []byte(`"Plant tulips"`)}}
+
+	created := &model.Revision{TodoId: first.Id, Action: model.ActionCreated, Changes: changes, Todo: first}
+	assert.NoError(t, s.AddRevision(ctx, Anonymous, created))
+	assert.Equal(t, 1, created.Number)
+	assert.Equal(t, now, created.At)
+
+	assert.NoError(t, s.AddRevision(ctx, Anonymous, &model.Revision{TodoId: second.Id, Action: model.ActionCreated, Todo: second}))
+
+	deleted := &model.Revision{TodoId: first.Id, Action: model.ActionDeleted, Actor: Anonymous, Todo: first}
+	assert.NoError(t, s.AddRevision(ctx, Anonymous, deleted))
+	assert.Equal(t, 2, deleted.Number)
+
+	assert.Equal(t, ErrTodoNotFound, s.AddRevision(ctx, 1, &model.Revision{TodoId: first.Id, Action: model.ActionUpdated, Todo: first}))
+	assert.Equal(t, ErrTodoNotFound, s.AddRevision(ctx, Anonymous, &model.Revision{TodoId: 99, Action: model.ActionUpdated, Todo: first}))
+
+	_, err := s.GetRevisions(ctx, 1, first.Id)
+	assert.Equal(t, ErrTodoNotFound, err)
+
+	setClock(func() time.Time { return now.Add(time.Hour) })
+	assert.NoError(t, s.Delete(ctx, Anonymous, first))
+
+	history, err := s.GetRevisions(ctx, Anonymous, first.Id)
+	if assert.NoError(t, err) && assert.Len(t, history, 2) {
+		assert.Equal(t, []int{1, 2}, []int{history[0].Number, history[1].Number})
+		assert.Equal(t, model.ActionCreated, history[0].Action)
+		assert.Equal(t, changes, history[0].Changes)
+		assert.Equal(t, "Plant tulips", history[0].Todo.Title)
+		assert.Equal(t, model.ActionDeleted, history[1].Action)
+		assert.Equal(t, now, history[1].At)
+	}
+
+	purged, err := s.Purge(ctx, now.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	_, err = s.GetRevisions(ctx, Anonymous, first.Id)
+	assert.Equal(t, ErrTodoNotFound, err)
+
+	history, err = s.GetRevisions(ctx, Anonymous, second.Id)
+	if assert.NoError(t, err) && assert.Len(t, history, 1) {
+		assert.Equal(t, 1, history[0].Number)
+	}
+}
+
+func TestInMemoryStore_Batch(t *testing.T) {
+	testStoreBatch(t, NewInMemoryStore())
+}
+
+// testStoreBatch checks that a batch is applied as a whole and that a failing
+// operation leaves the store as it was, including the next id.
+func testStoreBatch(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	water := &model.Todo{Title: "Water plants"}
+	assert.NoError(t, s.Add(ctx, Anonymous, water))
+
+	mow := &model.Todo{Title: "Mow lawn"}
+	assert.NoError(t, s.Add(ctx, Anonymous, mow))
+
+	results, err := s.Batch(ctx, Anonymous, []model.Operation{
+		{Op: model.OpCreate, Todo: &model.Todo{Title: "Plant tulips"}},
+		{Op: model.OpUpdate, Id: water.Id, Todo: &model.Todo{Title: "Water plants", Completed: true, Version: 1}},
+		{Op: model.OpDelete, Id: mow.Id},
+	})
+	if assert.NoError(t, err) && assert.Len(t, results, 3) {
+		assert.Equal(t, []int{3, water.Id, mow.Id}, []int{results[0].Id, results[1].Id, results[2].Id})
+		assert.Equal(t, []int{1, 2, 1}, []int{results[0].Version, results[1].Version, results[2].Version})
+		assert.True(t, results[1].Completed)
+		assert.NotNil(t, results[2].DeletedAt)
+	}
+
+	tests := []struct {
+		name      string
+		ops       []model.Operation
+		wantErr   error
+		wantIndex int
+	}{
+		{
+			name: "missing todo",
+			ops: []model.Operation{
+				{Op: model.OpCreate, Todo: &model.Todo{Title: "Buy bulbs"}},
+				{Op: model.OpUpdate, Id: 3, Todo: &model.Todo{Title: "Plant daffodils"}},
+				{Op: model.OpUpdate, Id: 99, Todo: &model.Todo{Title: "Missing"}},
+			},
+			wantErr:   ErrTodoNotFound,
+			wantIndex: 2,
+		},
+		{
+			name:      "version conflict",
+			ops:       []model.Operation{{Op: model.OpUpdate, Id: water.Id, Todo: &model.Todo{Title: "Water plants", Version: 1}}},
+			wantErr:   ErrVersionConflict,
+			wantIndex: 0,
+		},
+		{
+			name: "referenced by earlier operation",
+			ops: []model.Operation{
+				{Op: model.OpCreate, Todo: &model.Todo{Title: "Buy bulbs", ParentId: 3}},
+				{Op: model.OpDelete, Id: 3},
+			},
+			wantErr:   ErrTodoReferenced,
+			wantIndex: 1,
+		},
+		{
+			name: "deleted twice",
+			ops: []model.Operation{
+				{Op: model.OpDelete, Id: water.Id},
+				{Op: model.OpDelete, Id: water.Id},
+			},
+			wantErr:   ErrTodoNotFound,
+			wantIndex: 1,
+		},
+		{
+			name:      "unknown list",
+			ops:       []model.Operation{{Op: model.OpCreate, Todo: &model.Todo{Title: "Buy bulbs", ListId: 7}}},
+			wantErr:   ErrListNotFound,
+			wantIndex: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Batch(ctx, Anonymous, tt.ops)
+			assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+
+			var operr *model.OperationError
+			if assert.True(t, errors.As(err, &operr), "got error %v, want operation error", err) {
+				assert.Equal(t, tt.wantIndex, operr.Index)
+			}
+
+			all, err := s.GetAll(ctx, Anonymous)
+			assert.NoError(t, err)
+			assert.Len(t, all, 2)
+
+			stored, err := s.GetById(ctx, Anonymous, 3)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "Plant tulips", stored.Title)
+				assert.Equal(t, 1, stored.Version)
+			}
+		})
+	}
+
+	_, err = s.Batch(ctx, Anonymous, nil)
+	assert.Equal(t, model.ErrEmptyBatch, err)
+
+	next := &model.Todo{Title: "Buy bulbs"}
+	assert.NoError(t, s.Add(ctx, Anonymous, next))
+	assert.Equal(t, 4, next.Id)
+}
+
+func TestInMemoryStore_Context(t *testing.T) {
+	testStoreContext(t, NewInMemoryStore())
+}
+
+// testStoreContext checks that calls with a cancelled context fail with its
+// error and leave the store as it was.
+func testStoreContext(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	water := &model.Todo{Title: "Water plants"}
+	assert.NoError(t, s.Add(ctx, Anonymous, water))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"Add", func() error { return s.Add(cancelled, Anonymous, &model.Todo{Title: "Mow lawn"}) }},
+		{"GetAll", func() error { _, err := s.GetAll(cancelled, Anonymous); return err }},
+		{"Update", func() error {
+			_, err := s.Update(cancelled, Anonymous, water.Id, &model.Todo{Title: "Water roses"})
+			return err
+		}},
+		{"Delete", func() error { return s.Delete(cancelled, Anonymous, water) }},
+		{"Batch", func() error {
+			_, err := s.Batch(cancelled, Anonymous, []model.Operation{{Op: model.OpDelete, Id: water.Id}})
+			return err
+		}},
+		{"AddList", func() error { return s.AddList(cancelled, Anonymous, &model.List{Name: "Garden"}) }},
+		{"Purge", func() error { _, err := s.Purge(cancelled, time.Now().Add(time.Hour)); return err }},
+	}
+	for _, tt := range calls {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			assert.True(t, errors.Is(err, context.Canceled), "got error %v, want %v", err, context.Canceled)
+		})
+	}
+
+	todos, err := s.GetAll(ctx, Anonymous)
+	if assert.NoError(t, err) && assert.Len(t, todos, 1) {
+		assert.Equal(t, "Water plants", todos[0].Title)
+		assert.Equal(t, 1, todos[0].Version)
+	}
+
+	lists, err := s.GetLists(ctx, Anonymous)
+	assert.NoError(t, err)
+	assert.Empty(t, lists)
+}
+
+func TestRunPurger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ims := NewInMemoryStore()
+
+	todo := &model.Todo{Title: "Say hello"}
+	assert.NoError(t, ims.Add(ctx, Anonymous, todo))
+
+	ims.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	assert.NoError(t, ims.Delete(ctx, Anonymous, todo))
+
+	done := make(chan struct{})
+
+	go func() {
+		RunPurger(ctx, ims, time.Minute, time.Millisecond)
+		close(done)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		trash, err := ims.GetTrash(ctx, Anonymous)
+		if err == nil && len(trash) == 0 {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Error("expired todo was not purged")
+}
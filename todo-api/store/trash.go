@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+	"todoapp/model"
+)
+
+func (ims *InMemoryStore) GetTrash(ctx context.Context, owner int) ([]*model.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ims.RLock()
+	defer ims.RUnlock()
+
+	trash := []*model.Todo{}
+	for id, todo := range ims.todoMap {
+		if ims.owners[id] == owner && todo.DeletedAt != nil {
+			trash = append(trash, todo)
+		}
+	}
+
+	sortTrash(trash)
+
+	return trash, nil
+}
+
+func (ims *InMemoryStore) Restore(ctx context.Context, owner int, id int) (*model.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ims.Lock()
+	defer ims.Unlock()
+
+	current, err := ims.lookupTrashed(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := ims.restored(owner, current, ims.now())
+	if err != nil {
+		return nil, err
+	}
+
+	ims.todoMap[id] = restored
+
+	return restored, nil
+}
+
+func (ims *InMemoryStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	ims.Lock()
+	defer ims.Unlock()
+
+	purged := 0
+	for id, todo := range ims.todoMap {
+		if todo.DeletedAt != nil && todo.DeletedAt.Before(before) {
+			delete(ims.todoMap, id)
+			delete(ims.owners, id)
+			delete(ims.revisions, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// lookupTrashed returns the todo with the given id if it belongs to owner and
+// is in the trash, callers must hold the lock.
+func (ims *InMemoryStore) lookupTrashed(owner int, id int) (*model.Todo, error) {
+	todo, ok := ims.todoMap[id]
+	if !ok || ims.owners[id] != owner || todo.DeletedAt == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	return todo, nil
+}
+
+// restored returns a copy of the trashed todo taken out of the trash, callers
+// must hold the lock.
+func (ims *InMemoryStore) restored(owner int, todo *model.Todo, now time.Time) (*model.Todo, error) {
+	restored := *todo
+	restored.DeletedAt = nil
+
+	if ims.checkList(owner, restored.ListId) != nil {
+		restored.ListId = 0
+	}
+
+	if err := model.CheckRelations(restored.Id, &restored, ims.lookupFunc(owner)); err != nil {
+		return nil, err
+	}
+
+	restored.Version++
+	restored.UpdatedAt = now.UTC()
+
+	return &restored, nil
+}
+
+// expired returns the ids of the todos moved to the trash before the given
+// time.
+func (ims *InMemoryStore) expired(before time.Time) []int {
+	ims.RLock()
+	defer ims.RUnlock()
+
+	var ids []int
+	for id, todo := range ims.todoMap {
+		if todo.DeletedAt != nil && todo.DeletedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+// trashed returns a copy of todo moved to the trash at now. Neither version
+// nor update time change, restoring the todo counts as its next write.
+func trashed(todo *model.Todo, now time.Time) *model.Todo {
+	now = now.UTC()
+
+	deleted := *todo
+	deleted.DeletedAt = &now
+
+	return &deleted
+}
+
+// sortTrash orders todos by deletion time, the most recent first.
+func sortTrash(todos []*model.Todo) {
+	sort.Slice(todos, func(i, j int) bool {
+		if !todos[i].DeletedAt.Equal(*todos[j].DeletedAt) {
+			return todos[i].DeletedAt.After(*todos[j].DeletedAt)
+		}
+
+		return todos[i].Id < todos[j].Id
+	})
+}
+
+// RunPurger purges the todos that have been in the trash of s for longer than
+// retention every interval until ctx is done.
+func RunPurger(ctx context.Context, s Store, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.Purge(ctx, time.Now().Add(-retention))
+		switch {
+		case err != nil:
+			log.Printf("store: purging trash: %v", err)
+		case purged > 0:
+			log.Printf("store: purged %d todos from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
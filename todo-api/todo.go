@@ -1,11 +1,17 @@
 package todoapp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"todoapp/model"
 	"todoapp/store"
 )
 
+// maxPatchAttempts bounds how often an unconditional patch is reapplied when
+// it races with another write to the same todo.
+const maxPatchAttempts = 3
+
 type TodoApp struct {
 	backend store.Store
 }
@@ -16,50 +22,178 @@ func New(backendStore store.Store) *TodoApp {
 	}
 }
 
-func (t *TodoApp) GetTodo(index int) (*model.Todo, error) {
-	todo, err := t.backend.GetById(index)
+func (t *TodoApp) GetTodo(ctx context.Context, owner int, index int) (*model.Todo, error) {
+	todo, err := t.backend.GetById(ctx, owner, index)
 	if err != nil {
-		if err == store.ErrTodoNotFound {
-			return nil, err
-		}
-
-		return nil, fmt.Errorf("unexpected error from backend: %v", err)
+		return nil, backendError("get todo", err)
 	}
 
 	return todo, nil
 }
 
-func (t *TodoApp) GetTodos() ([]*model.Todo, error) {
-	todos, err := t.backend.GetAll()
+func (t *TodoApp) GetTodos(ctx context.Context, owner int) ([]*model.Todo, error) {
+	todos, err := t.backend.GetAll(ctx, owner)
 	if err != nil {
-		return nil, fmt.Errorf("get all todos: %v", err)
+		return nil, backendError("get all todos", err)
 	}
 
 	return todos, nil
 }
 
-func (t *TodoApp) SaveTodo(todo *model.Todo) error {
+// QueryTodos returns the page of todos selected by q along with the total
+// number of todos matching its filters.
+func (t *TodoApp) QueryTodos(ctx context.Context, owner int, q model.Query) ([]*model.Todo, int, error) {
+	todos, total, err := t.backend.Query(ctx, owner, q)
+	if err != nil {
+		return nil, 0, backendError("query todos", err)
+	}
+
+	return todos, total, nil
+}
+
+// SaveTodo adds todo, a completed todo must not be blocked by open todos.
+func (t *TodoApp) SaveTodo(ctx context.Context, owner int, todo *model.Todo) error {
 	if err := todo.IsValid(); err != nil {
-		return fmt.Errorf("save todo: %v", err)
+		return err
+	}
+
+	if todo.Completed {
+		if err := t.checkBlockers(ctx, owner, todo); err != nil {
+			return err
+		}
 	}
 
-	err := t.backend.Add(todo)
+	err := t.backend.Add(ctx, owner, todo)
 	if err != nil {
-		return fmt.Errorf("save todo: %v", err)
+		return backendError("save todo", err)
+	}
+
+	t.record(ctx, owner, &model.Revision{Action: model.ActionCreated}, nil, todo)
+
+	if todo.Completed {
+		t.completeParents(ctx, owner, todo)
 	}
 
 	return nil
 }
 
-func (t *TodoApp) UpdateTodo(id int, todo *model.Todo) (*model.Todo, error) {
+// UpdateTodo replaces the todo with the given id. Completing it requires its
+// blockers to be completed, adds the next occurrence of a recurring todo and
+// may complete its parents, see model.Todo.AutoComplete.
+func (t *TodoApp) UpdateTodo(ctx context.Context, owner int, id int, todo *model.Todo) (*model.Todo, error) {
 	if err := todo.IsValid(); err != nil {
-		return nil, fmt.Errorf("save todo: %v", err)
+		return nil, err
 	}
 
-	updatedTodo, err := t.backend.Update(id, todo)
+	current, err := t.backend.GetById(ctx, owner, id)
 	if err != nil {
-		return nil, fmt.Errorf("save todo: %v", err)
+		return nil, backendError("get todo", err)
+	}
+
+	return t.update(ctx, owner, current, todo, &model.Revision{Action: model.ActionUpdated})
+}
+
+// update replaces current with the already validated todo and records rev
+// for the write.
+func (t *TodoApp) update(ctx context.Context, owner int, current *model.Todo, todo *model.Todo, rev *model.Revision) (*model.Todo, error) {
+	var next *model.Todo
+
+	completing := todo.Completed && !current.Completed
+	if completing {
+		if err := t.checkBlockers(ctx, owner, todo); err != nil {
+			return nil, err
+		}
+
+		todo, next = takeRecurrence(todo)
+	}
+
+	updatedTodo, err := t.backend.Update(ctx, owner, current.Id, todo)
+	if err != nil {
+		return nil, backendError("update todo", err)
+	}
+
+	t.record(ctx, owner, rev, current, updatedTodo)
+
+	if completing {
+		t.scheduleNext(ctx, owner, updatedTodo.Id, next)
+		t.completeParents(ctx, owner, updatedTodo)
 	}
 
 	return updatedTodo, nil
 }
+
+// PatchTodo applies patch to the stored todo with the given id. The patched
+// todo is validated like any other update before it is saved. A non-zero
+// version makes the patch conditional on the todo still being at that version,
+// otherwise the patch is retried on top of concurrent writes.
+func (t *TodoApp) PatchTodo(ctx context.Context, owner int, id int, version int, patch model.Patch) (*model.Todo, error) {
+	for attempt := 1; ; attempt++ {
+		current, err := t.backend.GetById(ctx, owner, id)
+		if err != nil {
+			return nil, backendError("get todo", err)
+		}
+
+		if version != 0 && current.Version != version {
+			return nil, store.ErrVersionConflict
+		}
+
+		patched, err := patch.Apply(current)
+		if err != nil {
+			if errors.Is(err, model.ErrInvalidPatch) || errors.Is(err, model.ErrPatchTestFailed) {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("patch todo: %w", err)
+		}
+
+		patched.Version = current.Version
+
+		if err := patched.IsValid(); err != nil {
+			return nil, err
+		}
+
+		updatedTodo, err := t.update(ctx, owner, current, patched, &model.Revision{Action: model.ActionUpdated})
+		if errors.Is(err, store.ErrVersionConflict) && version == 0 && attempt < maxPatchAttempts {
+			continue
+		}
+
+		return updatedTodo, err
+	}
+}
+
+func (t *TodoApp) DeleteTodo(ctx context.Context, owner int, id int) error {
+	todo, err := t.backend.GetById(ctx, owner, id)
+	if err != nil {
+		return backendError("get todo", err)
+	}
+
+	err = t.backend.Delete(ctx, owner, todo)
+	if err != nil {
+		return backendError("delete todo", err)
+	}
+
+	t.record(ctx, owner, &model.Revision{Action: model.ActionDeleted}, todo, nil)
+
+	return nil
+}
+
+// backendError adds op as context to an unexpected error of the backend.
+// Errors describing the todo itself, like store.ErrTodoNotFound or a failed
+// validation, are returned unchanged so they read the same at every layer.
+func backendError(op string, err error) error {
+	switch {
+	case errors.Is(err, store.ErrTodoNotFound),
+		errors.Is(err, store.ErrVersionConflict),
+		errors.Is(err, store.ErrListNotFound),
+		errors.Is(err, store.ErrListNotEmpty),
+		errors.Is(err, store.ErrRevisionNotFound),
+		errors.Is(err, store.ErrTodoReferenced),
+		errors.Is(err, model.ErrInvalidTodo),
+		errors.Is(err, model.ErrNilTodo),
+		errors.Is(err, model.ErrInvalidList),
+		errors.Is(err, model.ErrNilList):
+		return err
+	default:
+		return fmt.Errorf("%s: %w", op, err)
+	}
+}
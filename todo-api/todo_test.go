@@ -1,15 +1,24 @@
 package todoapp_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 	"todoapp"
 	"todoapp/model"
 	"todoapp/store"
+	"todoapp/transfer"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestTodoApp_GetTodo(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name    string
 		todo    *model.Todo
@@ -48,13 +57,13 @@ func TestTodoApp_GetTodo(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ta := todoapp.New(store.NewInMemoryStore())
 
-			err := ta.SaveTodo(tt.todo)
+			err := ta.SaveTodo(ctx, store.Anonymous, tt.todo)
 			if err != nil {
 				t.Errorf("Saving todo item failed: %v", err)
 				return
 			}
 
-			got, err := ta.GetTodo(tt.getID)
+			got, err := ta.GetTodo(ctx, store.Anonymous, tt.getID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TodoApp.GetTodo() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -70,6 +79,8 @@ func TestTodoApp_GetTodo(t *testing.T) {
 }
 
 func TestTodoApp_SaveTodo(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name    string
 		todos   []*model.Todo
@@ -103,7 +114,7 @@ func TestTodoApp_SaveTodo(t *testing.T) {
 			ta := todoapp.New(store.NewInMemoryStore())
 
 			for _, todo := range tt.todos {
-				err := ta.SaveTodo(todo)
+				err := ta.SaveTodo(ctx, store.Anonymous, todo)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("SaveTodo(%v) error=%v, wantErr=%t", todo, err, tt.wantErr)
 					return
@@ -114,7 +125,7 @@ func TestTodoApp_SaveTodo(t *testing.T) {
 				}
 			}
 
-			allTodos, err := ta.GetTodos()
+			allTodos, err := ta.GetTodos(ctx, store.Anonymous)
 			if err != nil {
 				t.Errorf("GetTodos() failed: %v", err)
 				return
@@ -122,7 +133,7 @@ func TestTodoApp_SaveTodo(t *testing.T) {
 
 			assert.Equal(t, len(allTodos), len(tt.todos))
 
-			got, err := ta.GetTodo(1)
+			got, err := ta.GetTodo(ctx, store.Anonymous, 1)
 			if err != nil {
 				t.Errorf("GetTodo() failed: %v", err)
 				return
@@ -134,6 +145,8 @@ func TestTodoApp_SaveTodo(t *testing.T) {
 }
 
 func TestTodoApp_GetTodos(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name  string
 		todos []*model.Todo
@@ -157,14 +170,14 @@ func TestTodoApp_GetTodos(t *testing.T) {
 			ta := todoapp.New(store.NewInMemoryStore())
 
 			for _, todo := range tt.todos {
-				err := ta.SaveTodo(todo)
+				err := ta.SaveTodo(ctx, store.Anonymous, todo)
 				if err != nil {
 					t.Errorf("SaveTodo(%v) failed: %v", todo, err)
 					return
 				}
 			}
 
-			allTodos, err := ta.GetTodos()
+			allTodos, err := ta.GetTodos(ctx, store.Anonymous)
 			if err != nil {
 				t.Errorf("GetTodos() failed: %v", err)
 				return
@@ -179,7 +192,7 @@ func TestTodoApp_GetTodos(t *testing.T) {
 				assert.Equal(t, todo, allTodos[i])
 			}
 
-			got, err := ta.GetTodo(1)
+			got, err := ta.GetTodo(ctx, store.Anonymous, 1)
 			if err != nil {
 				t.Errorf("GetTodo() failed: %v", err)
 				return
@@ -191,6 +204,8 @@ func TestTodoApp_GetTodos(t *testing.T) {
 }
 
 func TestTodoApp_UpdateTodo(t *testing.T) {
+	ctx := context.Background()
+
 	tests := []struct {
 		name       string
 		addTodos   []*model.Todo
@@ -254,14 +269,14 @@ func TestTodoApp_UpdateTodo(t *testing.T) {
 			ta := todoapp.New(store.NewInMemoryStore())
 
 			for _, addTodo := range tt.addTodos {
-				err := ta.SaveTodo(addTodo)
+				err := ta.SaveTodo(ctx, store.Anonymous, addTodo)
 				if err != nil {
 					t.Errorf("Adding todos failed: %v", err)
 					return
 				}
 			}
 
-			updatedTodo, err := ta.UpdateTodo(tt.updateId, tt.updateTodo)
+			updatedTodo, err := ta.UpdateTodo(ctx, store.Anonymous, tt.updateId, tt.updateTodo)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("SaveTodo(%d, %v) error=%v, wantErr=%t", tt.updateId, tt.updateTodo, err, tt.wantErr)
 				return
@@ -275,7 +290,7 @@ func TestTodoApp_UpdateTodo(t *testing.T) {
 
 			assert.Equal(t, updatedTodo, tt.updateTodo)
 
-			allTodos, err := ta.GetTodos()
+			allTodos, err := ta.GetTodos(ctx, store.Anonymous)
 			if err != nil {
 				t.Errorf("GetTodos() failed: %v", err)
 				return
@@ -283,7 +298,7 @@ func TestTodoApp_UpdateTodo(t *testing.T) {
 
 			assert.Equal(t, len(allTodos), len(tt.addTodos))
 
-			updatedTodoInStore, err := ta.GetTodo(tt.updateId)
+			updatedTodoInStore, err := ta.GetTodo(ctx, store.Anonymous, tt.updateId)
 			if err != nil {
 				t.Errorf("GetTodo() failed: %v", err)
 				return
@@ -293,3 +308,764 @@ func TestTodoApp_UpdateTodo(t *testing.T) {
 		})
 	}
 }
+
+func TestTodoApp_DeleteTodo(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		addTodos   []*model.Todo
+		deleteId   int
+		wantErr    error
+		wantLength int
+	}{
+		{
+			name: "Delete existing todo",
+			addTodos: []*model.Todo{
+				{Title: "Say hello", Completed: true},
+			},
+			deleteId:   1,
+			wantErr:    nil,
+			wantLength: 0,
+		},
+		{
+			name: "Delete second of three",
+			addTodos: []*model.Todo{
+				{Title: "First", Completed: false},
+				{Title: "Second", Completed: false},
+				{Title: "Third", Completed: false},
+			},
+			deleteId:   2,
+			wantErr:    nil,
+			wantLength: 2,
+		},
+		{
+			name: "Delete non-existent todo",
+			addTodos: []*model.Todo{
+				{Title: "Say hello", Completed: true},
+			},
+			deleteId:   8,
+			wantErr:    store.ErrTodoNotFound,
+			wantLength: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ta := todoapp.New(store.NewInMemoryStore())
+
+			for _, addTodo := range tt.addTodos {
+				err := ta.SaveTodo(ctx, store.Anonymous, addTodo)
+				if err != nil {
+					t.Errorf("Adding todos failed: %v", err)
+					return
+				}
+			}
+
+			err := ta.DeleteTodo(ctx, store.Anonymous, tt.deleteId)
+			assert.Equal(t, tt.wantErr, err)
+
+			allTodos, err := ta.GetTodos(ctx, store.Anonymous)
+			if err != nil {
+				t.Errorf("GetTodos() failed: %v", err)
+				return
+			}
+
+			assert.Equal(t, tt.wantLength, len(allTodos))
+
+			_, err = ta.GetTodo(ctx, store.Anonymous, tt.deleteId)
+			assert.Equal(t, store.ErrTodoNotFound, err)
+		})
+	}
+}
+
+func TestTodoApp_PatchTodo(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		addTodos []*model.Todo
+		patchId  int
+		version  int
+		patch    model.Patch
+		want     *model.Todo
+		wantErr  bool
+		wantIs   error
+	}{
+		{
+			name: "Complete with merge patch",
+			addTodos: []*model.Todo{
+				{Title: "First", Completed: false},
+				{Title: "Second", Completed: false},
+			},
+			patchId: 2,
+			patch:   model.MergePatch(`{"completed":true}`),
+			want:    &model.Todo{Id: 2, Title: "Second", Completed: true, Version: 2},
+		},
+		{
+			name: "Rename with json patch",
+			addTodos: []*model.Todo{
+				{Title: "First", Completed: true},
+			},
+			patchId: 1,
+			patch:   model.JSONPatch(`[{"op":"replace","path":"/title","value":"Renamed"}]`),
+			want:    &model.Todo{Id: 1, Title: "Renamed", Completed: true, Version: 2},
+		},
+		{
+			name: "Ignore todoID",
+			addTodos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId: 1,
+			patch:   model.MergePatch(`{"id":8}`),
+			want:    &model.Todo{Id: 1, Title: "First", Version: 2},
+		},
+		{
+			name: "Matching version",
+			addTodos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId: 1,
+			version: 1,
+			patch:   model.MergePatch(`{"completed":true,"version":7}`),
+			want:    &model.Todo{Id: 1, Title: "First", Completed: true, Version: 2},
+		},
+		{
+			name: "Stale version",
+			addTodos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId: 1,
+			version: 3,
+			patch:   model.MergePatch(`{"completed":true}`),
+			wantErr: true,
+			wantIs:  store.ErrVersionConflict,
+		},
+		{
+			name: "Patch non-existent todo",
+			addTodos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId: 8,
+			patch:   model.MergePatch(`{"completed":true}`),
+			wantErr: true,
+			wantIs:  store.ErrTodoNotFound,
+		},
+		{
+			name: "Invalid patch",
+			addTodos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId: 1,
+			patch:   model.JSONPatch(`[{"op":"remove","path":"/missing"}]`),
+			wantErr: true,
+			wantIs:  model.ErrInvalidPatch,
+		},
+		{
+			name: "Result is validated",
+			addTodos: []*model.Todo{
+				{Title: "First"},
+			},
+			patchId: 1,
+			patch:   model.MergePatch(`{"title":""}`),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ta := todoapp.New(store.NewInMemoryStore())
+
+			for _, addTodo := range tt.addTodos {
+				err := ta.SaveTodo(ctx, store.Anonymous, addTodo)
+				if err != nil {
+					t.Errorf("Adding todos failed: %v", err)
+					return
+				}
+			}
+
+			patched, err := ta.PatchTodo(ctx, store.Anonymous, tt.patchId, tt.version, tt.patch)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PatchTodo(%d) error=%v, wantErr=%t", tt.patchId, err, tt.wantErr)
+				return
+			}
+
+			if tt.wantIs != nil {
+				assert.True(t, errors.Is(err, tt.wantIs), "got error %v, want %v", err, tt.wantIs)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			stored, err := ta.GetTodo(ctx, store.Anonymous, tt.patchId)
+			if assert.NoError(t, err) {
+				assert.Equal(t, patched, stored)
+			}
+
+			patched.CreatedAt, patched.UpdatedAt, patched.CompletedAt = time.Time{}, time.Time{}, nil
+			assert.Equal(t, tt.want, patched)
+		})
+	}
+}
+
+func TestTodoApp_QueryTodos(t *testing.T) {
+	ctx := context.Background()
+
+	ta := todoapp.New(store.NewInMemoryStore())
+
+	for _, todo := range []*model.Todo{
+		{Title: "Say hello", Completed: true},
+		{Title: "Say goodbye"},
+		{Title: "Wave"},
+	} {
+		err := ta.SaveTodo(ctx, store.Anonymous, todo)
+		if err != nil {
+			t.Errorf("SaveTodo(%v) failed: %v", todo, err)
+			return
+		}
+	}
+
+	open := false
+	todos, total, err := ta.QueryTodos(ctx, store.Anonymous, model.Query{
+		Completed: &open,
+		Sort:      []model.SortKey{{Field: model.SortFieldTitle, Desc: true}},
+		Limit:     1,
+	})
+	if err != nil {
+		t.Errorf("QueryTodos() failed: %v", err)
+		return
+	}
+
+	assert.Equal(t, 2, total)
+	if assert.Equal(t, 1, len(todos)) {
+		assert.Equal(t, 3, todos[0].Id)
+		assert.Equal(t, "Wave", todos[0].Title)
+	}
+}
+
+// failingStore fails every call with err.
+type failingStore struct {
+	err error
+}
+
+func (fs failingStore) Add(context.Context, int, *model.Todo) error            { return fs.err }
+func (fs failingStore) GetById(context.Context, int, int) (*model.Todo, error) { return nil, fs.err }
+func (fs failingStore) GetAll(context.Context, int) ([]*model.Todo, error)     { return nil, fs.err }
+func (fs failingStore) Delete(context.Context, int, *model.Todo) error         { return fs.err }
+func (fs failingStore) Update(context.Context, int, int, *model.Todo) (*model.Todo, error) {
+	return nil, fs.err
+}
+func (fs failingStore) Query(context.Context, int, model.Query) ([]*model.Todo, int, error) {
+	return nil, 0, fs.err
+}
+func (fs failingStore) GetTrash(context.Context, int) ([]*model.Todo, error)    { return nil, fs.err }
+func (fs failingStore) Restore(context.Context, int, int) (*model.Todo, error)  { return nil, fs.err }
+func (fs failingStore) Purge(context.Context, time.Time) (int, error)           { return 0, fs.err }
+func (fs failingStore) AddRevision(context.Context, int, *model.Revision) error { return fs.err }
+func (fs failingStore) Batch(context.Context, int, []model.Operation) ([]*model.Todo, error) {
+	return nil, fs.err
+}
+func (fs failingStore) GetRevisions(context.Context, int, int) ([]*model.Revision, error) {
+	return nil, fs.err
+}
+func (fs failingStore) AddList(context.Context, int, *model.List) error           { return fs.err }
+func (fs failingStore) GetList(context.Context, int, int) (*model.List, error)    { return nil, fs.err }
+func (fs failingStore) GetLists(context.Context, int) ([]*model.List, error)      { return nil, fs.err }
+func (fs failingStore) DeleteList(context.Context, int, int, model.Cascade) error { return fs.err }
+func (fs failingStore) UpdateList(context.Context, int, int, *model.List) (*model.List, error) {
+	return nil, fs.err
+}
+
+func TestTodoApp_BackendErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"Not found", store.ErrTodoNotFound},
+		{"Version conflict", store.ErrVersionConflict},
+		{"Unavailable", fmt.Errorf("select todo: %w: connection refused", store.ErrUnavailable)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ta := todoapp.New(failingStore{err: tt.err})
+
+			calls := map[string]func() error{
+				"GetTodo": func() error {
+					_, err := ta.GetTodo(ctx, store.Anonymous, 1)
+					return err
+				},
+				"GetTodos": func() error {
+					_, err := ta.GetTodos(ctx, store.Anonymous)
+					return err
+				},
+				"QueryTodos": func() error {
+					_, _, err := ta.QueryTodos(ctx, store.Anonymous, model.Query{})
+					return err
+				},
+				"SaveTodo": func() error {
+					return ta.SaveTodo(ctx, store.Anonymous, &model.Todo{Title: "Say hello"})
+				},
+				"UpdateTodo": func() error {
+					_, err := ta.UpdateTodo(ctx, store.Anonymous, 1, &model.Todo{Title: "Say hello"})
+					return err
+				},
+				"PatchTodo": func() error {
+					_, err := ta.PatchTodo(ctx, store.Anonymous, 1, 0, model.MergePatch(`{"completed":true}`))
+					return err
+				},
+				"DeleteTodo": func() error {
+					return ta.DeleteTodo(ctx, store.Anonymous, 1)
+				},
+				"GetTrash": func() error {
+					_, err := ta.GetTrash(ctx, store.Anonymous)
+					return err
+				},
+				"RestoreTodo": func() error {
+					_, err := ta.RestoreTodo(ctx, store.Anonymous, 1)
+					return err
+				},
+				"GetHistory": func() error {
+					_, err := ta.GetHistory(ctx, store.Anonymous, 1)
+					return err
+				},
+				"RevertTodo": func() error {
+					_, err := ta.RevertTodo(ctx, store.Anonymous, 1, 1)
+					return err
+				},
+				"BatchTodos": func() error {
+					_, err := ta.BatchTodos(ctx, store.Anonymous, []model.Operation{{Op: model.OpDelete, Id: 1}})
+					return err
+				},
+			}
+
+			for name, call := range calls {
+				err := call()
+				assert.True(t, errors.Is(err, tt.err), "%s: got error %v, want %v", name, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTodoApp_UpdateMissingTodo(t *testing.T) {
+	ctx := context.Background()
+
+	ta := todoapp.New(store.NewInMemoryStore())
+
+	_, err := ta.UpdateTodo(ctx, store.Anonymous, 8, &model.Todo{Title: "noop"})
+	assert.Equal(t, store.ErrTodoNotFound, err)
+}
+
+func TestTodoApp_CompleteParents(t *testing.T) {
+	ctx := context.Background()
+
+	ta := todoapp.New(store.NewInMemoryStore())
+
+	project := &model.Todo{Title: "Move house", AutoComplete: true}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, project))
+
+	manual := &model.Todo{Title: "Pack", ParentId: project.Id}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, manual))
+
+	auto := &model.Todo{Title: "Clean", ParentId: project.Id, AutoComplete: true}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, auto))
+
+	// Completing the only subtask of a manual todo leaves it open.
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, &model.Todo{Title: "Tape boxes", ParentId: manual.Id, Completed: true}))
+
+	kitchen := &model.Todo{Title: "Kitchen", ParentId: auto.Id}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, kitchen))
+
+	_, err := ta.PatchTodo(ctx, store.Anonymous, kitchen.Id, 0, model.MergePatch(`{"completed":true}`))
+	assert.NoError(t, err)
+
+	for id, want := range map[int]bool{project.Id: false, manual.Id: false, auto.Id: true} {
+		todo, err := ta.GetTodo(ctx, store.Anonymous, id)
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, todo.Completed, "todo %d", id)
+		}
+	}
+
+	_, err = ta.PatchTodo(ctx, store.Anonymous, manual.Id, 0, model.MergePatch(`{"completed":true}`))
+	assert.NoError(t, err)
+
+	stored, err := ta.GetTodo(ctx, store.Anonymous, project.Id)
+	if assert.NoError(t, err) {
+		assert.True(t, stored.Completed)
+	}
+}
+
+func TestTodoApp_CompleteBlockedTodo(t *testing.T) {
+	ctx := context.Background()
+
+	ta := todoapp.New(store.NewInMemoryStore())
+
+	blocker := &model.Todo{Title: "Get keys"}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, blocker))
+
+	err := ta.SaveTodo(ctx, store.Anonymous, &model.Todo{Title: "Open door", Completed: true, BlockedBy: []int{blocker.Id}})
+	assert.True(t, errors.Is(err, todoapp.ErrBlocked), "got error %v, want %v", err, todoapp.ErrBlocked)
+
+	blocked := &model.Todo{Title: "Open door", BlockedBy: []int{blocker.Id}}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, blocked))
+
+	_, err = ta.PatchTodo(ctx, store.Anonymous, blocked.Id, 0, model.MergePatch(`{"completed":true}`))
+	assert.True(t, errors.Is(err, todoapp.ErrBlocked), "got error %v, want %v", err, todoapp.ErrBlocked)
+
+	_, err = ta.PatchTodo(ctx, store.Anonymous, blocker.Id, 0, model.MergePatch(`{"completed":true}`))
+	assert.NoError(t, err)
+
+	_, err = ta.PatchTodo(ctx, store.Anonymous, blocked.Id, 0, model.MergePatch(`{"completed":true}`))
+	assert.NoError(t, err)
+
+	blockers, err := ta.GetBlockers(ctx, store.Anonymous, blocked.Id)
+	if assert.NoError(t, err) && assert.Len(t, blockers, 1) {
+		assert.Equal(t, blocker.Id, blockers[0].Id)
+	}
+}
+
+func TestTodoApp_RecurringTodo(t *testing.T) {
+	ctx := context.Background()
+
+	ta := todoapp.New(store.NewInMemoryStore())
+
+	due := time.Date(2026, time.October, 19, 18, 0, 0, 0, time.UTC)
+	chore := &model.Todo{Title: "Take out the trash", Due: &due, Recurrence: "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=2"}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, chore))
+
+	_, err := ta.PatchTodo(ctx, store.Anonymous, chore.Id, 0, model.MergePatch(`{"title":"Take out the bins"}`))
+	assert.NoError(t, err)
+
+	_, err = ta.PatchTodo(ctx, store.Anonymous, chore.Id, 0, model.MergePatch(`{"completed":true}`))
+	assert.NoError(t, err)
+
+	open := false
+	todos, _, err := ta.QueryTodos(ctx, store.Anonymous, model.Query{Completed: &open})
+	if !assert.NoError(t, err) || !assert.Len(t, todos, 1) {
+		return
+	}
+
+	next := todos[0]
+	assert.Equal(t, "Take out the bins", next.Title)
+	assert.Equal(t, due.AddDate(0, 0, 3), *next.Due)
+	assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=1", next.Recurrence)
+
+	// The rule moved on to the next occurrence, so reopening and completing
+	// the first one again schedules nothing.
+	_, err = ta.PatchTodo(ctx, store.Anonymous, chore.Id, 0, model.MergePatch(`{"completed":false}`))
+	assert.NoError(t, err)
+
+	done, err := ta.PatchTodo(ctx, store.Anonymous, chore.Id, 0, model.MergePatch(`{"completed":true}`))
+	if assert.NoError(t, err) {
+		assert.Empty(t, done.Recurrence)
+	}
+
+	todos, _, err = ta.QueryTodos(ctx, store.Anonymous, model.Query{Completed: &open})
+	assert.NoError(t, err)
+	assert.Len(t, todos, 1)
+
+	// Editing a completed occurrence schedules nothing, the last one ends the
+	// series.
+	_, err = ta.PatchTodo(ctx, store.Anonymous, chore.Id, 0, model.MergePatch(`{"title":"Take out all bins"}`))
+	assert.NoError(t, err)
+
+	_, err = ta.PatchTodo(ctx, store.Anonymous, next.Id, 0, model.MergePatch(`{"completed":true}`))
+	assert.NoError(t, err)
+
+	todos, err = ta.GetTodos(ctx, store.Anonymous)
+	assert.NoError(t, err)
+	assert.Len(t, todos, 2)
+}
+
+func TestTodoApp_RecurringTodoBatch(t *testing.T) {
+	ctx := context.Background()
+
+	ta := todoapp.New(store.NewInMemoryStore())
+
+	due := time.Date(2026, time.October, 19, 18, 0, 0, 0, time.UTC)
+	chore := &model.Todo{Title: "Water plants", Due: &due, Recurrence: "FREQ=DAILY"}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, chore))
+
+	completed := *chore
+	completed.Completed = true
+	completed.Version = 0
+
+	// Reopening replaces the todo as completing it left it, without the rule.
+	reopened := completed
+	reopened.Completed = false
+	reopened.Recurrence = ""
+
+	recompleted := reopened
+	recompleted.Completed = true
+
+	for idx, todo := range []*model.Todo{&completed, &reopened, &recompleted} {
+		results, err := ta.BatchTodos(ctx, store.Anonymous, []model.Operation{{Op: model.OpUpdate, Id: chore.Id, Todo: todo}})
+		if assert.NoError(t, err) && idx == 0 {
+			assert.Empty(t, results[0].Recurrence)
+		}
+	}
+
+	// The todos of the operations are left as they were.
+	assert.Equal(t, "FREQ=DAILY", completed.Recurrence)
+
+	open := false
+	todos, _, err := ta.QueryTodos(ctx, store.Anonymous, model.Query{Completed: &open})
+	if assert.NoError(t, err) && assert.Len(t, todos, 1) {
+		assert.Equal(t, due.AddDate(0, 0, 1), *todos[0].Due)
+	}
+}
+
+func TestTodoApp_History(t *testing.T) {
+	ctx := context.Background()
+
+	ta := todoapp.New(store.NewInMemoryStore())
+
+	todo := &model.Todo{Title: "Plant tulips"}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, todo))
+
+	_, err := ta.PatchTodo(ctx, store.Anonymous, todo.Id, 0, model.MergePatch(`{"title":"Plant daffodils","priority":1}`))
+	assert.NoError(t, err)
+
+	assert.NoError(t, ta.DeleteTodo(ctx, store.Anonymous, todo.Id))
+
+	_, err = ta.RestoreTodo(ctx, store.Anonymous, todo.Id)
+	assert.NoError(t, err)
+
+	reverted, err := ta.RevertTodo(ctx, store.Anonymous, todo.Id, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Plant tulips", reverted.Title)
+		assert.Equal(t, 0, reverted.Priority)
+		assert.Equal(t, 4, reverted.Version)
+	}
+
+	_, err = ta.RevertTodo(ctx, store.Anonymous, todo.Id, 9)
+	assert.Equal(t, store.ErrRevisionNotFound, err)
+
+	history, err := ta.GetHistory(ctx, store.Anonymous, todo.Id)
+	if !assert.NoError(t, err) || !assert.Len(t, history, 5) {
+		return
+	}
+
+	actions := make([]model.Action, len(history))
+	for i, rev := range history {
+		actions[i] = rev.Action
+		assert.Equal(t, i+1, rev.Number)
+		assert.Equal(t, store.Anonymous, rev.Actor)
+	}
+
+	assert.Equal(t, []model.Action{
+		model.ActionCreated, model.ActionUpdated, model.ActionDeleted, model.ActionRestored, model.ActionReverted,
+	}, actions)
+
+	assert.Equal(t, []model.FieldChange{
+		{Field: "priority", After: []byte(`1`)},
+		{Field: "title", Before: []byte(`"Plant tulips"`), After: []byte(`"Plant daffodils"`)},
+	}, history[1].Changes)
+	assert.Equal(t, "Plant daffodils", history[2].Todo.Title)
+	assert.Equal(t, 1, history[4].Reverts)
+	assert.Equal(t, []model.FieldChange{
+		{Field: "priority", Before: []byte(`1`)},
+		{Field: "title", Before: []byte(`"Plant daffodils"`), After: []byte(`"Plant tulips"`)},
+	}, history[4].Changes)
+
+	// Writes made on the side are recorded for the todos they change.
+	project := &model.Todo{Title: "Garden", AutoComplete: true}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, project))
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, &model.Todo{Title: "Weed", ParentId: project.Id, Completed: true}))
+
+	history, err = ta.GetHistory(ctx, store.Anonymous, project.Id)
+	if assert.NoError(t, err) && assert.Len(t, history, 2) {
+		assert.Equal(t, model.ActionUpdated, history[1].Action)
+		assert.Equal(t, []model.FieldChange{{Field: "completed", After: []byte(`true`)}}, history[1].Changes)
+	}
+}
+
+func TestTodoApp_DeleteListHistory(t *testing.T) {
+	ctx := context.Background()
+
+	// A deleted todo is recorded as it was, a detached one as it is now.
+	tests := []struct {
+		cascade     model.Cascade
+		wantAction  model.Action
+		wantVersion int
+		wantListId  int
+	}{
+		{model.CascadeDelete, model.ActionDeleted, 1, 1},
+		{model.CascadeDetach, model.ActionUpdated, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.cascade), func(t *testing.T) {
+			ta := todoapp.New(store.NewInMemoryStore())
+
+			list := &model.List{Name: "Garden"}
+			assert.NoError(t, ta.SaveList(ctx, store.Anonymous, list))
+
+			todo := &model.Todo{Title: "Plant tulips", ListId: list.Id}
+			assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, todo))
+
+			assert.NoError(t, ta.DeleteList(ctx, store.Anonymous, list.Id, tt.cascade))
+
+			history, err := ta.GetHistory(ctx, store.Anonymous, todo.Id)
+			if assert.NoError(t, err) && assert.Len(t, history, 2) {
+				assert.Equal(t, tt.wantAction, history[1].Action)
+				assert.Equal(t, tt.wantVersion, history[1].Todo.Version)
+				assert.Equal(t, tt.wantListId, history[1].Todo.ListId)
+				assert.Contains(t, history[1].Changes, model.FieldChange{Field: "list_id", Before: []byte(`1`)})
+			}
+		})
+	}
+}
+
+// cancellingStore cancels the context of a call once a todo is stored, like
+// a client going away right after its write.
+type cancellingStore struct {
+	store.Store
+	cancel context.CancelFunc
+}
+
+func (cs cancellingStore) Add(ctx context.Context, owner int, todo *model.Todo) error {
+	defer cs.cancel()
+	return cs.Store.Add(ctx, owner, todo)
+}
+
+func TestTodoApp_Context(t *testing.T) {
+	ctx := context.Background()
+
+	backend := store.NewInMemoryStore()
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	err := todoapp.New(backend).SaveTodo(cancelled, store.Anonymous, &model.Todo{Title: "Plant tulips"})
+	assert.True(t, errors.Is(err, context.Canceled), "got error %v, want %v", err, context.Canceled)
+
+	todos, err := backend.GetAll(ctx, store.Anonymous)
+	assert.NoError(t, err)
+	assert.Empty(t, todos)
+
+	// The revision of a stored todo is recorded even if the caller is gone.
+	cancelled, cancel = context.WithCancel(ctx)
+	ta := todoapp.New(cancellingStore{Store: backend, cancel: cancel})
+
+	todo := &model.Todo{Title: "Plant daffodils"}
+	assert.NoError(t, ta.SaveTodo(cancelled, store.Anonymous, todo))
+
+	history, err := ta.GetHistory(ctx, store.Anonymous, todo.Id)
+	if assert.NoError(t, err) && assert.Len(t, history, 1) {
+		assert.Equal(t, model.ActionCreated, history[0].Action)
+	}
+}
+
+func TestTodoApp_BatchTodos(t *testing.T) {
+	ctx := context.Background()
+
+	ta := todoapp.New(store.NewInMemoryStore())
+
+	blocker := &model.Todo{Title: "Get keys"}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, blocker))
+
+	blocked := &model.Todo{Title: "Open door", BlockedBy: []int{blocker.Id}}
+	assert.NoError(t, ta.SaveTodo(ctx, store.Anonymous, blocked))
+
+	// The blocker has to be completed first, within the batch as well.
+	_, err := ta.BatchTodos(ctx, store.Anonymous, []model.Operation{
+		{Op: model.OpUpdate, Id: blocked.Id, Todo: &model.Todo{Title: "Open door", Completed: true, BlockedBy: []int{blocker.Id}}},
+		{Op: model.OpUpdate, Id: blocker.Id, Todo: &model.Todo{Title: "Get keys", Completed: true}},
+	})
+	assert.True(t, errors.Is(err, todoapp.ErrBlocked), "got error %v, want %v", err, todoapp.ErrBlocked)
+
+	var operr *model.OperationError
+	if assert.True(t, errors.As(err, &operr), "got error %v, want operation error", err) {
+		assert.Equal(t, 0, operr.Index)
+	}
+
+	_, err = ta.BatchTodos(ctx, store.Anonymous, []model.Operation{
+		{Op: model.OpDelete, Id: 42},
+	})
+	assert.Equal(t, &model.OperationError{Index: 0, Err: store.ErrTodoNotFound}, err)
+
+	results, err := ta.BatchTodos(ctx, store.Anonymous, []model.Operation{
+		{Op: model.OpUpdate, Id: blocker.Id, Todo: &model.Todo{Title: "Get keys", Completed: true}},
+		{Op: model.OpUpdate, Id: blocked.Id, Todo: &model.Todo{Title: "Open door", Completed: true, BlockedBy: []int{blocker.Id}}},
+		{Op: model.OpCreate, Todo: &model.Todo{Title: "Close door"}},
+	})
+	if assert.NoError(t, err) && assert.Len(t, results, 3) {
+		assert.True(t, results[0].Completed)
+		assert.True(t, results[1].Completed)
+		assert.Equal(t, 3, results[2].Id)
+	}
+
+	history, err := ta.GetHistory(ctx, store.Anonymous, blocked.Id)
+	if assert.NoError(t, err) && assert.Len(t, history, 2) {
+		assert.Equal(t, model.ActionUpdated, history[1].Action)
+		assert.Equal(t, []model.FieldChange{{Field: "completed", After: []byte(`true`)}}, history[1].Changes)
+	}
+
+	history, err = ta.GetHistory(ctx, store.Anonymous, 3)
+	if assert.NoError(t, err) && assert.Len(t, history, 1) {
+		assert.Equal(t, model.ActionCreated, history[0].Action)
+	}
+}
+
+func TestTodoApp_ImportExport(t *testing.T) {
+	ctx := context.Background()
+
+	ta := todoapp.New(store.NewInMemoryStore())
+
+	list := &model.List{Name: "Garden"}
+	assert.NoError(t, ta.SaveList(ctx, store.Anonymous, list))
+
+	input := "id,title,completed,list,parent_id,blocked_by\n" +
+		"10,Plant tulips,false,Garden,,\n" +
+		"11,Buy bulbs,true,Garden,10,\n" +
+		"12,Water,false,Balcony,,11\n" +
+		"13,,false,,,\n" +
+		"14,Mow lawn,false,,99,\n"
+
+	read := func() transfer.Reader {
+		r, err := transfer.NewReader(transfer.FormatCSV, strings.NewReader(input))
+		assert.NoError(t, err)
+		return r
+	}
+
+	report, err := ta.ImportTodos(ctx, store.Anonymous, read(), true)
+	if assert.NoError(t, err) {
+		assert.True(t, report.DryRun)
+		assert.Equal(t, 3, report.Imported)
+		assert.Equal(t, 2, report.Failed)
+		assert.Equal(t, []string{"Balcony"}, report.Lists)
+		if assert.Len(t, report.Errors, 2) {
+			assert.Equal(t, 5, report.Errors[0].Row)
+			assert.True(t, errors.Is(report.Errors[0], model.ErrEmptyTitle), "got error %v, want %v", report.Errors[0], model.ErrEmptyTitle)
+			assert.Equal(t, "row 6: parent_id 99 does not refer to a todo imported before", report.Errors[1].Error())
+		}
+	}
+
+	todos, err := ta.GetTodos(ctx, store.Anonymous)
+	assert.NoError(t, err)
+	assert.Empty(t, todos)
+
+	report, err = ta.ImportTodos(ctx, store.Anonymous, read(), false)
+	if assert.NoError(t, err) {
+		assert.False(t, report.DryRun)
+		assert.Equal(t, 3, report.Imported)
+		assert.Equal(t, 2, report.Failed)
+	}
+
+	lists, err := ta.GetLists(ctx, store.Anonymous)
+	if assert.NoError(t, err) && assert.Len(t, lists, 2) {
+		assert.Equal(t, "Balcony", lists[1].Name)
+	}
+
+	var buf bytes.Buffer
+	w, err := transfer.NewWriter(transfer.FormatTodoTxt, &buf)
+	assert.NoError(t, err)
+	assert.NoError(t, ta.ExportTodos(ctx, store.Anonymous, w))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Contains(t, lines[0], "Plant tulips +Garden id:1")
+		assert.Contains(t, lines[1], "Buy bulbs +Garden id:2 parent:1")
+		assert.Contains(t, lines[2], "Water +Balcony id:3 blocked:2")
+	}
+}
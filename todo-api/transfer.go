@@ -0,0 +1,213 @@
+package todoapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"todoapp/model"
+	"todoapp/store"
+	"todoapp/transfer"
+)
+
+// exportPage is the number of todos read from the store at a time while
+// exporting.
+const exportPage = 100
+
+// ExportTodos writes every todo of owner to w ordered by id and closes it.
+// Todos are read page by page, so w can stream them to the client.
+func (t *TodoApp) ExportTodos(ctx context.Context, owner int, w transfer.Writer) error {
+	lists, err := t.backend.GetLists(ctx, owner)
+	if err != nil {
+		return backendError("get lists", err)
+	}
+
+	names := make(map[int]string, len(lists))
+	for _, list := range lists {
+		names[list.Id] = list.Name
+	}
+
+	for offset := 0; ; offset += exportPage {
+		q := model.Query{Sort: []model.SortKey{{Field: model.SortFieldId}}, Limit: exportPage, Offset: offset}
+
+		todos, _, err := t.backend.Query(ctx, owner, q)
+		if err != nil {
+			return backendError("query todos", err)
+		}
+
+		for _, todo := range todos {
+			if err := w.Write(&transfer.Item{Todo: *todo, List: names[todo.ListId]}); err != nil {
+				return fmt.Errorf("write todo %d: %w", todo.Id, err)
+			}
+		}
+
+		if len(todos) < exportPage {
+			break
+		}
+	}
+
+	return w.Close()
+}
+
+// ImportTodos adds the todos read from r as new todos of owner. Lists are
+// looked up by name and created when missing. Parents and blockers have to
+// come before the todos referring to them, their ids are those of the file
+// and are mapped onto the ids of the imported todos.
+//
+// An item that cannot be read or saved is reported and skipped, reading goes
+// on with the next one. The import stops with an error if the file turns out
+// to be malformed, the store fails or ctx is done, the todos imported so far
+// are kept.
+func (t *TodoApp) ImportTodos(ctx context.Context, owner int, r transfer.Reader, dryRun bool) (*transfer.Report, error) {
+	report := &transfer.Report{DryRun: dryRun, Lists: []string{}, Errors: []*transfer.RowError{}}
+
+	lists, err := t.backend.GetLists(ctx, owner)
+	if err != nil {
+		return nil, backendError("get lists", err)
+	}
+
+	imp := &importer{app: t, owner: owner, dryRun: dryRun, report: report, lists: make(map[string]int), ids: make(map[int]int)}
+	for _, list := range lists {
+		imp.lists[transfer.ProjectName(list.Name)] = list.Id
+	}
+	for _, list := range lists {
+		imp.lists[list.Name] = list.Id
+	}
+
+	for {
+		item, err := r.Read()
+		if err == io.EOF {
+			return report, nil
+		}
+
+		var rowErr *transfer.RowError
+		if errors.As(err, &rowErr) {
+			imp.fail(rowErr)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		err = imp.add(ctx, item)
+		if errors.Is(err, store.ErrUnavailable) || ctx.Err() != nil {
+			return report, err
+		}
+		if err != nil {
+			imp.fail(&transfer.RowError{Row: item.Row, Err: err})
+			continue
+		}
+
+		report.Imported++
+	}
+}
+
+// importer keeps track of the lists and todos of one import.
+type importer struct {
+	app    *TodoApp
+	owner  int
+	dryRun bool
+	report *transfer.Report
+
+	// lists maps list names, also as todo.txt projects, to their ids. Lists a
+	// dry run would create map to zero.
+	lists map[string]int
+	// ids maps the ids of the file onto those of the imported todos. A dry run
+	// keeps the ids of the file.
+	ids map[int]int
+}
+
+func (imp *importer) add(ctx context.Context, item *transfer.Item) error {
+	todo := model.Todo{
+		Title:        item.Title,
+		Completed:    item.Completed,
+		Description:  item.Description,
+		Due:          item.Due,
+		Priority:     item.Priority,
+		Tags:         item.Tags,
+		Recurrence:   item.Recurrence,
+		AutoComplete: item.AutoComplete,
+	}
+
+	var err error
+	if todo.ParentId, err = imp.resolve("parent_id", item.ParentId); err != nil {
+		return err
+	}
+
+	for _, blocker := range item.BlockedBy {
+		id, err := imp.resolve("blocked_by", blocker)
+		if err != nil {
+			return err
+		}
+
+		todo.BlockedBy = append(todo.BlockedBy, id)
+	}
+
+	// Validating first keeps lists from being created for invalid todos.
+	if err := todo.IsValid(); err != nil {
+		return err
+	}
+
+	if todo.ListId, err = imp.list(ctx, item.List); err != nil {
+		return err
+	}
+
+	if !imp.dryRun {
+		if err := imp.app.SaveTodo(ctx, imp.owner, &todo); err != nil {
+			return err
+		}
+	} else {
+		todo.Id = item.Id
+	}
+
+	if item.Id != 0 {
+		imp.ids[item.Id] = todo.Id
+	}
+
+	return nil
+}
+
+// resolve maps the id of a todo in the file onto the id it was imported as.
+func (imp *importer) resolve(field string, id int) (int, error) {
+	if id == 0 {
+		return 0, nil
+	}
+
+	imported, ok := imp.ids[id]
+	if !ok {
+		return 0, fmt.Errorf("%s %d does not refer to a todo imported before", field, id)
+	}
+
+	return imported, nil
+}
+
+// list returns the id of the list with the given name, creating the list if
+// there is none yet.
+func (imp *importer) list(ctx context.Context, name string) (int, error) {
+	if name == "" {
+		return 0, nil
+	}
+
+	if id, ok := imp.lists[name]; ok {
+		return id, nil
+	}
+
+	list := &model.List{Name: name}
+	if imp.dryRun {
+		if err := list.IsValid(); err != nil {
+			return 0, err
+		}
+	} else if err := imp.app.SaveList(ctx, imp.owner, list); err != nil {
+		return 0, err
+	}
+
+	imp.lists[name] = list.Id
+	imp.report.Lists = append(imp.report.Lists, name)
+
+	return list.Id, nil
+}
+
+func (imp *importer) fail(err *transfer.RowError) {
+	imp.report.Failed++
+	imp.report.Errors = append(imp.report.Errors, err)
+}
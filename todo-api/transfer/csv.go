@@ -0,0 +1,252 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns are the columns of an export in order. Tags and blockers are
+// separated by spaces, neither of them may contain whitespace.
+var csvColumns = []string{
+	"id", "title", "completed", "description", "due", "priority", "tags", "recurrence",
+	"list", "parent_id", "auto_complete", "blocked_by", "created_at", "completed_at",
+}
+
+// csvWriter writes a header followed by one record per item.
+type csvWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (cw *csvWriter) Write(item *Item) error {
+	if err := cw.header(); err != nil {
+		return err
+	}
+
+	blockedBy := make([]string, len(item.BlockedBy))
+	for idx, id := range item.BlockedBy {
+		blockedBy[idx] = strconv.Itoa(id)
+	}
+
+	return cw.w.Write([]string{
+		strconv.Itoa(item.Id),
+		item.Title,
+		strconv.FormatBool(item.Completed),
+		item.Description,
+		formatTime(item.Due),
+		formatInt(item.Priority),
+		strings.Join(item.Tags, " "),
+		item.Recurrence,
+		item.List,
+		formatInt(item.ParentId),
+		strconv.FormatBool(item.AutoComplete),
+		strings.Join(blockedBy, " "),
+		formatTime(&item.CreatedAt),
+		formatTime(item.CompletedAt),
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	if err := cw.header(); err != nil {
+		return err
+	}
+
+	cw.w.Flush()
+
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) header() error {
+	if cw.started {
+		return nil
+	}
+
+	cw.started = true
+
+	return cw.w.Write(csvColumns)
+}
+
+// csvReader reads records by the names in the header, so that columns may
+// come in any order and all but title may be left out. Timestamps are
+// maintained by the store, their columns are ignored.
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) *csvReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	return &csvReader{r: cr}
+}
+
+func (cr *csvReader) Read() (*Item, error) {
+	if cr.columns == nil {
+		if err := cr.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	record, err := cr.r.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, &RowError{Row: parseErr.Line, Err: parseErr.Err}
+	}
+	if err != nil {
+		return nil, malformed(err)
+	}
+
+	row, _ := cr.r.FieldPos(0)
+
+	item, err := cr.parse(record)
+	if err != nil {
+		return nil, &RowError{Row: row, Err: err}
+	}
+
+	item.Row = row
+
+	return item, nil
+}
+
+func (cr *csvReader) readHeader() error {
+	header, err := cr.r.Read()
+	if err == io.EOF {
+		return malformed(errors.New("missing CSV header"))
+	}
+	if err != nil {
+		return malformed(err)
+	}
+
+	known := make(map[string]bool, len(csvColumns))
+	for _, name := range csvColumns {
+		known[name] = true
+	}
+
+	cr.columns = make(map[string]int, len(header))
+	for idx, name := range header {
+		name = strings.TrimSpace(name)
+		if !known[name] {
+			return malformed(fmt.Errorf("unknown CSV column '%s'", name))
+		}
+
+		cr.columns[name] = idx
+	}
+
+	if _, ok := cr.columns["title"]; !ok {
+		return malformed(errors.New("missing CSV column 'title'"))
+	}
+
+	return nil
+}
+
+func (cr *csvReader) parse(record []string) (*Item, error) {
+	field := func(name string) string {
+		idx, ok := cr.columns[name]
+		if !ok || idx >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[idx])
+	}
+
+	item := &Item{List: field("list")}
+	item.Title = field("title")
+	item.Description = field("description")
+	item.Recurrence = field("recurrence")
+	if tags := strings.Fields(field("tags")); len(tags) > 0 {
+		item.Tags = tags
+	}
+
+	var err error
+	if item.Id, err = parseInt("id", field("id")); err != nil {
+		return nil, err
+	}
+	if item.Priority, err = parseInt("priority", field("priority")); err != nil {
+		return nil, err
+	}
+	if item.ParentId, err = parseInt("parent_id", field("parent_id")); err != nil {
+		return nil, err
+	}
+	if item.Completed, err = parseBool("completed", field("completed")); err != nil {
+		return nil, err
+	}
+	if item.AutoComplete, err = parseBool("auto_complete", field("auto_complete")); err != nil {
+		return nil, err
+	}
+
+	for _, value := range strings.Fields(field("blocked_by")) {
+		id, err := parseInt("blocked_by", value)
+		if err != nil {
+			return nil, err
+		}
+
+		item.BlockedBy = append(item.BlockedBy, id)
+	}
+
+	if due := field("due"); due != "" {
+		parsed, err := time.Parse(time.RFC3339, due)
+		if err != nil {
+			return nil, fmt.Errorf("due must be an RFC 3339 time, not '%s'", due)
+		}
+
+		item.Due = &parsed
+	}
+
+	return item, nil
+}
+
+func formatInt(value int) string {
+	if value == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(value)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseInt(name, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number, not '%s'", name, value)
+	}
+
+	return parsed, nil
+}
+
+func parseBool(name, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, not '%s'", name, value)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,99 @@
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// jsonWriter writes items as the elements of one JSON array.
+type jsonWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func newJSONWriter(w io.Writer) *jsonWriter {
+	return &jsonWriter{w: w}
+}
+
+func (jw *jsonWriter) Write(item *Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("encode todo %d: %w", item.Id, err)
+	}
+
+	sep := ","
+	if !jw.started {
+		sep = "["
+		jw.started = true
+	}
+
+	_, err = io.WriteString(jw.w, sep+string(data))
+
+	return err
+}
+
+func (jw *jsonWriter) Close() error {
+	end := "]"
+	if !jw.started {
+		end = "[]"
+	}
+
+	_, err := io.WriteString(jw.w, end)
+
+	return err
+}
+
+// jsonReader decodes the elements of a JSON array one at a time.
+type jsonReader struct {
+	dec     *json.Decoder
+	row     int
+	started bool
+}
+
+func newJSONReader(r io.Reader) *jsonReader {
+	return &jsonReader{dec: json.NewDecoder(r)}
+}
+
+func (jr *jsonReader) Read() (*Item, error) {
+	if !jr.started {
+		tok, err := jr.dec.Token()
+		if err != nil {
+			return nil, malformed(err)
+		}
+
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return nil, malformed(errors.New("todos must be a JSON array"))
+		}
+
+		jr.started = true
+	}
+
+	if !jr.dec.More() {
+		if _, err := jr.dec.Token(); err != nil {
+			return nil, malformed(err)
+		}
+
+		return nil, io.EOF
+	}
+
+	jr.row++
+
+	// A value of the wrong type is consumed entirely, so only this element
+	// is lost. Anything else leaves the decoder at an unknown position.
+	var item Item
+	err := jr.dec.Decode(&item)
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return nil, &RowError{Row: jr.row, Err: err}
+	}
+	if err != nil {
+		return nil, malformed(fmt.Errorf("row %d: %w", jr.row, err))
+	}
+
+	item.Row = jr.row
+
+	return &item, nil
+}
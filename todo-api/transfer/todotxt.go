@@ -0,0 +1,269 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"todoapp/model"
+)
+
+// todoTxtDate is the date format of todo.txt, times are written in full when
+// a due date is not at midnight.
+const todoTxtDate = "2006-01-02"
+
+// maxTodoTxtLine bounds the length of a line of a todo.txt file.
+const maxTodoTxtLine = 1 << 20
+
+// todoTxtWriter writes one todo.txt line per item. Priorities A to I stand
+// for model.PriorityHighest to model.PriorityLowest, the list is the project,
+// tags are contexts and the remaining fields are key:value extensions.
+// Descriptions have no place in todo.txt and are left out.
+type todoTxtWriter struct {
+	w io.Writer
+}
+
+func newTodoTxtWriter(w io.Writer) *todoTxtWriter {
+	return &todoTxtWriter{w: w}
+}
+
+func (tw *todoTxtWriter) Write(item *Item) error {
+	var parts []string
+
+	if item.Completed {
+		parts = append(parts, "x")
+		if item.CompletedAt != nil {
+			parts = append(parts, item.CompletedAt.UTC().Format(todoTxtDate))
+		}
+	} else if item.Priority != model.PriorityNone {
+		parts = append(parts, "("+priorityLetter(item.Priority)+")")
+	}
+
+	// A creation date of a completed todo is only recognised after its
+	// completion date.
+	if !item.CreatedAt.IsZero() && (!item.Completed || item.CompletedAt != nil) {
+		parts = append(parts, item.CreatedAt.UTC().Format(todoTxtDate))
+	}
+
+	parts = append(parts, strings.Fields(item.Title)...)
+
+	if item.List != "" {
+		parts = append(parts, "+"+ProjectName(item.List))
+	}
+
+	for _, tag := range item.Tags {
+		parts = append(parts, "@"+tag)
+	}
+
+	if item.Due != nil {
+		parts = append(parts, "due:"+formatDue(*item.Due))
+	}
+
+	if item.Completed && item.Priority != model.PriorityNone {
+		parts = append(parts, "pri:"+priorityLetter(item.Priority))
+	}
+
+	if item.Recurrence != "" {
+		parts = append(parts, "rrule:"+item.Recurrence)
+	}
+
+	if item.Id != 0 {
+		parts = append(parts, "id:"+strconv.Itoa(item.Id))
+	}
+
+	if item.ParentId != 0 {
+		parts = append(parts, "parent:"+strconv.Itoa(item.ParentId))
+	}
+
+	if len(item.BlockedBy) > 0 {
+		blockers := make([]string, len(item.BlockedBy))
+		for idx, id := range item.BlockedBy {
+			blockers[idx] = strconv.Itoa(id)
+		}
+
+		parts = append(parts, "blocked:"+strings.Join(blockers, ","))
+	}
+
+	_, err := io.WriteString(tw.w, strings.Join(parts, " ")+"\n")
+
+	return err
+}
+
+func (tw *todoTxtWriter) Close() error {
+	return nil
+}
+
+// todoTxtReader reads one item per non-blank line. The first project becomes
+// the list and further ones tags, key:value pairs other than those written
+// by todoTxtWriter stay part of the title.
+type todoTxtReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newTodoTxtReader(r io.Reader) *todoTxtReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxTodoTxtLine)
+
+	return &todoTxtReader{scanner: scanner}
+}
+
+func (tr *todoTxtReader) Read() (*Item, error) {
+	for tr.scanner.Scan() {
+		tr.line++
+
+		fields := strings.Fields(tr.scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		item, err := parseTodoTxt(fields)
+		if err != nil {
+			return nil, &RowError{Row: tr.line, Err: err}
+		}
+
+		item.Row = tr.line
+
+		return item, nil
+	}
+
+	if err := tr.scanner.Err(); err != nil {
+		return nil, malformed(fmt.Errorf("line %d: %w", tr.line+1, err))
+	}
+
+	return nil, io.EOF
+}
+
+func parseTodoTxt(fields []string) (*Item, error) {
+	item := &Item{}
+
+	if fields[0] == "x" {
+		item.Completed = true
+		fields = fields[1:]
+	} else if priority, ok := parsePriority(fields[0]); ok {
+		item.Priority = priority
+		fields = fields[1:]
+	}
+
+	// Completion and creation dates are maintained by the store.
+	for dates := 0; dates < 2 && len(fields) > 0 && isDate(fields[0]); dates++ {
+		fields = fields[1:]
+	}
+
+	var words []string
+	for _, field := range fields {
+		switch {
+		case len(field) > 1 && field[0] == '+':
+			if item.List == "" {
+				item.List = field[1:]
+			} else {
+				item.Tags = append(item.Tags, field[1:])
+			}
+		case len(field) > 1 && field[0] == '@':
+			item.Tags = append(item.Tags, field[1:])
+		default:
+			handled, err := item.parseExtension(field)
+			if err != nil {
+				return nil, err
+			}
+
+			if !handled {
+				words = append(words, field)
+			}
+		}
+	}
+
+	item.Title = strings.Join(words, " ")
+
+	return item, nil
+}
+
+// parseExtension applies one of the key:value pairs written by todoTxtWriter
+// to item and reports whether field was one of them.
+func (item *Item) parseExtension(field string) (bool, error) {
+	key, value, ok := strings.Cut(field, ":")
+	if !ok || value == "" {
+		return false, nil
+	}
+
+	var err error
+	switch key {
+	case "due":
+		var due time.Time
+		due, err = parseDue(value)
+		item.Due = &due
+	case "pri":
+		priority, ok := parsePriority("(" + value + ")")
+		if !ok {
+			return true, fmt.Errorf("pri must be a letter from A to Z, not '%s'", value)
+		}
+		item.Priority = priority
+	case "rrule":
+		item.Recurrence = value
+	case "id":
+		item.Id, err = parseInt("id", value)
+	case "parent":
+		item.ParentId, err = parseInt("parent", value)
+	case "blocked":
+		for _, blocker := range strings.Split(value, ",") {
+			var id int
+			if id, err = parseInt("blocked", blocker); err != nil {
+				break
+			}
+			item.BlockedBy = append(item.BlockedBy, id)
+		}
+	default:
+		return false, nil
+	}
+
+	return true, err
+}
+
+// parsePriority parses "(A)" to "(Z)". Letters after I all map onto
+// model.PriorityLowest.
+func parsePriority(field string) (int, bool) {
+	if len(field) != 3 || field[0] != '(' || field[2] != ')' || field[1] < 'A' || field[1] > 'Z' {
+		return 0, false
+	}
+
+	priority := int(field[1]-'A') + model.PriorityHighest
+	if priority > model.PriorityLowest {
+		priority = model.PriorityLowest
+	}
+
+	return priority, true
+}
+
+func priorityLetter(priority int) string {
+	return string(rune('A' + priority - model.PriorityHighest))
+}
+
+func isDate(field string) bool {
+	_, err := time.Parse(todoTxtDate, field)
+
+	return err == nil
+}
+
+func formatDue(due time.Time) string {
+	due = due.UTC()
+	if due.Equal(due.Truncate(24 * time.Hour)) {
+		return due.Format(todoTxtDate)
+	}
+
+	return due.Format(time.RFC3339)
+}
+
+func parseDue(value string) (time.Time, error) {
+	if due, err := time.Parse(todoTxtDate, value); err == nil {
+		return due, nil
+	}
+
+	due, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("due must be a date like 2006-01-02, not '%s'", value)
+	}
+
+	return due, nil
+}
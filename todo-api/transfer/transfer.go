@@ -0,0 +1,161 @@
+// Package transfer reads and writes todos in formats shared with other tools,
+// JSON, CSV and todo.txt, one todo at a time so that large files never have
+// to be held in memory.
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"todoapp/model"
+)
+
+// Format is the encoding of an export or import.
+type Format string
+
+const (
+	FormatJSON    Format = "json"
+	FormatCSV     Format = "csv"
+	FormatTodoTxt Format = "todotxt"
+)
+
+var (
+	ErrUnknownFormat = fmt.Errorf("format must be one of %s, %s or %s", FormatJSON, FormatCSV, FormatTodoTxt)
+	// ErrMalformed is matched by errors that stop reading a file altogether,
+	// e.g. broken JSON syntax or a missing CSV header.
+	ErrMalformed = errors.New("malformed import")
+)
+
+// ParseFormat parses one of the Format* values, the empty string is
+// FormatJSON.
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatCSV, FormatTodoTxt:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w, not '%s'", ErrUnknownFormat, value)
+	}
+}
+
+// ContentType returns the media type of files in format f.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatTodoTxt:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Extension returns the usual file name extension of format f.
+func (f Format) Extension() string {
+	if f == FormatTodoTxt {
+		return "txt"
+	}
+
+	return string(f)
+}
+
+// Item is a todo as exchanged with other tools. The list is named rather
+// than referred to by id, since list ids only mean something within one
+// instance. Id, ParentId and BlockedBy are kept so that an import can link
+// the todos of one file with each other.
+type Item struct {
+	model.Todo
+	List string `json:"list,omitempty"`
+
+	// Row is the position of the item in the file it was read from, e.g. the
+	// line of a CSV record.
+	Row int `json:"-"`
+}
+
+// Writer writes items in one of the formats, Close finishes the file.
+type Writer interface {
+	Write(item *Item) error
+	Close() error
+}
+
+// Reader reads items in one of the formats. Read returns io.EOF after the
+// last item and a *RowError for an item that cannot be parsed, reading may
+// continue with the next item after it. Any other error is final.
+type Reader interface {
+	Read() (*Item, error)
+}
+
+// NewWriter returns a Writer encoding items in format to w.
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatJSON:
+		return newJSONWriter(w), nil
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatTodoTxt:
+		return newTodoTxtWriter(w), nil
+	default:
+		return nil, fmt.Errorf("%w, not '%s'", ErrUnknownFormat, format)
+	}
+}
+
+// NewReader returns a Reader decoding items in format from r.
+func NewReader(format Format, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatJSON:
+		return newJSONReader(r), nil
+	case FormatCSV:
+		return newCSVReader(r), nil
+	case FormatTodoTxt:
+		return newTodoTxtReader(r), nil
+	default:
+		return nil, fmt.Errorf("%w, not '%s'", ErrUnknownFormat, format)
+	}
+}
+
+// RowError reports a single item that could not be read or imported.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (re *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", re.Row, re.Err)
+}
+
+func (re *RowError) Unwrap() error {
+	return re.Err
+}
+
+func (re *RowError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Row   int    `json:"row"`
+		Error string `json:"error"`
+	}{re.Row, re.Err.Error()})
+}
+
+// Report sums up an import. A dry run validates every item and resolves its
+// list and references like a real import, but saves neither todos nor lists.
+// Checks left to the store, like blockers having to be completed, are only
+// made by a real import.
+type Report struct {
+	DryRun   bool        `json:"dry_run"`
+	Imported int         `json:"imported"`
+	Failed   int         `json:"failed"`
+	Lists    []string    `json:"created_lists"`
+	Errors   []*RowError `json:"errors"`
+}
+
+// ProjectName returns the name of a list as a todo.txt project, which must not
+// contain whitespace.
+func ProjectName(list string) string {
+	return strings.Join(strings.Fields(list), "_")
+}
+
+// malformed wraps an error that stops reading a file.
+func malformed(err error) error {
+	return fmt.Errorf("%w: %w", ErrMalformed, err)
+}
@@ -0,0 +1,222 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"todoapp/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testItems() []*Item {
+	due := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	evening := time.Date(2026, time.October, 20, 18, 30, 0, 0, time.UTC)
+	created := time.Date(2026, time.October, 1, 9, 0, 0, 0, time.UTC)
+	completed := time.Date(2026, time.October, 2, 9, 0, 0, 0, time.UTC)
+
+	return []*Item{
+		{Todo: model.Todo{Id: 1, Title: "Move house", Priority: 1, Tags: []string{"home"}, Due: &due, CreatedAt: created}, List: "Big plans"},
+		{Todo: model.Todo{Id: 2, Title: "Pack boxes", Completed: true, Priority: 3, ParentId: 1, CreatedAt: created, CompletedAt: &completed}},
+		{Todo: model.Todo{Id: 3, Title: "Hand over keys", BlockedBy: []int{2}, Due: &evening, Recurrence: "FREQ=WEEKLY", CreatedAt: created}},
+	}
+}
+
+// comparable drops what a format cannot carry, so that items read back can be
+// compared with the written ones.
+func comparable(items []*Item, format Format) []*Item {
+	var result []*Item
+	for idx, item := range items {
+		copied := *item
+		copied.CreatedAt = time.Time{}
+		copied.CompletedAt = nil
+		copied.Row = 0
+		if format == FormatTodoTxt && copied.List != "" {
+			copied.List = ProjectName(copied.List)
+		}
+		if format == FormatJSON {
+			copied.CreatedAt = items[idx].CreatedAt
+			copied.CompletedAt = items[idx].CompletedAt
+		}
+
+		result = append(result, &copied)
+	}
+
+	return result
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatJSON, FormatCSV, FormatTodoTxt} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w, err := NewWriter(format, &buf)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			for _, item := range testItems() {
+				assert.NoError(t, w.Write(item))
+			}
+			assert.NoError(t, w.Close())
+
+			r, err := NewReader(format, &buf)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var read []*Item
+			for {
+				item, err := r.Read()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				read = append(read, item)
+			}
+
+			assert.Equal(t, comparable(testItems(), format), comparable(read, format))
+		})
+	}
+}
+
+func TestWriter_Empty(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatJSON, "[]"},
+		{FormatCSV, strings.Join(csvColumns, ",") + "\n"},
+		{FormatTodoTxt, ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w, err := NewWriter(tt.format, &buf)
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestTodoTxtWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := newTodoTxtWriter(&buf)
+	for _, item := range testItems() {
+		assert.NoError(t, w.Write(item))
+	}
+
+	assert.Equal(t, "(A) 2026-10-01 Move house +Big_plans @home due:2026-10-19 id:1\n"+
+		"x 2026-10-02 2026-10-01 Pack boxes pri:C id:2 parent:1\n"+
+		"2026-10-01 Hand over keys due:2026-10-20T18:30:00Z rrule:FREQ=WEEKLY id:3 blocked:2\n", buf.String())
+}
+
+func TestTodoTxtReader(t *testing.T) {
+	input := "(B) 2026-10-01 Call mom +Family @phone see https://example.com due:2026-10-19\n" +
+		"\n" +
+		"x 2026-10-02 2026-10-01 Water plants +Garden +Weekly @home\n" +
+		"(Q) Someday maybe\n" +
+		"Pay rent due:tomorrow\n"
+
+	r := newTodoTxtReader(strings.NewReader(input))
+
+	due := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	want := []*Item{
+		{Todo: model.Todo{Title: "Call mom see https://example.com", Priority: 2, Tags: []string{"phone"}, Due: &due}, List: "Family", Row: 1},
+		{Todo: model.Todo{Title: "Water plants", Completed: true, Tags: []string{"Weekly", "home"}}, List: "Garden", Row: 3},
+		{Todo: model.Todo{Title: "Someday maybe", Priority: model.PriorityLowest}, Row: 4},
+	}
+
+	for _, item := range want {
+		read, err := r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, item, read)
+	}
+
+	_, err := r.Read()
+	var rowErr *RowError
+	if assert.True(t, errors.As(err, &rowErr), "got error %v, want row error", err) {
+		assert.Equal(t, 5, rowErr.Row)
+	}
+
+	_, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReader_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		input    string
+		wantRows []int
+		wantErr  error
+	}{
+		{name: "json not an array", format: FormatJSON, input: `{"title":"Say hello"}`, wantErr: ErrMalformed},
+		{name: "json syntax", format: FormatJSON, input: `[{"title":"Say hello"},{"title":`, wantErr: ErrMalformed},
+		{
+			name:     "json wrong types",
+			format:   FormatJSON,
+			input:    `[{"title":5},{"title":"Say hello"},{"priority":"high"}]`,
+			wantRows: []int{1, 3},
+		},
+		{name: "csv without header", format: FormatCSV, input: "", wantErr: ErrMalformed},
+		{name: "csv unknown column", format: FormatCSV, input: "title,colour\n", wantErr: ErrMalformed},
+		{name: "csv without title", format: FormatCSV, input: "id,completed\n", wantErr: ErrMalformed},
+		{
+			name:     "csv bad values",
+			format:   FormatCSV,
+			input:    "title,priority,completed,due\nSay hello,high,,\nWave,,yes,\nNod,,,\"tomorrow\"\nSmile,2,true,2026-10-19T18:00:00Z\n",
+			wantRows: []int{2, 3, 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(tt.format, strings.NewReader(tt.input))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var rows []int
+			for {
+				_, err := r.Read()
+				if err == nil {
+					continue
+				}
+				if err == io.EOF {
+					break
+				}
+
+				var rowErr *RowError
+				if errors.As(err, &rowErr) {
+					rows = append(rows, rowErr.Row)
+					continue
+				}
+
+				assert.True(t, errors.Is(err, tt.wantErr), "got error %v, want %v", err, tt.wantErr)
+				break
+			}
+
+			assert.Equal(t, tt.wantRows, rows)
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for value, want := range map[string]Format{"": FormatJSON, "json": FormatJSON, "csv": FormatCSV, "todotxt": FormatTodoTxt} {
+		format, err := ParseFormat(value)
+		assert.NoError(t, err)
+		assert.Equal(t, want, format)
+	}
+
+	_, err := ParseFormat("xml")
+	assert.True(t, errors.Is(err, ErrUnknownFormat), "got error %v, want %v", err, ErrUnknownFormat)
+}
@@ -0,0 +1,30 @@
+package todoapp
+
+import (
+	"context"
+	"todoapp/model"
+)
+
+// GetTrash returns the deleted todos that have not been purged yet, the most
+// recently deleted first.
+func (t *TodoApp) GetTrash(ctx context.Context, owner int) ([]*model.Todo, error) {
+	todos, err := t.backend.GetTrash(ctx, owner)
+	if err != nil {
+		return nil, backendError("get trash", err)
+	}
+
+	return todos, nil
+}
+
+// RestoreTodo takes the todo with the given id out of the trash. Its parent
+// and blockers have to be restored first.
+func (t *TodoApp) RestoreTodo(ctx context.Context, owner int, id int) (*model.Todo, error) {
+	todo, err := t.backend.Restore(ctx, owner, id)
+	if err != nil {
+		return nil, backendError("restore todo", err)
+	}
+
+	t.record(ctx, owner, &model.Revision{Action: model.ActionRestored}, nil, todo)
+
+	return todo, nil
+}
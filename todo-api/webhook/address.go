@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is the error of a delivery to a receiver that resolves
+// to an address of the server's own network, see WithPrivateAddresses.
+var ErrForbiddenAddress = errors.New("webhook receivers must not resolve to loopback, private or link-local addresses")
+
+// forbidden reports whether addr belongs to the host or network of the
+// server, where users must not be able to send requests to, e.g. the metadata
+// service of a cloud provider at 169.254.169.254.
+func forbidden(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsUnspecified()
+}
+
+// checkAddress is the Control function of the dialer of the receivers. It
+// sees every address a host name resolves to right before connecting to it,
+// so a name cannot be changed to resolve elsewhere after being checked.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if forbidden(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+
+	return nil
+}
+
+// newClient returns the client sending deliveries, which refuses to connect
+// to forbidden addresses unless allowPrivate is set. Proxies are not used
+// then, since they would connect on behalf of the client unchecked.
+func newClient(allowPrivate bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if !allowPrivate {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: checkAddress}
+
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+	}
+
+	return &http.Client{Timeout: DefaultTimeout, Transport: transport}
+}
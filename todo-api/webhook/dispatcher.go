@@ -0,0 +1,555 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"todoapp/model"
+	"todoapp/store"
+)
+
+const (
+	EventHeader     = "X-Todoapp-Event"
+	DeliveryHeader  = "X-Todoapp-Delivery"
+	SignatureHeader = "X-Todoapp-Signature"
+
+	// SignaturePrefix precedes the hex encoded HMAC-SHA256 of the body in the
+	// signature header.
+	SignaturePrefix = "sha256="
+
+	DefaultBackoff     = 10 * time.Second
+	DefaultMaxBackoff  = time.Hour
+	DefaultMaxAttempts = 8
+	DefaultTimeout     = 10 * time.Second
+
+	// batchSize is the number of due deliveries sent before checking for new
+	// ones, pollInterval how often the queue is checked without a wake-up.
+	batchSize    = 100
+	pollInterval = time.Second
+
+	// maxSenders is the number of webhooks sent to at the same time.
+	maxSenders = 8
+
+	// queueSize is the number of published changes waiting to be stored as
+	// deliveries, changes published while it is full are dropped.
+	queueSize = 1024
+
+	// responseLimit is the number of bytes of a response drained so that its
+	// connection can be reused.
+	responseLimit = 512
+)
+
+// Payload is the body sent to a webhook.
+type Payload struct {
+	Event      string      `json:"event"`
+	Todo       *model.Todo `json:"todo"`
+	OccurredAt time.Time   `json:"occurred_at"`
+}
+
+// Dispatcher queues the changes of a store for the webhooks of their owner and
+// sends them in the background, retrying failed deliveries with exponential
+// backoff. It also manages the webhooks on behalf of the server.
+//
+// Deliveries are sent at least once: a delivery interrupted by a restart is
+// sent again, receivers can tell by the delivery header. Published changes
+// wait in memory until Run stores their deliveries though, those not stored
+// yet when the process dies are lost.
+type Dispatcher struct {
+	store        Store
+	client       *http.Client
+	allowPrivate bool
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	maxAttempts  int
+	poll         time.Duration
+	now          func() time.Time
+	changes      chan published
+	wake         chan struct{}
+
+	// flushing keeps the deliveries of the changes in the order they were
+	// published while Flush and Run store them.
+	flushing sync.Mutex
+}
+
+// published is a change waiting to be stored as deliveries.
+type published struct {
+	change store.Change
+	at     time.Time
+}
+
+// Option configures optional behaviour of a Dispatcher.
+type Option func(*Dispatcher)
+
+// WithClient sends deliveries with c instead of a client timing out after
+// DefaultTimeout and refusing forbidden addresses. Restricting the addresses
+// c connects to is left to the caller.
+func WithClient(c *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = c
+	}
+}
+
+// WithPrivateAddresses lets deliveries reach receivers on loopback, private
+// and link-local addresses, which are refused with ErrForbiddenAddress
+// otherwise so that users cannot make the server send requests into its own
+// network. Only meant for servers whose users are trusted.
+func WithPrivateAddresses() Option {
+	return func(d *Dispatcher) {
+		d.allowPrivate = true
+	}
+}
+
+// WithBackoff waits base before the first retry of a failed delivery, doubling
+// the wait for every further retry up to limit.
+func WithBackoff(base, limit time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.backoff = base
+		d.maxBackoff = limit
+	}
+}
+
+// WithMaxAttempts gives up on a delivery after n failed attempts.
+func WithMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = n
+	}
+}
+
+func NewDispatcher(s Store, options ...Option) *Dispatcher {
+	d := &Dispatcher{
+		store:       s,
+		backoff:     DefaultBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+		maxAttempts: DefaultMaxAttempts,
+		poll:        pollInterval,
+		now:         time.Now,
+		changes:     make(chan published, queueSize),
+		wake:        make(chan struct{}, 1),
+	}
+
+	for _, option := range options {
+		option(d)
+	}
+
+	if d.client == nil {
+		d.client = newClient(d.allowPrivate)
+	}
+
+	return d
+}
+
+// Publish queues change for the webhooks of its owner, it is a
+// store.ChangeHook. It only hands the change over to Run, which stores its
+// deliveries and sends them.
+func (d *Dispatcher) Publish(change store.Change) {
+	if len(changeEvents(change)) == 0 {
+		return
+	}
+
+	select {
+	case d.changes <- published{change: change, at: d.now().UTC()}:
+	default:
+		log.Printf("webhook: queue full, dropping %s of todo %d", change.Type, change.Todo.Id)
+	}
+}
+
+// queue stores the deliveries of the published changes until ctx is done.
+func (d *Dispatcher) queue(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			d.flush()
+			return
+		case next := <-d.changes:
+			d.flush(next)
+		}
+	}
+}
+
+// Flush stores the deliveries of the changes published so far right away
+// rather than leaving it to Run.
+func (d *Dispatcher) Flush() {
+	for len(d.changes) > 0 {
+		d.flush()
+	}
+}
+
+// flush stores the deliveries of changes and of the changes waiting behind
+// them, up to batchSize, with one write to the store, so that a burst of
+// changes is not written one by one.
+func (d *Dispatcher) flush(changes ...published) {
+	d.flushing.Lock()
+	defer d.flushing.Unlock()
+
+fill:
+	for len(changes) < batchSize {
+		select {
+		case next := <-d.changes:
+			changes = append(changes, next)
+		default:
+			break fill
+		}
+	}
+
+	var deliveries []*model.Delivery
+	for _, next := range changes {
+		deliveries = append(deliveries, d.deliveries(next)...)
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := d.store.AddDeliveries(deliveries); err != nil {
+		log.Printf("webhook: queueing %d deliveries: %v", len(deliveries), err)
+		return
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliveries returns the deliveries announcing a published change to the
+// webhooks of its owner.
+func (d *Dispatcher) deliveries(next published) []*model.Delivery {
+	change := next.change
+
+	hooks, err := d.store.GetHooks(change.Owner)
+	if err != nil {
+		log.Printf("webhook: fetching webhooks of owner %d: %v", change.Owner, err)
+		return nil
+	}
+
+	var deliveries []*model.Delivery
+	for _, event := range changeEvents(change) {
+		payload, err := json.Marshal(Payload{Event: event, Todo: change.Todo, OccurredAt: next.at})
+		if err != nil {
+			log.Printf("webhook: encoding %s of todo %d: %v", event, change.Todo.Id, err)
+			continue
+		}
+
+		for _, hook := range hooks {
+			if hook.Wants(event) {
+				deliveries = append(deliveries, &model.Delivery{WebhookId: hook.Id, Event: event, Payload: payload})
+			}
+		}
+	}
+
+	return deliveries
+}
+
+// changeEvents returns the webhook events announcing change.
+func changeEvents(change store.Change) []string {
+	switch change.Type {
+	case store.ChangeCreated:
+		return []string{model.EventTodoCreated}
+	case store.ChangeUpdated:
+		events := []string{model.EventTodoUpdated}
+		if change.Todo.Completed && change.Previous != nil && !change.Previous.Completed {
+			events = append(events, model.EventTodoCompleted)
+		}
+
+		return events
+	case store.ChangeDeleted:
+		return []string{model.EventTodoDeleted}
+	default:
+		return nil
+	}
+}
+
+// Run stores the deliveries of published changes and sends due deliveries
+// until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	queued := make(chan struct{})
+	go func() {
+		d.queue(ctx)
+		close(queued)
+	}()
+	defer func() { <-queued }()
+
+	for {
+		d.sendDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-time.After(d.poll):
+		}
+	}
+}
+
+// sendDue sends the deliveries that are due. The deliveries of a webhook are
+// sent one at a time in order, up to maxSenders webhooks at the same time, so
+// that a slow receiver only holds up its own deliveries.
+func (d *Dispatcher) sendDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := d.store.DueDeliveries(d.now(), batchSize)
+		if err != nil {
+			log.Printf("webhook: fetching due deliveries: %v", err)
+			return
+		}
+
+		var (
+			hooks  []int
+			byHook = make(map[int][]*model.Delivery)
+		)
+		for _, delivery := range due {
+			if _, ok := byHook[delivery.WebhookId]; !ok {
+				hooks = append(hooks, delivery.WebhookId)
+			}
+			byHook[delivery.WebhookId] = append(byHook[delivery.WebhookId], delivery)
+		}
+
+		var wg sync.WaitGroup
+		senders := make(chan struct{}, maxSenders)
+		for _, hookId := range hooks {
+			senders <- struct{}{}
+			wg.Add(1)
+
+			go func(deliveries []*model.Delivery) {
+				defer wg.Done()
+				defer func() { <-senders }()
+
+				d.sendHook(ctx, deliveries)
+			}(byHook[hookId])
+		}
+		wg.Wait()
+
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
+
+// sendHook sends the due deliveries of one webhook in order. Once the
+// receiver cannot be reached, the remaining ones are postponed along with the
+// failed one instead of waiting for it to time out again.
+func (d *Dispatcher) sendHook(ctx context.Context, deliveries []*model.Delivery) {
+	for idx, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if !d.deliver(ctx, delivery) {
+			d.postpone(deliveries[idx+1:], delivery.NextAttempt)
+			return
+		}
+	}
+}
+
+// postpone moves the next attempt of deliveries to until, or the first retry
+// of a delivery if until is nil, without counting it as an attempt.
+func (d *Dispatcher) postpone(deliveries []*model.Delivery, until *time.Time) {
+	if until == nil {
+		next := d.now().UTC().Add(d.retryAfter(1))
+		until = &next
+	}
+
+	for _, delivery := range deliveries {
+		delivery.NextAttempt = until
+		if err := d.store.UpdateDelivery(delivery); err != nil {
+			log.Printf("webhook: postponing delivery %d: %v", delivery.Id, err)
+		}
+	}
+}
+
+// deliver makes one attempt to send delivery and records its outcome. It
+// reports whether the receiver could be reached, whatever it answered.
+func (d *Dispatcher) deliver(ctx context.Context, delivery *model.Delivery) bool {
+	hook, err := d.store.LookupHook(delivery.WebhookId)
+	if err != nil {
+		// The webhook was deleted along with the delivery.
+		return true
+	}
+
+	status, err := d.send(ctx, hook, delivery)
+	if ctx.Err() != nil {
+		// Shutting down is not the receiver's fault, the attempt is made
+		// again after a restart.
+		return true
+	}
+
+	now := d.now().UTC()
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	delivery.LastError = ""
+	delivery.NextAttempt = nil
+
+	switch {
+	case err != nil:
+		delivery.LastError = err.Error()
+	case status < 200 || status >= 300:
+		delivery.LastError = fmt.Sprintf("receiver responded with status %d", status)
+	default:
+		delivery.Status = model.DeliveryDelivered
+		delivery.DeliveredAt = &now
+	}
+
+	if delivery.Status == model.DeliveryPending {
+		if delivery.Attempts >= d.maxAttempts {
+			delivery.Status = model.DeliveryFailed
+		} else {
+			next := now.Add(d.retryAfter(delivery.Attempts))
+			delivery.NextAttempt = &next
+		}
+	}
+
+	if err := d.store.UpdateDelivery(delivery); err != nil {
+		log.Printf("webhook: recording delivery %d: %v", delivery.Id, err)
+	}
+
+	return err == nil
+}
+
+// send posts the payload of delivery to hook and returns the status of the
+// response.
+func (d *Dispatcher) send(ctx context.Context, hook *model.Webhook, delivery *model.Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todoapp-webhook")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.Id))
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Only the status matters, large responses are not worth waiting for.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, responseLimit))
+
+	return resp.StatusCode, nil
+}
+
+// retryAfter returns the wait before the next attempt after the given number
+// of failed attempts.
+func (d *Dispatcher) retryAfter(attempts int) time.Duration {
+	wait := d.backoff
+	for i := 1; i < attempts && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > d.maxBackoff {
+		wait = d.maxBackoff
+	}
+
+	return wait
+}
+
+// Sign returns the signature header value of payload for a webhook with the
+// given secret.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return SignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SaveWebhook adds hook for owner, generating a secret if it has none. The
+// secret is only ever returned here.
+func (d *Dispatcher) SaveWebhook(owner int, hook *model.Webhook) error {
+	if hook == nil {
+		return model.ErrNilWebhook
+	}
+
+	if hook.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return err
+		}
+
+		hook.Secret = secret
+	}
+
+	return d.store.AddHook(owner, hook)
+}
+
+// UpdateWebhook replaces the webhook id of owner, keeping its secret unless
+// hook brings a new one.
+func (d *Dispatcher) UpdateWebhook(owner int, id int, hook *model.Webhook) (*model.Webhook, error) {
+	if hook == nil {
+		return nil, model.ErrNilWebhook
+	}
+
+	if hook.Secret == "" {
+		current, err := d.store.GetHook(owner, id)
+		if err != nil {
+			return nil, err
+		}
+
+		hook.Secret = current.Secret
+	}
+
+	updated, err := d.store.UpdateHook(owner, id, hook)
+	if err != nil {
+		return nil, err
+	}
+
+	return redact(updated), nil
+}
+
+func (d *Dispatcher) GetWebhook(owner int, id int) (*model.Webhook, error) {
+	hook, err := d.store.GetHook(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return redact(hook), nil
+}
+
+func (d *Dispatcher) GetWebhooks(owner int) ([]*model.Webhook, error) {
+	hooks, err := d.store.GetHooks(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range hooks {
+		redact(hook)
+	}
+
+	return hooks, nil
+}
+
+func (d *Dispatcher) DeleteWebhook(owner int, id int) error {
+	return d.store.DeleteHook(owner, id)
+}
+
+// GetDeliveries returns the delivery log of the webhook id of owner, newest
+// first.
+func (d *Dispatcher) GetDeliveries(owner int, id int) ([]*model.Delivery, error) {
+	return d.store.GetDeliveries(owner, id)
+}
+
+func redact(hook *model.Webhook) *model.Webhook {
+	hook.Secret = ""
+	return hook
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate secret: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,469 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+	"todoapp/model"
+	"todoapp/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver records the requests sent to a webhook and answers them with the
+// next of its statuses, the last one repeating.
+type receiver struct {
+	sync.Mutex
+
+	statuses []int
+	requests []received
+	got      chan struct{}
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(statuses ...int) *receiver {
+	return &receiver{statuses: statuses, got: make(chan struct{}, 100)}
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.Lock()
+	rc.requests = append(rc.requests, received{header: r.Header, body: body})
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+	rc.Unlock()
+
+	w.WriteHeader(status)
+	rc.got <- struct{}{}
+}
+
+// wait waits for n more requests.
+func (rc *receiver) wait(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-rc.got:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("receiver got %d of %d requests", i, n)
+		}
+	}
+}
+
+func (rc *receiver) received() []received {
+	rc.Lock()
+	defer rc.Unlock()
+
+	return append([]received(nil), rc.requests...)
+}
+
+// waitStatus polls the deliveries of hook until the newest one has status.
+func waitStatus(t *testing.T, d *Dispatcher, hook *model.Webhook, status model.DeliveryStatus) *model.Delivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, err := d.GetDeliveries(0, hook.Id)
+		if err == nil && len(deliveries) > 0 && deliveries[0].Status == status {
+			return deliveries[0]
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("delivery did not become %s", status)
+	return nil
+}
+
+func run(t *testing.T, d *Dispatcher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	rc := newReceiver(http.StatusNoContent)
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	d := NewDispatcher(NewMemoryStore(), WithPrivateAddresses())
+
+	hook := &model.Webhook{URL: ts.URL, Secret: "s3cret"}
+	assert.NoError(t, d.SaveWebhook(0, hook))
+
+	todo := &model.Todo{Id: 1, Title: "Water plants", Version: 1}
+	d.Publish(store.Change{Type: store.ChangeCreated, Owner: 0, Todo: todo})
+
+	// Changes of other owners are not sent to the webhook.
+	d.Publish(store.Change{Type: store.ChangeCreated, Owner: 1, Todo: todo})
+
+	run(t, d)
+	rc.wait(t, 1)
+
+	got := rc.received()[0]
+	assert.Equal(t, model.EventTodoCreated, got.header.Get(EventHeader))
+	assert.Equal(t, "1", got.header.Get(DeliveryHeader))
+	assert.Equal(t, Sign("s3cret", got.body), got.header.Get(SignatureHeader))
+
+	var payload Payload
+	if assert.NoError(t, json.Unmarshal(got.body, &payload)) {
+		assert.Equal(t, model.EventTodoCreated, payload.Event)
+		assert.Equal(t, todo, payload.Todo)
+	}
+
+	delivery := waitStatus(t, d, hook, model.DeliveryDelivered)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.ResponseStatus)
+	assert.NotNil(t, delivery.DeliveredAt)
+}
+
+func TestDispatcher_Events(t *testing.T) {
+	open := &model.Todo{Id: 1, Title: "Water plants"}
+	done := &model.Todo{Id: 1, Title: "Water plants", Completed: true}
+
+	tests := []struct {
+		name   string
+		events []string
+		change store.Change
+		want   []string
+	}{
+		{
+			name:   "created",
+			change: store.Change{Type: store.ChangeCreated, Todo: open},
+			want:   []string{model.EventTodoCreated},
+		},
+		{
+			name:   "completed",
+			change: store.Change{Type: store.ChangeUpdated, Todo: done, Previous: open},
+			want:   []string{model.EventTodoUpdated, model.EventTodoCompleted},
+		},
+		{
+			name:   "still completed",
+			change: store.Change{Type: store.ChangeUpdated, Todo: done, Previous: done},
+			want:   []string{model.EventTodoUpdated},
+		},
+		{
+			name:   "only completed",
+			events: []string{model.EventTodoCompleted},
+			change: store.Change{Type: store.ChangeUpdated, Todo: done, Previous: open},
+			want:   []string{model.EventTodoCompleted},
+		},
+		{
+			name:   "filtered",
+			events: []string{model.EventTodoCompleted},
+			change: store.Change{Type: store.ChangeDeleted, Todo: done},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDispatcher(NewMemoryStore())
+
+			hook := &model.Webhook{URL: "https://example.com/hooks", Events: tt.events}
+			assert.NoError(t, d.SaveWebhook(0, hook))
+
+			d.Publish(tt.change)
+			d.Flush()
+
+			deliveries, err := d.GetDeliveries(0, hook.Id)
+			assert.NoError(t, err)
+
+			var got []string
+			for i := len(deliveries) - 1; i >= 0; i-- {
+				got = append(got, deliveries[i].Event)
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	rc := newReceiver(http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK)
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	d := NewDispatcher(NewMemoryStore(), WithPrivateAddresses(), WithBackoff(10*time.Millisecond, time.Second))
+	d.poll = 5 * time.Millisecond
+
+	hook := &model.Webhook{URL: ts.URL}
+	assert.NoError(t, d.SaveWebhook(0, hook))
+
+	d.Publish(store.Change{Type: store.ChangeDeleted, Todo: &model.Todo{Id: 1, Title: "Water plants"}})
+
+	run(t, d)
+	rc.wait(t, 3)
+
+	delivery := waitStatus(t, d, hook, model.DeliveryDelivered)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Empty(t, delivery.LastError)
+
+	// Every attempt is the same delivery with the same signature.
+	requests := rc.received()
+	for _, r := range requests[1:] {
+		assert.Equal(t, requests[0].header.Get(DeliveryHeader), r.header.Get(DeliveryHeader))
+		assert.Equal(t, requests[0].header.Get(SignatureHeader), r.header.Get(SignatureHeader))
+	}
+}
+
+func TestDispatcher_GiveUp(t *testing.T) {
+	rc := newReceiver(http.StatusGone)
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	d := NewDispatcher(NewMemoryStore(), WithPrivateAddresses(), WithBackoff(time.Millisecond, time.Millisecond), WithMaxAttempts(2))
+	d.poll = 5 * time.Millisecond
+
+	hook := &model.Webhook{URL: ts.URL}
+	assert.NoError(t, d.SaveWebhook(0, hook))
+
+	d.Publish(store.Change{Type: store.ChangeCreated, Todo: &model.Todo{Id: 1, Title: "Water plants"}})
+
+	run(t, d)
+
+	delivery := waitStatus(t, d, hook, model.DeliveryFailed)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Equal(t, http.StatusGone, delivery.ResponseStatus)
+	assert.Equal(t, "receiver responded with status 410", delivery.LastError)
+	assert.Nil(t, delivery.NextAttempt)
+	assert.Len(t, rc.received(), 2)
+}
+
+func TestDispatcher_PublishDoesNotWaitForReceiver(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	d := NewDispatcher(NewMemoryStore(), WithPrivateAddresses())
+
+	hook := &model.Webhook{URL: ts.URL}
+	assert.NoError(t, d.SaveWebhook(0, hook))
+
+	run(t, d)
+
+	published := make(chan struct{})
+	go func() {
+		for i := 1; i <= 10; i++ {
+			d.Publish(store.Change{Type: store.ChangeCreated, Todo: &model.Todo{Id: i, Title: "Water plants"}})
+		}
+		close(published)
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publishing waited for the receiver")
+	}
+}
+
+// slowStore is a Store whose writes of deliveries wait for release, like a
+// file store busy syncing its state.
+type slowStore struct {
+	Store
+	release chan struct{}
+	writes  chan int
+}
+
+func (ss *slowStore) AddDeliveries(deliveries []*model.Delivery) error {
+	<-ss.release
+	ss.writes <- len(deliveries)
+
+	return ss.Store.AddDeliveries(deliveries)
+}
+
+func TestDispatcher_PublishDoesNotWaitForStore(t *testing.T) {
+	ss := &slowStore{Store: NewMemoryStore(), release: make(chan struct{}), writes: make(chan int, 10)}
+	d := NewDispatcher(ss)
+
+	hook := &model.Webhook{URL: "https://example.com/hooks", Events: []string{model.EventTodoCompleted}}
+	assert.NoError(t, d.SaveWebhook(0, hook))
+
+	published := make(chan struct{})
+	go func() {
+		for i := 1; i <= 10; i++ {
+			done := &model.Todo{Id: i, Title: "Water plants", Completed: true}
+			d.Publish(store.Change{Type: store.ChangeUpdated, Todo: done, Previous: &model.Todo{Id: i}})
+		}
+		close(published)
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publishing waited for the store")
+	}
+
+	// The deliveries of all changes waiting are stored at once.
+	close(ss.release)
+	d.Flush()
+	assert.Equal(t, 10, <-ss.writes)
+
+	deliveries, err := d.GetDeliveries(0, hook.Id)
+	if assert.NoError(t, err) && assert.Len(t, deliveries, 10) {
+		var payload Payload
+		if assert.NoError(t, json.Unmarshal(deliveries[0].Payload, &payload)) {
+			assert.Equal(t, 10, payload.Todo.Id)
+		}
+	}
+}
+
+func TestDispatcher_ForbiddenAddress(t *testing.T) {
+	rc := newReceiver(http.StatusOK)
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	d := NewDispatcher(NewMemoryStore(), WithMaxAttempts(1))
+
+	hook := &model.Webhook{URL: ts.URL}
+	assert.NoError(t, d.SaveWebhook(0, hook))
+
+	d.Publish(store.Change{Type: store.ChangeCreated, Todo: &model.Todo{Id: 1, Title: "Water plants"}})
+
+	run(t, d)
+
+	delivery := waitStatus(t, d, hook, model.DeliveryFailed)
+	assert.Contains(t, delivery.LastError, ErrForbiddenAddress.Error())
+	assert.Empty(t, rc.received())
+}
+
+func TestForbidden(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"0.0.0.0", true},
+		{"::ffff:127.0.0.1", true},
+		{"93.184.216.34", false},
+		{"2606:4700::1111", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.want, forbidden(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+func TestDispatcher_SlowReceiver(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	rc := newReceiver(http.StatusOK)
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	d := NewDispatcher(NewMemoryStore(), WithPrivateAddresses())
+
+	assert.NoError(t, d.SaveWebhook(0, &model.Webhook{URL: slow.URL}))
+	assert.NoError(t, d.SaveWebhook(1, &model.Webhook{URL: ts.URL}))
+
+	for id := 1; id <= 3; id++ {
+		todo := &model.Todo{Id: id, Title: "Water plants"}
+		d.Publish(store.Change{Type: store.ChangeCreated, Owner: 0, Todo: todo})
+		d.Publish(store.Change{Type: store.ChangeCreated, Owner: 1, Todo: todo})
+	}
+
+	// The receiver of owner 1 gets its deliveries while the one of owner 0
+	// still hangs on its first.
+	run(t, d)
+	rc.wait(t, 3)
+}
+
+func TestDispatcher_UnreachableReceiver(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	now := time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC)
+
+	d := NewDispatcher(NewMemoryStore(), WithPrivateAddresses(), WithBackoff(time.Minute, time.Hour))
+	d.now = func() time.Time { return now }
+
+	hook := &model.Webhook{URL: ts.URL}
+	assert.NoError(t, d.SaveWebhook(0, hook))
+
+	for id := 1; id <= 3; id++ {
+		d.Publish(store.Change{Type: store.ChangeCreated, Todo: &model.Todo{Id: id, Title: "Water plants"}})
+	}
+
+	d.Flush()
+	d.sendDue(context.Background())
+
+	// Only the first delivery is attempted, the others wait for its retry.
+	deliveries, err := d.GetDeliveries(0, hook.Id)
+	if assert.NoError(t, err) && assert.Len(t, deliveries, 3) {
+		retry := now.Add(time.Minute)
+		for idx, want := range []int{0, 0, 1} {
+			assert.Equal(t, want, deliveries[idx].Attempts)
+			if assert.NotNil(t, deliveries[idx].NextAttempt) {
+				assert.True(t, retry.Equal(*deliveries[idx].NextAttempt), "delivery %d next attempt %v", deliveries[idx].Id, deliveries[idx].NextAttempt)
+			}
+		}
+	}
+}
+
+func TestDispatcher_RetryAfter(t *testing.T) {
+	d := NewDispatcher(NewMemoryStore(), WithBackoff(time.Second, 10*time.Second))
+
+	var got []time.Duration
+	for attempts := 1; attempts <= 6; attempts++ {
+		got = append(got, d.retryAfter(attempts))
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	assert.Equal(t, want, got)
+}
+
+func TestDispatcher_Secrets(t *testing.T) {
+	d := NewDispatcher(NewMemoryStore())
+
+	hook := &model.Webhook{URL: "https://example.com/hooks"}
+	assert.NoError(t, d.SaveWebhook(0, hook))
+	assert.Len(t, hook.Secret, 64)
+
+	got, err := d.GetWebhook(0, hook.Id)
+	if assert.NoError(t, err) {
+		assert.Empty(t, got.Secret)
+	}
+
+	updated, err := d.UpdateWebhook(0, hook.Id, &model.Webhook{URL: "https://example.com/v2"})
+	if assert.NoError(t, err) {
+		assert.Empty(t, updated.Secret)
+	}
+
+	// Updating without a secret keeps the generated one.
+	stored, err := d.store.GetHook(0, hook.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, hook.Secret, stored.Secret)
+	}
+}
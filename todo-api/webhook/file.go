@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"todoapp/model"
+	"todoapp/store"
+)
+
+// FileStore is a Store that serves reads from memory and writes its whole
+// state to a file after every change, so pending deliveries survive a
+// restart. The file is replaced atomically and only readable by its owner, as
+// it holds the secrets of the webhooks.
+//
+// Rewriting the whole state is fine as long as the delivery log is bounded
+// and receivers keep up, it is not meant for thousands of webhooks.
+type FileStore struct {
+	path string
+	mem  *MemoryStore
+	// saved is the state last written to the file, it is restored when
+	// writing a change fails.
+	saved snapshot
+
+	sync.Mutex
+}
+
+type snapshot struct {
+	HookCounter int              `json:"hook_counter"`
+	Hooks       []*model.Webhook `json:"hooks"`
+	// Owners maps the id of every webhook not owned by store.Anonymous to its
+	// owner.
+	Owners map[int]int `json:"owners,omitempty"`
+
+	DeliveryCounter int               `json:"delivery_counter"`
+	Deliveries      []*model.Delivery `json:"deliveries"`
+}
+
+// NewFileStore opens the store kept in the file at path, starting empty if
+// it does not exist yet.
+func NewFileStore(path string) (*FileStore, error) {
+	fs := &FileStore{path: path}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("read webhooks: %w", err)
+	default:
+		if err := json.Unmarshal(data, &fs.saved); err != nil {
+			return nil, fmt.Errorf("decode webhooks: %w", err)
+		}
+	}
+
+	fs.mem = fs.saved.restore()
+
+	return fs, nil
+}
+
+func (fs *FileStore) AddHook(owner int, hook *model.Webhook) error {
+	return fs.write(func() error {
+		return fs.mem.AddHook(owner, hook)
+	})
+}
+
+func (fs *FileStore) UpdateHook(owner int, id int, hook *model.Webhook) (*model.Webhook, error) {
+	var updated *model.Webhook
+	err := fs.write(func() error {
+		var err error
+		updated, err = fs.mem.UpdateHook(owner, id, hook)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (fs *FileStore) GetHook(owner int, id int) (*model.Webhook, error) {
+	return fs.read().GetHook(owner, id)
+}
+
+func (fs *FileStore) GetHooks(owner int) ([]*model.Webhook, error) {
+	return fs.read().GetHooks(owner)
+}
+
+func (fs *FileStore) DeleteHook(owner int, id int) error {
+	return fs.write(func() error {
+		return fs.mem.DeleteHook(owner, id)
+	})
+}
+
+func (fs *FileStore) LookupHook(id int) (*model.Webhook, error) {
+	return fs.read().LookupHook(id)
+}
+
+func (fs *FileStore) AddDeliveries(deliveries []*model.Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	return fs.write(func() error {
+		return fs.mem.AddDeliveries(deliveries)
+	})
+}
+
+func (fs *FileStore) UpdateDelivery(delivery *model.Delivery) error {
+	return fs.write(func() error {
+		return fs.mem.UpdateDelivery(delivery)
+	})
+}
+
+func (fs *FileStore) DueDeliveries(now time.Time, limit int) ([]*model.Delivery, error) {
+	return fs.read().DueDeliveries(now, limit)
+}
+
+func (fs *FileStore) GetDeliveries(owner int, hookId int) ([]*model.Delivery, error) {
+	return fs.read().GetDeliveries(owner, hookId)
+}
+
+// read returns the memory store to read from, it is replaced when a write
+// fails.
+func (fs *FileStore) read() *MemoryStore {
+	fs.Lock()
+	defer fs.Unlock()
+
+	return fs.mem
+}
+
+// write applies change to the memory store and persists the result. If
+// persisting fails the change is rolled back, so memory never holds what the
+// file does not.
+func (fs *FileStore) write(change func() error) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err := change(); err != nil {
+		return err
+	}
+
+	state := fs.mem.snapshot()
+
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = store.WriteFileAtomic(fs.path, data, 0600)
+	}
+
+	if err != nil {
+		fs.mem = fs.saved.restore()
+		return fmt.Errorf("write webhooks: %w", err)
+	}
+
+	fs.saved = state
+
+	return nil
+}
+
+// snapshot returns a copy of the state of the store.
+func (ms *MemoryStore) snapshot() snapshot {
+	ms.Lock()
+	defer ms.Unlock()
+
+	state := snapshot{
+		HookCounter:     ms.hookCounter,
+		Hooks:           make([]*model.Webhook, 0, len(ms.hooks)),
+		Owners:          make(map[int]int),
+		DeliveryCounter: ms.deliveryCounter,
+		Deliveries:      make([]*model.Delivery, 0, len(ms.deliveries)),
+	}
+
+	for id, hook := range ms.hooks {
+		state.Hooks = append(state.Hooks, copyHook(hook))
+
+		if owner := ms.owners[id]; owner != store.Anonymous {
+			state.Owners[id] = owner
+		}
+	}
+
+	for _, delivery := range ms.deliveries {
+		copied := *delivery
+		state.Deliveries = append(state.Deliveries, &copied)
+	}
+
+	sort.Slice(state.Hooks, func(i, j int) bool { return state.Hooks[i].Id < state.Hooks[j].Id })
+	sort.Slice(state.Deliveries, func(i, j int) bool { return state.Deliveries[i].Id < state.Deliveries[j].Id })
+
+	return state
+}
+
+// restore returns a memory store holding a copy of the state.
+func (s snapshot) restore() *MemoryStore {
+	ms := NewMemoryStore()
+	ms.hookCounter = s.HookCounter
+	ms.deliveryCounter = s.DeliveryCounter
+
+	for _, hook := range s.Hooks {
+		ms.hooks[hook.Id] = copyHook(hook)
+		ms.owners[hook.Id] = s.Owners[hook.Id]
+	}
+
+	for _, delivery := range s.Deliveries {
+		copied := *delivery
+		ms.deliveries[delivery.Id] = &copied
+	}
+
+	return ms
+}
@@ -0,0 +1,292 @@
+// Package webhook sends the changes of a store to the URLs subscribed by their
+// owners. Deliveries are queued in a Store and sent in the background by a
+// Dispatcher, so writing a todo never waits for a receiver.
+package webhook
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"todoapp/model"
+)
+
+// deliveryLog is the number of finished deliveries kept per webhook, older
+// ones are dropped so the log does not grow without bound.
+const deliveryLog = 100
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
+
+// Store keeps webhooks along with the queue and log of their deliveries.
+// Methods taking an owner only see the webhooks of that owner.
+type Store interface {
+	AddHook(owner int, hook *model.Webhook) error
+	UpdateHook(owner int, id int, hook *model.Webhook) (*model.Webhook, error)
+	GetHook(owner int, id int) (*model.Webhook, error)
+	GetHooks(owner int) ([]*model.Webhook, error)
+	// DeleteHook deletes a webhook along with its deliveries.
+	DeleteHook(owner int, id int) error
+
+	// LookupHook returns a webhook regardless of its owner, it is meant for
+	// sending deliveries.
+	LookupHook(id int) (*model.Webhook, error)
+
+	AddDeliveries(deliveries []*model.Delivery) error
+	UpdateDelivery(delivery *model.Delivery) error
+	// DueDeliveries returns up to limit pending deliveries whose next attempt
+	// is not after now, oldest first.
+	DueDeliveries(now time.Time, limit int) ([]*model.Delivery, error)
+	// GetDeliveries returns the deliveries of a webhook, newest first.
+	GetDeliveries(owner int, hookId int) ([]*model.Delivery, error)
+}
+
+// MemoryStore is a Store keeping everything in memory, its queue is lost on
+// restart.
+type MemoryStore struct {
+	hookCounter     int
+	hooks           map[int]*model.Webhook
+	owners          map[int]int
+	deliveryCounter int
+	deliveries      map[int]*model.Delivery
+	now             func() time.Time
+
+	sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		hooks:      make(map[int]*model.Webhook),
+		owners:     make(map[int]int),
+		deliveries: make(map[int]*model.Delivery),
+		now:        time.Now,
+	}
+}
+
+func (ms *MemoryStore) AddHook(owner int, hook *model.Webhook) error {
+	if err := hook.IsValid(); err != nil {
+		return err
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	ms.hookCounter++
+
+	now := ms.now().UTC()
+	hook.Id = ms.hookCounter
+	hook.CreatedAt = now
+	hook.UpdatedAt = now
+
+	ms.hooks[hook.Id] = copyHook(hook)
+	ms.owners[hook.Id] = owner
+
+	return nil
+}
+
+func (ms *MemoryStore) UpdateHook(owner int, id int, hook *model.Webhook) (*model.Webhook, error) {
+	if err := hook.IsValid(); err != nil {
+		return nil, err
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	current, err := ms.lookup(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := copyHook(hook)
+	updated.Id = id
+	updated.CreatedAt = current.CreatedAt
+	updated.UpdatedAt = ms.now().UTC()
+
+	ms.hooks[id] = updated
+
+	return copyHook(updated), nil
+}
+
+func (ms *MemoryStore) GetHook(owner int, id int) (*model.Webhook, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	hook, err := ms.lookup(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyHook(hook), nil
+}
+
+func (ms *MemoryStore) GetHooks(owner int) ([]*model.Webhook, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	hooks := make([]*model.Webhook, 0)
+	for id, hook := range ms.hooks {
+		if ms.owners[id] == owner {
+			hooks = append(hooks, copyHook(hook))
+		}
+	}
+
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].Id < hooks[j].Id })
+
+	return hooks, nil
+}
+
+func (ms *MemoryStore) DeleteHook(owner int, id int) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, err := ms.lookup(owner, id); err != nil {
+		return err
+	}
+
+	delete(ms.hooks, id)
+	delete(ms.owners, id)
+
+	for deliveryId, delivery := range ms.deliveries {
+		if delivery.WebhookId == id {
+			delete(ms.deliveries, deliveryId)
+		}
+	}
+
+	return nil
+}
+
+func (ms *MemoryStore) LookupHook(id int) (*model.Webhook, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	hook, ok := ms.hooks[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+
+	return copyHook(hook), nil
+}
+
+func (ms *MemoryStore) AddDeliveries(deliveries []*model.Delivery) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	now := ms.now().UTC()
+	for _, delivery := range deliveries {
+		ms.deliveryCounter++
+
+		delivery.Id = ms.deliveryCounter
+		delivery.Status = model.DeliveryPending
+		delivery.CreatedAt = now
+
+		copied := *delivery
+		ms.deliveries[delivery.Id] = &copied
+	}
+
+	return nil
+}
+
+func (ms *MemoryStore) UpdateDelivery(delivery *model.Delivery) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	// The webhook may have been deleted while the delivery was being sent.
+	if _, ok := ms.deliveries[delivery.Id]; !ok {
+		return nil
+	}
+
+	copied := *delivery
+	ms.deliveries[delivery.Id] = &copied
+
+	if delivery.Status != model.DeliveryPending {
+		ms.prune(delivery.WebhookId)
+	}
+
+	return nil
+}
+
+func (ms *MemoryStore) DueDeliveries(now time.Time, limit int) ([]*model.Delivery, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	var due []*model.Delivery
+	for _, delivery := range ms.deliveries {
+		if delivery.Status != model.DeliveryPending {
+			continue
+		}
+
+		if delivery.NextAttempt != nil && delivery.NextAttempt.After(now) {
+			continue
+		}
+
+		copied := *delivery
+		due = append(due, &copied)
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].Id < due[j].Id })
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	return due, nil
+}
+
+func (ms *MemoryStore) GetDeliveries(owner int, hookId int) ([]*model.Delivery, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, err := ms.lookup(owner, hookId); err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*model.Delivery, 0)
+	for _, delivery := range ms.deliveries {
+		if delivery.WebhookId == hookId {
+			copied := *delivery
+			deliveries = append(deliveries, &copied)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Id > deliveries[j].Id })
+
+	return deliveries, nil
+}
+
+// lookup returns the webhook id of owner, callers must hold the lock.
+func (ms *MemoryStore) lookup(owner int, id int) (*model.Webhook, error) {
+	hook, ok := ms.hooks[id]
+	if !ok || ms.owners[id] != owner {
+		return nil, ErrWebhookNotFound
+	}
+
+	return hook, nil
+}
+
+// prune drops the oldest finished deliveries of hookId beyond deliveryLog,
+// callers must hold the lock.
+func (ms *MemoryStore) prune(hookId int) {
+	var finished []int
+	for id, delivery := range ms.deliveries {
+		if delivery.WebhookId == hookId && delivery.Status != model.DeliveryPending {
+			finished = append(finished, id)
+		}
+	}
+
+	if len(finished) <= deliveryLog {
+		return
+	}
+
+	sort.Ints(finished)
+	for _, id := range finished[:len(finished)-deliveryLog] {
+		delete(ms.deliveries, id)
+	}
+}
+
+func copyHook(hook *model.Webhook) *model.Webhook {
+	copied := *hook
+	copied.Events = append([]string(nil), hook.Events...)
+
+	return &copied
+}
@@ -0,0 +1,198 @@
+package webhook
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"todoapp/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	backends := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store {
+			return NewMemoryStore()
+		},
+		"file": func(t *testing.T) Store {
+			fs, err := NewFileStore(filepath.Join(t.TempDir(), "webhooks.json"))
+			if err != nil {
+				t.Fatalf("opening store failed: %v", err)
+			}
+
+			return fs
+		},
+	}
+
+	for name, open := range backends {
+		t.Run(name+"/hooks", func(t *testing.T) { testStoreHooks(t, open(t)) })
+		t.Run(name+"/deliveries", func(t *testing.T) { testStoreDeliveries(t, open(t)) })
+	}
+}
+
+func testStoreHooks(t *testing.T, s Store) {
+	hook := &model.Webhook{URL: "https://example.com/hooks", Secret: "s3cret"}
+	assert.NoError(t, s.AddHook(1, hook))
+	assert.Equal(t, 1, hook.Id)
+	assert.False(t, hook.CreatedAt.IsZero())
+
+	err := s.AddHook(1, &model.Webhook{URL: "example.com"})
+	assert.True(t, errors.Is(err, model.ErrInvalidWebhook), "got error %v, want %v", err, model.ErrInvalidWebhook)
+
+	_, err = s.GetHook(2, hook.Id)
+	assert.True(t, errors.Is(err, ErrWebhookNotFound), "got error %v, want %v", err, ErrWebhookNotFound)
+
+	hooks, err := s.GetHooks(2)
+	assert.NoError(t, err)
+	assert.Empty(t, hooks)
+
+	updated, err := s.UpdateHook(1, hook.Id, &model.Webhook{URL: "https://example.com/v2", Events: []string{model.EventTodoCreated}, Secret: "s3cret"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://example.com/v2", updated.URL)
+		assert.Equal(t, hook.CreatedAt, updated.CreatedAt)
+	}
+
+	_, err = s.UpdateHook(2, hook.Id, &model.Webhook{URL: "https://example.com"})
+	assert.True(t, errors.Is(err, ErrWebhookNotFound), "got error %v, want %v", err, ErrWebhookNotFound)
+
+	looked, err := s.LookupHook(hook.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{model.EventTodoCreated}, looked.Events)
+		assert.Equal(t, "s3cret", looked.Secret)
+	}
+
+	assert.True(t, errors.Is(s.DeleteHook(2, hook.Id), ErrWebhookNotFound))
+	assert.NoError(t, s.DeleteHook(1, hook.Id))
+
+	_, err = s.LookupHook(hook.Id)
+	assert.True(t, errors.Is(err, ErrWebhookNotFound), "got error %v, want %v", err, ErrWebhookNotFound)
+}
+
+func testStoreDeliveries(t *testing.T, s Store) {
+	hook := &model.Webhook{URL: "https://example.com/hooks"}
+	assert.NoError(t, s.AddHook(1, hook))
+
+	deliveries := []*model.Delivery{
+		{WebhookId: hook.Id, Event: model.EventTodoCreated, Payload: []byte(`{}`)},
+		{WebhookId: hook.Id, Event: model.EventTodoUpdated, Payload: []byte(`{}`)},
+	}
+	assert.NoError(t, s.AddDeliveries(deliveries))
+	assert.Equal(t, 1, deliveries[0].Id)
+	assert.Equal(t, model.DeliveryPending, deliveries[1].Status)
+
+	now := time.Now()
+	due, err := s.DueDeliveries(now, 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 2)
+
+	later := now.Add(time.Minute)
+	retry := *deliveries[0]
+	retry.Attempts = 1
+	retry.NextAttempt = &later
+	assert.NoError(t, s.UpdateDelivery(&retry))
+
+	delivered := *deliveries[1]
+	delivered.Attempts = 1
+	delivered.Status = model.DeliveryDelivered
+	assert.NoError(t, s.UpdateDelivery(&delivered))
+
+	due, err = s.DueDeliveries(now, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, due)
+
+	due, err = s.DueDeliveries(later, 10)
+	if assert.NoError(t, err) && assert.Len(t, due, 1) {
+		assert.Equal(t, retry.Id, due[0].Id)
+	}
+
+	log, err := s.GetDeliveries(1, hook.Id)
+	if assert.NoError(t, err) && assert.Len(t, log, 2) {
+		assert.Equal(t, delivered.Id, log[0].Id)
+		assert.Equal(t, model.DeliveryDelivered, log[0].Status)
+	}
+
+	_, err = s.GetDeliveries(2, hook.Id)
+	assert.True(t, errors.Is(err, ErrWebhookNotFound), "got error %v, want %v", err, ErrWebhookNotFound)
+
+	assert.NoError(t, s.DeleteHook(1, hook.Id))
+
+	due, err = s.DueDeliveries(later, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, due)
+}
+
+func TestMemoryStore_PrunesDeliveryLog(t *testing.T) {
+	s := NewMemoryStore()
+
+	hook := &model.Webhook{URL: "https://example.com/hooks"}
+	assert.NoError(t, s.AddHook(0, hook))
+
+	for i := 0; i < deliveryLog+5; i++ {
+		delivery := &model.Delivery{WebhookId: hook.Id, Event: model.EventTodoCreated}
+		assert.NoError(t, s.AddDeliveries([]*model.Delivery{delivery}))
+
+		delivery.Status = model.DeliveryDelivered
+		assert.NoError(t, s.UpdateDelivery(delivery))
+	}
+
+	log, err := s.GetDeliveries(0, hook.Id)
+	if assert.NoError(t, err) && assert.Len(t, log, deliveryLog) {
+		assert.Equal(t, deliveryLog+5, log[0].Id)
+		assert.Equal(t, 6, log[len(log)-1].Id)
+	}
+}
+
+func TestFileStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+
+	fs, err := NewFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	hook := &model.Webhook{URL: "https://example.com/hooks", Secret: "s3cret"}
+	assert.NoError(t, fs.AddHook(3, hook))
+	assert.NoError(t, fs.AddDeliveries([]*model.Delivery{{WebhookId: hook.Id, Event: model.EventTodoCreated, Payload: []byte(`{"event":"todo.created"}`)}}))
+
+	reopened, err := NewFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	got, err := reopened.GetHook(3, hook.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "s3cret", got.Secret)
+	}
+
+	due, err := reopened.DueDeliveries(time.Now(), 10)
+	if assert.NoError(t, err) && assert.Len(t, due, 1) {
+		assert.JSONEq(t, `{"event":"todo.created"}`, string(due[0].Payload))
+	}
+
+	// Ids continue where the previous run stopped.
+	next := &model.Webhook{URL: "https://example.com/other"}
+	assert.NoError(t, reopened.AddHook(3, next))
+	assert.Equal(t, 2, next.Id)
+}
+
+func TestFileStore_RollsBackFailedWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	fs, err := NewFileStore(filepath.Join(dir, "webhooks.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, fs.AddHook(0, &model.Webhook{URL: "https://example.com/hooks"}))
+
+	// The directory of the file is gone, so writing the next change fails.
+	fs.path = filepath.Join(dir, "missing", "webhooks.json")
+
+	err = fs.AddHook(0, &model.Webhook{URL: "https://example.com/other"})
+	assert.Error(t, err)
+
+	hooks, err := fs.GetHooks(0)
+	assert.NoError(t, err)
+	assert.Len(t, hooks, 1)
+}